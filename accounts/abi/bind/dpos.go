@@ -0,0 +1,122 @@
+// Copyright 2017 The bgmchain Authors
+// This file is part of the bgmchain library.
+//
+// The bgmchain library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The bgmchain library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the bgmchain library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/5sWind/bgmchain"
+	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/core/types"
+	"github.com/5sWind/bgmchain/rlp"
+)
+
+// BecomeCandidate registers opts.From as a DPoS candidate, locking opts.Value as
+// its deposit. The commission is the percentage of the block reward the
+// candidate keeps for itself, nil to keep all of it. The metadata describing
+// the candidate is optional.
+func BecomeCandidate(opts *TransactOpts, transactor ContractTransactor, commission *uint64, meta *types.CandidateMeta) (*types.Transaction, error) {
+	var payload []byte
+	if commission != nil || meta != nil {
+		candidate := &types.CandidatePayload{Commission: types.MaxCommission}
+		if commission != nil {
+			candidate.Commission = *commission
+		}
+		if meta != nil {
+			candidate.Meta = []*types.CandidateMeta{meta}
+		}
+		var err error
+		if payload, err = rlp.EncodeToBytes(candidate); err != nil {
+			return nil, err
+		}
+	}
+	return transactDpos(opts, transactor, types.LoginCandidate, common.Address{}, payload)
+}
+
+// QuitCandidate removes opts.From from the DPoS candidates.
+func QuitCandidate(opts *TransactOpts, transactor ContractTransactor) (*types.Transaction, error) {
+	return transactDpos(opts, transactor, types.LogoutCandidate, common.Address{}, nil)
+}
+
+// BindSigner binds the DPoS candidate opts.From to the key sealing its blocks
+// from the next epoch on. Binding opts.From itself removes the binding.
+func BindSigner(opts *TransactOpts, transactor ContractTransactor, signer common.Address) (*types.Transaction, error) {
+	return transactDpos(opts, transactor, types.BindSigner, signer, nil)
+}
+
+// Delegate votes for a DPoS candidate, locking opts.Value as stake behind the vote.
+func Delegate(opts *TransactOpts, transactor ContractTransactor, candidate common.Address) (*types.Transaction, error) {
+	return transactDpos(opts, transactor, types.Delegate, candidate, nil)
+}
+
+// UnDelegate withdraws the vote of opts.From for a DPoS candidate.
+func UnDelegate(opts *TransactOpts, transactor ContractTransactor, candidate common.Address) (*types.Transaction, error) {
+	return transactDpos(opts, transactor, types.UnDelegate, candidate, nil)
+}
+
+// transactDpos assembles a DPoS transaction of the given type, signs it with
+// the authorization data of opts and injects it into the pending pool.
+func transactDpos(opts *TransactOpts, transactor ContractTransactor, txType types.TxType, to common.Address, payload []byte) (*types.Transaction, error) {
+	var err error
+
+	value := opts.Value
+	if value == nil {
+		value = new(big.Int)
+	}
+	var nonce uint64
+	if opts.Nonce == nil {
+		nonce, err = transactor.PendingNonceAt(ensureContext(opts.Context), opts.From)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve account nonce: %v", err)
+		}
+	} else {
+		nonce = opts.Nonce.Uint64()
+	}
+	gasPrice := opts.GasPrice
+	if gasPrice == nil {
+		gasPrice, err = transactor.SuggestGasPrice(ensureContext(opts.Context))
+		if err != nil {
+			return nil, fmt.Errorf("failed to suggest gas price: %v", err)
+		}
+	}
+	gasLimit := opts.GasLimit
+	if gasLimit == nil {
+		// DPoS transactions never transfer their value, so estimate them as plain calls
+		msg := bgmchain.CallMsg{From: opts.From, To: &to, Data: payload}
+		gasLimit, err = transactor.EstimateGas(ensureContext(opts.Context), msg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to estimate gas needed: %v", err)
+		}
+	}
+	rawTx := types.NewTransaction(txType, nonce, to, value, gasLimit, gasPrice, payload)
+	if err := rawTx.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.Signer == nil {
+		return nil, errors.New("no signer to authorize the transaction with")
+	}
+	signedTx, err := opts.Signer(types.HomesteadSigner{}, opts.From, rawTx)
+	if err != nil {
+		return nil, err
+	}
+	if err := transactor.SendTransaction(ensureContext(opts.Context), signedTx); err != nil {
+		return nil, err
+	}
+	return signedTx, nil
+}
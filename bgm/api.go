@@ -60,6 +60,11 @@ func (api *PublicBgmchainAPI) Validator() (common.Address, error) {
 	return api.e.Validator()
 }
 
+// Validators returns every validator the node mints blocks for.
+func (api *PublicBgmchainAPI) Validators() ([]common.Address, error) {
+	return api.e.Validators()
+}
+
 //
 func (api *PublicBgmchainAPI) Coinbase() (common.Address, error) {
 	return api.e.Coinbase()
@@ -164,6 +169,31 @@ func (api *PrivateMinerAPI) SetValidator(validator common.Address) bool {
 	return true
 }
 
+// AddValidator adds a further validator to mint blocks for, sealing them with
+// the given key, or with the validator itself if it's omitted.
+func (api *PrivateMinerAPI) AddValidator(validator common.Address, signer *common.Address) (bool, error) {
+	if signer == nil {
+		signer = &validator
+	}
+	if err := api.e.AddValidator(validator, *signer); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RemoveValidator stops minting blocks for a further validator.
+func (api *PrivateMinerAPI) RemoveValidator(validator common.Address) bool {
+	api.e.RemoveValidator(validator)
+	return true
+}
+
+// SetSigner sets the key sealing the blocks of the validator, taking effect
+// the next time mining starts.
+func (api *PrivateMinerAPI) SetSigner(signer common.Address) bool {
+	api.e.SetSigner(signer)
+	return true
+}
+
 //
 func (api *PrivateMinerAPI) SetCoinbase(coinbase common.Address) bool {
 	api.e.SetCoinbase(coinbase)
@@ -667,11 +697,11 @@ func (api *PrivateDebugAPI) getModifiedAccounts(startBlock, endBlock *types.Bloc
 		return nil, fmt.Errorf("start block height (%d) must be less than end block height (%d)", startBlock.Number().Uint64(), endBlock.Number().Uint64())
 	}
 
-	oldTrie, err := trie.NewSecure(startBlock.Root(), api.bgm.chainDb, 0)
+	oldTrie, err := trie.NewSecure(startBlock.Root(), api.bgm.blockchain.TrieDB(), 0)
 	if err != nil {
 		return nil, err
 	}
-	newTrie, err := trie.NewSecure(endBlock.Root(), api.bgm.chainDb, 0)
+	newTrie, err := trie.NewSecure(endBlock.Root(), api.bgm.blockchain.TrieDB(), 0)
 	if err != nil {
 		return nil, err
 	}
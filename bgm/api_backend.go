@@ -18,11 +18,13 @@ package bgm
 
 import (
 	"context"
+	"errors"
 	"math/big"
 
 	"github.com/5sWind/bgmchain/accounts"
 	"github.com/5sWind/bgmchain/common"
 	"github.com/5sWind/bgmchain/common/math"
+	"github.com/5sWind/bgmchain/consensus/dpos"
 	"github.com/5sWind/bgmchain/core"
 	"github.com/5sWind/bgmchain/core/bloombits"
 	"github.com/5sWind/bgmchain/core/state"
@@ -65,9 +67,21 @@ func (b *BgmApiBackend) HeaderByNumber(ctx context.Context, blockNr rpc.BlockNum
 	if blockNr == rpc.LatestBlockNumber {
 		return b.bgm.blockchain.CurrentBlock().Header(), nil
 	}
+	if blockNr == rpc.ConfirmedBlockNumber {
+		return b.confirmedHeader()
+	}
 	return b.bgm.blockchain.GetHeaderByNumber(uint64(blockNr)), nil
 }
 
+// confirmedHeader returns the header of the latest irreversible block.
+func (b *BgmApiBackend) confirmedHeader() (*types.Header, error) {
+	engine, ok := b.bgm.engine.(*dpos.Dpos)
+	if !ok {
+		return nil, errors.New("confirmed block unavailable without dpos")
+	}
+	return engine.ConfirmedHeader(b.bgm.blockchain)
+}
+
 func (b *BgmApiBackend) BlockByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Block, error) {
 //
 	if blockNr == rpc.PendingBlockNumber {
@@ -78,6 +92,13 @@ func (b *BgmApiBackend) BlockByNumber(ctx context.Context, blockNr rpc.BlockNumb
 	if blockNr == rpc.LatestBlockNumber {
 		return b.bgm.blockchain.CurrentBlock(), nil
 	}
+	if blockNr == rpc.ConfirmedBlockNumber {
+		header, err := b.confirmedHeader()
+		if err != nil {
+			return nil, err
+		}
+		return b.bgm.blockchain.GetBlock(header.Hash(), header.Number.Uint64()), nil
+	}
 	return b.bgm.blockchain.GetBlockByNumber(uint64(blockNr)), nil
 }
 
@@ -132,6 +153,16 @@ func (b *BgmApiBackend) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscri
 	return b.bgm.BlockChain().SubscribeLogsEvent(ch)
 }
 
+func (b *BgmApiBackend) SubscribeConfirmedHeadEvent(ch chan<- dpos.ConfirmedHeadEvent) event.Subscription {
+	if engine, ok := b.bgm.engine.(*dpos.Dpos); ok {
+		return engine.SubscribeConfirmedHeadEvent(ch)
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
 func (b *BgmApiBackend) SendTx(ctx context.Context, signedTx *types.Transaction) error {
 	return b.bgm.txPool.AddLocal(signedTx)
 }
@@ -18,10 +18,13 @@
 package bgm
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"math/big"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"sync"
 	"sync/atomic"
 
@@ -30,6 +33,7 @@ import (
 	"github.com/5sWind/bgmchain/common/hexutil"
 	"github.com/5sWind/bgmchain/consensus"
 	"github.com/5sWind/bgmchain/consensus/dpos"
+	"github.com/5sWind/bgmchain/consensus/dpos/remotesigner"
 	"github.com/5sWind/bgmchain/core"
 	"github.com/5sWind/bgmchain/core/bloombits"
 	"github.com/5sWind/bgmchain/core/types"
@@ -85,8 +89,11 @@ type Bgmchain struct {
 
 	miner     *miner.Miner
 	gasPrice  *big.Int
-	validator common.Address
-	coinbase  common.Address
+	validator  common.Address
+	signer     common.Address
+	validators map[common.Address]common.Address // Further validators, mapped to their signers
+	remote     *remotesigner.Signer             // Daemon signing the blocks, nil to use the local keystore
+	coinbase   common.Address
 
 	networkId     uint64
 	netRPCService *bgmapi.PublicNetAPI
@@ -108,7 +115,7 @@ func New(ctx *node.ServiceContext, config *Config) (*Bgmchain, error) {
 	if !config.SyncMode.IsValid() {
 		return nil, fmt.Errorf("invalid sync mode %d", config.SyncMode)
 	}
-	chainDb, err := CreateDB(ctx, config, "chaindata")
+	chainDb, err := createChainDB(ctx, config)
 	if err != nil {
 		return nil, err
 	}
@@ -119,23 +126,44 @@ func New(ctx *node.ServiceContext, config *Config) (*Bgmchain, error) {
 	}
 	log.Info("Initialised chain configuration", "config", chainConfig)
 
+	engine, err := dpos.New(chainConfig.Dpos, chainDb)
+	if err != nil {
+		return nil, err
+	}
 	bgm := &Bgmchain{
 		config:         config,
 		chainDb:        chainDb,
 		chainConfig:    chainConfig,
 		eventMux:       ctx.EventMux,
 		accountManager: ctx.AccountManager,
-		engine:         dpos.New(chainConfig.Dpos, chainDb),
+		engine:         engine,
 		shutdownChan:   make(chan bool),
 		stopDbUpgrade:  stopDbUpgrade,
 		networkId:      config.NetworkId,
 		gasPrice:       config.GasPrice,
 		validator:      config.Validator,
+		signer:         config.Signer,
+		validators:     make(map[common.Address]common.Address),
 		coinbase:       config.Coinbase,
 		bloomRequests:  make(chan chan *bloombits.Retrieval),
 		bloomIndexer:   NewBloomIndexer(chainDb, params.BloomBitsBlocks),
 	}
 
+	for _, validator := range config.Validators {
+		bgm.validators[validator] = validator
+	}
+	if config.RemoteSigner != "" {
+		// Slashing protection records are kept apart from the chain
+		db, err := ctx.OpenDatabase("signerdata", 16, 16)
+		if err != nil {
+			return nil, err
+		}
+		if bgm.remote, err = remotesigner.New(config.RemoteSigner, db); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to connect to remote signer: %v", err)
+		}
+		log.Info("Sealing blocks with remote signer", "endpoint", config.RemoteSigner)
+	}
 	log.Info("Initialising Bgmchain protocol", "versions", ProtocolVersions, "network", config.NetworkId)
 
 	if !config.SkipBcVersionCheck {
@@ -146,7 +174,8 @@ func New(ctx *node.ServiceContext, config *Config) (*Bgmchain, error) {
 		core.WriteBlockChainVersion(chainDb, core.BlockChainVersion)
 	}
 	vmConfig := vm.Config{EnablePreimageRecording: config.EnablePreimageRecording}
-	bgm.blockchain, err = core.NewBlockChain(chainDb, bgm.chainConfig, bgm.engine, vmConfig)
+	cacheConfig := &core.CacheConfig{Disabled: config.NoPruning, TrieNodeLimit: config.TrieCache, TrieTimeLimit: config.TrieTimeout}
+	bgm.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, bgm.chainConfig, bgm.engine, vmConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -208,6 +237,30 @@ func CreateDB(ctx *node.ServiceContext, config *Config, name string) (bgmdb.Data
 	return db, nil
 }
 
+// createChainDB opens the chain database of a full node, along with the ancient
+// store the finalized blocks are moved into, unless the chain is held in memory.
+func createChainDB(ctx *node.ServiceContext, config *Config) (bgmdb.Database, error) {
+	db, err := CreateDB(ctx, config, "chaindata")
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := db.(*bgmdb.MemDatabase); ok {
+		return db, nil
+	}
+	freezer := config.DatabaseFreezer
+	if freezer == "" {
+		freezer = filepath.Join(ctx.ResolvePath("chaindata"), "ancient")
+	} else {
+		freezer = ctx.ResolvePath(freezer)
+	}
+	chainDb, err := bgmdb.NewDatabaseWithFreezer(db, freezer, false)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return chainDb, nil
+}
+
 //
 //
 func (s *Bgmchain) APIs() []rpc.API {
@@ -292,6 +345,93 @@ func (self *Bgmchain) SetValidator(validator common.Address) {
 	self.lock.Unlock()
 }
 
+// Signer returns the key sealing the blocks of the validator, which is the
+// validator itself unless a separate signing key was configured.
+func (s *Bgmchain) Signer() (common.Address, error) {
+	s.lock.RLock()
+	signer := s.signer
+	s.lock.RUnlock()
+
+	if signer != (common.Address{}) {
+		return signer, nil
+	}
+	return s.Validator()
+}
+
+// SetSigner sets the key sealing the blocks of the validator. It has to match
+// the signer binding of the validator in force for the epoch being minted.
+func (self *Bgmchain) SetSigner(signer common.Address) {
+	self.lock.Lock()
+	self.signer = signer
+	self.lock.Unlock()
+}
+
+// Validators returns every validator the node mints blocks for: the validator
+// first, followed by the further ones.
+func (s *Bgmchain) Validators() ([]common.Address, error) {
+	validator, err := s.Validator()
+	if err != nil {
+		return nil, err
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	validators := []common.Address{validator}
+	for further := range s.validators {
+		if further != validator {
+			validators = append(validators, further)
+		}
+	}
+	sort.Slice(validators[1:], func(i, j int) bool {
+		return bytes.Compare(validators[1+i].Bytes(), validators[1+j].Bytes()) < 0
+	})
+	return validators, nil
+}
+
+// AddValidator adds a further validator to mint blocks for, sealing them with
+// the given key. The key has to be available locally, and the validator is
+// minted for right away if the node is mining.
+func (s *Bgmchain) AddValidator(validator, signer common.Address) error {
+	if engine, ok := s.engine.(*dpos.Dpos); ok && s.IsMining() {
+		if err := s.authorize(engine, validator, signer); err != nil {
+			return err
+		}
+	}
+	s.lock.Lock()
+	s.validators[validator] = signer
+	s.lock.Unlock()
+	return nil
+}
+
+// RemoveValidator stops minting blocks for a further validator.
+func (s *Bgmchain) RemoveValidator(validator common.Address) {
+	s.lock.Lock()
+	delete(s.validators, validator)
+	s.lock.Unlock()
+
+	if engine, ok := s.engine.(*dpos.Dpos); ok {
+		if primary, err := s.Validator(); err != nil || primary != validator {
+			engine.Deauthorize(validator)
+		}
+	}
+}
+
+// authorize lets the engine mint blocks for a validator, sealing them with the
+// remote signer if one is configured, or with the locally available signer.
+func (s *Bgmchain) authorize(engine *dpos.Dpos, validator, signer common.Address) error {
+	if s.remote != nil {
+		engine.AuthorizeSlotSigner(validator, signer, s.remote.SignSlot)
+		return nil
+	}
+	wallet, err := s.accountManager.Find(accounts.Account{Address: signer})
+	if wallet == nil || err != nil {
+		log.Error("Signer account unavailable locally", "validator", validator, "signer", signer, "err", err)
+		return fmt.Errorf("signer missing: %v", err)
+	}
+	engine.Authorize(validator, signer, wallet.SignHash)
+	return nil
+}
+
 func (s *Bgmchain) Coinbase() (eb common.Address, err error) {
 	s.lock.RLock()
 	coinbase := s.coinbase
@@ -330,12 +470,31 @@ func (s *Bgmchain) StartMining(local bool) error {
 	}
 
 	if dpos, ok := s.engine.(*dpos.Dpos); ok {
-		wallet, err := s.accountManager.Find(accounts.Account{Address: validator})
-		if wallet == nil || err != nil {
-			log.Error("Coinbase account unavailable locally", "err", err)
+		signer, err := s.Signer()
+		if err != nil {
+			log.Error("Cannot start mining without signer", "err", err)
 			return fmt.Errorf("signer missing: %v", err)
 		}
-		dpos.Authorize(validator, wallet.SignHash)
+		// Mint for the configured validators only, dropping any replaced since
+		s.lock.RLock()
+		signers := map[common.Address]common.Address{validator: signer}
+		for further, signer := range s.validators {
+			if further != validator {
+				signers[further] = signer
+			}
+		}
+		s.lock.RUnlock()
+
+		for _, authorized := range dpos.Validators() {
+			if _, ok := signers[authorized]; !ok {
+				dpos.Deauthorize(authorized)
+			}
+		}
+		for validator, signer := range signers {
+			if err := s.authorize(dpos, validator, signer); err != nil {
+				return err
+			}
+		}
 	}
 	if local {
 //
@@ -414,6 +573,9 @@ func (s *Bgmchain) Stop() error {
 	s.eventMux.Stop()
 
 	s.chainDb.Close()
+	if s.remote != nil {
+		s.remote.Close()
+	}
 	close(s.shutdownChan)
 
 	return nil
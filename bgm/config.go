@@ -20,6 +20,7 @@ import (
 	"math/big"
 	"os"
 	"os/user"
+	"time"
 
 	"github.com/5sWind/bgmchain/common"
 	"github.com/5sWind/bgmchain/common/hexutil"
@@ -35,6 +36,9 @@ var DefaultConfig = Config{
 	NetworkId:     1357,
 	LightPeers:    20,
 	DatabaseCache: 128,
+	TrieCache:     256,
+	TrieTimeout:   5 * time.Minute,
+	NoPruning:     true,
 	GasPrice:      big.NewInt(18 * params.Shannon),
 
 	TxPool: core.DefaultTxPoolConfig,
@@ -72,12 +76,19 @@ type Config struct {
 	SkipBcVersionCheck bool `toml:"-"`
 	DatabaseHandles    int  `toml:"-"`
 	DatabaseCache      int
-
-//
-	Validator    common.Address `toml:",omitempty"`
-	Coinbase     common.Address `toml:",omitempty"`
-	MinerThreads int            `toml:",omitempty"`
-	ExtraData    []byte         `toml:",omitempty"`
+	DatabaseFreezer    string        // Directory of the ancient block store, inside the chain database if empty
+	TrieCache          int           // Megabytes of recent state tries held in memory before a flush
+	TrieTimeout        time.Duration // Block processing time after which the recent state is flushed
+	NoPruning          bool          // Whether to write every state to disk instead of pruning them
+
+//
+	Validator    common.Address   `toml:",omitempty"`
+	Signer       common.Address   `toml:",omitempty"` // Key sealing the blocks of the validator, the validator itself if unset
+	Validators   []common.Address `toml:",omitempty"` // Further validators minted for, each sealing with its own key
+	RemoteSigner string           `toml:",omitempty"` // Endpoint of the daemon signing the blocks, the local keystore if unset
+	Coinbase     common.Address   `toml:",omitempty"`
+	MinerThreads int              `toml:",omitempty"`
+	ExtraData    []byte           `toml:",omitempty"`
 	GasPrice     *big.Int
 
 //
@@ -50,7 +50,7 @@ func upgradeDeduplicateData(db bgmdb.Database) func() error {
 
 	go func() {
 //
-		it := db.(*bgmdb.LDBDatabase).NewIterator()
+		it := db.NewIteratorWithRange(nil, nil)
 		defer func() {
 			if it != nil {
 				it.Release()
@@ -99,9 +99,9 @@ func upgradeDeduplicateData(db bgmdb.Database) func() error {
 //
 			converted++
 			if converted%100000 == 0 {
+				key = common.CopyBytes(key)
 				it.Release()
-				it = db.(*bgmdb.LDBDatabase).NewIterator()
-				it.Seek(key)
+				it = db.NewIteratorWithRange(key, nil)
 
 				log.Info("Deduplicating database entries", "deduped", converted)
 			}
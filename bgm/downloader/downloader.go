@@ -79,6 +79,7 @@ var (
 	errEmptyHeaderSet          = errors.New("empty header set by peer")
 	errPeersUnavailable        = errors.New("no peers available or all tried for download")
 	errInvalidAncestor         = errors.New("retrieved ancestor is invalid")
+	errConfirmedConflict       = errors.New("retrieved chain conflicts with the confirmed block")
 	errInvalidChain            = errors.New("retrieved hash chain is invalid")
 	errInvalidBlock            = errors.New("retrieved block is invalid")
 	errInvalidBody             = errors.New("retrieved block body is invalid")
@@ -174,6 +175,12 @@ type LightChain interface {
 	Rollback([]common.Hash)
 }
 
+// confirmedChain is implemented by local chains tracking an irreversible block.
+type confirmedChain interface {
+	// ConfirmedHeader retrieves the irreversible block, nil if there's none.
+	ConfirmedHeader() *types.Header
+}
+
 // BlockChain encapsulates functions required to sync a (full or fast) blockchain.
 type BlockChain interface {
 	LightChain
@@ -260,6 +267,9 @@ func (d *Downloader) Progress() bgmchain.SyncProgress {
 		HighestBlock:  d.syncStatsChainHeight,
 		PulledStates:  d.syncStatsState.processed,
 		KnownStates:   d.syncStatsState.processed + d.syncStatsState.pending,
+
+		PulledDposTries: d.syncStatsState.dposPulled,
+		KnownDposTries:  d.syncStatsState.dposKnown,
 	}
 }
 
@@ -322,7 +332,7 @@ func (d *Downloader) Synchronise(id string, head common.Hash, td *big.Int, mode
 
 	case errTimeout, errBadPeer, errStallingPeer,
 		errEmptyHeaderSet, errPeersUnavailable, errTooOld,
-		errInvalidAncestor, errInvalidChain:
+		errInvalidAncestor, errConfirmedConflict, errInvalidChain:
 		log.Warn("Synchronisation failed, dropping peer", "peer", id, "err", err)
 		d.dropPeer(id)
 
@@ -611,6 +621,13 @@ func (d *Downloader) findAncestor(p *peerConnection, height uint64) (uint64, err
 	if ceil >= MaxForkAncestry {
 		floor = int64(ceil - MaxForkAncestry)
 	}
+	// Forks below the irreversible block are never acceptable, whatever their TD
+	confirmed := int64(-1)
+	if chain, ok := d.lightchain.(confirmedChain); ok {
+		if header := chain.ConfirmedHeader(); header != nil {
+			confirmed = header.Number.Int64()
+		}
+	}
 	// Request the topmost blocks to short circuit binary ancestor lookup
 	head := ceil
 	if head > height {
@@ -689,6 +706,11 @@ func (d *Downloader) findAncestor(p *peerConnection, height uint64) (uint64, err
 	}
 	// If the head fetch already found an ancestor, return
 	if !common.EmptyHash(hash) {
+		if int64(number) < confirmed {
+			p.log.Warn("Ancestor below confirmed block", "number", number, "hash", hash, "confirmed", confirmed)
+			confirmedConflictMeter.Mark(1)
+			return 0, errConfirmedConflict
+		}
 		if int64(number) <= floor {
 			p.log.Warn("Ancestor below allowance", "number", number, "hash", hash, "allowance", floor)
 			return 0, errInvalidAncestor
@@ -753,6 +775,11 @@ func (d *Downloader) findAncestor(p *peerConnection, height uint64) (uint64, err
 		}
 	}
 	// Ensure valid ancestry and return
+	if int64(start) < confirmed {
+		p.log.Warn("Ancestor below confirmed block", "number", start, "hash", hash, "confirmed", confirmed)
+		confirmedConflictMeter.Mark(1)
+		return 0, errConfirmedConflict
+	}
 	if int64(start) <= floor {
 		p.log.Warn("Ancestor below allowance", "number", start, "hash", hash, "allowance", floor)
 		return 0, errInvalidAncestor
@@ -1371,7 +1398,7 @@ func (d *Downloader) importBlockResults(results []*fetchResult) error {
 func (d *Downloader) processFastSyncContent(latest *types.Header) error {
 	// Start syncing state of the reported head block.
 	// This should get us most of the state of the pivot block.
-	stateSync := d.syncState(latest.Root)
+	stateSync := d.syncState(latest.Root, latest.DposContext)
 	defer stateSync.Cancel()
 	go func() {
 		if err := stateSync.Wait(); err != nil {
@@ -1456,12 +1483,9 @@ func (d *Downloader) commitFastSyncData(results []*fetchResult, stateSync *state
 
 func (d *Downloader) commitPivotBlock(result *fetchResult) error {
 	b := types.NewBlockWithHeader(result.Header).WithBody(result.Transactions, result.Uncles)
-	// Sync the pivot block state. This should complete reasonably quickly because
-	// we've already synced up to the reported head block state earlier.
-	if err := d.syncState(b.Root()).Wait(); err != nil {
-		return err
-	}
-	if err := d.syncDposContextState(b.Header().DposContext); err != nil {
+	// Sync the pivot block state and dpos context. This should complete reasonably
+	// quickly because we've already synced up to the reported head block state earlier.
+	if err := d.syncState(b.Root(), b.Header().DposContext).Wait(); err != nil {
 		return err
 	}
 	log.Debug("Committing fast sync pivot as new head", "number", b.Number(), "hash", b.Hash())
@@ -1471,23 +1495,6 @@ func (d *Downloader) commitPivotBlock(result *fetchResult) error {
 	return d.blockchain.FastSyncCommitHead(b.Hash())
 }
 
-// Todo: sync dpos context in concurrent
-func (d *Downloader) syncDposContextState(context *types.DposContextProto) error {
-	roots := []common.Hash{
-		context.CandidateHash,
-		context.DelegateHash,
-		context.VoteHash,
-		context.EpochHash,
-		context.MintCntHash,
-	}
-	for _, root := range roots {
-		if err := d.syncState(root).Wait(); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 // DeliverHeaders injects a new batch of block headers received from a remote
 // node into the download schedule.
 func (d *Downloader) DeliverHeaders(id string, headers []*types.Header) (err error) {
@@ -78,6 +78,12 @@ func newTester() *downloadTester {
 	testdb, _ := bgmdb.NewMemDatabase()
 	genesis := core.GenesisBlockForTesting(testdb, testAddress, big.NewInt(1000000000))
 
+	return newTesterWithGenesis(testdb, genesis)
+}
+
+// newTesterWithGenesis creates a new downloader test mocker whose peers share
+// the given genesis block, committed into testdb.
+func newTesterWithGenesis(testdb bgmdb.Database, genesis *types.Block) *downloadTester {
 	tester := &downloadTester{
 		genesis:           genesis,
 		peerDb:            testdb,
@@ -696,6 +702,67 @@ func testCanonicalSynchronisation(t *testing.T, protocol int, mode SyncMode) {
 	assertOwnChain(t, tester, targetBlocks+1)
 }
 
+// Tests that fast sync retrieves the dpos context tries of the pivot block along
+// with its state, and reports their progress.
+func TestDposContextSync63Fast(t *testing.T) { testDposContextSync(t, 63) }
+func TestDposContextSync64Fast(t *testing.T) { testDposContextSync(t, 64) }
+
+func testDposContextSync(t *testing.T, protocol int) {
+	t.Parallel()
+
+	// Create a genesis with large delegate and candidate tries, inherited by every block
+	validators := make([]common.Address, 1024)
+	for i := range validators {
+		validators[i] = common.BigToAddress(big.NewInt(int64(i + 1)))
+	}
+	config := *params.TestChainConfig
+	config.Dpos = &params.DposConfig{Validators: validators}
+
+	testdb, _ := bgmdb.NewMemDatabase()
+	gspec := &core.Genesis{
+		Config: &config,
+		Alloc:  core.GenesisAlloc{testAddress: {Balance: big.NewInt(1000000000)}},
+	}
+	tester := newTesterWithGenesis(testdb, gspec.MustCommit(testdb))
+	defer tester.terminate()
+
+	targetBlocks := blockCacheLimit - 15
+	hashes, headers, blocks, receipts := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
+
+	tester.newPeer("peer", protocol, hashes, headers, blocks, receipts)
+	if err := tester.sync("peer", nil, FastSync); err != nil {
+		t.Fatalf("failed to synchronise blocks: %v", err)
+	}
+	assertOwnChain(t, tester, targetBlocks+1)
+
+	// Every entry of the pivot's dpos context must be readable locally
+	pivot := tester.ownHeaders[tester.ownHashes[tester.downloader.queue.fastSyncPivot]]
+	dposContext, err := types.NewDposContextFromProto(tester.stateDb, pivot.DposContext)
+	if err != nil {
+		t.Fatalf("failed to open pivot dpos context: %v", err)
+	}
+	for name, tr := range map[string]*trie.Trie{"delegate": dposContext.DelegateTrie(), "candidate": dposContext.CandidateTrie()} {
+		entries := 0
+		it := trie.NewIterator(tr.NodeIterator(nil))
+		for it.Next() {
+			entries++
+		}
+		if it.Err != nil {
+			t.Fatalf("%s trie incomplete: %v", name, it.Err)
+		}
+		if entries != len(validators) {
+			t.Errorf("%s trie entries mismatch: have %d, want %d", name, entries, len(validators))
+		}
+	}
+	if _, err := dposContext.GetValidators(); err != nil {
+		t.Errorf("failed to read validators: %v", err)
+	}
+	// The epoch, delegate and candidate tries are the non-empty ones
+	if progress := tester.downloader.Progress(); progress.KnownDposTries != 3 || progress.PulledDposTries != 3 {
+		t.Errorf("dpos progress mismatch: have %d/%d, want 3/3", progress.PulledDposTries, progress.KnownDposTries)
+	}
+}
+
 // Tests that if a large batch of blocks are being downloaded, it is throttled
 // until the cached blocks are retrieved.
 func TestThrottling62(t *testing.T)     { testThrottling(t, 62, FullSync) }
@@ -40,4 +40,6 @@ var (
 
 	stateInMeter   = metrics.NewMeter("bgm/downloader/states/in")
 	stateDropMeter = metrics.NewMeter("bgm/downloader/states/drop")
+
+	confirmedConflictMeter = metrics.NewMeter("bgm/downloader/confirmed/conflict")
 )
@@ -25,6 +25,7 @@ import (
 
 	"github.com/5sWind/bgmchain/common"
 	"github.com/5sWind/bgmchain/core/state"
+	"github.com/5sWind/bgmchain/core/types"
 	"github.com/5sWind/bgmchain/crypto/sha3"
 	"github.com/5sWind/bgmchain/bgmdb"
 	"github.com/5sWind/bgmchain/log"
@@ -55,11 +56,15 @@ type stateSyncStats struct {
 	duplicate  uint64 // Number of state entries downloaded twice
 	unexpected uint64 // Number of non-requested state entries received
 	pending    uint64 // Number of still pending state entries
+
+	dposPulled uint64 // Number of dpos context tries of the current sync completed
+	dposKnown  uint64 // Number of dpos context tries the current sync retrieves
 }
 
-// syncState starts downloading state with the given root hash.
-func (d *Downloader) syncState(root common.Hash) *stateSync {
-	s := newStateSync(d, root)
+// syncState starts downloading state with the given root hash, together with
+// the tries of the dpos context if one is given.
+func (d *Downloader) syncState(root common.Hash, dposContext *types.DposContextProto) *stateSync {
+	s := newStateSync(d, root, dposContext)
 	select {
 	case d.stateSyncStart <- s:
 	case <-d.quitCh:
@@ -211,9 +216,10 @@ func (d *Downloader) runStateSync(s *stateSync) *stateSync {
 type stateSync struct {
 	d *Downloader // Downloader instance to access and manage current peerset
 
-	sched  *trie.TrieSync             // State trie sync scheduler defining the tasks
-	keccak hash.Hash                  // Keccak256 hasher to verify deliveries with
-	tasks  map[common.Hash]*stateTask // Set of tasks currently queued for retrieval
+	sched     *trie.TrieSync             // State trie sync scheduler defining the tasks
+	keccak    hash.Hash                  // Keccak256 hasher to verify deliveries with
+	tasks     map[common.Hash]*stateTask // Set of tasks currently queued for retrieval
+	dposRoots []common.Hash              // Roots of the dpos context tries synced alongside the state
 
 	numUncommitted   int
 	bytesUncommitted int
@@ -233,8 +239,12 @@ type stateTask struct {
 
 // newStateSync creates a new state trie download scheduler. This method does not
 // yet start the sync. The user needs to call run to initiate.
-func newStateSync(d *Downloader, root common.Hash) *stateSync {
-	return &stateSync{
+//
+// The tries of the dpos context, if given, are scheduled as additional roots of
+// the same trie sync, so their nodes are fetched concurrently with the account
+// trie instead of one trie after the other.
+func newStateSync(d *Downloader, root common.Hash, dposContext *types.DposContextProto) *stateSync {
+	s := &stateSync{
 		d:       d,
 		sched:   state.NewStateSync(root, d.stateDB),
 		keccak:  sha3.NewKeccak256(),
@@ -243,6 +253,38 @@ func newStateSync(d *Downloader, root common.Hash) *stateSync {
 		cancel:  make(chan struct{}),
 		done:    make(chan struct{}),
 	}
+	if dposContext != nil {
+		for _, root := range dposContextRoots(dposContext) {
+			s.sched.AddSubTrie(root, 0, common.Hash{}, nil)
+			s.dposRoots = append(s.dposRoots, root)
+		}
+	}
+	return s
+}
+
+// dposContextRoots returns the distinct, non-empty roots of the tries of a dpos
+// context.
+func dposContextRoots(dposContext *types.DposContextProto) []common.Hash {
+	var (
+		roots []common.Hash
+		seen  = make(map[common.Hash]bool)
+	)
+	for _, root := range []common.Hash{
+		dposContext.EpochHash,
+		dposContext.DelegateHash,
+		dposContext.VoteHash,
+		dposContext.CandidateHash,
+		dposContext.MintCntHash,
+		dposContext.RewardHash,
+		dposContext.StakeHash,
+	} {
+		if root == (common.Hash{}) || root == types.EmptyRootHash || seen[root] {
+			continue
+		}
+		seen[root] = true
+		roots = append(roots, root)
+	}
+	return roots
 }
 
 // run starts the task assignment and response processing loop, blocking until
@@ -277,6 +319,9 @@ func (s *stateSync) loop() error {
 	peerSub := s.d.peers.SubscribeNewPeers(newPeer)
 	defer peerSub.Unsubscribe()
 
+	// Report the tries of this sync before anything is written
+	s.updateStats(0, 0, 0, 0)
+
 	// Keep assigning new tasks until the sync completes or aborts
 	for s.sched.Pending() > 0 {
 		if err := s.commit(false); err != nil {
@@ -469,7 +514,16 @@ func (s *stateSync) updateStats(written, duplicate, unexpected int, duration tim
 	s.d.syncStatsState.duplicate += uint64(duplicate)
 	s.d.syncStatsState.unexpected += uint64(unexpected)
 
+	// A trie root is only written once its whole trie is, so the roots present
+	// in the database are the dpos tries fully synced.
+	s.d.syncStatsState.dposKnown = uint64(len(s.dposRoots))
+	s.d.syncStatsState.dposPulled = 0
+	for _, root := range s.dposRoots {
+		if ok, _ := s.d.stateDB.Has(root.Bytes()); ok {
+			s.d.syncStatsState.dposPulled++
+		}
+	}
 	if written > 0 || duplicate > 0 || unexpected > 0 {
-		log.Info("Imported new state entries", "count", written, "elapsed", common.PrettyDuration(duration), "processed", s.d.syncStatsState.processed, "pending", s.d.syncStatsState.pending, "retry", len(s.tasks), "duplicate", s.d.syncStatsState.duplicate, "unexpected", s.d.syncStatsState.unexpected)
+		log.Info("Imported new state entries", "count", written, "elapsed", common.PrettyDuration(duration), "processed", s.d.syncStatsState.processed, "pending", s.d.syncStatsState.pending, "retry", len(s.tasks), "duplicate", s.d.syncStatsState.duplicate, "unexpected", s.d.syncStatsState.unexpected, "dpos", fmt.Sprintf("%d/%d", s.d.syncStatsState.dposPulled, s.d.syncStatsState.dposKnown))
 	}
 }
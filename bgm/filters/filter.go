@@ -21,6 +21,7 @@ import (
 	"math/big"
 
 	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/consensus/dpos"
 	"github.com/5sWind/bgmchain/core"
 	"github.com/5sWind/bgmchain/core/bloombits"
 	"github.com/5sWind/bgmchain/core/types"
@@ -39,6 +40,7 @@ type Backend interface {
 	SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription
 	SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription
 	SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription
+	SubscribeConfirmedHeadEvent(ch chan<- dpos.ConfirmedHeadEvent) event.Subscription
 
 	BloomStatus() (uint64, uint64)
 	ServiceFilter(ctx context.Context, session *bloombits.MatcherSession)
@@ -101,13 +103,28 @@ func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
 	}
 	head := header.Number.Uint64()
 
+	// Resolve the irreversible block if the range is bounded by it
+	var confirmed uint64
+	if f.begin == rpc.ConfirmedBlockNumber.Int64() || f.end == rpc.ConfirmedBlockNumber.Int64() {
+		header, err := f.backend.HeaderByNumber(ctx, rpc.ConfirmedBlockNumber)
+		if header == nil || err != nil {
+			return nil, err
+		}
+		confirmed = header.Number.Uint64()
+	}
 	if f.begin == -1 {
 		f.begin = int64(head)
 	}
+	if f.begin == rpc.ConfirmedBlockNumber.Int64() {
+		f.begin = int64(confirmed)
+	}
 	end := uint64(f.end)
 	if f.end == -1 {
 		end = head
 	}
+	if f.end == rpc.ConfirmedBlockNumber.Int64() {
+		end = confirmed
+	}
 	// Gather all indexed logs, and finish with non indexed ones
 	var (
 		logs []*types.Log
@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/consensus/dpos"
 	"github.com/5sWind/bgmchain/core"
 	"github.com/5sWind/bgmchain/core/types"
 	"github.com/5sWind/bgmchain/event"
@@ -50,6 +51,10 @@ const (
 	PendingTransactionsSubscription
 	// BlocksSubscription queries hashes for blocks that are imported
 	BlocksSubscription
+	// ConfirmedLogsSubscription queries for logs once their block is irreversible
+	ConfirmedLogsSubscription
+	// ConfirmedBlocksSubscription queries headers for blocks that become irreversible
+	ConfirmedBlocksSubscription
 	// LastSubscription keeps track of the last index
 	LastIndexSubscription
 )
@@ -65,6 +70,8 @@ const (
 	logsChanSize = 10
 	// chainEvChanSize is the size of channel listening to ChainEvent.
 	chainEvChanSize = 10
+	// confirmedEvChanSize is the size of channel listening to ConfirmedHeadEvent.
+	confirmedEvChanSize = 10
 )
 
 var (
@@ -90,6 +97,8 @@ type EventSystem struct {
 	backend   Backend
 	lightMode bool
 	lastHead  *types.Header
+
+	lastConfirmed *types.Header // Latest irreversible block whose logs were delivered
 	install   chan *subscription // install filter for event notification
 	uninstall chan *subscription // remove filter for event notification
 }
@@ -175,6 +184,10 @@ func (es *EventSystem) SubscribeLogs(crit FilterCriteria, logs chan []*types.Log
 		to = rpc.BlockNumber(crit.ToBlock.Int64())
 	}
 
+	// only interested in logs once their block is irreversible
+	if to == rpc.ConfirmedBlockNumber && from != rpc.PendingBlockNumber {
+		return es.subscribeConfirmedLogs(crit, logs), nil
+	}
 	// only interested in pending logs
 	if from == rpc.PendingBlockNumber && to == rpc.PendingBlockNumber {
 		return es.subscribePendingLogs(crit, logs), nil
@@ -232,6 +245,23 @@ func (es *EventSystem) subscribeLogs(crit FilterCriteria, logs chan []*types.Log
 	return es.subscribe(sub)
 }
 
+// subscribeConfirmedLogs creates a subscription that will write all logs matching
+// the given criteria to the given logs channel once their block is irreversible.
+func (es *EventSystem) subscribeConfirmedLogs(crit FilterCriteria, logs chan []*types.Log) *Subscription {
+	sub := &subscription{
+		id:        rpc.NewID(),
+		typ:       ConfirmedLogsSubscription,
+		logsCrit:  crit,
+		created:   time.Now(),
+		logs:      logs,
+		hashes:    make(chan common.Hash),
+		headers:   make(chan *types.Header),
+		installed: make(chan struct{}),
+		err:       make(chan error),
+	}
+	return es.subscribe(sub)
+}
+
 // subscribePendingLogs creates a subscription that writes transaction hashes for
 // transactions that enter the transaction pool.
 func (es *EventSystem) subscribePendingLogs(crit FilterCriteria, logs chan []*types.Log) *Subscription {
@@ -265,6 +295,22 @@ func (es *EventSystem) SubscribeNewHeads(headers chan *types.Header) *Subscripti
 	return es.subscribe(sub)
 }
 
+// SubscribeConfirmedHeads creates a subscription that writes the header of a block
+// that becomes irreversible.
+func (es *EventSystem) SubscribeConfirmedHeads(headers chan *types.Header) *Subscription {
+	sub := &subscription{
+		id:        rpc.NewID(),
+		typ:       ConfirmedBlocksSubscription,
+		created:   time.Now(),
+		logs:      make(chan []*types.Log),
+		hashes:    make(chan common.Hash),
+		headers:   headers,
+		installed: make(chan struct{}),
+		err:       make(chan error),
+	}
+	return es.subscribe(sub)
+}
+
 // SubscribePendingTxEvents creates a subscription that writes transaction hashes for
 // transactions that enter the transaction pool.
 func (es *EventSystem) SubscribePendingTxEvents(hashes chan common.Hash) *Subscription {
@@ -332,9 +378,47 @@ func (es *EventSystem) broadcast(filters filterIndex, ev interface{}) {
 				}
 			})
 		}
+	case dpos.ConfirmedHeadEvent:
+		if len(filters[ConfirmedBlocksSubscription]) == 0 && len(filters[ConfirmedLogsSubscription]) == 0 {
+			es.lastConfirmed = e.Header
+			return
+		}
+		headers := es.newConfirmedHeaders(e.Header)
+		for _, header := range headers {
+			for _, f := range filters[ConfirmedBlocksSubscription] {
+				f.headers <- header
+			}
+			for _, f := range filters[ConfirmedLogsSubscription] {
+				if matchedLogs := es.lightFilterLogs(header, f.logsCrit.Addresses, f.logsCrit.Topics, false); len(matchedLogs) > 0 {
+					if matchedLogs = filterLogs(matchedLogs, f.logsCrit.FromBlock, nil, nil, nil); len(matchedLogs) > 0 {
+						f.logs <- matchedLogs
+					}
+				}
+			}
+		}
 	}
 }
 
+// newConfirmedHeaders returns the headers which became irreversible since the
+// last confirmed head, oldest first.
+func (es *EventSystem) newConfirmedHeaders(confirmed *types.Header) []*types.Header {
+	last := es.lastConfirmed
+	es.lastConfirmed = confirmed
+	if last == nil || last.Number.Uint64() >= confirmed.Number.Uint64() {
+		return []*types.Header{confirmed}
+	}
+	headers := make([]*types.Header, confirmed.Number.Uint64()-last.Number.Uint64())
+	for i, header := len(headers)-1, confirmed; i >= 0; i-- {
+		if header == nil {
+			// happens when CHT syncing, only deliver what is known
+			return headers[i+1:]
+		}
+		headers[i] = header
+		header = core.GetHeader(es.backend.ChainDb(), header.ParentHash, header.Number.Uint64()-1)
+	}
+	return headers
+}
+
 func (es *EventSystem) lightFilterNewHead(newHeader *types.Header, callBack func(*types.Header, bool)) {
 	oldh := es.lastHead
 	es.lastHead = newHeader
@@ -409,6 +493,9 @@ func (es *EventSystem) eventLoop() {
 		// Subscribe ChainEvent
 		chainEvCh  = make(chan core.ChainEvent, chainEvChanSize)
 		chainEvSub = es.backend.SubscribeChainEvent(chainEvCh)
+		// Subscribe ConfirmedHeadEvent
+		confirmedEvCh  = make(chan dpos.ConfirmedHeadEvent, confirmedEvChanSize)
+		confirmedEvSub = es.backend.SubscribeConfirmedHeadEvent(confirmedEvCh)
 	)
 
 	// Unsubscribe all events
@@ -417,6 +504,12 @@ func (es *EventSystem) eventLoop() {
 	defer rmLogsSub.Unsubscribe()
 	defer logsSub.Unsubscribe()
 	defer chainEvSub.Unsubscribe()
+	defer confirmedEvSub.Unsubscribe()
+
+	// Logs of blocks confirmed before the system started are not delivered
+	if header, err := es.backend.HeaderByNumber(context.Background(), rpc.ConfirmedBlockNumber); err == nil {
+		es.lastConfirmed = header
+	}
 
 	for i := UnknownSubscription; i < LastIndexSubscription; i++ {
 		index[i] = make(map[rpc.ID]*subscription)
@@ -439,6 +532,8 @@ func (es *EventSystem) eventLoop() {
 			es.broadcast(index, ev)
 		case ev := <-chainEvCh:
 			es.broadcast(index, ev)
+		case ev := <-confirmedEvCh:
+			es.broadcast(index, ev)
 
 		case f := <-es.install:
 			if f.typ == MinedAndPendingLogsSubscription {
@@ -468,6 +563,8 @@ func (es *EventSystem) eventLoop() {
 			return
 		case <-chainEvSub.Err():
 			return
+		case <-confirmedEvSub.Err():
+			return
 		}
 	}
 }
@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/consensus/dpos"
 	"github.com/5sWind/bgmchain/core"
 	"github.com/5sWind/bgmchain/core/bloombits"
 	"github.com/5sWind/bgmchain/core/types"
@@ -43,6 +44,8 @@ type testBackend struct {
 	rmLogsFeed *event.Feed
 	logsFeed   *event.Feed
 	chainFeed  *event.Feed
+
+	confirmedFeed *event.Feed
 }
 
 func (b *testBackend) ChainDb() bgmdb.Database {
@@ -87,6 +90,10 @@ func (b *testBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subsc
 	return b.chainFeed.Subscribe(ch)
 }
 
+func (b *testBackend) SubscribeConfirmedHeadEvent(ch chan<- dpos.ConfirmedHeadEvent) event.Subscription {
+	return b.confirmedFeed.Subscribe(ch)
+}
+
 func (b *testBackend) BloomStatus() (uint64, uint64) {
 	return params.BloomBitsBlocks, b.sections
 }
@@ -133,7 +140,7 @@ func TestBlockSubscription(t *testing.T) {
 		rmLogsFeed  = new(event.Feed)
 		logsFeed    = new(event.Feed)
 		chainFeed   = new(event.Feed)
-		backend     = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend     = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		api         = NewPublicFilterAPI(backend, false)
 		genesis     = new(core.Genesis).MustCommit(db)
 		chain, _    = core.GenerateChain(params.TestChainConfig, genesis, db, 10, func(i int, gen *core.BlockGen) {})
@@ -179,6 +186,79 @@ func TestBlockSubscription(t *testing.T) {
 	<-sub1.Err()
 }
 
+// TestConfirmedSubscription tests if confirmed head and confirmed log subscriptions
+// deliver every block between two confirmed head events, and only those.
+func TestConfirmedSubscription(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mux           = new(event.TypeMux)
+		db, _         = bgmdb.NewMemDatabase()
+		confirmedFeed = new(event.Feed)
+		backend       = &testBackend{mux, db, 0, new(event.Feed), new(event.Feed), new(event.Feed), new(event.Feed), confirmedFeed}
+		api           = NewPublicFilterAPI(backend, false)
+		addr          = common.HexToAddress("0x1111111111111111111111111111111111111111")
+		genesis       = new(core.Genesis).MustCommit(db)
+	)
+	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, db, 10, func(i int, gen *core.BlockGen) {
+		if i == 2 || i == 6 {
+			receipt := types.NewReceipt(nil, false, new(big.Int))
+			receipt.Logs = []*types.Log{{Address: addr, BlockNumber: uint64(i + 1)}}
+			gen.AddUncheckedReceipt(receipt)
+		}
+	})
+	for i, block := range chain {
+		core.WriteBlock(db, block)
+		if err := core.WriteCanonicalHash(db, block.Hash(), block.NumberU64()); err != nil {
+			t.Fatalf("failed to insert block number: %v", err)
+		}
+		if err := core.WriteBlockReceipts(db, block.Hash(), block.NumberU64(), receipts[i]); err != nil {
+			t.Fatal("error writing block receipts:", err)
+		}
+	}
+
+	headers := make(chan *types.Header)
+	headersSub := api.events.SubscribeConfirmedHeads(headers)
+	logs := make(chan []*types.Log)
+	crit := FilterCriteria{ToBlock: big.NewInt(rpc.ConfirmedBlockNumber.Int64()), Addresses: []common.Address{addr}}
+	logsSub, err := api.events.SubscribeLogs(crit, logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Confirm block 2, then jump to block 8 which confirms blocks 3 to 8 at once
+	go func() {
+		confirmedFeed.Send(dpos.ConfirmedHeadEvent{Header: chain[1].Header()})
+		confirmedFeed.Send(dpos.ConfirmedHeadEvent{Header: chain[7].Header()})
+	}()
+
+	var (
+		gotHeaders []uint64
+		gotLogs    []uint64
+		timeout    = time.After(5 * time.Second)
+	)
+	for len(gotHeaders) < 7 || len(gotLogs) < 2 {
+		select {
+		case header := <-headers:
+			gotHeaders = append(gotHeaders, header.Number.Uint64())
+		case matched := <-logs:
+			for _, log := range matched {
+				gotLogs = append(gotLogs, log.BlockNumber)
+			}
+		case <-timeout:
+			t.Fatalf("timeout, got headers %v and logs %v", gotHeaders, gotLogs)
+		}
+	}
+	if want := []uint64{2, 3, 4, 5, 6, 7, 8}; !reflect.DeepEqual(gotHeaders, want) {
+		t.Errorf("confirmed headers mismatch: have %v, want %v", gotHeaders, want)
+	}
+	if want := []uint64{3, 7}; !reflect.DeepEqual(gotLogs, want) {
+		t.Errorf("confirmed logs mismatch: have %v, want %v", gotLogs, want)
+	}
+	headersSub.Unsubscribe()
+	logsSub.Unsubscribe()
+}
+
 // TestPendingTxFilter tests whbgmchain pending tx filters retrieve all pending transactions that are posted to the event mux.
 func TestPendingTxFilter(t *testing.T) {
 	t.Parallel()
@@ -190,7 +270,7 @@ func TestPendingTxFilter(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		api        = NewPublicFilterAPI(backend, false)
 
 		transactions = []*types.Transaction{
@@ -253,7 +333,7 @@ func TestLogFilterCreation(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		api        = NewPublicFilterAPI(backend, false)
 
 		testCases = []struct {
@@ -302,7 +382,7 @@ func TestInvalidLogFilterCreation(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		api        = NewPublicFilterAPI(backend, false)
 	)
 
@@ -332,7 +412,7 @@ func TestLogFilter(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		api        = NewPublicFilterAPI(backend, false)
 
 		firstAddr      = common.HexToAddress("0x1111111111111111111111111111111111111111")
@@ -451,7 +531,7 @@ func TestPendingLogsSubscription(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		api        = NewPublicFilterAPI(backend, false)
 
 		firstAddr      = common.HexToAddress("0x1111111111111111111111111111111111111111")
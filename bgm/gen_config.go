@@ -4,6 +4,7 @@ package bgm
 
 import (
 	"math/big"
+	"time"
 
 	"github.com/5sWind/bgmchain/common"
 	"github.com/5sWind/bgmchain/common/hexutil"
@@ -25,10 +26,17 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		SkipBcVersionCheck      bool `toml:"-"`
 		DatabaseHandles         int  `toml:"-"`
 		DatabaseCache           int
-		Validator               common.Address `toml:",omitempty"`
-		Coinbase                common.Address `toml:",omitempty"`
-		MinerThreads            int            `toml:",omitempty"`
-		ExtraData               hexutil.Bytes  `toml:",omitempty"`
+		DatabaseFreezer         string
+		TrieCache               int
+		TrieTimeout             time.Duration
+		NoPruning               bool
+		Validator               common.Address   `toml:",omitempty"`
+		Signer                  common.Address   `toml:",omitempty"`
+		Validators              []common.Address `toml:",omitempty"`
+		RemoteSigner            string           `toml:",omitempty"`
+		Coinbase                common.Address   `toml:",omitempty"`
+		MinerThreads            int              `toml:",omitempty"`
+		ExtraData               hexutil.Bytes    `toml:",omitempty"`
 		GasPrice                *big.Int
 		TxPool                  core.TxPoolConfig
 		GPO                     gasprice.Config
@@ -48,7 +56,14 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.SkipBcVersionCheck = c.SkipBcVersionCheck
 	enc.DatabaseHandles = c.DatabaseHandles
 	enc.DatabaseCache = c.DatabaseCache
+	enc.DatabaseFreezer = c.DatabaseFreezer
+	enc.TrieCache = c.TrieCache
+	enc.TrieTimeout = c.TrieTimeout
+	enc.NoPruning = c.NoPruning
 	enc.Validator = c.Validator
+	enc.Signer = c.Signer
+	enc.Validators = c.Validators
+	enc.RemoteSigner = c.RemoteSigner
 	enc.Coinbase = c.Coinbase
 	enc.MinerThreads = c.MinerThreads
 	enc.ExtraData = c.ExtraData
@@ -75,10 +90,17 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		SkipBcVersionCheck      *bool `toml:"-"`
 		DatabaseHandles         *int  `toml:"-"`
 		DatabaseCache           *int
-		Validator               *common.Address `toml:",omitempty"`
-		Coinbase                *common.Address `toml:",omitempty"`
-		MinerThreads            *int            `toml:",omitempty"`
-		ExtraData               *hexutil.Bytes  `toml:",omitempty"`
+		DatabaseFreezer         *string
+		TrieCache               *int
+		TrieTimeout             *time.Duration
+		NoPruning               *bool
+		Validator               *common.Address  `toml:",omitempty"`
+		Signer                  *common.Address  `toml:",omitempty"`
+		Validators              []common.Address `toml:",omitempty"`
+		RemoteSigner            *string          `toml:",omitempty"`
+		Coinbase                *common.Address  `toml:",omitempty"`
+		MinerThreads            *int             `toml:",omitempty"`
+		ExtraData               *hexutil.Bytes   `toml:",omitempty"`
 		GasPrice                *big.Int
 		TxPool                  *core.TxPoolConfig
 		GPO                     *gasprice.Config
@@ -117,9 +139,30 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.DatabaseCache != nil {
 		c.DatabaseCache = *dec.DatabaseCache
 	}
+	if dec.DatabaseFreezer != nil {
+		c.DatabaseFreezer = *dec.DatabaseFreezer
+	}
+	if dec.TrieCache != nil {
+		c.TrieCache = *dec.TrieCache
+	}
+	if dec.TrieTimeout != nil {
+		c.TrieTimeout = *dec.TrieTimeout
+	}
+	if dec.NoPruning != nil {
+		c.NoPruning = *dec.NoPruning
+	}
 	if dec.Validator != nil {
 		c.Validator = *dec.Validator
 	}
+	if dec.Signer != nil {
+		c.Signer = *dec.Signer
+	}
+	if dec.Validators != nil {
+		c.Validators = dec.Validators
+	}
+	if dec.RemoteSigner != nil {
+		c.RemoteSigner = *dec.RemoteSigner
+	}
 	if dec.Coinbase != nil {
 		c.Coinbase = *dec.Coinbase
 	}
@@ -266,6 +266,9 @@ type rpcProgress struct {
 	HighestBlock  hexutil.Uint64
 	PulledStates  hexutil.Uint64
 	KnownStates   hexutil.Uint64
+
+	PulledDposTries hexutil.Uint64
+	KnownDposTries  hexutil.Uint64
 }
 
 //
@@ -290,6 +293,9 @@ func (ec *Client) SyncProgress(ctx context.Context) (*bgmchain.SyncProgress, err
 		HighestBlock:  uint64(progress.HighestBlock),
 		PulledStates:  uint64(progress.PulledStates),
 		KnownStates:   uint64(progress.KnownStates),
+
+		PulledDposTries: uint64(progress.PulledDposTries),
+		KnownDposTries:  uint64(progress.KnownDposTries),
 	}, nil
 }
 
@@ -0,0 +1,181 @@
+// Copyright 2017 The bgmchain Authors
+// This file is part of the bgmchain library.
+//
+// The bgmchain library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The bgmchain library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the bgmchain library. If not, see <http://www.gnu.org/licenses/>.
+
+package bgmclient
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/5sWind/bgmchain"
+	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/common/hexutil"
+	"github.com/5sWind/bgmchain/consensus/dpos"
+	"github.com/5sWind/bgmchain/core/types"
+)
+
+// DPoS Access
+
+// ValidatorsAt returns the validators of the epoch of the given block. The
+// block number can be nil, in which case the latest known block is used.
+func (ec *Client) ValidatorsAt(ctx context.Context, blockNumber *big.Int) ([]common.Address, error) {
+	var result []common.Address
+	err := ec.c.CallContext(ctx, &result, "dpos_getValidators", toBlockNumArg(blockNumber))
+	return result, err
+}
+
+// CandidatesAt returns the registered candidates at the given block.
+func (ec *Client) CandidatesAt(ctx context.Context, blockNumber *big.Int) ([]common.Address, error) {
+	var result []common.Address
+	err := ec.c.CallContext(ctx, &result, "dpos_getCandidates", toBlockNumArg(blockNumber))
+	return result, err
+}
+
+// CandidateAt returns the deposit, commission and metadata of a candidate at
+// the given block, or nil if the address isn't a candidate.
+func (ec *Client) CandidateAt(ctx context.Context, candidate common.Address, blockNumber *big.Int) (*dpos.CandidateInfo, error) {
+	var result *dpos.CandidateInfo
+	err := ec.c.CallContext(ctx, &result, "dpos_getCandidate", candidate, toBlockNumArg(blockNumber))
+	return result, err
+}
+
+// CandidateInfosAt returns the deposit, commission and metadata of every
+// registered candidate at the given block.
+func (ec *Client) CandidateInfosAt(ctx context.Context, blockNumber *big.Int) ([]*dpos.CandidateInfo, error) {
+	var result []*dpos.CandidateInfo
+	err := ec.c.CallContext(ctx, &result, "dpos_getCandidateInfos", toBlockNumArg(blockNumber))
+	return result, err
+}
+
+// SignerAt returns the key sealing the blocks of a validator in the epoch of
+// the given block.
+func (ec *Client) SignerAt(ctx context.Context, validator common.Address, blockNumber *big.Int) (common.Address, error) {
+	var result common.Address
+	err := ec.c.CallContext(ctx, &result, "dpos_getSigner", validator, toBlockNumArg(blockNumber))
+	return result, err
+}
+
+// DelegatorsAt returns the delegators voting for a candidate at the given block.
+func (ec *Client) DelegatorsAt(ctx context.Context, candidate common.Address, blockNumber *big.Int) ([]common.Address, error) {
+	var result []common.Address
+	err := ec.c.CallContext(ctx, &result, "dpos_getDelegators", candidate, toBlockNumArg(blockNumber))
+	return result, err
+}
+
+// VoteAt returns the candidate a delegator votes for at the given block, or nil
+// if it doesn't vote.
+func (ec *Client) VoteAt(ctx context.Context, delegator common.Address, blockNumber *big.Int) (*common.Address, error) {
+	var result *common.Address
+	err := ec.c.CallContext(ctx, &result, "dpos_getVote", delegator, toBlockNumArg(blockNumber))
+	return result, err
+}
+
+// VoteWeightsAt returns the votes each candidate would receive in an election
+// held at the given block.
+func (ec *Client) VoteWeightsAt(ctx context.Context, blockNumber *big.Int) (map[common.Address]*big.Int, error) {
+	var result map[common.Address]*big.Int
+	err := ec.c.CallContext(ctx, &result, "dpos_getVoteWeights", toBlockNumArg(blockNumber))
+	return result, err
+}
+
+// MintCountAt returns the number of blocks a validator minted in an epoch, as
+// recorded at the given block.
+func (ec *Client) MintCountAt(ctx context.Context, epoch uint64, validator common.Address, blockNumber *big.Int) (uint64, error) {
+	var result uint64
+	err := ec.c.CallContext(ctx, &result, "dpos_getMintCount", epoch, validator, toBlockNumArg(blockNumber))
+	return result, err
+}
+
+// EpochAt returns the epoch the given block belongs to.
+func (ec *Client) EpochAt(ctx context.Context, blockNumber *big.Int) (uint64, error) {
+	var result uint64
+	err := ec.c.CallContext(ctx, &result, "dpos_getEpoch", toBlockNumArg(blockNumber))
+	return result, err
+}
+
+// ValidatorStatsAt returns, for each validator of the epoch of the given block,
+// the slots it was scheduled for up to that block and the blocks it minted.
+func (ec *Client) ValidatorStatsAt(ctx context.Context, blockNumber *big.Int) (map[common.Address]*dpos.ValidatorStat, error) {
+	var result map[common.Address]*dpos.ValidatorStat
+	err := ec.c.CallContext(ctx, &result, "dpos_getValidatorStats", toBlockNumArg(blockNumber))
+	return result, err
+}
+
+// ConfirmedBlockNumber returns the number of the latest irreversible block.
+func (ec *Client) ConfirmedBlockNumber(ctx context.Context) (*big.Int, error) {
+	var result *big.Int
+	err := ec.c.CallContext(ctx, &result, "dpos_getConfirmedBlockNumber")
+	return result, err
+}
+
+// SubscribeConfirmedHead subscribes to notifications about blocks becoming
+// irreversible.
+func (ec *Client) SubscribeConfirmedHead(ctx context.Context, ch chan<- *types.Header) (bgmchain.Subscription, error) {
+	return ec.c.BgmSubscribe(ctx, ch, "newConfirmedHeads")
+}
+
+// DPoS Transactions
+//
+// These are signed by the node with the key of the sending account, which must
+// be unlocked there. Use the helpers of accounts/abi/bind to sign locally.
+
+// BecomeCandidate registers from as a candidate, locking deposit. The
+// commission is the percentage of the block reward the candidate keeps for
+// itself, nil to keep all of it. The metadata describing the candidate is
+// optional.
+func (ec *Client) BecomeCandidate(ctx context.Context, from common.Address, deposit *big.Int, commission *uint64, meta *types.CandidateMeta) (common.Hash, error) {
+	var hash common.Hash
+	arg := map[string]interface{}{
+		"from":  from,
+		"value": (*hexutil.Big)(deposit),
+	}
+	err := ec.c.CallContext(ctx, &hash, "bgm_becomeCandidate", arg, (*hexutil.Uint64)(commission), meta)
+	return hash, err
+}
+
+// QuitCandidate removes from from the candidates.
+func (ec *Client) QuitCandidate(ctx context.Context, from common.Address) (common.Hash, error) {
+	var hash common.Hash
+	err := ec.c.CallContext(ctx, &hash, "bgm_quitCandidate", map[string]interface{}{"from": from})
+	return hash, err
+}
+
+// BindSigner binds the candidate from to the key sealing its blocks from the
+// next epoch on. Binding from itself removes the binding.
+func (ec *Client) BindSigner(ctx context.Context, from, signer common.Address) (common.Hash, error) {
+	var hash common.Hash
+	err := ec.c.CallContext(ctx, &hash, "bgm_bindSigner", map[string]interface{}{"from": from, "to": signer})
+	return hash, err
+}
+
+// Delegate votes for a candidate, locking amount as stake behind the vote.
+func (ec *Client) Delegate(ctx context.Context, from, candidate common.Address, amount *big.Int) (common.Hash, error) {
+	var hash common.Hash
+	arg := map[string]interface{}{
+		"from":  from,
+		"to":    candidate,
+		"value": (*hexutil.Big)(amount),
+	}
+	err := ec.c.CallContext(ctx, &hash, "bgm_delegate", arg)
+	return hash, err
+}
+
+// UnDelegate withdraws the vote of from for a candidate.
+func (ec *Client) UnDelegate(ctx context.Context, from, candidate common.Address) (common.Hash, error) {
+	var hash common.Hash
+	err := ec.c.CallContext(ctx, &hash, "bgm_unDelegate", map[string]interface{}{"from": from, "to": candidate})
+	return hash, err
+}
@@ -0,0 +1,375 @@
+// Copyright 2017 The bgmchain Authors
+// This file is part of the bgmchain library.
+//
+// The bgmchain library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The bgmchain library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the bgmchain library. If not, see <http://www.gnu.org/licenses/>.
+
+package bgmdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/log"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// boltFile is the name of the bolt database file inside the database directory.
+	boltFile = "bolt.db"
+
+	// boltIteratorChunk is the number of entries an iterator reads in one
+	// transaction. Read transactions are kept short, bolt can't grow its file
+	// while one is open.
+	boltIteratorChunk = 1024
+)
+
+var (
+	// boltBucket is the bucket holding all the entries of the database.
+	boltBucket = []byte("bgmdb")
+
+	errNotFound = errors.New("not found")
+)
+
+func init() {
+	RegisterEngine("bolt", func(dir string, cache int, handles int, readonly bool) (Database, error) {
+		db, err := NewBoltDatabase(dir, readonly)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	})
+}
+
+// BoltDatabase is a database stored in a single bolt file, a pure Go copy-on-write
+// B+tree. Every write is a transaction synced to disk, batches being the cheap
+// way to write many entries.
+type BoltDatabase struct {
+	fn string
+	db *bolt.DB
+
+	log log.Logger
+}
+
+// NewBoltDatabase opens the bolt database in dir, creating it if needed unless
+// readonly is set.
+func NewBoltDatabase(dir string, readonly bool) (*BoltDatabase, error) {
+	logger := log.New("database", dir)
+
+	if !readonly {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	file := filepath.Join(dir, boltFile)
+	if readonly {
+		// Bolt would create the missing file despite the read only flag
+		if _, err := os.Stat(file); err != nil {
+			return nil, err
+		}
+	}
+	db, err := bolt.Open(file, 0644, &bolt.Options{
+		Timeout:      time.Second, // Fail if another process holds the database
+		ReadOnly:     readonly,
+		FreelistType: bolt.FreelistMapType,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !readonly {
+		err = db.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(boltBucket)
+			return err
+		})
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	logger.Info("Opened bolt database", "readonly", readonly)
+	return &BoltDatabase{fn: dir, db: db, log: logger}, nil
+}
+
+// boltKey returns the key an entry is stored under. Bolt refuses empty keys, so
+// all of them are stored behind a zero byte.
+func boltKey(key []byte) []byte {
+	return append([]byte{0}, key...)
+}
+
+// Path returns the directory of the database.
+func (db *BoltDatabase) Path() string {
+	return db.fn
+}
+
+// Put stores an entry in the database.
+func (db *BoltDatabase) Put(key []byte, value []byte) error {
+	return db.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put(boltKey(key), value)
+	})
+}
+
+// Has reports whether the database holds an entry.
+func (db *BoltDatabase) Has(key []byte) (bool, error) {
+	var has bool
+	err := db.db.View(func(tx *bolt.Tx) error {
+		has = tx.Bucket(boltBucket).Get(boltKey(key)) != nil
+		return nil
+	})
+	return has, err
+}
+
+// Get returns the value of an entry.
+func (db *BoltDatabase) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := db.db.View(func(tx *bolt.Tx) error {
+		// Values are only valid for the lifetime of the transaction
+		value = common.CopyBytes(tx.Bucket(boltBucket).Get(boltKey(key)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, errNotFound
+	}
+	return value, nil
+}
+
+// Delete removes an entry from the database.
+func (db *BoltDatabase) Delete(key []byte) error {
+	return db.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete(boltKey(key))
+	})
+}
+
+// NewIteratorWithPrefix iterates over the entries whose key starts with prefix.
+// The iterator doesn't see a snapshot of the database, the writes made while
+// iterating may or may not be returned.
+func (db *BoltDatabase) NewIteratorWithPrefix(prefix []byte) Iterator {
+	r := util.BytesPrefix(prefix)
+	return db.NewIteratorWithRange(r.Start, r.Limit)
+}
+
+// NewIteratorWithRange iterates over the entries whose key is in the range
+// [start, limit), with the same consistency as NewIteratorWithPrefix.
+func (db *BoltDatabase) NewIteratorWithRange(start, limit []byte) Iterator {
+	it := &boltIterator{db: db.db, next: boltKey(start), pos: -1}
+	if limit != nil {
+		it.limit = boltKey(limit)
+	}
+	return it
+}
+
+// DeleteRange deletes the entries whose key is in the range [start, limit),
+// deleteRangeBatchLen of them per transaction.
+func (db *BoltDatabase) DeleteRange(start, limit []byte) error {
+	from := boltKey(start)
+	var to []byte
+	if limit != nil {
+		to = boltKey(limit)
+	}
+	for {
+		var done bool
+		err := db.db.Update(func(tx *bolt.Tx) error {
+			var (
+				bucket = tx.Bucket(boltBucket)
+				c      = bucket.Cursor()
+				keys   [][]byte
+			)
+			// Deleting through a moving cursor skips entries, collect the keys first
+			k, _ := c.Seek(from)
+			for ; k != nil && len(keys) < deleteRangeBatchLen; k, _ = c.Next() {
+				if to != nil && bytes.Compare(k, to) >= 0 {
+					break
+				}
+				keys = append(keys, common.CopyBytes(k))
+			}
+			done = len(keys) < deleteRangeBatchLen
+			for _, key := range keys {
+				if err := bucket.Delete(key); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// Stat returns a statistic of the database, "bolt.stats" being the only one.
+func (db *BoltDatabase) Stat(property string) (string, error) {
+	if property != "bolt.stats" {
+		return "", errors.New("unknown property")
+	}
+	var stats bolt.BucketStats
+	err := db.db.View(func(tx *bolt.Tx) error {
+		stats = tx.Bucket(boltBucket).Stats()
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	dbStats := db.db.Stats()
+	return fmt.Sprintf("Keys: %d, depth: %d\nBranch pages: %d (%v in use)\nLeaf pages: %d (%v in use)\nFree pages: %d, pending: %d (%v)\n",
+		stats.KeyN, stats.Depth,
+		stats.BranchPageN, common.StorageSize(stats.BranchInuse),
+		stats.LeafPageN, common.StorageSize(stats.LeafInuse),
+		dbStats.FreePageN, dbStats.PendingPageN, common.StorageSize(dbStats.FreeAlloc)), nil
+}
+
+// Compact does nothing, bolt reuses the pages freed by deletions but never
+// shrinks its file in place.
+func (db *BoltDatabase) Compact(start, limit []byte) error {
+	return nil
+}
+
+// Close closes the database file.
+func (db *BoltDatabase) Close() {
+	if err := db.db.Close(); err != nil {
+		db.log.Error("Failed to close database", "err", err)
+		return
+	}
+	db.log.Info("Database closed")
+}
+
+// NewBatch creates a batch writing its entries in a single transaction.
+func (db *BoltDatabase) NewBatch() Batch {
+	return &boltBatch{db: db.db}
+}
+
+// boltIterator iterates over a range of a bolt database, reading it by chunks of
+// boltIteratorChunk entries.
+type boltIterator struct {
+	db    *bolt.DB
+	next  []byte // Stored key to resume the iteration from
+	limit []byte // Stored key ending the iteration, nil for the last one
+
+	keys   [][]byte
+	values [][]byte
+	pos    int
+	done   bool // Whether the last chunk was read
+	err    error
+}
+
+// Next moves the iterator to the next entry, reading the next chunk if needed.
+func (it *boltIterator) Next() bool {
+	if it.pos+1 < len(it.keys) {
+		it.pos++
+		return true
+	}
+	if it.done || it.err != nil {
+		it.pos = len(it.keys)
+		return false
+	}
+	it.keys, it.values, it.pos = it.keys[:0], it.values[:0], 0
+	it.err = it.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltBucket).Cursor()
+
+		k, v := c.Seek(it.next)
+		for ; k != nil && len(it.keys) < boltIteratorChunk; k, v = c.Next() {
+			if it.limit != nil && bytes.Compare(k, it.limit) >= 0 {
+				break
+			}
+			it.keys = append(it.keys, common.CopyBytes(k[1:]))
+			it.values = append(it.values, common.CopyBytes(v))
+		}
+		it.done = len(it.keys) < boltIteratorChunk
+		return nil
+	})
+	if it.err != nil || len(it.keys) == 0 {
+		it.done = true
+		return false
+	}
+	// The next chunk starts right after the last key read
+	it.next = append(boltKey(it.keys[len(it.keys)-1]), 0)
+	return true
+}
+
+// Error returns the error hit while reading the database, if any.
+func (it *boltIterator) Error() error {
+	return it.err
+}
+
+// Key returns the key of the current entry.
+func (it *boltIterator) Key() []byte {
+	if it.pos < 0 || it.pos >= len(it.keys) {
+		return nil
+	}
+	return it.keys[it.pos]
+}
+
+// Value returns the value of the current entry.
+func (it *boltIterator) Value() []byte {
+	if it.pos < 0 || it.pos >= len(it.values) {
+		return nil
+	}
+	return it.values[it.pos]
+}
+
+// Release drops the entries read.
+func (it *boltIterator) Release() {
+	it.keys, it.values, it.done = nil, nil, true
+}
+
+type boltBatch struct {
+	db     *bolt.DB
+	writes []kv
+	size   int
+}
+
+func (b *boltBatch) Put(key, value []byte) error {
+	b.writes = append(b.writes, kv{common.CopyBytes(key), common.CopyBytes(value), false})
+	b.size += len(value)
+	return nil
+}
+
+func (b *boltBatch) Delete(key []byte) error {
+	b.writes = append(b.writes, kv{common.CopyBytes(key), nil, true})
+	b.size += len(key)
+	return nil
+}
+
+func (b *boltBatch) Write() error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		for _, kv := range b.writes {
+			var err error
+			if kv.del {
+				err = bucket.Delete(boltKey(kv.k))
+			} else {
+				err = bucket.Put(boltKey(kv.k), kv.v)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltBatch) ValueSize() int {
+	return b.size
+}
+
+func (b *boltBatch) Reset() {
+	b.writes = b.writes[:0]
+	b.size = 0
+}
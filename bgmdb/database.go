@@ -29,12 +29,16 @@ import (
 	"github.com/syndtr/goleveldb/leveldb/filter"
 	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 
 	gometrics "github.com/rcrowley/go-metrics"
 )
 
 var OpenFileLimit = 64
 
+// deleteRangeBatchLen is the number of deletions written at once by DeleteRange.
+const deleteRangeBatchLen = 10000
+
 type LDBDatabase struct {
 	fn string      //
 	db *leveldb.DB //
@@ -55,8 +59,28 @@ type LDBDatabase struct {
 	log log.Logger //
 }
 
+func init() {
+	RegisterEngine("leveldb", func(dir string, cache int, handles int, readonly bool) (Database, error) {
+		db, err := newLDBDatabase(dir, cache, handles, readonly)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	})
+}
+
 //
 func NewLDBDatabase(file string, cache int, handles int) (*LDBDatabase, error) {
+	return newLDBDatabase(file, cache, handles, false)
+}
+
+// NewReadOnlyLDBDatabase opens an existing leveldb database for inspection,
+// refusing any write to it. Corrupted databases are not recovered.
+func NewReadOnlyLDBDatabase(file string, cache int, handles int) (*LDBDatabase, error) {
+	return newLDBDatabase(file, cache, handles, true)
+}
+
+func newLDBDatabase(file string, cache int, handles int, readonly bool) (*LDBDatabase, error) {
 	logger := log.New("database", file)
 
 //
@@ -74,8 +98,10 @@ func NewLDBDatabase(file string, cache int, handles int) (*LDBDatabase, error) {
 		BlockCacheCapacity:     cache / 2 * opt.MiB,
 		WriteBuffer:            cache / 4 * opt.MiB, //
 		Filter:                 filter.NewBloomFilter(10),
+		ErrorIfMissing:         readonly,
+		ReadOnly:               readonly,
 	})
-	if _, corrupted := err.(*errors.ErrCorrupted); corrupted {
+	if _, corrupted := err.(*errors.ErrCorrupted); corrupted && !readonly {
 		db, err = leveldb.RecoverFile(file, nil)
 	}
 //
@@ -149,6 +175,50 @@ func (db *LDBDatabase) NewIterator() iterator.Iterator {
 	return db.db.NewIterator(nil, nil)
 }
 
+// NewIteratorWithPrefix iterates over the entries whose key starts with prefix.
+func (db *LDBDatabase) NewIteratorWithPrefix(prefix []byte) Iterator {
+	return db.db.NewIterator(util.BytesPrefix(prefix), nil)
+}
+
+// NewIteratorWithRange iterates over the entries whose key is in [start, limit).
+func (db *LDBDatabase) NewIteratorWithRange(start, limit []byte) Iterator {
+	return db.db.NewIterator(&util.Range{Start: start, Limit: limit}, nil)
+}
+
+// DeleteRange deletes the entries whose key is in [start, limit), in batches.
+func (db *LDBDatabase) DeleteRange(start, limit []byte) error {
+	if db.delTimer != nil {
+		defer db.delTimer.UpdateSince(time.Now())
+	}
+	it := db.db.NewIterator(&util.Range{Start: start, Limit: limit}, nil)
+	defer it.Release()
+
+	batch := new(leveldb.Batch)
+	for it.Next() {
+		batch.Delete(it.Key())
+		if batch.Len() >= deleteRangeBatchLen {
+			if err := db.db.Write(batch, nil); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return db.db.Write(batch, nil)
+}
+
+// Stat returns a leveldb property, like "leveldb.stats".
+func (db *LDBDatabase) Stat(property string) (string, error) {
+	return db.db.GetProperty(property)
+}
+
+// Compact compacts the leveldb storage of the keys in [start, limit).
+func (db *LDBDatabase) Compact(start, limit []byte) error {
+	return db.db.CompactRange(util.Range{Start: start, Limit: limit})
+}
+
 func (db *LDBDatabase) Close() {
 //
 	db.quitLock.Lock()
@@ -291,6 +361,12 @@ func (b *ldbBatch) Put(key, value []byte) error {
 	return nil
 }
 
+func (b *ldbBatch) Delete(key []byte) error {
+	b.b.Delete(key)
+	b.size += len(key)
+	return nil
+}
+
 func (b *ldbBatch) Write() error {
 	return b.db.Write(b.b, nil)
 }
@@ -299,6 +375,11 @@ func (b *ldbBatch) ValueSize() int {
 	return b.size
 }
 
+func (b *ldbBatch) Reset() {
+	b.b.Reset()
+	b.size = 0
+}
+
 type table struct {
 	db     Database
 	prefix string
@@ -329,10 +410,57 @@ func (dt *table) Delete(key []byte) error {
 	return dt.db.Delete(append([]byte(dt.prefix), key...))
 }
 
+func (dt *table) NewIteratorWithPrefix(prefix []byte) Iterator {
+	return &tableIterator{dt.db.NewIteratorWithPrefix(append([]byte(dt.prefix), prefix...)), len(dt.prefix)}
+}
+
+func (dt *table) NewIteratorWithRange(start, limit []byte) Iterator {
+	start, limit = dt.keyRange(start, limit)
+	return &tableIterator{dt.db.NewIteratorWithRange(start, limit), len(dt.prefix)}
+}
+
+func (dt *table) DeleteRange(start, limit []byte) error {
+	return dt.db.DeleteRange(dt.keyRange(start, limit))
+}
+
+func (dt *table) Stat(property string) (string, error) {
+	return dt.db.Stat(property)
+}
+
+func (dt *table) Compact(start, limit []byte) error {
+	return dt.db.Compact(dt.keyRange(start, limit))
+}
+
+// keyRange maps a range of keys of the table to the range of the underlying
+// database, open bounds being the bounds of the table prefix.
+func (dt *table) keyRange(start, limit []byte) ([]byte, []byte) {
+	bounds := util.BytesPrefix([]byte(dt.prefix))
+	if start != nil {
+		bounds.Start = append([]byte(dt.prefix), start...)
+	}
+	if limit != nil {
+		bounds.Limit = append([]byte(dt.prefix), limit...)
+	}
+	return bounds.Start, bounds.Limit
+}
+
 func (dt *table) Close() {
 //
 }
 
+// tableIterator strips the table prefix from the keys of an iterator.
+type tableIterator struct {
+	Iterator
+	prefix int
+}
+
+func (it *tableIterator) Key() []byte {
+	if key := it.Iterator.Key(); key != nil {
+		return key[it.prefix:]
+	}
+	return nil
+}
+
 type tableBatch struct {
 	batch  Batch
 	prefix string
@@ -351,6 +479,10 @@ func (tb *tableBatch) Put(key, value []byte) error {
 	return tb.batch.Put(append([]byte(tb.prefix), key...), value)
 }
 
+func (tb *tableBatch) Delete(key []byte) error {
+	return tb.batch.Delete(append([]byte(tb.prefix), key...))
+}
+
 func (tb *tableBatch) Write() error {
 	return tb.batch.Write()
 }
@@ -358,3 +490,7 @@ func (tb *tableBatch) Write() error {
 func (tb *tableBatch) ValueSize() int {
 	return tb.batch.ValueSize()
 }
+
+func (tb *tableBatch) Reset() {
+	tb.batch.Reset()
+}
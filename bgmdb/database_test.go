@@ -44,6 +44,22 @@ func newTestLDB() (*bgmdb.LDBDatabase, func()) {
 	}
 }
 
+func newTestBoltDB() (*bgmdb.BoltDatabase, func()) {
+	dirname, err := ioutil.TempDir(os.TempDir(), "bgmdb_test_")
+	if err != nil {
+		panic("failed to create test file: " + err.Error())
+	}
+	db, err := bgmdb.NewBoltDatabase(dirname, false)
+	if err != nil {
+		panic("failed to create test database: " + err.Error())
+	}
+
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dirname)
+	}
+}
+
 var test_values = []string{"", "a", "1251", "\x00123\x00"}
 
 func TestLDB_PutGet(t *testing.T) {
@@ -52,6 +68,12 @@ func TestLDB_PutGet(t *testing.T) {
 	testPutGet(db, t)
 }
 
+func TestBoltDB_PutGet(t *testing.T) {
+	db, remove := newTestBoltDB()
+	defer remove()
+	testPutGet(db, t)
+}
+
 func TestMemoryDB_PutGet(t *testing.T) {
 	db, _ := bgmdb.NewMemDatabase()
 	testPutGet(db, t)
@@ -130,6 +152,12 @@ func TestLDB_ParallelPutGet(t *testing.T) {
 	testParallelPutGet(db, t)
 }
 
+func TestBoltDB_ParallelPutGet(t *testing.T) {
+	db, remove := newTestBoltDB()
+	defer remove()
+	testParallelPutGet(db, t)
+}
+
 func TestMemoryDB_ParallelPutGet(t *testing.T) {
 	db, _ := bgmdb.NewMemDatabase()
 	testParallelPutGet(db, t)
@@ -190,3 +218,121 @@ func testParallelPutGet(db bgmdb.Database, t *testing.T) {
 	}
 	pending.Wait()
 }
+
+func TestLDB_IterateDeleteRange(t *testing.T) {
+	db, remove := newTestLDB()
+	defer remove()
+	testIterateDeleteRange(db, t)
+}
+
+func TestBoltDB_IterateDeleteRange(t *testing.T) {
+	db, remove := newTestBoltDB()
+	defer remove()
+	testIterateDeleteRange(db, t)
+}
+
+func TestMemoryDB_IterateDeleteRange(t *testing.T) {
+	db, _ := bgmdb.NewMemDatabase()
+	testIterateDeleteRange(db, t)
+}
+
+func TestTable_IterateDeleteRange(t *testing.T) {
+	db, _ := bgmdb.NewMemDatabase()
+	// Entries around the table must not be reached through it
+	db.Put([]byte("s"), []byte("before"))
+	db.Put([]byte("u"), []byte("after"))
+	testIterateDeleteRange(bgmdb.NewTable(db, "t"), t)
+
+	if _, err := db.Get([]byte("s")); err != nil {
+		t.Errorf("entry before the table deleted")
+	}
+	if _, err := db.Get([]byte("u")); err != nil {
+		t.Errorf("entry after the table deleted")
+	}
+}
+
+// Tests that bolt iterators carry on across the chunks they read the database by.
+func TestBoltDB_IterateChunks(t *testing.T) {
+	db, remove := newTestBoltDB()
+	defer remove()
+
+	batch := db.NewBatch()
+	for i := 0; i < 2500; i++ {
+		key := fmt.Sprintf("%05d", i)
+		batch.Put([]byte(key), []byte("v"+key))
+	}
+	if err := batch.Write(); err != nil {
+		t.Fatalf("batch write failed: %v", err)
+	}
+	keys := collect(t, db.NewIteratorWithRange([]byte("00100"), []byte("02300")))
+	if len(keys) != 2200 {
+		t.Fatalf("iterated keys mismatch: have %d, want %d", len(keys), 2200)
+	}
+	for i, key := range keys {
+		if want := fmt.Sprintf("%05d", i+100); key != want {
+			t.Fatalf("key %d mismatch: have %s, want %s", i, key, want)
+		}
+	}
+}
+
+// collect returns the keys yielded by an iterator, checking the values.
+func collect(t *testing.T, it bgmdb.Iterator) []string {
+	defer it.Release()
+
+	var keys []string
+	for it.Next() {
+		if !bytes.Equal(it.Value(), append([]byte("v"), it.Key()...)) {
+			t.Fatalf("value mismatch for %q: %q", it.Key(), it.Value())
+		}
+		keys = append(keys, string(it.Key()))
+	}
+	if err := it.Error(); err != nil {
+		t.Fatalf("iteration failed: %v", err)
+	}
+	return keys
+}
+
+func testIterateDeleteRange(db bgmdb.Database, t *testing.T) {
+	for _, key := range []string{"a1", "a2", "a3", "b1", "b2", "c"} {
+		if err := db.Put([]byte(key), []byte("v"+key)); err != nil {
+			t.Fatalf("put failed: %v", err)
+		}
+	}
+	tests := []struct {
+		it   bgmdb.Iterator
+		want []string
+	}{
+		{db.NewIteratorWithPrefix(nil), []string{"a1", "a2", "a3", "b1", "b2", "c"}},
+		{db.NewIteratorWithPrefix([]byte("a")), []string{"a1", "a2", "a3"}},
+		{db.NewIteratorWithPrefix([]byte("d")), nil},
+		{db.NewIteratorWithRange([]byte("a2"), []byte("b2")), []string{"a2", "a3", "b1"}},
+		{db.NewIteratorWithRange([]byte("b"), nil), []string{"b1", "b2", "c"}},
+		{db.NewIteratorWithRange(nil, []byte("a2")), []string{"a1"}},
+	}
+	for i, tt := range tests {
+		if have := collect(t, tt.it); fmt.Sprint(have) != fmt.Sprint(tt.want) {
+			t.Errorf("test %d: keys mismatch: have %v, want %v", i, have, tt.want)
+		}
+	}
+	if err := db.DeleteRange([]byte("a2"), []byte("b2")); err != nil {
+		t.Fatalf("range delete failed: %v", err)
+	}
+	if have, want := collect(t, db.NewIteratorWithPrefix(nil)), []string{"a1", "b2", "c"}; fmt.Sprint(have) != fmt.Sprint(want) {
+		t.Errorf("keys mismatch after range delete: have %v, want %v", have, want)
+	}
+	batch := db.NewBatch()
+	batch.Delete([]byte("a1"))
+	batch.Put([]byte("d"), []byte("vd"))
+	if err := batch.Write(); err != nil {
+		t.Fatalf("batch write failed: %v", err)
+	}
+	if err := db.DeleteRange([]byte("c"), nil); err != nil {
+		t.Fatalf("open range delete failed: %v", err)
+	}
+	if have, want := collect(t, db.NewIteratorWithPrefix(nil)), []string{"b2"}; fmt.Sprint(have) != fmt.Sprint(want) {
+		t.Errorf("keys mismatch after batch and open range delete: have %v, want %v", have, want)
+	}
+	if err := db.Compact(nil, nil); err != nil {
+		t.Errorf("compaction failed: %v", err)
+	}
+}
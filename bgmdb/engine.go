@@ -0,0 +1,131 @@
+// Copyright 2017 The bgmchain Authors
+// This file is part of the bgmchain library.
+//
+// The bgmchain library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The bgmchain library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the bgmchain library. If not, see <http://www.gnu.org/licenses/>.
+
+package bgmdb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultEngine is the storage engine of the new databases when none is chosen.
+const DefaultEngine = "leveldb"
+
+// engineFile is the file recording the storage engine inside a database directory.
+const engineFile = "ENGINE"
+
+// Opener opens the database of a storage engine in dir, creating it if needed
+// unless readonly is set. The cache size in megabytes and the number of file
+// handles are hints the engine may ignore.
+type Opener func(dir string, cache int, handles int, readonly bool) (Database, error)
+
+var (
+	enginesLock sync.RWMutex
+	engines     = make(map[string]Opener)
+)
+
+// RegisterEngine makes a storage engine available under the given name. It
+// panics if the name is taken already.
+func RegisterEngine(name string, open Opener) {
+	enginesLock.Lock()
+	defer enginesLock.Unlock()
+
+	if _, ok := engines[name]; ok {
+		panic(fmt.Sprintf("database engine %q registered twice", name))
+	}
+	engines[name] = open
+}
+
+// Engines returns the names of the registered storage engines, sorted.
+func Engines() []string {
+	enginesLock.RLock()
+	defer enginesLock.RUnlock()
+
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReadEngine returns the storage engine of the database in dir, or an empty
+// string if there is no database there. The databases created before engines
+// were recorded are leveldb ones.
+func ReadEngine(dir string) (string, error) {
+	blob, err := ioutil.ReadFile(filepath.Join(dir, engineFile))
+	switch {
+	case err == nil:
+		return strings.TrimSpace(string(blob)), nil
+	case !os.IsNotExist(err):
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(dir, "CURRENT")); err == nil {
+		return "leveldb", nil
+	}
+	return "", nil
+}
+
+// OpenDatabase opens the database in dir with the given storage engine, creating
+// it if needed, and records the engine in dir. An existing database created by
+// another engine is refused. With an empty engine, an existing database is opened
+// with its own engine and a new one is created with DefaultEngine.
+func OpenDatabase(engine string, dir string, cache int, handles int) (Database, error) {
+	return openDatabase(engine, dir, cache, handles, false)
+}
+
+// OpenReadOnlyDatabase opens the existing database in dir for inspection,
+// refusing any write to it. The engine is chosen like in OpenDatabase.
+func OpenReadOnlyDatabase(engine string, dir string, cache int, handles int) (Database, error) {
+	return openDatabase(engine, dir, cache, handles, true)
+}
+
+func openDatabase(engine string, dir string, cache int, handles int, readonly bool) (Database, error) {
+	recorded, err := ReadEngine(dir)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case engine == "" && recorded != "":
+		engine = recorded
+	case engine == "":
+		engine = DefaultEngine
+	case recorded != "" && recorded != engine:
+		return nil, fmt.Errorf("database %s was created by the %s engine, not %s", dir, recorded, engine)
+	}
+	enginesLock.RLock()
+	open, ok := engines[engine]
+	enginesLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown database engine %q (available: %s)", engine, strings.Join(Engines(), ", "))
+	}
+	db, err := open(dir, cache, handles, readonly)
+	if err != nil {
+		return nil, err
+	}
+	if !readonly {
+		if err := ioutil.WriteFile(filepath.Join(dir, engineFile), []byte(engine+"\n"), 0644); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return db, nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2017 The bgmchain Authors
+// This file is part of the bgmchain library.
+//
+// The bgmchain library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The bgmchain library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the bgmchain library. If not, see <http://www.gnu.org/licenses/>.
+
+package bgmdb_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/5sWind/bgmchain/bgmdb"
+)
+
+// Tests that the engine of a database is recorded, and that the database is
+// refused to any other engine.
+func TestOpenDatabaseEngine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bgmdb_engine_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, engine := range bgmdb.Engines() {
+		path := filepath.Join(dir, engine)
+		db, err := bgmdb.OpenDatabase(engine, path, 0, 0)
+		if err != nil {
+			t.Fatalf("%s: failed to create database: %v", engine, err)
+		}
+		db.Put([]byte("key"), []byte("value"))
+		db.Close()
+
+		if recorded, err := bgmdb.ReadEngine(path); err != nil || recorded != engine {
+			t.Fatalf("%s: recorded engine mismatch: have %q, %v", engine, recorded, err)
+		}
+		for _, other := range bgmdb.Engines() {
+			if other == engine {
+				continue
+			}
+			if db, err := bgmdb.OpenDatabase(other, path, 0, 0); err == nil {
+				db.Close()
+				t.Errorf("%s: database opened by the %s engine", engine, other)
+			}
+		}
+		// Without an engine given, the recorded one is used
+		db, err = bgmdb.OpenReadOnlyDatabase("", path, 0, 0)
+		if err != nil {
+			t.Fatalf("%s: failed to reopen database: %v", engine, err)
+		}
+		if value, err := db.Get([]byte("key")); err != nil || string(value) != "value" {
+			t.Errorf("%s: value mismatch: have %q, %v", engine, value, err)
+		}
+		db.Close()
+	}
+}
+
+// Tests that the leveldb databases created before engines were recorded are
+// recognised.
+func TestReadEngineUnrecorded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bgmdb_engine_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if engine, err := bgmdb.ReadEngine(dir); err != nil || engine != "" {
+		t.Fatalf("empty directory engine mismatch: have %q, %v", engine, err)
+	}
+	db, err := bgmdb.NewLDBDatabase(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	db.Close()
+
+	if engine, err := bgmdb.ReadEngine(dir); err != nil || engine != "leveldb" {
+		t.Fatalf("unrecorded database engine mismatch: have %q, %v", engine, err)
+	}
+	if db, err := bgmdb.OpenDatabase("bolt", dir, 0, 0); err == nil {
+		db.Close()
+		t.Errorf("unrecorded leveldb database opened by bolt")
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2017 The bgmchain Authors
+// This file is part of the bgmchain library.
+//
+// The bgmchain library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The bgmchain library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the bgmchain library. If not, see <http://www.gnu.org/licenses/>.
+
+package bgmdb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/5sWind/bgmchain/log"
+)
+
+// Tables of the ancient block store, each holding an item per block.
+const (
+	FreezerHashTable       = "hashes"   // Canonical block hashes
+	FreezerHeaderTable     = "headers"  // Block headers
+	FreezerBodiesTable     = "bodies"   // Block bodies
+	FreezerReceiptTable    = "receipts" // Block receipts
+	FreezerDifficultyTable = "diffs"    // Total difficulties
+)
+
+// freezerTables lists the tables of the ancient store, along with whether their
+// items are compressed. Hashes and difficulties are too small to gain anything.
+var freezerTables = map[string]bool{
+	FreezerHashTable:       false,
+	FreezerHeaderTable:     true,
+	FreezerBodiesTable:     true,
+	FreezerReceiptTable:    true,
+	FreezerDifficultyTable: false,
+}
+
+var errReadOnly = errors.New("read only freezer")
+
+// Freezer is an append-only flat file store of the canonical blocks the chain
+// can't reorganise anymore, taking them off the key-value store. It holds the
+// blocks from the genesis up to the last one frozen, without gaps.
+type Freezer struct {
+	frozen   uint64 // Number of blocks frozen, accessed atomically
+	readonly bool
+
+	tables map[string]*freezerTable
+}
+
+// NewFreezer opens the ancient store in dir, creating it if needed. Blocks only
+// partially written to it by a crash are dropped.
+func NewFreezer(dir string, readonly bool) (*Freezer, error) {
+	if !readonly {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	freezer := &Freezer{
+		readonly: readonly,
+		tables:   make(map[string]*freezerTable),
+	}
+	for name, compress := range freezerTables {
+		table, err := newFreezerTable(dir, name, compress, readonly)
+		if err != nil {
+			freezer.Close()
+			return nil, err
+		}
+		freezer.tables[name] = table
+	}
+	// Blocks are complete only once in all the tables
+	frozen := ^uint64(0)
+	for _, table := range freezer.tables {
+		if items := table.Items(); items < frozen {
+			frozen = items
+		}
+	}
+	if !readonly {
+		if err := freezer.truncate(frozen); err != nil {
+			freezer.Close()
+			return nil, err
+		}
+	}
+	freezer.frozen = frozen
+
+	log.Info("Opened ancient block store", "dir", dir, "blocks", frozen, "readonly", readonly)
+	return freezer, nil
+}
+
+// Ancient retrieves an item of a frozen block from one of the tables.
+func (f *Freezer) Ancient(kind string, number uint64) ([]byte, error) {
+	table, ok := f.tables[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown ancient table %q", kind)
+	}
+	if number >= atomic.LoadUint64(&f.frozen) {
+		return nil, errOutOfBounds
+	}
+	return table.Retrieve(number)
+}
+
+// Ancients returns the number of blocks frozen, which is also the number of the
+// next block to freeze.
+func (f *Freezer) Ancients() uint64 {
+	return atomic.LoadUint64(&f.frozen)
+}
+
+// AppendAncient freezes the next block. If any table fails to store it, the
+// block is dropped from all of them.
+func (f *Freezer) AppendAncient(number uint64, hash, header, body, receipts, td []byte) error {
+	if f.readonly {
+		return errReadOnly
+	}
+	if frozen := atomic.LoadUint64(&f.frozen); number != frozen {
+		return fmt.Errorf("freezing block %d out of order, next is %d", number, frozen)
+	}
+	items := map[string][]byte{
+		FreezerHashTable:       hash,
+		FreezerHeaderTable:     header,
+		FreezerBodiesTable:     body,
+		FreezerReceiptTable:    receipts,
+		FreezerDifficultyTable: td,
+	}
+	for name, item := range items {
+		if err := f.tables[name].Append(number, item); err != nil {
+			if rerr := f.truncate(number); rerr != nil {
+				log.Error("Failed to roll back ancient block", "number", number, "err", rerr)
+			}
+			return fmt.Errorf("freezer table %s: %v", name, err)
+		}
+	}
+	atomic.StoreUint64(&f.frozen, number+1)
+	return nil
+}
+
+// TruncateAncients drops the frozen blocks from the given number onwards.
+func (f *Freezer) TruncateAncients(items uint64) error {
+	if f.readonly {
+		return errReadOnly
+	}
+	if atomic.LoadUint64(&f.frozen) <= items {
+		return nil
+	}
+	if err := f.truncate(items); err != nil {
+		return err
+	}
+	atomic.StoreUint64(&f.frozen, items)
+	return nil
+}
+
+// truncate drops the items from the given one onwards in all the tables.
+func (f *Freezer) truncate(items uint64) error {
+	for _, table := range f.tables {
+		if err := table.truncate(items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncAncients flushes the frozen blocks to disk.
+func (f *Freezer) SyncAncients() error {
+	for _, table := range f.tables {
+		if err := table.Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the files of the ancient store.
+func (f *Freezer) Close() error {
+	var errs []error
+	for _, table := range f.tables {
+		if err := table.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+// freezerDatabase is a key-value store with the ancient blocks of the chain
+// held in a freezer on the side.
+type freezerDatabase struct {
+	Database
+	*Freezer
+}
+
+// NewDatabaseWithFreezer attaches the ancient store in dir to a key-value store.
+// The returned database implements AncientStore, the chain data accessors read
+// the frozen blocks from it.
+func NewDatabaseWithFreezer(db Database, dir string, readonly bool) (Database, error) {
+	freezer, err := NewFreezer(dir, readonly)
+	if err != nil {
+		return nil, err
+	}
+	return &freezerDatabase{Database: db, Freezer: freezer}, nil
+}
+
+// Close closes both the ancient and the key-value store.
+func (db *freezerDatabase) Close() {
+	if err := db.Freezer.Close(); err != nil {
+		log.Error("Failed to close ancient block store", "err", err)
+	}
+	db.Database.Close()
+}
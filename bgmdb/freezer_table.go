@@ -0,0 +1,253 @@
+// Copyright 2017 The bgmchain Authors
+// This file is part of the bgmchain library.
+//
+// The bgmchain library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The bgmchain library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the bgmchain library. If not, see <http://www.gnu.org/licenses/>.
+
+package bgmdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/golang/snappy"
+)
+
+var (
+	// errOutOfBounds is returned when retrieving an item not in the table.
+	errOutOfBounds = errors.New("out of bounds")
+
+	// errOutOfOrder is returned when appending an item other than the next one.
+	errOutOfOrder = errors.New("out of order insertion")
+)
+
+// indexEntrySize is the size of an index entry, the end offset of an item in
+// the data file.
+const indexEntrySize = 8
+
+// freezerTable is an append-only table of items numbered from zero. Items are
+// stored one after the other in a data file, and the end offset of each of them
+// in an index file.
+type freezerTable struct {
+	name     string
+	compress bool // Whether items are snappy compressed
+	readonly bool
+
+	data  *os.File
+	index *os.File
+
+	items uint64 // Number of items stored
+	size  uint64 // Size of the data file, the end of the last item
+
+	lock sync.RWMutex
+}
+
+// newFreezerTable opens the table of the given name in dir, creating it if
+// needed. The files of a writable table are repaired after a crash, dropping
+// any item only partially written.
+func newFreezerTable(dir, name string, compress, readonly bool) (*freezerTable, error) {
+	flag := os.O_RDWR | os.O_CREATE
+	if readonly {
+		flag = os.O_RDONLY
+	}
+	ext := ".rdat"
+	if compress {
+		ext = ".cdat"
+	}
+	data, err := os.OpenFile(filepath.Join(dir, name+ext), flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	index, err := os.OpenFile(filepath.Join(dir, name+".ridx"), flag, 0644)
+	if err != nil {
+		data.Close()
+		return nil, err
+	}
+	t := &freezerTable{
+		name:     name,
+		compress: compress,
+		readonly: readonly,
+		data:     data,
+		index:    index,
+	}
+	if err := t.repair(); err != nil {
+		t.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// repair counts the items fully written, and truncates the files of a writable
+// table to them.
+func (t *freezerTable) repair() error {
+	stat, err := t.index.Stat()
+	if err != nil {
+		return err
+	}
+	items := uint64(stat.Size()) / indexEntrySize
+
+	if stat, err = t.data.Stat(); err != nil {
+		return err
+	}
+	size := uint64(stat.Size())
+
+	// Drop the items whose data didn't make it to disk
+	var end uint64
+	for ; items > 0; items-- {
+		if end, err = t.offset(items - 1); err != nil {
+			return err
+		}
+		if end <= size {
+			break
+		}
+	}
+	if items == 0 {
+		end = 0
+	}
+	t.items, t.size = items, end
+
+	if t.readonly {
+		return nil
+	}
+	if err := t.index.Truncate(int64(items * indexEntrySize)); err != nil {
+		return err
+	}
+	return t.data.Truncate(int64(end))
+}
+
+// offset returns the end offset of an item in the data file.
+func (t *freezerTable) offset(item uint64) (uint64, error) {
+	var entry [indexEntrySize]byte
+	if _, err := t.index.ReadAt(entry[:], int64(item*indexEntrySize)); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(entry[:]), nil
+}
+
+// Items returns the number of items in the table.
+func (t *freezerTable) Items() uint64 {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.items
+}
+
+// Retrieve returns an item of the table.
+func (t *freezerTable) Retrieve(item uint64) ([]byte, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if item >= t.items {
+		return nil, errOutOfBounds
+	}
+	var start uint64
+	if item > 0 {
+		var err error
+		if start, err = t.offset(item - 1); err != nil {
+			return nil, err
+		}
+	}
+	end, err := t.offset(item)
+	if err != nil {
+		return nil, err
+	}
+	if end < start {
+		return nil, fmt.Errorf("freezer table %s: corrupt index of item %d", t.name, item)
+	}
+	blob := make([]byte, end-start)
+	if _, err := t.data.ReadAt(blob, int64(start)); err != nil {
+		return nil, err
+	}
+	if t.compress {
+		return snappy.Decode(nil, blob)
+	}
+	return blob, nil
+}
+
+// Append adds an item at the end of the table, which must be the next one.
+func (t *freezerTable) Append(item uint64, blob []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if item != t.items {
+		return errOutOfOrder
+	}
+	if t.compress {
+		blob = snappy.Encode(nil, blob)
+	}
+	if _, err := t.data.WriteAt(blob, int64(t.size)); err != nil {
+		return err
+	}
+	var entry [indexEntrySize]byte
+	binary.BigEndian.PutUint64(entry[:], t.size+uint64(len(blob)))
+	if _, err := t.index.WriteAt(entry[:], int64(t.items*indexEntrySize)); err != nil {
+		return err
+	}
+	t.items++
+	t.size += uint64(len(blob))
+	return nil
+}
+
+// truncate drops the items from the given one onwards.
+func (t *freezerTable) truncate(items uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.items <= items {
+		return nil
+	}
+	var size uint64
+	if items > 0 {
+		var err error
+		if size, err = t.offset(items - 1); err != nil {
+			return err
+		}
+	}
+	if err := t.index.Truncate(int64(items * indexEntrySize)); err != nil {
+		return err
+	}
+	if err := t.data.Truncate(int64(size)); err != nil {
+		return err
+	}
+	t.items, t.size = items, size
+	return nil
+}
+
+// Sync flushes the table files to disk.
+func (t *freezerTable) Sync() error {
+	if err := t.data.Sync(); err != nil {
+		return err
+	}
+	return t.index.Sync()
+}
+
+// Close closes the table files.
+func (t *freezerTable) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var errs []error
+	for _, f := range []*os.File{t.data, t.index} {
+		if err := f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
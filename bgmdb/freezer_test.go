@@ -0,0 +1,130 @@
+// Copyright 2017 The bgmchain Authors
+// This file is part of the bgmchain library.
+//
+// The bgmchain library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The bgmchain library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the bgmchain library. If not, see <http://www.gnu.org/licenses/>.
+
+package bgmdb
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testItem(kind string, number uint64) []byte {
+	return bytes.Repeat([]byte(fmt.Sprintf("%s-%d", kind, number)), int(number%7)+1)
+}
+
+func appendTestBlocks(t *testing.T, f *Freezer, from, to uint64) {
+	for n := from; n < to; n++ {
+		err := f.AppendAncient(n, testItem(FreezerHashTable, n), testItem(FreezerHeaderTable, n), testItem(FreezerBodiesTable, n),
+			testItem(FreezerReceiptTable, n), testItem(FreezerDifficultyTable, n))
+		if err != nil {
+			t.Fatalf("failed to append block %d: %v", n, err)
+		}
+	}
+}
+
+func checkTestBlocks(t *testing.T, f *Freezer, count uint64) {
+	if have := f.Ancients(); have != count {
+		t.Fatalf("ancient block count mismatch: have %d, want %d", have, count)
+	}
+	for n := uint64(0); n < count; n++ {
+		for kind := range freezerTables {
+			if have, err := f.Ancient(kind, n); err != nil || !bytes.Equal(have, testItem(kind, n)) {
+				t.Fatalf("block %d: %s mismatch: have %q, err %v", n, kind, have, err)
+			}
+		}
+	}
+	if _, err := f.Ancient(FreezerHeaderTable, count); err == nil {
+		t.Fatalf("block %d retrieved past the end", count)
+	}
+}
+
+func TestFreezer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := NewFreezer(dir, false)
+	if err != nil {
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+	appendTestBlocks(t, f, 0, 20)
+	if err := f.AppendAncient(25, nil, nil, nil, nil, nil); err == nil {
+		t.Fatalf("appended block out of order")
+	}
+	checkTestBlocks(t, f, 20)
+
+	if err := f.TruncateAncients(12); err != nil {
+		t.Fatalf("failed to truncate: %v", err)
+	}
+	checkTestBlocks(t, f, 12)
+	appendTestBlocks(t, f, 12, 15)
+	f.Close()
+
+	// Reopening read only and writable yields the same blocks
+	if f, err = NewFreezer(dir, true); err != nil {
+		t.Fatalf("failed to open read only freezer: %v", err)
+	}
+	checkTestBlocks(t, f, 15)
+	if err := f.AppendAncient(15, nil, nil, nil, nil, nil); err != errReadOnly {
+		t.Fatalf("read only freezer append: have %v, want %v", err, errReadOnly)
+	}
+	f.Close()
+
+	if f, err = NewFreezer(dir, false); err != nil {
+		t.Fatalf("failed to reopen freezer: %v", err)
+	}
+	checkTestBlocks(t, f, 15)
+	f.Close()
+}
+
+func TestFreezerRepair(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := NewFreezer(dir, false)
+	if err != nil {
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+	appendTestBlocks(t, f, 0, 10)
+	f.Close()
+
+	// Tear the last body apart and leave a partial index entry behind
+	data := filepath.Join(dir, FreezerBodiesTable+".cdat")
+	stat, _ := os.Stat(data)
+	os.Truncate(data, stat.Size()-1)
+
+	index := filepath.Join(dir, FreezerHeaderTable+".ridx")
+	file, _ := os.OpenFile(index, os.O_WRONLY|os.O_APPEND, 0644)
+	file.Write([]byte{0x00, 0x01, 0x02})
+	file.Close()
+
+	if f, err = NewFreezer(dir, false); err != nil {
+		t.Fatalf("failed to reopen freezer: %v", err)
+	}
+	checkTestBlocks(t, f, 9)
+	appendTestBlocks(t, f, 9, 11)
+	checkTestBlocks(t, f, 11)
+	f.Close()
+}
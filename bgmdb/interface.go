@@ -25,20 +25,84 @@ type Putter interface {
 	Put(key []byte, value []byte) error
 }
 
+//
+type Deleter interface {
+	Delete(key []byte) error
+}
+
+// Iterator iterates over key/value pairs of a database in ascending key order.
+// It must be released after use.
+type Iterator interface {
+	Next() bool
+	Error() error
+	Key() []byte
+	Value() []byte
+	Release()
+}
+
+// Iteratee creates iterators over the content of a database.
+type Iteratee interface {
+	// NewIteratorWithPrefix iterates over the entries whose key starts with prefix.
+	NewIteratorWithPrefix(prefix []byte) Iterator
+
+	// NewIteratorWithRange iterates over the entries whose key is in the range
+	// [start, limit). A nil start means the first key, a nil limit the last.
+	NewIteratorWithRange(start, limit []byte) Iterator
+}
+
 //
 type Database interface {
 	Putter
+	Deleter
+	Iteratee
 	Get(key []byte) ([]byte, error)
 	Has(key []byte) (bool, error)
-	Delete(key []byte) error
 	Close()
 	NewBatch() Batch
+
+	// DeleteRange deletes the entries whose key is in the range [start, limit),
+	// with the same nil bounds as NewIteratorWithRange.
+	DeleteRange(start, limit []byte) error
+
+	// Stat returns a statistic of the database engine. The general statistics
+	// are named after the engine, like "leveldb.stats".
+	Stat(property string) (string, error)
+
+	// Compact flattens the storage of the keys in the range [start, limit),
+	// reclaiming the space of the deleted and overwritten entries.
+	Compact(start, limit []byte) error
+}
+
+// AncientReader gives access to the blocks moved into an ancient store.
+type AncientReader interface {
+	// Ancient retrieves an item of a frozen block from one of the tables.
+	Ancient(kind string, number uint64) ([]byte, error)
+
+	// Ancients returns the number of blocks frozen.
+	Ancients() uint64
+}
+
+// AncientStore is an ancient store the canonical blocks are moved into once
+// final, in order from the genesis.
+type AncientStore interface {
+	AncientReader
+
+	// AppendAncient freezes the next block.
+	AppendAncient(number uint64, hash, header, body, receipts, td []byte) error
+
+	// TruncateAncients drops the frozen blocks from the given number onwards.
+	TruncateAncients(items uint64) error
+
+	// SyncAncients flushes the frozen blocks to disk.
+	SyncAncients() error
 }
 
 //
 //
 type Batch interface {
 	Putter
+	Deleter
 	ValueSize() int //
 	Write() error
+	Reset()
 }
@@ -17,7 +17,9 @@
 package bgmdb
 
 import (
+	"bytes"
 	"errors"
+	"sort"
 	"sync"
 
 	"github.com/5sWind/bgmchain/common"
@@ -92,11 +94,120 @@ func (db *MemDatabase) Delete(key []byte) error {
 
 func (db *MemDatabase) Close() {}
 
+func (db *MemDatabase) NewIteratorWithPrefix(prefix []byte) Iterator {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	it := new(memIterator)
+	for key, value := range db.db {
+		if bytes.HasPrefix([]byte(key), prefix) {
+			it.add(key, value)
+		}
+	}
+	return it.sort()
+}
+
+func (db *MemDatabase) NewIteratorWithRange(start, limit []byte) Iterator {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	it := new(memIterator)
+	for key, value := range db.db {
+		if inRange([]byte(key), start, limit) {
+			it.add(key, value)
+		}
+	}
+	return it.sort()
+}
+
+func (db *MemDatabase) DeleteRange(start, limit []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	for key := range db.db {
+		if inRange([]byte(key), start, limit) {
+			delete(db.db, key)
+		}
+	}
+	return nil
+}
+
+// Stat is not supported, the memory database has no engine statistics.
+func (db *MemDatabase) Stat(property string) (string, error) {
+	return "", errors.New("unknown property")
+}
+
+// Compact is a no-op, deleted entries are released right away.
+func (db *MemDatabase) Compact(start, limit []byte) error {
+	return nil
+}
+
+// inRange reports whether key is in [start, limit), nil bounds being open.
+func inRange(key, start, limit []byte) bool {
+	return bytes.Compare(key, start) >= 0 && (limit == nil || bytes.Compare(key, limit) < 0)
+}
+
+// memIterator iterates over a snapshot of the entries of a memory database.
+type memIterator struct {
+	keys   []string
+	values [][]byte
+	index  int
+}
+
+func (it *memIterator) add(key string, value []byte) {
+	it.keys = append(it.keys, key)
+	it.values = append(it.values, common.CopyBytes(value))
+}
+
+// sort orders the snapshot by key and positions the iterator before the first.
+func (it *memIterator) sort() *memIterator {
+	sort.Sort(it)
+	it.index = -1
+	return it
+}
+
+func (it *memIterator) Len() int           { return len(it.keys) }
+func (it *memIterator) Less(i, j int) bool { return it.keys[i] < it.keys[j] }
+func (it *memIterator) Swap(i, j int) {
+	it.keys[i], it.keys[j] = it.keys[j], it.keys[i]
+	it.values[i], it.values[j] = it.values[j], it.values[i]
+}
+
+func (it *memIterator) Next() bool {
+	if it.index < len(it.keys) {
+		it.index++
+	}
+	return it.index < len(it.keys)
+}
+
+func (it *memIterator) Error() error { return nil }
+
+func (it *memIterator) Key() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return []byte(it.keys[it.index])
+}
+
+func (it *memIterator) Value() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return it.values[it.index]
+}
+
+func (it *memIterator) Release() {
+	it.keys, it.values = nil, nil
+}
+
 func (db *MemDatabase) NewBatch() Batch {
 	return &memBatch{db: db}
 }
 
-type kv struct{ k, v []byte }
+type kv struct {
+	k, v []byte
+	del  bool
+}
 
 type memBatch struct {
 	db     *MemDatabase
@@ -105,16 +216,26 @@ type memBatch struct {
 }
 
 func (b *memBatch) Put(key, value []byte) error {
-	b.writes = append(b.writes, kv{common.CopyBytes(key), common.CopyBytes(value)})
+	b.writes = append(b.writes, kv{k: common.CopyBytes(key), v: common.CopyBytes(value)})
 	b.size += len(value)
 	return nil
 }
 
+func (b *memBatch) Delete(key []byte) error {
+	b.writes = append(b.writes, kv{k: common.CopyBytes(key), del: true})
+	b.size += len(key)
+	return nil
+}
+
 func (b *memBatch) Write() error {
 	b.db.lock.Lock()
 	defer b.db.lock.Unlock()
 
 	for _, kv := range b.writes {
+		if kv.del {
+			delete(b.db.db, string(kv.k))
+			continue
+		}
 		b.db.db[string(kv.k)] = kv.v
 	}
 	return nil
@@ -123,3 +244,8 @@ func (b *memBatch) Write() error {
 func (b *memBatch) ValueSize() int {
 	return b.size
 }
+
+func (b *memBatch) Reset() {
+	b.writes = b.writes[:0]
+	b.size = 0
+}
@@ -36,7 +36,6 @@ import (
 	"github.com/5sWind/bgmchain/event"
 	"github.com/5sWind/bgmchain/log"
 	"github.com/5sWind/bgmchain/trie"
-	"github.com/syndtr/goleveldb/leveldb/util"
 	"gopkg.in/urfave/cli.v1"
 )
 
@@ -48,6 +47,8 @@ var (
 		ArgsUsage: "<genesisPath>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.DBEngineFlag,
 			utils.LightModeFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
@@ -65,8 +66,11 @@ It expects the genesis file as argument.`,
 		ArgsUsage: "<filename> (<filename 2> ... <filename N>) ",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.DBEngineFlag,
 			utils.CacheFlag,
 			utils.LightModeFlag,
+			utils.GCModeFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
@@ -83,6 +87,8 @@ processing will proceed even if an individual RLP-file import failure occurs.`,
 		ArgsUsage: "<filename> [<blockNumFirst> <blockNumLast>]",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.DBEngineFlag,
 			utils.CacheFlag,
 			utils.LightModeFlag,
 		},
@@ -100,6 +106,8 @@ if already existing.`,
 		ArgsUsage: "<sourceChaindataDir>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.DBEngineFlag,
 			utils.CacheFlag,
 			utils.SyncModeFlag,
 		},
@@ -114,6 +122,7 @@ The first argument must be the directory containing the blockchain to download f
 		ArgsUsage: " ",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.AncientFlag,
 			utils.LightModeFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
@@ -127,6 +136,8 @@ Remove blockchain and state databases`,
 		ArgsUsage: "[<blockHash> | <blockNum>]...",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.DBEngineFlag,
 			utils.CacheFlag,
 			utils.LightModeFlag,
 		},
@@ -155,6 +166,11 @@ func initGenesis(ctx *cli.Context) error {
 	if err := json.NewDecoder(file).Decode(genesis); err != nil {
 		utils.Fatalf("invalid genesis file: %v", err)
 	}
+	if genesis.Config != nil && genesis.Config.Dpos != nil {
+		if err := genesis.Config.Dpos.Validate(); err != nil {
+			utils.Fatalf("invalid dpos configuration: %v", err)
+		}
+	}
 	// Open an initialise both full and light databases
 	stack := makeFullNode(ctx)
 	for _, name := range []string{"chaindata", "lightchaindata"} {
@@ -209,16 +225,11 @@ func importChain(ctx *cli.Context) error {
 		}
 	}
 
+	chain.Stop()
 	fmt.Printf("Import done in %v.\n\n", time.Since(start))
 
 	// Output pre-compaction stats mostly to see the import trashing
-	db := chainDb.(*bgmdb.LDBDatabase)
-
-	stats, err := db.LDB().GetProperty("leveldb.stats")
-	if err != nil {
-		utils.Fatalf("Failed to read database stats: %v", err)
-	}
-	fmt.Println(stats)
+	printDatabaseStats(chainDb)
 	fmt.Printf("Trie cache misses:  %d\n", trie.CacheMisses())
 	fmt.Printf("Trie cache unloads: %d\n\n", trie.CacheUnloads())
 
@@ -238,16 +249,12 @@ func importChain(ctx *cli.Context) error {
 	// Compact the entire database to more accurately measure disk io and print the stats
 	start = time.Now()
 	fmt.Println("Compacting entire database...")
-	if err = db.LDB().CompactRange(util.Range{}); err != nil {
+	if err := chainDb.Compact(nil, nil); err != nil {
 		utils.Fatalf("Compaction failed: %v", err)
 	}
 	fmt.Printf("Compaction done in %v.\n\n", time.Since(start))
 
-	stats, err = db.LDB().GetProperty("leveldb.stats")
-	if err != nil {
-		utils.Fatalf("Failed to read database stats: %v", err)
-	}
-	fmt.Println(stats)
+	printDatabaseStats(chainDb)
 
 	return nil
 }
@@ -284,6 +291,17 @@ func exportChain(ctx *cli.Context) error {
 	return nil
 }
 
+// printDatabaseStats prints the general statistics of the storage engine of a
+// database, if it has any.
+func printDatabaseStats(db bgmdb.Database) {
+	for _, engine := range bgmdb.Engines() {
+		if stats, err := db.Stat(engine + ".stats"); err == nil {
+			fmt.Println(stats)
+			return
+		}
+	}
+}
+
 func copyDb(ctx *cli.Context) error {
 	// Ensure we have a source chain directory to copy
 	if len(ctx.Args()) != 1 {
@@ -297,7 +315,7 @@ func copyDb(ctx *cli.Context) error {
 	dl := downloader.New(syncmode, chainDb, new(event.TypeMux), chain, nil, nil)
 
 	// Create a source peer to satisfy downloader requests from
-	db, err := bgmdb.NewLDBDatabase(ctx.Args().First(), ctx.GlobalInt(utils.CacheFlag.Name), 256)
+	db, err := bgmdb.OpenDatabase("", ctx.Args().First(), ctx.GlobalInt(utils.CacheFlag.Name), 256)
 	if err != nil {
 		return err
 	}
@@ -324,7 +342,7 @@ func copyDb(ctx *cli.Context) error {
 	// Compact the entire database to remove any sync overhead
 	start = time.Now()
 	fmt.Println("Compacting entire database...")
-	if err = chainDb.(*bgmdb.LDBDatabase).LDB().CompactRange(util.Range{}); err != nil {
+	if err := chainDb.Compact(nil, nil); err != nil {
 		utils.Fatalf("Compaction failed: %v", err)
 	}
 	fmt.Printf("Compaction done in %v.\n\n", time.Since(start))
@@ -335,11 +353,22 @@ func copyDb(ctx *cli.Context) error {
 func removeDB(ctx *cli.Context) error {
 	stack, _ := makeConfigNode(ctx)
 
-	for _, name := range []string{"chaindata", "lightchaindata"} {
+	dbdirs := map[string]string{
+		"chaindata":      stack.ResolvePath("chaindata"),
+		"lightchaindata": stack.ResolvePath("lightchaindata"),
+	}
+	// The ancient store goes along with the chain database, unless moved away
+	if dir := ctx.GlobalString(utils.AncientFlag.Name); dir != "" {
+		dbdirs["ancient"] = stack.ResolvePath(dir)
+	}
+	for _, name := range []string{"chaindata", "lightchaindata", "ancient"} {
+		dbdir, ok := dbdirs[name]
+		if !ok {
+			continue
+		}
 		// Ensure the database exists in the first place
 		logger := log.New("database", name)
 
-		dbdir := stack.ResolvePath(name)
 		if !common.FileExist(dbdir) {
 			logger.Info("Database doesn't exist, skipping", "path", dbdir)
 			continue
@@ -0,0 +1,250 @@
+// Copyright 2017 The bgmchain Authors
+// This file is part of bgmchain.
+//
+// bgmchain is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// bgmchain is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with bgmchain. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/5sWind/bgmchain/bgmdb"
+	"github.com/5sWind/bgmchain/cmd/utils"
+	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/core/state/pruner"
+	"github.com/5sWind/bgmchain/log"
+	"github.com/cespare/cp"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	pruneKeepFlag = cli.Uint64Flag{
+		Name:  "keep",
+		Value: 128,
+		Usage: "Number of recent blocks whose state is retained",
+	}
+	pruneDryRunFlag = cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Report the reclaimable space without deleting anything",
+	}
+	dbCommand = cli.Command{
+		Name:     "db",
+		Usage:    "Low level chain database operations",
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The db commands operate directly on the chain database. The node must not be
+running.`,
+		Subcommands: []cli.Command{
+			{
+				Action:    utils.MigrateFlags(pruneState),
+				Name:      "prune-state",
+				Usage:     "Delete the state no longer reachable from the recent blocks",
+				ArgsUsage: " ",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.DBEngineFlag,
+					utils.CacheFlag,
+					utils.NoCompactionFlag,
+					pruneKeepFlag,
+					pruneDryRunFlag,
+				},
+				Description: `
+Marks every trie node reachable from the state and the DPoS context of the head
+block, of the --keep-1 blocks preceding it and of the genesis, and deletes all
+the other trie nodes and contract code from the chain database. The state of the
+older blocks is lost, it can't be queried nor rewound to anymore.
+
+The deletions are made in batches, each recording the progress of the sweep. An
+interrupted prune is resumed by running the command again, retaining the same
+blocks as the interrupted one.
+
+With --dry-run nothing is deleted, the command only reports the space the prune
+would reclaim.`,
+			},
+			{
+				Action:    utils.MigrateFlags(convertDB),
+				Name:      "convert",
+				Usage:     "Copy a chain database into a new one of another storage engine",
+				ArgsUsage: "<source> <destination>",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.DBEngineFlag,
+					utils.CacheFlag,
+				},
+				Description: `
+Copies every entry of the chain database in the source directory, like
+<datadir>/gbgm/chaindata, into a new database of the --db.engine storage engine
+created in the destination directory, which must not hold a database already.
+The ancient store, <source>/ancient or the --datadir.ancient directory of the
+node, is copied to the same place in the destination directory if it lies
+inside the source one, otherwise it is shared by both databases as is.
+
+Once done, the destination directory replaces the chaindata directory of the
+node, which then keeps opening it with the new engine.`,
+			},
+		},
+	}
+)
+
+// pruneState deletes the trie nodes of the chain database not reachable from
+// the retained blocks, and compacts the database to reclaim the space.
+func pruneState(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	dryRun := ctx.Bool(pruneDryRunFlag.Name)
+
+	start := time.Now()
+	stats, err := pruner.New(db, ctx.Uint64(pruneKeepFlag.Name)).Prune(dryRun)
+	if err != nil {
+		utils.Fatalf("State prune failed: %v", err)
+	}
+	if dryRun {
+		fmt.Printf("Retained states: %d, reachable nodes: %d\n", stats.Retained, stats.Marked)
+		fmt.Printf("Reclaimable: %d entries, %v\n", stats.Deleted, stats.Size)
+		return nil
+	}
+	fmt.Printf("Deleted %d entries, %v, in %v\n", stats.Deleted, stats.Size, time.Since(start))
+
+	if ctx.GlobalIsSet(utils.NoCompactionFlag.Name) {
+		return nil
+	}
+	// Compact the entire database to release the space of the deleted entries
+	start = time.Now()
+	fmt.Println("Compacting entire database...")
+	if err = db.Compact(nil, nil); err != nil {
+		utils.Fatalf("Compaction failed: %v", err)
+	}
+	fmt.Printf("Compaction done in %v.\n", time.Since(start))
+	return nil
+}
+
+// convertDB copies a chain database into a new database of another storage
+// engine, along with its ancient store.
+func convertDB(ctx *cli.Context) error {
+	if len(ctx.Args()) != 2 {
+		utils.Fatalf("Source and destination directory arguments required")
+	}
+	engine := ctx.GlobalString(utils.DBEngineFlag.Name)
+	if engine == "" {
+		utils.Fatalf("Destination storage engine missing (--%s)", utils.DBEngineFlag.Name)
+	}
+	src, dst := ctx.Args().Get(0), ctx.Args().Get(1)
+	if existing, err := bgmdb.ReadEngine(dst); err != nil || existing != "" {
+		utils.Fatalf("Destination %s already holds a database (%s, %v)", dst, existing, err)
+	}
+	// The ancient store is made of flat files, the same for every engine. It
+	// is resolved like the node does, and only needs copying if replacing the
+	// source directory with the destination one would lose it.
+	ancient := filepath.Join(src, "ancient")
+	if dir := ctx.GlobalString(utils.AncientFlag.Name); dir != "" {
+		stack, _ := makeConfigNode(ctx)
+		ancient = stack.ResolvePath(dir)
+	}
+	rel, err := relativePath(src, ancient)
+	if err != nil {
+		utils.Fatalf("Failed to locate ancient store: %v", err)
+	}
+	cache := ctx.GlobalInt(utils.CacheFlag.Name)
+
+	srcDb, err := bgmdb.OpenReadOnlyDatabase("", src, cache/2, 256)
+	if err != nil {
+		utils.Fatalf("Could not open source database: %v", err)
+	}
+	defer srcDb.Close()
+
+	dstDb, err := bgmdb.OpenDatabase(engine, dst, cache/2, 256)
+	if err != nil {
+		utils.Fatalf("Could not create destination database: %v", err)
+	}
+	defer dstDb.Close()
+
+	var (
+		start   = time.Now()
+		logged  = time.Now()
+		entries int
+		size    common.StorageSize
+		batch   = dstDb.NewBatch()
+		it      = srcDb.NewIteratorWithPrefix(nil)
+	)
+	defer it.Release()
+
+	for it.Next() {
+		if err := batch.Put(it.Key(), it.Value()); err != nil {
+			return err
+		}
+		entries++
+		size += common.StorageSize(len(it.Key()) + len(it.Value()))
+
+		if batch.ValueSize() >= bgmdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				utils.Fatalf("Failed to write destination database: %v", err)
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Converting database", "entries", entries, "size", size, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := it.Error(); err != nil {
+		utils.Fatalf("Failed to read source database: %v", err)
+	}
+	if err := batch.Write(); err != nil {
+		utils.Fatalf("Failed to write destination database: %v", err)
+	}
+	fmt.Printf("Copied %d entries, %v, in %v\n", entries, size, time.Since(start))
+
+	// An ancient store outside of the source directory is shared as is
+	if rel == "" {
+		fmt.Printf("Ancient store %s left in place\n", ancient)
+		return nil
+	}
+	if common.FileExist(ancient) {
+		if err := cp.CopyAll(filepath.Join(dst, rel), ancient); err != nil {
+			utils.Fatalf("Failed to copy ancient store: %v", err)
+		}
+		fmt.Println("Copied ancient store")
+	}
+	return nil
+}
+
+// relativePath returns the path of target within the dir directory, or an empty
+// path if target lies outside of it.
+func relativePath(dir, target string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if target, err = filepath.Abs(target); err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(dir, target)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
+		return "", fmt.Errorf("%s is the database directory itself", target)
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", nil
+	}
+	return rel, nil
+}
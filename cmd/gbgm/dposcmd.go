@@ -0,0 +1,322 @@
+// Copyright 2017 The bgmchain Authors
+// This file is part of bgmchain.
+//
+// bgmchain is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// bgmchain is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with bgmchain. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+
+	"github.com/5sWind/bgmchain/bgmdb"
+	"github.com/5sWind/bgmchain/cmd/utils"
+	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/consensus/dpos"
+	"github.com/5sWind/bgmchain/core"
+	"github.com/5sWind/bgmchain/core/state"
+	"github.com/5sWind/bgmchain/core/types"
+	"github.com/5sWind/bgmchain/params"
+	"github.com/5sWind/bgmchain/trie"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	dposCommand = cli.Command{
+		Name:     "dpos",
+		Usage:    "Inspect the DPoS state of the local chain",
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The dpos commands read the DPoS state recorded in the chain database. The
+database is opened read-only, so they can't alter the chain, but the node must
+not be running.`,
+		Subcommands: []cli.Command{
+			{
+				Action:    utils.MigrateFlags(inspectDpos),
+				Name:      "inspect",
+				Usage:     "Print the DPoS state at a block",
+				ArgsUsage: "[<blockHash> | <blockNum>]",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.DBEngineFlag,
+					utils.CacheFlag,
+					utils.LightModeFlag,
+				},
+				Description: `
+Prints the validators of the epoch of the given block, the registered
+candidates, the votes of the delegators with the stake behind them, the blocks
+minted by every validator in each recorded epoch, and the candidates the next
+election would kick out for inactivity.
+
+The block defaults to the head of the chain.`,
+			},
+			{
+				Action:    utils.MigrateFlags(simulateElection),
+				Name:      "simulate-election",
+				Usage:     "Re-run the election of the epoch following a block",
+				ArgsUsage: "[<blockHash> | <blockNum>] [<timestamp>]",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.DBEngineFlag,
+					utils.CacheFlag,
+					utils.LightModeFlag,
+				},
+				Description: `
+Re-runs the elections a block minted at the given time on top of the given
+parent would hold, and prints the candidates kicked out and the validators
+elected. Nothing is written to the database.
+
+The parent defaults to the head of the chain, and the timestamp to the start of
+the epoch following it.`,
+			},
+		},
+	}
+)
+
+// dposChain is the read-only view of the chain the dpos commands work on.
+type dposChain struct {
+	db      bgmdb.Database
+	config  *params.DposConfig
+	genesis *types.Header
+}
+
+// openDposChain opens the chain database of the node read-only.
+func openDposChain(ctx *cli.Context) *dposChain {
+	stack, _ := makeConfigNode(ctx)
+	db := utils.MakeReadOnlyChainDatabase(ctx, stack)
+
+	genesis := core.GetHeader(db, core.GetCanonicalHash(db, 0), 0)
+	if genesis == nil {
+		utils.Fatalf("Chain database has no genesis block")
+	}
+	config, err := core.GetChainConfig(db, genesis.Hash())
+	if err != nil {
+		utils.Fatalf("Could not read chain config: %v", err)
+	}
+	if config.Dpos == nil {
+		utils.Fatalf("Chain has no dpos configuration")
+	}
+	return &dposChain{db: db, config: config.Dpos, genesis: genesis}
+}
+
+// header returns the block given as hash or number, or the head of the chain
+// if arg is empty.
+func (c *dposChain) header(arg string) *types.Header {
+	var header *types.Header
+	switch {
+	case arg == "":
+		hash := core.GetHeadBlockHash(c.db)
+		header = core.GetHeader(c.db, hash, core.GetBlockNumber(c.db, hash))
+	case hashish(arg):
+		hash := common.HexToHash(arg)
+		header = core.GetHeader(c.db, hash, core.GetBlockNumber(c.db, hash))
+	default:
+		num, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			utils.Fatalf("Invalid block number %q", arg)
+		}
+		header = core.GetHeader(c.db, core.GetCanonicalHash(c.db, num), num)
+	}
+	if header == nil {
+		utils.Fatalf("Block %q not found", arg)
+	}
+	return header
+}
+
+// elect re-runs the elections of a block minted at the given time on top of
+// parent, defaulting to the start of the epoch following it.
+func (c *dposChain) elect(parent *types.Header, timestamp int64) (*dpos.Election, error) {
+	if timestamp == 0 {
+		interval := c.config.At(new(big.Int).Add(parent.Number, common.Big1)).EpochInterval
+		timestamp = (parent.Time.Int64()/interval + 1) * interval
+	}
+	first := core.GetHeader(c.db, core.GetCanonicalHash(c.db, 1), 1)
+	getHeader := func(hash common.Hash, number uint64) *types.Header {
+		return core.GetHeader(c.db, hash, number)
+	}
+	return dpos.SimulateElection(c.config, c.db, getHeader, c.genesis, first, parent, timestamp)
+}
+
+func inspectDpos(ctx *cli.Context) error {
+	chain := openDposChain(ctx)
+	defer chain.db.Close()
+
+	header := chain.header(ctx.Args().First())
+	dposContext, err := types.NewDposContextFromProto(chain.db, header.DposContext)
+	if err != nil {
+		utils.Fatalf("Could not open dpos context: %v", err)
+	}
+	epoch := uint64(header.Time.Int64() / chain.config.At(header.Number).EpochInterval)
+	fmt.Printf("Block:  #%d [%x]\n", header.Number, header.Hash())
+	fmt.Printf("Epoch:  %d\n\n", epoch)
+
+	// Validators of the epoch, in minting order
+	validators, err := dposContext.GetValidators()
+	if err != nil {
+		utils.Fatalf("Could not read validators: %v", err)
+	}
+	fmt.Printf("Validators (%d):\n", len(validators))
+	for _, validator := range validators {
+		signer, err := dposContext.GetEpochSigner(validator)
+		if err != nil {
+			utils.Fatalf("Could not read signer of %x: %v", validator, err)
+		}
+		minted, err := dposContext.GetMintCnt(epoch, validator)
+		if err != nil {
+			utils.Fatalf("Could not read mint count of %x: %v", validator, err)
+		}
+		fmt.Printf("  %x  signer %x  minted %d\n", validator, signer, minted)
+	}
+
+	// Registered candidates along with the votes they'd receive
+	infos, err := dpos.CandidateInfos(dposContext)
+	if err != nil {
+		utils.Fatalf("Could not read candidates: %v", err)
+	}
+	weights := make(map[common.Address]*big.Int)
+	fmt.Printf("\nCandidates (%d):\n", len(infos))
+	for _, info := range infos {
+		weights[info.Address] = new(big.Int)
+		name := ""
+		if info.Meta != nil {
+			name = info.Meta.Name
+		}
+		fmt.Printf("  %x  deposit %v  commission %d%%  %s\n", info.Address, info.Deposit, info.Commission, name)
+	}
+
+	// Votes of the delegators, weighted by the stake behind them once stake
+	// locking is on and by their balance before
+	var (
+		votes   int
+		statedb *state.StateDB
+		staking = chain.config.At(header.Number).Staking
+	)
+	if !staking {
+		if statedb, err = state.New(header.Root, state.NewDatabase(chain.db)); err != nil {
+			utils.Fatalf("Could not open state: %v", err)
+		}
+	}
+	fmt.Printf("\nVotes:\n")
+	iter := trie.NewIterator(dposContext.VoteTrie().NodeIterator(nil))
+	for iter.Next() {
+		// The delegator is the tail of the prefixed trie key
+		delegator, candidate := common.BytesToAddress(iter.Key), common.BytesToAddress(iter.Value)
+		var (
+			amount *big.Int
+			unit   = "balance"
+		)
+		if staking {
+			if amount, err = dposContext.GetStake(delegator); err != nil {
+				utils.Fatalf("Could not read stake of %x: %v", delegator, err)
+			}
+			unit = "stake"
+		} else {
+			amount = statedb.GetBalance(delegator)
+		}
+		if weight, ok := weights[candidate]; ok {
+			weight.Add(weight, amount)
+		}
+		fmt.Printf("  %x -> %x  %s %v\n", delegator, candidate, unit, amount)
+		votes++
+	}
+	if iter.Err != nil {
+		utils.Fatalf("Could not read votes: %v", iter.Err)
+	}
+	fmt.Printf("  %d votes in total\n", votes)
+
+	ranked := make([]common.Address, 0, len(weights))
+	for candidate := range weights {
+		ranked = append(ranked, candidate)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if cmp := weights[ranked[i]].Cmp(weights[ranked[j]]); cmp != 0 {
+			return cmp > 0
+		}
+		return ranked[i].String() < ranked[j].String()
+	})
+	fmt.Printf("\nVote weights:\n")
+	for _, candidate := range ranked {
+		fmt.Printf("  %x  %v\n", candidate, weights[candidate])
+	}
+
+	// Blocks minted in every epoch still recorded
+	counts, err := dpos.MintCounts(dposContext)
+	if err != nil {
+		utils.Fatalf("Could not read mint counts: %v", err)
+	}
+	epochs := make([]uint64, 0, len(counts))
+	for epoch := range counts {
+		epochs = append(epochs, epoch)
+	}
+	sort.Slice(epochs, func(i, j int) bool { return epochs[i] < epochs[j] })
+	fmt.Printf("\nMint counts:\n")
+	for _, epoch := range epochs {
+		fmt.Printf("  Epoch %d:\n", epoch)
+		for validator, count := range counts[epoch] {
+			fmt.Printf("    %x  %d\n", validator, count)
+		}
+	}
+
+	// Candidates the election opening the next epoch would remove
+	fmt.Printf("\nKicked out at the next election:\n")
+	election, err := chain.elect(header, 0)
+	if err != nil {
+		fmt.Printf("  election fails: %v\n", err)
+		return nil
+	}
+	for _, candidate := range election.Kickouts {
+		fmt.Printf("  %x\n", candidate)
+	}
+	if len(election.Kickouts) == 0 {
+		fmt.Printf("  none\n")
+	}
+	return nil
+}
+
+func simulateElection(ctx *cli.Context) error {
+	if len(ctx.Args()) > 2 {
+		utils.Fatalf("This command takes at most two arguments.")
+	}
+	chain := openDposChain(ctx)
+	defer chain.db.Close()
+
+	parent := chain.header(ctx.Args().First())
+	var timestamp int64
+	if len(ctx.Args()) == 2 {
+		var err error
+		if timestamp, err = strconv.ParseInt(ctx.Args().Get(1), 10, 64); err != nil || timestamp <= parent.Time.Int64() {
+			utils.Fatalf("Invalid timestamp %q, must follow the parent", ctx.Args().Get(1))
+		}
+	}
+	election, err := chain.elect(parent, timestamp)
+	if err != nil {
+		utils.Fatalf("Election failed: %v", err)
+	}
+	fmt.Printf("Parent:  #%d [%x]\n", parent.Number, parent.Hash())
+	fmt.Printf("Epoch:   %d\n\n", election.Epoch)
+
+	fmt.Printf("Kicked out (%d):\n", len(election.Kickouts))
+	for _, candidate := range election.Kickouts {
+		fmt.Printf("  %x\n", candidate)
+	}
+	fmt.Printf("\nValidators (%d):\n", len(election.Validators))
+	for _, validator := range election.Validators {
+		fmt.Printf("  %x\n", validator)
+	}
+	return nil
+}
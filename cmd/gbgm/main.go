@@ -59,6 +59,8 @@ var (
 		utils.BootnodesV4Flag,
 		utils.BootnodesV5Flag,
 		utils.DataDirFlag,
+		utils.AncientFlag,
+		utils.DBEngineFlag,
 		utils.KeyStoreDirFlag,
 		utils.NoUSBFlag,
 		utils.DashboardEnabledFlag,
@@ -78,6 +80,7 @@ var (
 		utils.FastSyncFlag,
 		utils.LightModeFlag,
 		utils.SyncModeFlag,
+		utils.GCModeFlag,
 		utils.LightServFlag,
 		utils.LightPeersFlag,
 		utils.LightKDFFlag,
@@ -87,6 +90,8 @@ var (
 		utils.MaxPeersFlag,
 		utils.MaxPendingPeersFlag,
 		utils.ValidatorFlag,
+		utils.SignerFlag,
+		utils.RemoteSignerFlag,
 		utils.CoinbaseFlag,
 		utils.GasPriceFlag,
 		utils.MiningEnabledFlag,
@@ -143,6 +148,10 @@ func init() {
 		copydbCommand,
 		removedbCommand,
 		dumpCommand,
+		// See dposcmd.go:
+		dposCommand,
+		// See dbcmd.go:
+		dbCommand,
 		// See monitorcmd.go:
 		monitorCommand,
 		// See accountcmd.go:
@@ -68,10 +68,13 @@ var AppHelpFlagGroups = []flagGroup{
 		Flags: []cli.Flag{
 			configFileFlag,
 			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.DBEngineFlag,
 			utils.KeyStoreDirFlag,
 			utils.NoUSBFlag,
 			utils.NetworkIdFlag,
 			utils.SyncModeFlag,
+			utils.GCModeFlag,
 			utils.BgmStatsURLFlag,
 			utils.IdentityFlag,
 			utils.LightServFlag,
@@ -160,6 +163,8 @@ var AppHelpFlagGroups = []flagGroup{
 		Flags: []cli.Flag{
 			utils.MiningEnabledFlag,
 			utils.ValidatorFlag,
+			utils.SignerFlag,
+			utils.RemoteSignerFlag,
 			utils.CoinbaseFlag,
 			utils.TargetGasLimitFlag,
 			utils.GasPriceFlag,
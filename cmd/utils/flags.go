@@ -114,6 +114,14 @@ var (
 		Usage: "Data directory for the databases and keystore",
 		Value: DirectoryString{node.DefaultDataDir()},
 	}
+	AncientFlag = DirectoryFlag{
+		Name:  "datadir.ancient",
+		Usage: "Data directory for the ancient blocks (default = inside the chaindata)",
+	}
+	DBEngineFlag = cli.StringFlag{
+		Name:  "db.engine",
+		Usage: "Storage engine of new databases (" + strings.Join(bgmdb.Engines(), ", ") + "), an existing database must be opened with the engine it was created with",
+	}
 	KeyStoreDirFlag = DirectoryFlag{
 		Name:  "keystore",
 		Usage: "Directory for the keystore (default = inside the datadir)",
@@ -151,6 +159,12 @@ var (
 		Value: &defaultSyncMode,
 	}
 
+	GCModeFlag = cli.StringFlag{
+		Name:  "gcmode",
+		Usage: `Blockchain garbage collection mode ("full", "archive"), state is only pruned with "full"`,
+		Value: "archive",
+	}
+
 	LightServFlag = cli.IntFlag{
 		Name:  "lightserv",
 		Usage: "Maximum percentage of time allowed for serving LES requests (0-90)",
@@ -258,12 +272,21 @@ var (
 	}
 	ValidatorFlag = cli.StringFlag{
 		Name:  "validator",
-		Usage: "Public address for block mining signer (default = first account created)",
+		Usage: "Comma separated public addresses of the validators to mint blocks for (default = first account created)",
+		Value: "0",
+	}
+	RemoteSignerFlag = cli.StringFlag{
+		Name:  "signer.remote",
+		Usage: "IPC path or HTTP/WS URL of a signing daemon sealing the blocks instead of the local keystore",
+	}
+	SignerFlag = cli.StringFlag{
+		Name:  "signer",
+		Usage: "Public address of the key sealing the first validator's blocks, if bound to a separate key (default = validator)",
 		Value: "0",
 	}
 	CoinbaseFlag = cli.StringFlag{
 		Name:  "coinbase",
-		Usage: "Public address for block mining rewards (default = first account created)",
+		Usage: "Public address of the miner (default = first account created), block rewards go to the minting validator",
 		Value: "0",
 	}
 	GasPriceFlag = BigFlag{
@@ -680,15 +703,22 @@ func MakeAddress(ks *keystore.KeyStore, account string) (accounts.Account, error
 	return accs[index], nil
 }
 
-// setValidator retrieves the validator either from the directly specified
-// command line flags or from the keystore if CLI indexed.
+// setValidator retrieves the validators either from the directly specified
+// command line flags or from the keystore if CLI indexed. The first one is the
+// validator, the rest are further validators sealing with their own keys.
 func setValidator(ctx *cli.Context, ks *keystore.KeyStore, cfg *bgm.Config) {
 	if ctx.GlobalIsSet(ValidatorFlag.Name) {
-		account, err := MakeAddress(ks, ctx.GlobalString(ValidatorFlag.Name))
-		if err != nil {
-			Fatalf("Option %q: %v", ValidatorFlag.Name, err)
+		for i, validator := range strings.Split(ctx.GlobalString(ValidatorFlag.Name), ",") {
+			account, err := MakeAddress(ks, strings.TrimSpace(validator))
+			if err != nil {
+				Fatalf("Option %q: %v", ValidatorFlag.Name, err)
+			}
+			if i == 0 {
+				cfg.Validator = account.Address
+			} else {
+				cfg.Validators = append(cfg.Validators, account.Address)
+			}
 		}
-		cfg.Validator = account.Address
 		return
 	}
 	accounts := ks.Accounts()
@@ -701,6 +731,22 @@ func setValidator(ctx *cli.Context, ks *keystore.KeyStore, cfg *bgm.Config) {
 	}
 }
 
+// setSigner retrieves the key sealing the validator's blocks from the directly
+// specified command line flags or from the keystore if CLI indexed, along with
+// the daemon holding the keys if they aren't kept locally.
+func setSigner(ctx *cli.Context, ks *keystore.KeyStore, cfg *bgm.Config) {
+	if ctx.GlobalIsSet(SignerFlag.Name) {
+		account, err := MakeAddress(ks, ctx.GlobalString(SignerFlag.Name))
+		if err != nil {
+			Fatalf("Option %q: %v", SignerFlag.Name, err)
+		}
+		cfg.Signer = account.Address
+	}
+	if ctx.GlobalIsSet(RemoteSignerFlag.Name) {
+		cfg.RemoteSigner = ctx.GlobalString(RemoteSignerFlag.Name)
+	}
+}
+
 // setCoinbase retrieves the coinbase either from the directly specified
 // command line flags or from the keystore if CLI indexed.
 func setCoinbase(ctx *cli.Context, ks *keystore.KeyStore, cfg *bgm.Config) {
@@ -790,6 +836,9 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 		cfg.DataDir = ctx.GlobalString(DataDirFlag.Name)
 	}
 
+	if ctx.GlobalIsSet(DBEngineFlag.Name) {
+		cfg.DBEngine = ctx.GlobalString(DBEngineFlag.Name)
+	}
 	if ctx.GlobalIsSet(KeyStoreDirFlag.Name) {
 		cfg.KeyStoreDir = ctx.GlobalString(KeyStoreDirFlag.Name)
 	}
@@ -872,6 +921,7 @@ func SetBgmConfig(ctx *cli.Context, stack *node.Node, cfg *bgm.Config) {
 
 	ks := stack.AccountManager().Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
 	setValidator(ctx, ks, cfg)
+	setSigner(ctx, ks, cfg)
 	setCoinbase(ctx, ks, cfg)
 	setGPO(ctx, &cfg.GPO)
 	setTxPool(ctx, &cfg.TxPool)
@@ -884,6 +934,16 @@ func SetBgmConfig(ctx *cli.Context, stack *node.Node, cfg *bgm.Config) {
 	case ctx.GlobalBool(LightModeFlag.Name):
 		cfg.SyncMode = downloader.LightSync
 	}
+	if ctx.GlobalIsSet(GCModeFlag.Name) {
+		switch ctx.GlobalString(GCModeFlag.Name) {
+		case "full":
+			cfg.NoPruning = false
+		case "archive":
+			cfg.NoPruning = true
+		default:
+			Fatalf("--%s must be either 'full' or 'archive'", GCModeFlag.Name)
+		}
+	}
 	if ctx.GlobalIsSet(LightServFlag.Name) {
 		cfg.LightServ = ctx.GlobalInt(LightServFlag.Name)
 	}
@@ -897,6 +957,9 @@ func SetBgmConfig(ctx *cli.Context, stack *node.Node, cfg *bgm.Config) {
 	if ctx.GlobalIsSet(CacheFlag.Name) {
 		cfg.DatabaseCache = ctx.GlobalInt(CacheFlag.Name)
 	}
+	if ctx.GlobalIsSet(AncientFlag.Name) {
+		cfg.DatabaseFreezer = ctx.GlobalString(AncientFlag.Name)
+	}
 	cfg.DatabaseHandles = makeDatabaseHandles()
 
 	if ctx.GlobalIsSet(DocRootFlag.Name) {
@@ -946,7 +1009,11 @@ func RegisterBgmService(stack *node.Node, cfg *bgm.Config) {
 // RegisterDashboardService adds a dashboard to the stack.
 func RegisterDashboardService(stack *node.Node, cfg *dashboard.Config) {
 	stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
-		return dashboard.New(cfg)
+		// Retrieve the full node to report the DPoS candidates of, if any
+		var bgmServ *bgm.Bgmchain
+		ctx.Service(&bgmServ)
+
+		return dashboard.New(cfg, bgmServ)
 	})
 }
 
@@ -982,7 +1049,8 @@ func SetupNetwork(ctx *cli.Context) {
 	params.TargetGasLimit = new(big.Int).SetUint64(ctx.GlobalUint64(TargetGasLimitFlag.Name))
 }
 
-// MakeChainDatabase open an LevelDB using the flags passed to the client and will hard crash if it fails.
+// MakeChainDatabase opens the chain database with the storage engine passed to the
+// client and will hard crash if it fails.
 func MakeChainDatabase(ctx *cli.Context, stack *node.Node) bgmdb.Database {
 	var (
 		cache   = ctx.GlobalInt(CacheFlag.Name)
@@ -996,9 +1064,45 @@ func MakeChainDatabase(ctx *cli.Context, stack *node.Node) bgmdb.Database {
 	if err != nil {
 		Fatalf("Could not open database: %v", err)
 	}
+	// The blocks of a full node may have been moved into the ancient store
+	if _, ok := chainDb.(*bgmdb.MemDatabase); !ok && name == "chaindata" {
+		if chainDb, err = bgmdb.NewDatabaseWithFreezer(chainDb, ancientDir(ctx, stack), false); err != nil {
+			Fatalf("Could not open ancient store: %v", err)
+		}
+	}
 	return chainDb
 }
 
+// MakeReadOnlyChainDatabase opens the existing chain database of the node for
+// inspection, refusing any write to it.
+func MakeReadOnlyChainDatabase(ctx *cli.Context, stack *node.Node) bgmdb.Database {
+	name := "chaindata"
+	if ctx.GlobalBool(LightModeFlag.Name) {
+		name = "lightchaindata"
+	}
+	chainDb, err := bgmdb.OpenReadOnlyDatabase(ctx.GlobalString(DBEngineFlag.Name), stack.ResolvePath(name), ctx.GlobalInt(CacheFlag.Name), makeDatabaseHandles())
+	if err != nil {
+		Fatalf("Could not open database: %v", err)
+	}
+	if dir := ancientDir(ctx, stack); name == "chaindata" && common.FileExist(dir) {
+		db, err := bgmdb.NewDatabaseWithFreezer(chainDb, dir, true)
+		if err != nil {
+			Fatalf("Could not open ancient store: %v", err)
+		}
+		return db
+	}
+	return chainDb
+}
+
+// ancientDir returns the directory of the ancient store of the chain database:
+// the one given on the command line, or "ancient" inside the chain database.
+func ancientDir(ctx *cli.Context, stack *node.Node) string {
+	if dir := ctx.GlobalString(AncientFlag.Name); dir != "" {
+		return stack.ResolvePath(dir)
+	}
+	return filepath.Join(stack.ResolvePath("chaindata"), "ancient")
+}
+
 // MakeChain creates a chain manager from set command line flags.
 func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chainDb bgmdb.Database) {
 	var err error
@@ -1008,9 +1112,17 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 	if err != nil {
 		Fatalf("%v", err)
 	}
-	engine := dpos.New(config.Dpos, chainDb)
+	engine, err := dpos.New(config.Dpos, chainDb)
+	if err != nil {
+		Fatalf("%v", err)
+	}
 	vmcfg := vm.Config{EnablePreimageRecording: ctx.GlobalBool(VMEnableDebugFlag.Name)}
-	chain, err = core.NewBlockChain(chainDb, config, engine, vmcfg)
+	cache := &core.CacheConfig{
+		Disabled:      ctx.GlobalString(GCModeFlag.Name) == "archive",
+		TrieNodeLimit: bgm.DefaultConfig.TrieCache,
+		TrieTimeLimit: bgm.DefaultConfig.TrieTimeout,
+	}
+	chain, err = core.NewBlockChain(chainDb, cache, config, engine, vmcfg)
 	if err != nil {
 		Fatalf("Can't create BlockChain: %v", err)
 	}
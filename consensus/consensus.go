@@ -92,6 +92,18 @@ type Engine interface {
 	APIs(chain ChainReader) []rpc.API
 }
 
+// ForkChoice is implemented by consensus engines with a rule of their own to
+// choose between competing chains. Chains the rule can't tell apart are left
+// to total difficulty.
+type ForkChoice interface {
+	// CompareChains compares the chain ending at header with the canonical one
+	// ending at current. It returns a positive number if the chain of header is
+	// preferred, a negative one if the canonical chain is, and zero if the rule
+	// can't tell them apart. The header itself need not be stored yet, but its
+	// ancestors must be.
+	CompareChains(chain ChainReader, current, header *types.Header) (int, error)
+}
+
 //
 type PoW interface {
 	Engine
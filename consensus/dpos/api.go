@@ -19,6 +19,7 @@ package dpos
 import (
 	"github.com/5sWind/bgmchain/common"
 	"github.com/5sWind/bgmchain/consensus"
+	"github.com/5sWind/bgmchain/core/state"
 	"github.com/5sWind/bgmchain/core/types"
 	"github.com/5sWind/bgmchain/rpc"
 
@@ -32,19 +33,39 @@ type API struct {
 	dpos  *Dpos
 }
 
-// GetValidators retrieves the list of the validators at specified block
-func (api *API) GetValidators(number *rpc.BlockNumber) ([]common.Address, error) {
+// header retrieves the header at the specified block, defaulting to the head
+func (api *API) header(number *rpc.BlockNumber) (*types.Header, error) {
 	var header *types.Header
 	if number == nil || *number == rpc.LatestBlockNumber {
 		header = api.chain.CurrentHeader()
+	} else if *number == rpc.ConfirmedBlockNumber {
+		return api.dpos.ConfirmedHeader(api.chain)
 	} else {
 		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
 	}
 	if header == nil {
 		return nil, errUnknownBlock
 	}
+	return header, nil
+}
 
-	epochTrie, err := types.NewEpochTrie(header.DposContext.EpochHash, api.dpos.db)
+// dposContext opens the dpos context at the specified block
+func (api *API) dposContext(number *rpc.BlockNumber) (*types.DposContext, error) {
+	header, err := api.header(number)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewDposContextFromProto(api.dpos.triedb, header.DposContext)
+}
+
+// GetValidators retrieves the list of the validators at specified block
+func (api *API) GetValidators(number *rpc.BlockNumber) ([]common.Address, error) {
+	header, err := api.header(number)
+	if err != nil {
+		return nil, err
+	}
+
+	epochTrie, err := types.NewEpochTrie(header.DposContext.EpochHash, api.dpos.triedb)
 	if err != nil {
 		return nil, err
 	}
@@ -59,13 +80,256 @@ func (api *API) GetValidators(number *rpc.BlockNumber) ([]common.Address, error)
 
 // GetConfirmedBlockNumber retrieves the latest irreversible block
 func (api *API) GetConfirmedBlockNumber() (*big.Int, error) {
-	var err error
-	header := api.dpos.confirmedBlockHeader
-	if header == nil {
-		header, err = api.dpos.loadConfirmedBlockHeader(api.chain)
+	header, err := api.dpos.ConfirmedHeader(api.chain)
+	if err != nil {
+		return nil, err
+	}
+	return header.Number, nil
+}
+
+// GetCommission retrieves the percentage of the block reward a candidate keeps
+// for itself at specified block, the rest being shared with its delegators
+func (api *API) GetCommission(candidate common.Address, number *rpc.BlockNumber) (uint64, error) {
+	dposContext, err := api.dposContext(number)
+	if err != nil {
+		return 0, err
+	}
+	commission, _, err := dposContext.GetCommission(candidate)
+	return commission, err
+}
+
+// GetAccruedReward retrieves the total block rewards paid out to a delegator
+// up to the specified block
+func (api *API) GetAccruedReward(delegator common.Address, number *rpc.BlockNumber) (*big.Int, error) {
+	dposContext, err := api.dposContext(number)
+	if err != nil {
+		return nil, err
+	}
+	return dposContext.GetAccruedReward(delegator)
+}
+
+// GetRewardPool retrieves the delegator share of the rewards a validator has
+// collected in the epoch of the specified block, pending distribution
+func (api *API) GetRewardPool(validator common.Address, number *rpc.BlockNumber) (*big.Int, error) {
+	dposContext, err := api.dposContext(number)
+	if err != nil {
+		return nil, err
+	}
+	return dposContext.GetRewardPool(validator)
+}
+
+// GetStake retrieves the stake a delegator has locked behind its vote at the
+// specified block
+func (api *API) GetStake(delegator common.Address, number *rpc.BlockNumber) (*big.Int, error) {
+	dposContext, err := api.dposContext(number)
+	if err != nil {
+		return nil, err
+	}
+	return dposContext.GetStake(delegator)
+}
+
+// GetUnbondings retrieves the undelegated stake of a delegator which is still
+// waiting for its unbonding period to end at the specified block
+func (api *API) GetUnbondings(delegator common.Address, number *rpc.BlockNumber) ([]*types.Unbonding, error) {
+	dposContext, err := api.dposContext(number)
+	if err != nil {
+		return nil, err
+	}
+	return dposContext.GetUnbondings(delegator)
+}
+
+// GetCandidates retrieves the list of the registered candidates at specified block
+func (api *API) GetCandidates(number *rpc.BlockNumber) ([]common.Address, error) {
+	dposContext, err := api.dposContext(number)
+	if err != nil {
+		return nil, err
+	}
+	return dposContext.GetCandidates()
+}
+
+// CandidateInfo describes a registered candidate to the delegators choosing
+// whom to vote for.
+type CandidateInfo struct {
+	Address    common.Address       `json:"address"`
+	Deposit    *big.Int             `json:"deposit"`    // Deposit locked by the candidate
+	Commission uint64               `json:"commission"` // Percentage of the block reward kept by the candidate
+	Meta       *types.CandidateMeta `json:"meta"`       // Description of the candidate, null if it provided none
+	Signer     common.Address       `json:"signer"`     // Key sealing the blocks of the candidate from the next epoch on
+}
+
+// candidateInfo collects the registration details of a candidate, nil if the
+// address isn't a candidate.
+func candidateInfo(dposContext *types.DposContext, candidate common.Address) (*CandidateInfo, error) {
+	registered, err := dposContext.CandidateTrie().TryGet(candidate.Bytes())
+	if err != nil || registered == nil {
+		return nil, err
+	}
+	info := &CandidateInfo{Address: candidate}
+	if info.Deposit, err = dposContext.GetDeposit(candidate); err != nil {
+		return nil, err
+	}
+	if info.Commission, _, err = dposContext.GetCommission(candidate); err != nil {
+		return nil, err
+	}
+	if info.Meta, err = dposContext.GetCandidateMeta(candidate); err != nil {
+		return nil, err
+	}
+	if info.Signer, err = dposContext.GetBoundSigner(candidate); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// GetCandidate retrieves the deposit, commission and metadata of a candidate at
+// specified block, or null if the address isn't a candidate
+func (api *API) GetCandidate(candidate common.Address, number *rpc.BlockNumber) (*CandidateInfo, error) {
+	dposContext, err := api.dposContext(number)
+	if err != nil {
+		return nil, err
+	}
+	return candidateInfo(dposContext, candidate)
+}
+
+// GetCandidateInfos retrieves the deposit, commission and metadata of every
+// registered candidate at specified block
+func (api *API) GetCandidateInfos(number *rpc.BlockNumber) ([]*CandidateInfo, error) {
+	dposContext, err := api.dposContext(number)
+	if err != nil {
+		return nil, err
+	}
+	return CandidateInfos(dposContext)
+}
+
+// CandidateInfos collects the registration details of every candidate of the
+// dpos context.
+func CandidateInfos(dposContext *types.DposContext) ([]*CandidateInfo, error) {
+	candidates, err := dposContext.GetCandidates()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]*CandidateInfo, 0, len(candidates))
+	for _, candidate := range candidates {
+		info, err := candidateInfo(dposContext, candidate)
 		if err != nil {
 			return nil, err
 		}
+		infos = append(infos, info)
 	}
-	return header.Number, nil
+	return infos, nil
+}
+
+// GetSigner retrieves the key sealing the blocks of a validator in the epoch of
+// the specified block, which is the validator itself unless it bound another
+func (api *API) GetSigner(validator common.Address, number *rpc.BlockNumber) (common.Address, error) {
+	dposContext, err := api.dposContext(number)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return dposContext.GetEpochSigner(validator)
+}
+
+// GetDeposit retrieves the deposit a candidate has locked at specified block,
+// not counting a deposit in its cooldown after the candidate logged out
+func (api *API) GetDeposit(candidate common.Address, number *rpc.BlockNumber) (*big.Int, error) {
+	dposContext, err := api.dposContext(number)
+	if err != nil {
+		return nil, err
+	}
+	return dposContext.GetDeposit(candidate)
+}
+
+// GetDelegators retrieves the list of the delegators voting for a candidate at
+// specified block
+func (api *API) GetDelegators(candidate common.Address, number *rpc.BlockNumber) ([]common.Address, error) {
+	dposContext, err := api.dposContext(number)
+	if err != nil {
+		return nil, err
+	}
+	return dposContext.GetDelegators(candidate)
+}
+
+// GetVote retrieves the candidate a delegator votes for at specified block, or
+// null if it doesn't vote
+func (api *API) GetVote(delegator common.Address, number *rpc.BlockNumber) (*common.Address, error) {
+	dposContext, err := api.dposContext(number)
+	if err != nil {
+		return nil, err
+	}
+	return dposContext.GetVote(delegator)
+}
+
+// GetVoteWeights retrieves the votes each candidate would receive in an
+// election held at specified block
+func (api *API) GetVoteWeights(number *rpc.BlockNumber) (map[common.Address]*big.Int, error) {
+	header, err := api.header(number)
+	if err != nil {
+		return nil, err
+	}
+	dposContext, err := types.NewDposContextFromProto(api.dpos.triedb, header.DposContext)
+	if err != nil {
+		return nil, err
+	}
+	epochContext := &EpochContext{
+		TimeStamp:   header.Time.Int64(),
+		DposContext: dposContext,
+		config:      api.dpos.config.At(header.Number),
+	}
+	// Votes are weighted by balance until stake locking is on
+	if !epochContext.config.Staking {
+		if epochContext.statedb, err = state.New(header.Root, state.NewDatabase(api.dpos.triedb)); err != nil {
+			return nil, err
+		}
+	}
+	candidates, err := dposContext.GetCandidates()
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return map[common.Address]*big.Int{}, nil
+	}
+	return epochContext.countVotes()
+}
+
+// GetMintCount retrieves the number of blocks a validator minted in an epoch,
+// as recorded at specified block
+func (api *API) GetMintCount(epoch uint64, validator common.Address, number *rpc.BlockNumber) (uint64, error) {
+	dposContext, err := api.dposContext(number)
+	if err != nil {
+		return 0, err
+	}
+	return dposContext.GetMintCnt(epoch, validator)
+}
+
+// GetValidatorStats retrieves, for each validator of the epoch the specified
+// block belongs to, the slots it was scheduled for up to that block and the
+// blocks it minted. Slots before the first block of the chain are ignored.
+func (api *API) GetValidatorStats(number *rpc.BlockNumber) (map[common.Address]*ValidatorStat, error) {
+	header, err := api.header(number)
+	if err != nil {
+		return nil, err
+	}
+	dposContext, err := types.NewDposContextFromProto(api.dpos.triedb, header.DposContext)
+	if err != nil {
+		return nil, err
+	}
+	config := api.dpos.config.At(header.Number)
+	from := header.Time.Int64() / config.EpochInterval * config.EpochInterval
+	if first := api.chain.GetHeaderByNumber(1); first != nil && first.Time.Int64() > from {
+		from = first.Time.Int64()
+	}
+	epochContext := &EpochContext{
+		TimeStamp:   header.Time.Int64(),
+		DposContext: dposContext,
+		config:      config,
+	}
+	return epochContext.validatorStats(from, header.Time.Int64())
+}
+
+// GetEpoch retrieves the epoch the specified block belongs to
+func (api *API) GetEpoch(number *rpc.BlockNumber) (uint64, error) {
+	header, err := api.header(number)
+	if err != nil {
+		return 0, err
+	}
+	return header.Time.Uint64() / uint64(api.dpos.config.At(header.Number).EpochInterval), nil
 }
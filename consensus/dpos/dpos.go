@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"sort"
 	"sync"
 	"time"
 
@@ -18,6 +19,7 @@ import (
 	"github.com/5sWind/bgmchain/core/types"
 	"github.com/5sWind/bgmchain/crypto"
 	"github.com/5sWind/bgmchain/crypto/sha3"
+	"github.com/5sWind/bgmchain/event"
 	"github.com/5sWind/bgmchain/log"
 	"github.com/5sWind/bgmchain/params"
 	"github.com/5sWind/bgmchain/rlp"
@@ -30,16 +32,17 @@ const (
 	extraVanity        = 32   // Fixed number of extra-data prefix bytes reserved for signer vanity
 	extraSeal          = 65   // Fixed number of extra-data suffix bytes reserved for signer seal
 	inmemorySignatures = 4096 // Number of recent block signatures to keep in memory
+	inmemoryRandao     = 16   // Number of randao hash chains of local validators to keep in memory
+)
 
-	blockInterval    = int64(10)
-	epochInterval    = int64(86400)
-	maxValidatorSize = 3
-	safeSize         = maxValidatorSize*2/3 + 1
-	consensusSize    = maxValidatorSize*2/3 + 1
+var (
+	diffInTurn = big.NewInt(2) // Block difficulty for blocks minted by the validator of their slot, with standbys enabled
+	diffNoTurn = big.NewInt(1) // Block difficulty for blocks minted by a standby, or for any block without standbys
 )
 
 var (
 	big0  = big.NewInt(0)
+	big1  = big.NewInt(1)
 	big8  = big.NewInt(8)
 	big32 = big.NewInt(32)
 
@@ -66,6 +69,12 @@ var (
 	// errInvalidUncleHash is returned if a block contains an non-empty uncle list.
 	errInvalidUncleHash  = errors.New("non empty uncle hash")
 	errInvalidDifficulty = errors.New("invalid difficulty")
+	// errUnexpectedRewardRoot is returned if a block's dpos context has a reward
+	// trie before reward sharing was turned on.
+	errUnexpectedRewardRoot = errors.New("reward root before reward sharing")
+	// errUnexpectedStakeRoot is returned if a block's dpos context has a stake
+	// trie before stake locking was turned on.
+	errUnexpectedStakeRoot = errors.New("stake root before stake locking")
 
 	// ErrInvalidTimestamp is returned if the timestamp of a block is lower than
 	// the previous block's timestamp + the minimum block period.
@@ -76,6 +85,11 @@ var (
 	ErrInvalidBlockValidator      = errors.New("invalid block validator")
 	ErrInvalidMintBlockTime       = errors.New("invalid time to mint the block")
 	ErrNilBlockHeader             = errors.New("nil block header returned")
+	ErrDifferentSlot              = errors.New("double sign evidence for different slots")
+	ErrIdenticalHeaders           = errors.New("double sign evidence with identical headers")
+	ErrDifferentSigners           = errors.New("double sign evidence sealed by different validators")
+	ErrSlotMinted                 = errors.New("slot already minted, no standby needed")
+	ErrUnauthorizedValidator      = errors.New("unauthorized validator")
 )
 var (
 	uncleHash = types.CalcUncleHash(nil) // Always Keccak256(RLP([])) as uncles are meaningless outside of PoW.
@@ -84,11 +98,16 @@ var (
 type Dpos struct {
 	config *params.DposConfig // Consensus engine configuration parameters
 	db     bgmdb.Database     // Database to store and retrieve snapshot checkpoints
+	triedb bgmdb.Database     // Database the dpos context tries are opened on
 
-	signer               common.Address
-	signFn               SignerFn
-	signatures           *lru.ARCCache // Signatures of recent blocks to speed up mining
+	validators           map[common.Address]*localValidator // Candidates the local node mints blocks for
+	signatures           *lru.ARCCache                      // Signatures of recent blocks to speed up mining
 	confirmedBlockHeader *types.Header
+	confirmedMu          sync.RWMutex // Protects the confirmed block header
+	confirmedFeed        event.Feed
+
+	randaoMu     sync.Mutex    // Serializes the creation of the randao seeds
+	randaoChains *lru.ARCCache // Randao hash chains of the local validators, by validator and epoch
 
 	mu   sync.RWMutex
 	stop chan bool
@@ -96,6 +115,27 @@ type Dpos struct {
 
 type SignerFn func(accounts.Account, []byte) ([]byte, error)
 
+// SlotSignerFn is a signer callback that is also told the validator and the
+// slot of the header it seals, so that it can refuse to sign twice for a slot.
+type SlotSignerFn func(signer accounts.Account, validator common.Address, slot int64, hash []byte) ([]byte, error)
+
+// localValidator is a candidate the local node mints blocks for.
+type localValidator struct {
+	signer common.Address // Key the blocks are sealed with, bound to the validator
+	signFn SlotSignerFn   // Function signing with that key
+}
+
+// ConfirmedHeadEvent is posted when the irreversible block advances.
+type ConfirmedHeadEvent struct{ Header *types.Header }
+
+// MissedSlotEvent is posted when a slot elapses without a block from the
+// validator scheduled for it.
+type MissedSlotEvent struct {
+	Slot      int64          // Timestamp of the missed slot
+	Validator common.Address // Validator scheduled to mint in the slot
+	Number    uint64         // Number of the first block minted after the slot, zero if none yet
+}
+
 // NOTE: sigHash was copy from clique
 // sigHash returns the hash which is used as input for the proof-of-authority
 // signing. It is the hash of the entire header apart from the 65 byte signature
@@ -130,13 +170,38 @@ func sigHash(header *types.Header) (hash common.Hash) {
 	return hash
 }
 
-func New(config *params.DposConfig, db bgmdb.Database) *Dpos {
+// SigHash returns the hash a validator signs to seal the given header.
+func SigHash(header *types.Header) common.Hash {
+	return sigHash(header)
+}
+
+// New creates a DPoS consensus engine, refusing an invalid configuration.
+func New(config *params.DposConfig, db bgmdb.Database) (*Dpos, error) {
+	// Keep a copy of the config, with its rule schedule resolved
+	conf := new(params.DposConfig)
+	if config != nil {
+		*conf = *config
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid dpos configuration: %v", err)
+	}
 	signatures, _ := lru.NewARC(inmemorySignatures)
+	randaoChains, _ := lru.NewARC(inmemoryRandao)
 	return &Dpos{
-		config:     config,
-		db:         db,
-		signatures: signatures,
-	}
+		config:       conf,
+		db:           db,
+		triedb:       db,
+		validators:   make(map[common.Address]*localValidator),
+		signatures:   signatures,
+		randaoChains: randaoChains,
+	}, nil
+}
+
+// SetTrieDatabase sets the database the dpos context tries are opened on, if
+// the recent ones are held in memory in front of the chain database. It has to
+// be called before the engine is used.
+func (d *Dpos) SetTrieDatabase(db bgmdb.Database) {
+	d.triedb = db
 }
 
 func (d *Dpos) Author(header *types.Header) (common.Address, error) {
@@ -163,18 +228,32 @@ func (d *Dpos) verifyHeader(chain consensus.ChainReader, header *types.Header, p
 	if len(header.Extra) < extraVanity+extraSeal {
 		return errMissingSignature
 	}
+	// Check the extra-data the shuffling strategy collects its randomness in
+	if err := verifyShuffleExtra(shufflerFor(d.config.At(header.Number)), header); err != nil {
+		return err
+	}
 	// Ensure that the mix digest is zero as we don't have fork protection currently
 	if header.MixDigest != (common.Hash{}) {
 		return errInvalidMixDigest
 	}
-	// Difficulty always 1
-	if header.Difficulty.Uint64() != 1 {
+	// Difficulty prefers the blocks of the scheduled validators over those of standbys
+	if header.Difficulty == nil || header.Difficulty.Cmp(calcDifficulty(d.config.At(header.Number), header.Time.Int64())) != 0 {
 		return errInvalidDifficulty
 	}
 	// Ensure that the block doesn't contain any uncles which are meaningless in DPoS
 	if header.UncleHash != uncleHash {
 		return errInvalidUncleHash
 	}
+	// The reward and stake tries only join the dpos context once their forks turned them on
+	if header.DposContext != nil {
+		rules := d.config.At(header.Number)
+		if header.DposContext.RewardHash != (common.Hash{}) && !rules.Rewards {
+			return errUnexpectedRewardRoot
+		}
+		if header.DposContext.StakeHash != (common.Hash{}) && !rules.Staking {
+			return errUnexpectedStakeRoot
+		}
+	}
 	// If all checks passed, validate any special fields for hard forks
 	if err := misc.VerifyForkHashes(chain.Config(), header, false); err != nil {
 		return err
@@ -189,7 +268,10 @@ func (d *Dpos) verifyHeader(chain consensus.ChainReader, header *types.Header, p
 	if parent == nil || parent.Number.Uint64() != number-1 || parent.Hash() != header.ParentHash {
 		return consensus.ErrUnknownAncestor
 	}
-	if parent.Time.Uint64()+uint64(blockInterval) > header.Time.Uint64() {
+	// Blocks of standbys are timed past the start of their slot, so only a block
+	// of a later slot may follow them
+	blockInterval := d.config.At(header.Number).BlockInterval
+	if parent.Time.Int64()/blockInterval*blockInterval+blockInterval > header.Time.Int64() {
 		return ErrInvalidTimestamp
 	}
 	return nil
@@ -239,42 +321,88 @@ func (d *Dpos) verifySeal(chain consensus.ChainReader, header *types.Header, par
 	} else {
 		parent = chain.GetHeader(header.ParentHash, number-1)
 	}
-	dposContext, err := types.NewDposContextFromProto(d.db, parent.DposContext)
+	dposContext, err := types.NewDposContextFromProto(d.triedb, parent.DposContext)
 	if err != nil {
 		return err
 	}
-	epochContext := &EpochContext{DposContext: dposContext}
+	epochContext := &EpochContext{DposContext: dposContext, config: d.config.At(header.Number)}
 	validator, err := epochContext.lookupValidator(header.Time.Int64())
 	if err != nil {
 		return err
 	}
-	if err := d.verifyBlockSigner(validator, header); err != nil {
+	signer, err := dposContext.GetEpochSigner(validator)
+	if err != nil {
+		return err
+	}
+	if err := d.verifyBlockSigner(validator, signer, header); err != nil {
 		return err
 	}
 	return d.updateConfirmedBlockHeader(chain)
 }
 
-func (d *Dpos) verifyBlockSigner(validator common.Address, header *types.Header) error {
-	signer, err := ecrecover(header, d.signatures)
+// VerifySealWith checks the seal of the header against the validators of the
+// dpos context of its parent and the signing key bound to the scheduled one,
+// as supplied by the caller. It is meant for light clients, which don't hold
+// the dpos context and prove the validators and signing keys instead.
+func (d *Dpos) VerifySealWith(header *types.Header, validators []common.Address, signerOf func(validator common.Address) (common.Address, error)) error {
+	if header.Number.Uint64() == 0 {
+		return errUnknownBlock
+	}
+	validator, err := scheduledValidator(d.config.At(header.Number), validators, header.Time.Int64())
+	if err != nil {
+		return err
+	}
+	signer, err := signerOf(validator)
+	if err != nil {
+		return err
+	}
+	return d.verifyBlockSigner(validator, signer, header)
+}
+
+// verifyBlockSigner checks the header names the validator scheduled for its
+// slot and is sealed by the key that validator is bound to.
+func (d *Dpos) verifyBlockSigner(validator, signer common.Address, header *types.Header) error {
+	sealer, err := ecrecover(header, d.signatures)
 	if err != nil {
 		return err
 	}
-	if bytes.Compare(signer.Bytes(), validator.Bytes()) != 0 {
+	if bytes.Compare(header.Validator.Bytes(), validator.Bytes()) != 0 {
 		return ErrInvalidBlockValidator
 	}
-	if bytes.Compare(signer.Bytes(), header.Validator.Bytes()) != 0 {
+	if bytes.Compare(sealer.Bytes(), signer.Bytes()) != 0 {
 		return ErrMismatchSignerAndValidator
 	}
 	return nil
 }
 
 func (d *Dpos) updateConfirmedBlockHeader(chain consensus.ChainReader) error {
+	d.confirmedMu.Lock()
+	confirmed, err := d.advanceConfirmedBlockHeader(chain)
+	d.confirmedMu.Unlock()
+
+	if confirmed != nil {
+		d.confirmedFeed.Send(ConfirmedHeadEvent{Header: confirmed})
+	}
+	return err
+}
+
+// UpdateConfirmedHeader moves the confirmed block header forward after headers
+// were inserted without their seals being verified against the chain, as light
+// clients do.
+func (d *Dpos) UpdateConfirmedHeader(chain consensus.ChainReader) error {
+	return d.updateConfirmedBlockHeader(chain)
+}
+
+// advanceConfirmedBlockHeader moves the confirmed block header forward to the
+// newest block built upon by enough distinct validators, returning it if it
+// changed. The caller must hold confirmedMu.
+func (d *Dpos) advanceConfirmedBlockHeader(chain consensus.ChainReader) (*types.Header, error) {
 	if d.confirmedBlockHeader == nil {
 		header, err := d.loadConfirmedBlockHeader(chain)
 		if err != nil {
 			header = chain.GetHeaderByNumber(0)
 			if header == nil {
-				return err
+				return nil, err
 			}
 		}
 		d.confirmedBlockHeader = header
@@ -285,7 +413,9 @@ func (d *Dpos) updateConfirmedBlockHeader(chain consensus.ChainReader) error {
 	validatorMap := make(map[common.Address]bool)
 	for d.confirmedBlockHeader.Hash() != curHeader.Hash() &&
 		d.confirmedBlockHeader.Number.Uint64() < curHeader.Number.Uint64() {
-		curEpoch := curHeader.Time.Int64() / epochInterval
+		config := d.config.At(curHeader.Number)
+		consensusSize := config.ConsensusSize()
+		curEpoch := curHeader.Time.Int64() / config.EpochInterval
 		if curEpoch != epoch {
 			epoch = curEpoch
 			validatorMap = make(map[common.Address]bool)
@@ -295,23 +425,173 @@ func (d *Dpos) updateConfirmedBlockHeader(chain consensus.ChainReader) error {
 		// there is no need to check block is confirmed
 		if curHeader.Number.Int64()-d.confirmedBlockHeader.Number.Int64() < int64(consensusSize-len(validatorMap)) {
 			log.Debug("Dpos fast return", "current", curHeader.Number.String(), "confirmed", d.confirmedBlockHeader.Number.String(), "witnessCount", len(validatorMap))
-			return nil
+			return nil, nil
 		}
 		validatorMap[curHeader.Validator] = true
 		if len(validatorMap) >= consensusSize {
 			d.confirmedBlockHeader = curHeader
 			if err := d.storeConfirmedBlockHeader(d.db); err != nil {
-				return err
+				return nil, err
 			}
 			log.Debug("dpos set confirmed block header success", "currentHeader", curHeader.Number.String())
-			return nil
+			return curHeader, nil
 		}
 		curHeader = chain.GetHeaderByHash(curHeader.ParentHash)
 		if curHeader == nil {
-			return ErrNilBlockHeader
+			return nil, ErrNilBlockHeader
 		}
 	}
-	return nil
+	return nil, nil
+}
+
+// ConfirmedHeader returns the header of the latest irreversible block.
+func (d *Dpos) ConfirmedHeader(chain consensus.ChainReader) (*types.Header, error) {
+	d.confirmedMu.RLock()
+	header := d.confirmedBlockHeader
+	d.confirmedMu.RUnlock()
+
+	if header != nil {
+		return header, nil
+	}
+	header, err := d.loadConfirmedBlockHeader(chain)
+	if err != nil {
+		return nil, err
+	}
+	d.confirmedMu.Lock()
+	if d.confirmedBlockHeader == nil {
+		d.confirmedBlockHeader = header
+	}
+	d.confirmedMu.Unlock()
+	return header, nil
+}
+
+// SubscribeConfirmedHeadEvent registers a subscription of ConfirmedHeadEvent.
+func (d *Dpos) SubscribeConfirmedHeadEvent(ch chan<- ConfirmedHeadEvent) event.Subscription {
+	return d.confirmedFeed.Subscribe(ch)
+}
+
+// MissedSlots returns the slots which elapsed between the parent of the header
+// and the header itself, along with the validators scheduled for them. At most
+// an epoch worth of slots is returned, and none before the first block.
+func (d *Dpos) MissedSlots(chain consensus.ChainReader, header *types.Header) ([]MissedSlotEvent, error) {
+	number := header.Number.Uint64()
+	if number <= 1 {
+		return nil, nil
+	}
+	parent := chain.GetHeader(header.ParentHash, number-1)
+	if parent == nil {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	var (
+		config        = d.config.At(header.Number)
+		from          = parent.Time.Int64() + 1
+		to            = header.Time.Int64()
+		boundary      = (parent.Time.Int64()/config.EpochInterval + 1) * config.EpochInterval
+		missed        []MissedSlotEvent
+		appendMissing = func(proto *types.DposContextProto, from, to int64) error {
+			if from >= to {
+				return nil
+			}
+			dposContext, err := types.NewDposContextFromProto(d.triedb, proto)
+			if err != nil {
+				return err
+			}
+			assignments, err := (&EpochContext{DposContext: dposContext, config: config}).schedule(from, to)
+			if err != nil {
+				return err
+			}
+			for _, assignment := range assignments {
+				missed = append(missed, MissedSlotEvent{Slot: assignment.slot, Validator: assignment.validator, Number: number})
+			}
+			return nil
+		}
+	)
+	if to-from > config.EpochInterval {
+		from = to - config.EpochInterval
+	}
+	// Slots of the parent's epoch were scheduled by its validators, later ones
+	// by the validators the header itself elected.
+	if from < boundary {
+		end := boundary
+		if to < end {
+			end = to
+		}
+		if err := appendMissing(parent.DposContext, from, end); err != nil {
+			return nil, err
+		}
+		from = end
+	}
+	if err := appendMissing(header.DposContext, from, to); err != nil {
+		return nil, err
+	}
+	return missed, nil
+}
+
+// OverdueSlots returns the slots after the head of the chain whose deadline
+// passed by the given time without a block, along with the validators scheduled
+// for them. A slot is overdue once the next one starts. Only the slots of the
+// head's epoch are returned, the validators of the next ones aren't elected yet.
+// The events carry no block number, there is none after the slots.
+func (d *Dpos) OverdueSlots(head *types.Header, now int64) ([]MissedSlotEvent, error) {
+	config := d.config.At(head.Number)
+	to := now - config.BlockInterval + 1
+	if boundary := (head.Time.Int64()/config.EpochInterval + 1) * config.EpochInterval; to > boundary {
+		to = boundary
+	}
+	if head.Number.Sign() == 0 || head.Time.Int64()+1 >= to {
+		return nil, nil
+	}
+	dposContext, err := types.NewDposContextFromProto(d.triedb, head.DposContext)
+	if err != nil {
+		return nil, err
+	}
+	assignments, err := (&EpochContext{DposContext: dposContext, config: config}).schedule(head.Time.Int64()+1, to)
+	if err != nil {
+		return nil, err
+	}
+	overdue := make([]MissedSlotEvent, 0, len(assignments))
+	for _, assignment := range assignments {
+		overdue = append(overdue, MissedSlotEvent{Slot: assignment.slot, Validator: assignment.validator})
+	}
+	return overdue, nil
+}
+
+// Validators returns the candidates the engine mints blocks for, in address
+// order.
+func (d *Dpos) Validators() []common.Address {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	validators := make([]common.Address, 0, len(d.validators))
+	for validator := range d.validators {
+		validators = append(validators, validator)
+	}
+	sort.Slice(validators, func(i, j int) bool {
+		return bytes.Compare(validators[i].Bytes(), validators[j].Bytes()) < 0
+	})
+	return validators
+}
+
+// Authorized reports whether the engine mints blocks for the given candidate.
+func (d *Dpos) Authorized(validator common.Address) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	_, ok := d.validators[validator]
+	return ok
+}
+
+// signer returns the key the blocks of a local validator are sealed with and
+// the function signing with it.
+func (d *Dpos) signer(validator common.Address) (common.Address, SlotSignerFn, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	local, ok := d.validators[validator]
+	if !ok {
+		return common.Address{}, nil, false
+	}
+	return local.signer, local.signFn, true
 }
 
 func (s *Dpos) loadConfirmedBlockHeader(chain consensus.ChainReader) (*types.Header, error) {
@@ -337,18 +617,30 @@ func (d *Dpos) Prepare(chain consensus.ChainReader, header *types.Header) error
 	if len(header.Extra) < extraVanity {
 		header.Extra = append(header.Extra, bytes.Repeat([]byte{0x00}, extraVanity-len(header.Extra))...)
 	}
+	shuffler := shufflerFor(d.config.At(header.Number))
 	header.Extra = header.Extra[:extraVanity]
-	header.Extra = append(header.Extra, make([]byte, extraSeal)...)
+	header.Extra = append(header.Extra, make([]byte, shuffler.extraSize()+extraSeal)...)
 	parent := chain.GetHeader(header.ParentHash, number-1)
 	if parent == nil {
 		return consensus.ErrUnknownAncestor
 	}
 	header.Difficulty = d.CalcDifficulty(chain, header.Time.Uint64(), parent)
-	header.Validator = d.signer
-	return nil
+	// Keep the local validator picked for the slot, if any
+	if !d.Authorized(header.Validator) {
+		header.Validator = common.Address{}
+		if validators := d.Validators(); len(validators) > 0 {
+			header.Validator = validators[0]
+		}
+	}
+	return shuffler.prepare(d, parent, header, shuffleExtra(shuffler, header))
 }
 
-func AccumulateRewards(config *params.ChainConfig, state *state.StateDB, header *types.Header, uncles []*types.Header) {
+// AccumulateRewards credits the coinbase of the given block with the mining
+// reward. Once reward sharing is on, only the commission of the validator goes
+// to the coinbase and the rest is pooled in the dpos context until the epoch
+// ends and it is distributed to the validator's delegators. Before it, or
+// without a dpos context, the whole reward is credited to the coinbase.
+func AccumulateRewards(config *params.ChainConfig, state *state.StateDB, header *types.Header, uncles []*types.Header, dposContext *types.DposContext) error {
 	// Select the correct block reward based on chain progression
 	blockReward := frontierBlockReward
 	if config.IsByzantium(header.Number) {
@@ -356,41 +648,75 @@ func AccumulateRewards(config *params.ChainConfig, state *state.StateDB, header
 	}
 	// Accumulate the rewards for the miner and any included uncles
 	reward := new(big.Int).Set(blockReward)
+	if dposContext != nil && config.Dpos.At(header.Number).Rewards {
+		commission, _, err := dposContext.GetCommission(header.Validator)
+		if err != nil {
+			return err
+		}
+		shared := new(big.Int).Mul(reward, new(big.Int).SetUint64(types.MaxCommission-commission))
+		shared.Div(shared, new(big.Int).SetUint64(types.MaxCommission))
+		if shared.Sign() > 0 {
+			if err := dposContext.AddRewardPool(header.Validator, shared); err != nil {
+				return err
+			}
+			reward.Sub(reward, shared)
+		}
+	}
 	state.AddBalance(header.Coinbase, reward)
+	return nil
 }
 
 func (d *Dpos) Finalize(chain consensus.ChainReader, header *types.Header, state *state.StateDB, txs []*types.Transaction,
 	uncles []*types.Header, receipts []*types.Receipt, dposContext *types.DposContext) (*types.Block, error) {
-	// Accumulate block rewards and commit the final state root
-	AccumulateRewards(chain.Config(), state, header, uncles)
-	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
-
 	parent := chain.GetHeaderByHash(header.ParentHash)
+	config := d.config.At(header.Number)
 	epochContext := &EpochContext{
 		statedb:     state,
 		DposContext: dposContext,
 		TimeStamp:   header.Time.Int64(),
+		config:      config,
+	}
+	// Accumulate block rewards, pay out the delegators and unbonded stake when
+	// the epoch is over and commit the final state root
+	if err := AccumulateRewards(chain.Config(), state, header, uncles, dposContext); err != nil {
+		return nil, fmt.Errorf("got error when accumulate rewards, err: %s", err)
+	}
+	if parent.Time.Int64()/config.EpochInterval < header.Time.Int64()/config.EpochInterval {
+		if err := epochContext.distributeRewards(); err != nil {
+			return nil, fmt.Errorf("got error when distribute rewards, err: %s", err)
+		}
+		if err := epochContext.releaseUnbondings(); err != nil {
+			return nil, fmt.Errorf("got error when release unbondings, err: %s", err)
+		}
 	}
+	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
+
 	if timeOfFirstBlock == 0 {
 		if firstBlockHeader := chain.GetHeaderByNumber(1); firstBlockHeader != nil {
 			timeOfFirstBlock = firstBlockHeader.Time.Int64()
 		}
 	}
 	genesis := chain.GetHeaderByNumber(0)
-	err := epochContext.tryElect(genesis, parent)
+	err := epochContext.electAt(header.Number, genesis, parent, chain.GetHeader)
 	if err != nil {
 		return nil, fmt.Errorf("got error when elect next epoch, err: %s", err)
 	}
+	shuffler := shufflerFor(config)
+	if err := shuffler.accumulate(dposContext, header, shuffleExtra(shuffler, header)); err != nil {
+		return nil, err
+	}
 
 	//update mint count trie
-	updateMintCnt(parent.Time.Int64(), header.Time.Int64(), header.Validator, dposContext)
+	updateMintCnt(parent.Time.Int64(), header.Time.Int64(), config.EpochInterval, header.Validator, dposContext)
 	header.DposContext = dposContext.ToProto()
 	return types.NewBlock(header, txs, uncles, receipts), nil
 }
 
 func (d *Dpos) checkDeadline(lastBlock *types.Block, now int64) error {
-	prevSlot := PrevSlot(now)
-	nextSlot := NextSlot(now)
+	config := d.config.At(new(big.Int).Add(lastBlock.Number(), big1))
+	blockInterval := config.BlockInterval
+	prevSlot := PrevSlot(now, blockInterval)
+	nextSlot := NextSlot(now, blockInterval)
 	if lastBlock.Time().Int64() >= nextSlot {
 		return ErrMintFutureBlock
 	}
@@ -398,26 +724,47 @@ func (d *Dpos) checkDeadline(lastBlock *types.Block, now int64) error {
 	if lastBlock.Time().Int64() == prevSlot || nextSlot-now <= 1 {
 		return nil
 	}
+	// the slot under way is past its grace period, its standby may step in
+	if isStandbyTime(config, now) {
+		return nil
+	}
 	return ErrWaitForPrevBlock
 }
 
-func (d *Dpos) CheckValidator(lastBlock *types.Block, now int64) error {
+// CheckValidator checks whether one of the local validators may mint on top
+// of the last block at the given time, and returns it.
+func (d *Dpos) CheckValidator(lastBlock *types.Block, now int64) (common.Address, error) {
 	if err := d.checkDeadline(lastBlock, now); err != nil {
-		return err
+		return common.Address{}, err
 	}
-	dposContext, err := types.NewDposContextFromProto(d.db, lastBlock.Header().DposContext)
+	dposContext, err := types.NewDposContextFromProto(d.triedb, lastBlock.Header().DposContext)
 	if err != nil {
-		return err
+		return common.Address{}, err
 	}
-	epochContext := &EpochContext{DposContext: dposContext}
+	number := new(big.Int).Add(lastBlock.Number(), big1)
+	config := d.config.At(number)
+	epochContext := &EpochContext{DposContext: dposContext, config: config}
 	validator, err := epochContext.lookupValidator(now)
 	if err != nil {
-		return err
+		return common.Address{}, err
 	}
-	if (validator == common.Address{}) || bytes.Compare(validator.Bytes(), d.signer.Bytes()) != 0 {
-		return ErrInvalidBlockValidator
+	// A standby only steps in for a slot still left empty
+	if isStandbyTime(config, now) && lastBlock.Time().Int64() >= now/config.BlockInterval*config.BlockInterval {
+		return common.Address{}, ErrSlotMinted
 	}
-	return nil
+	localSigner, _, ok := d.signer(validator)
+	if (validator == common.Address{}) || !ok {
+		return common.Address{}, ErrInvalidBlockValidator
+	}
+	// A rotated signing key only takes over at the epoch boundary
+	signer, err := dposContext.GetEpochSigner(validator)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if bytes.Compare(signer.Bytes(), localSigner.Bytes()) != 0 {
+		return common.Address{}, ErrMismatchSignerAndValidator
+	}
+	return validator, nil
 }
 
 // Seal generates a new block for the given input block with the local miner's
@@ -429,8 +776,9 @@ func (d *Dpos) Seal(chain consensus.ChainReader, block *types.Block, stop <-chan
 	if number == 0 {
 		return nil, errUnknownBlock
 	}
+	// Wait for the slot, or the end of its grace period for a standby
 	now := time.Now().Unix()
-	delay := NextSlot(now) - now
+	delay := header.Time.Int64() - now
 	if delay > 0 {
 		select {
 		case <-stop:
@@ -441,7 +789,13 @@ func (d *Dpos) Seal(chain consensus.ChainReader, block *types.Block, stop <-chan
 	block.Header().Time.SetInt64(time.Now().Unix())
 
 	// time's up, sign the block
-	sighash, err := d.signFn(accounts.Account{Address: d.signer}, sigHash(header).Bytes())
+	signer, signFn, ok := d.signer(header.Validator)
+	if !ok {
+		return nil, ErrUnauthorizedValidator
+	}
+	blockInterval := d.config.At(header.Number).BlockInterval
+	slot := header.Time.Int64() / blockInterval * blockInterval
+	sighash, err := signFn(accounts.Account{Address: signer}, header.Validator, slot, sigHash(header).Bytes())
 	if err != nil {
 		return nil, err
 	}
@@ -450,7 +804,18 @@ func (d *Dpos) Seal(chain consensus.ChainReader, block *types.Block, stop <-chan
 }
 
 func (d *Dpos) CalcDifficulty(chain consensus.ChainReader, time uint64, parent *types.Header) *big.Int {
-	return big.NewInt(1)
+	return calcDifficulty(d.config.At(new(big.Int).Add(parent.Number, big1)), int64(time))
+}
+
+// calcDifficulty returns the difficulty of a block minted at the given time.
+// Once standbys are enabled, blocks minted at the start of their slot weigh
+// more than those of standbys, so that the block of the scheduled validator
+// wins over the one of its standby if both show up.
+func calcDifficulty(config *params.DposRules, time int64) *big.Int {
+	if config.StandbyGracePeriod > 0 && time%config.BlockInterval == 0 {
+		return new(big.Int).Set(diffInTurn)
+	}
+	return new(big.Int).Set(diffNoTurn)
 }
 
 func (d *Dpos) APIs(chain consensus.ChainReader) []rpc.API {
@@ -462,19 +827,82 @@ func (d *Dpos) APIs(chain consensus.ChainReader) []rpc.API {
 	}}
 }
 
-func (d *Dpos) Authorize(signer common.Address, signFn SignerFn) {
+// Authorize adds a candidate to mint blocks for, along with the key bound to it
+// to seal them with and the function signing with that key, replacing those of
+// an already authorized candidate. The signer is the validator itself unless
+// the candidate bound a separate signing key.
+func (d *Dpos) Authorize(validator, signer common.Address, signFn SignerFn) {
+	d.AuthorizeSlotSigner(validator, signer, func(account accounts.Account, _ common.Address, _ int64, hash []byte) ([]byte, error) {
+		return signFn(account, hash)
+	})
+}
+
+// AuthorizeSlotSigner is like Authorize, sealing the blocks with a signer that
+// is told the slot of every header it signs.
+func (d *Dpos) AuthorizeSlotSigner(validator, signer common.Address, signFn SlotSignerFn) {
+	d.mu.Lock()
+	d.validators[validator] = &localValidator{signer: signer, signFn: signFn}
+	d.mu.Unlock()
+}
+
+// Deauthorize stops minting blocks for a candidate.
+func (d *Dpos) Deauthorize(validator common.Address) {
 	d.mu.Lock()
-	d.signer = signer
-	d.signFn = signFn
+	delete(d.validators, validator)
 	d.mu.Unlock()
 }
 
-// ecrecover extracts the Bgmchain account address from a signed header.
+// VerifyDoubleSign checks that the evidence holds two different headers for
+// the same slot and validator, both sealed by the same key, and returns that
+// validator, key and slot. Blocks of standbys are timed past the start of their
+// slot, so the headers are matched by the slot they fall in, which is the start
+// time of the slot under the rules at their height. Whether the key belongs to
+// the validator depends on its signer binding, which is left to the caller.
+func VerifyDoubleSign(config *params.DposConfig, evidence *types.DoubleSignEvidence) (common.Address, common.Address, uint64, error) {
+	first, second := evidence.First, evidence.Second
+	slots := make([]uint64, 2)
+	for i, header := range []*types.Header{first, second} {
+		if len(header.Extra) < extraVanity+extraSeal {
+			return common.Address{}, common.Address{}, 0, errMissingSignature
+		}
+		if header.DposContext == nil || header.Time.Sign() < 0 {
+			return common.Address{}, common.Address{}, 0, types.ErrInvalidEvidence
+		}
+		blockInterval := uint64(config.At(header.Number).BlockInterval)
+		slots[i] = header.Time.Uint64() / blockInterval * blockInterval
+	}
+	if slots[0] != slots[1] {
+		return common.Address{}, common.Address{}, 0, ErrDifferentSlot
+	}
+	if sigHash(first) == sigHash(second) {
+		return common.Address{}, common.Address{}, 0, ErrIdenticalHeaders
+	}
+	firstSigner, err := ecrecover(first, nil)
+	if err != nil {
+		return common.Address{}, common.Address{}, 0, err
+	}
+	secondSigner, err := ecrecover(second, nil)
+	if err != nil {
+		return common.Address{}, common.Address{}, 0, err
+	}
+	if firstSigner != secondSigner {
+		return common.Address{}, common.Address{}, 0, ErrDifferentSigners
+	}
+	if first.Validator != second.Validator {
+		return common.Address{}, common.Address{}, 0, ErrMismatchSignerAndValidator
+	}
+	return first.Validator, firstSigner, slots[0], nil
+}
+
+// ecrecover extracts the Bgmchain account address from a signed header. The
+// signature cache is optional.
 func ecrecover(header *types.Header, sigcache *lru.ARCCache) (common.Address, error) {
 	// If the signature's already cached, return that
 	hash := header.Hash()
-	if address, known := sigcache.Get(hash); known {
-		return address.(common.Address), nil
+	if sigcache != nil {
+		if address, known := sigcache.Get(hash); known {
+			return address.(common.Address), nil
+		}
 	}
 	// Retrieve the signature from the header extra-data
 	if len(header.Extra) < extraSeal {
@@ -488,20 +916,22 @@ func ecrecover(header *types.Header, sigcache *lru.ARCCache) (common.Address, er
 	}
 	var signer common.Address
 	copy(signer[:], crypto.Keccak256(pubkey[1:])[12:])
-	sigcache.Add(hash, signer)
+	if sigcache != nil {
+		sigcache.Add(hash, signer)
+	}
 	return signer, nil
 }
 
-func PrevSlot(now int64) int64 {
+func PrevSlot(now, blockInterval int64) int64 {
 	return int64((now-1)/blockInterval) * blockInterval
 }
 
-func NextSlot(now int64) int64 {
+func NextSlot(now, blockInterval int64) int64 {
 	return int64((now+blockInterval-1)/blockInterval) * blockInterval
 }
 
 // update counts in MintCntTrie for the miner of newBlock
-func updateMintCnt(parentBlockTime, currentBlockTime int64, validator common.Address, dposContext *types.DposContext) {
+func updateMintCnt(parentBlockTime, currentBlockTime, epochInterval int64, validator common.Address, dposContext *types.DposContext) {
 	currentMintCntTrie := dposContext.MintCntTrie()
 	currentEpoch := parentBlockTime / epochInterval
 	currentEpochBytes := make([]byte, 8)
@@ -1,18 +1,32 @@
 package dpos
 
 import (
+	"crypto/ecdsa"
+	"math/big"
 	"testing"
 
 	"encoding/binary"
 
 	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/consensus"
+	"github.com/5sWind/bgmchain/core/state"
 	"github.com/5sWind/bgmchain/core/types"
+	"github.com/5sWind/bgmchain/crypto"
 	"github.com/5sWind/bgmchain/bgmdb"
+	"github.com/5sWind/bgmchain/params"
 	"github.com/5sWind/bgmchain/trie"
 	"github.com/stretchr/testify/assert"
 )
 
 var (
+	testConfig       = new(params.DposConfig)
+	testRules        = testConfig.At(big.NewInt(0))
+	stakingRules     = (&params.DposConfig{Staking: true}).At(big.NewInt(0))
+	blockInterval    = testRules.BlockInterval
+	epochInterval    = testRules.EpochInterval
+	maxValidatorSize = testRules.MaxValidatorSize
+	safeSize         = testRules.SafeSize()
+
 	MockEpoch = []string{
 		"0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6e",
 		"0xa60a3886b552ff9992cfcd208ec1152079e046c2",
@@ -90,7 +104,7 @@ func TestUpdateMintCnt(t *testing.T) {
 	blockTime := int64(epochInterval + blockInterval)
 
 	beforeUpdateCnt := getMintCnt(blockTime/epochInterval, miner, dposContext.MintCntTrie())
-	updateMintCnt(lastTime, blockTime, miner, dposContext)
+	updateMintCnt(lastTime, blockTime, epochInterval, miner, dposContext)
 	afterUpdateCnt := getMintCnt(blockTime/epochInterval, miner, dposContext.MintCntTrie())
 	assert.Equal(t, int64(0), beforeUpdateCnt)
 	assert.Equal(t, int64(1), afterUpdateCnt)
@@ -102,7 +116,7 @@ func TestUpdateMintCnt(t *testing.T) {
 
 	// currentBlock has recorded the count for the newMiner before UpdateMintCnt
 	beforeUpdateCnt = getMintCnt(blockTime/epochInterval, miner, dposContext.MintCntTrie())
-	updateMintCnt(lastTime, blockTime, miner, dposContext)
+	updateMintCnt(lastTime, blockTime, epochInterval, miner, dposContext)
 	afterUpdateCnt = getMintCnt(blockTime/epochInterval, miner, dposContext.MintCntTrie())
 	assert.Equal(t, int64(1), beforeUpdateCnt)
 	assert.Equal(t, int64(2), afterUpdateCnt)
@@ -111,8 +125,301 @@ func TestUpdateMintCnt(t *testing.T) {
 	blockTime = epochInterval * 2
 
 	beforeUpdateCnt = getMintCnt(blockTime/epochInterval, miner, dposContext.MintCntTrie())
-	updateMintCnt(lastTime, blockTime, miner, dposContext)
+	updateMintCnt(lastTime, blockTime, epochInterval, miner, dposContext)
 	afterUpdateCnt = getMintCnt(blockTime/epochInterval, miner, dposContext.MintCntTrie())
 	assert.Equal(t, int64(0), beforeUpdateCnt)
 	assert.Equal(t, int64(1), afterUpdateCnt)
 }
+
+// testChainReader is a consensus.ChainReader over a fixed set of headers.
+type testChainReader struct {
+	consensus.ChainReader
+	headers map[common.Hash]*types.Header
+}
+
+func (r *testChainReader) GetHeader(hash common.Hash, number uint64) *types.Header {
+	return r.headers[hash]
+}
+
+func TestMissedSlots(t *testing.T) {
+	db, _ := bgmdb.NewMemDatabase()
+	engine, _ := New(testConfig, db)
+
+	committed := func(names ...string) *types.DposContextProto {
+		dposContext, err := types.NewDposContext(db)
+		assert.Nil(t, err)
+		var validators []common.Address
+		for _, name := range names {
+			validators = append(validators, common.StringToAddress(name))
+		}
+		assert.Nil(t, dposContext.SetValidators(validators))
+		proto, err := dposContext.CommitTo(db)
+		assert.Nil(t, err)
+		return proto
+	}
+	chain := &testChainReader{headers: make(map[common.Hash]*types.Header)}
+	header := func(number, time int64, proto *types.DposContextProto) *types.Header {
+		h := &types.Header{Number: big.NewInt(number), Time: big.NewInt(time), DposContext: proto}
+		chain.headers[h.Hash()] = h
+		return h
+	}
+	current := committed("addr1", "addr2", "addr3")
+	elected := committed("addr4", "addr5")
+
+	// Consecutive blocks miss no slot
+	parent := header(5, epochInterval+10*blockInterval, current)
+	child := header(6, epochInterval+11*blockInterval, current)
+	child.ParentHash = parent.Hash()
+	missed, err := engine.MissedSlots(chain, child)
+	assert.Nil(t, err)
+	assert.Empty(t, missed)
+
+	// Gaps within an epoch are reported with the parent's validators
+	child = header(6, epochInterval+14*blockInterval, current)
+	child.ParentHash = parent.Hash()
+	missed, err = engine.MissedSlots(chain, child)
+	assert.Nil(t, err)
+	assert.Equal(t, []MissedSlotEvent{
+		{Slot: epochInterval + 11*blockInterval, Validator: common.StringToAddress("addr3"), Number: 6},
+		{Slot: epochInterval + 12*blockInterval, Validator: common.StringToAddress("addr1"), Number: 6},
+		{Slot: epochInterval + 13*blockInterval, Validator: common.StringToAddress("addr2"), Number: 6},
+	}, missed)
+
+	// Slots of a new epoch were scheduled by the validators elected in the child
+	parent = header(5, 2*epochInterval-blockInterval, current)
+	child = header(6, 2*epochInterval+2*blockInterval, elected)
+	child.ParentHash = parent.Hash()
+	missed, err = engine.MissedSlots(chain, child)
+	assert.Nil(t, err)
+	assert.Equal(t, []MissedSlotEvent{
+		{Slot: 2 * epochInterval, Validator: common.StringToAddress("addr4"), Number: 6},
+		{Slot: 2*epochInterval + blockInterval, Validator: common.StringToAddress("addr5"), Number: 6},
+	}, missed)
+}
+
+func TestOverdueSlots(t *testing.T) {
+	db, _ := bgmdb.NewMemDatabase()
+	engine, _ := New(testConfig, db)
+
+	dposContext, err := types.NewDposContext(db)
+	assert.Nil(t, err)
+	assert.Nil(t, dposContext.SetValidators([]common.Address{common.StringToAddress("addr1"), common.StringToAddress("addr2")}))
+	proto, err := dposContext.CommitTo(db)
+	assert.Nil(t, err)
+	head := &types.Header{Number: big.NewInt(5), Time: big.NewInt(epochInterval + 10*blockInterval), DposContext: proto}
+
+	// The next slot isn't overdue until the one after starts
+	overdue, err := engine.OverdueSlots(head, epochInterval+12*blockInterval-1)
+	assert.Nil(t, err)
+	assert.Empty(t, overdue)
+
+	overdue, err = engine.OverdueSlots(head, epochInterval+13*blockInterval)
+	assert.Nil(t, err)
+	assert.Equal(t, []MissedSlotEvent{
+		{Slot: epochInterval + 11*blockInterval, Validator: common.StringToAddress("addr2")},
+		{Slot: epochInterval + 12*blockInterval, Validator: common.StringToAddress("addr1")},
+	}, overdue)
+
+	// Slots of the next epoch aren't scheduled yet
+	overdue, err = engine.OverdueSlots(head, 3*epochInterval)
+	assert.Nil(t, err)
+	assert.Len(t, overdue, int(epochInterval/blockInterval-11))
+}
+
+func TestVerifySealWithSigner(t *testing.T) {
+	validatorKey, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	signerKey, _ := crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+	validator := crypto.PubkeyToAddress(validatorKey.PublicKey)
+	signer := crypto.PubkeyToAddress(signerKey.PublicKey)
+
+	db, _ := bgmdb.NewMemDatabase()
+	engine, _ := New(testConfig, db)
+	sealed := func(validator common.Address, key *ecdsa.PrivateKey) *types.Header {
+		header := &types.Header{
+			Number:      big.NewInt(1),
+			Time:        big.NewInt(epochInterval),
+			Validator:   validator,
+			Extra:       make([]byte, extraVanity+extraSeal),
+			DposContext: &types.DposContextProto{},
+		}
+		sig, err := crypto.Sign(sigHash(header).Bytes(), key)
+		assert.Nil(t, err)
+		copy(header.Extra[extraVanity:], sig)
+		return header
+	}
+	boundTo := func(signer common.Address) func(common.Address) (common.Address, error) {
+		return func(common.Address) (common.Address, error) { return signer, nil }
+	}
+	validators := []common.Address{validator}
+
+	// Without a binding the validator seals its own blocks
+	assert.Nil(t, engine.VerifySealWith(sealed(validator, validatorKey), validators, boundTo(validator)))
+	assert.Equal(t, ErrMismatchSignerAndValidator, engine.VerifySealWith(sealed(validator, signerKey), validators, boundTo(validator)))
+
+	// With a binding only the bound key may seal, for the scheduled validator
+	assert.Nil(t, engine.VerifySealWith(sealed(validator, signerKey), validators, boundTo(signer)))
+	assert.Equal(t, ErrMismatchSignerAndValidator, engine.VerifySealWith(sealed(validator, validatorKey), validators, boundTo(signer)))
+	assert.Equal(t, ErrInvalidBlockValidator, engine.VerifySealWith(sealed(signer, signerKey), validators, boundTo(signer)))
+}
+
+func TestVerifyDoubleSignStandby(t *testing.T) {
+	validatorKey, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	validator := crypto.PubkeyToAddress(validatorKey.PublicKey)
+
+	config := *testConfig
+	config.StandbyGracePeriod = 5
+	sealed := func(time int64, coinbase common.Address) *types.Header {
+		header := &types.Header{
+			Number:      big.NewInt(1),
+			Time:        big.NewInt(time),
+			Coinbase:    coinbase,
+			Validator:   validator,
+			Extra:       make([]byte, extraVanity+extraSeal),
+			DposContext: &types.DposContextProto{},
+		}
+		sig, err := crypto.Sign(sigHash(header).Bytes(), validatorKey)
+		assert.Nil(t, err)
+		copy(header.Extra[extraVanity:], sig)
+		return header
+	}
+	slot := epochInterval
+	grace := slot + config.StandbyGracePeriod
+
+	// A standby minting twice in one slot is caught even at different seconds
+	evidence := &types.DoubleSignEvidence{First: sealed(grace, validator), Second: sealed(grace+1, common.Address{})}
+	offender, signer, slashed, err := VerifyDoubleSign(&config, evidence)
+	assert.Nil(t, err)
+	assert.Equal(t, validator, offender)
+	assert.Equal(t, validator, signer)
+	assert.Equal(t, uint64(slot), slashed)
+
+	evidence = &types.DoubleSignEvidence{First: sealed(slot, validator), Second: sealed(slot+blockInterval-1, validator)}
+	_, _, slashed, err = VerifyDoubleSign(&config, evidence)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(slot), slashed)
+
+	// Blocks of consecutive slots are no evidence
+	evidence = &types.DoubleSignEvidence{First: sealed(grace, validator), Second: sealed(slot+blockInterval, validator)}
+	_, _, _, err = VerifyDoubleSign(&config, evidence)
+	assert.Equal(t, ErrDifferentSlot, err)
+}
+
+func TestCheckStandbyValidator(t *testing.T) {
+	db, _ := bgmdb.NewMemDatabase()
+	config := *testConfig
+	config.StandbyGracePeriod = 5
+	engine, _ := New(&config, db)
+
+	validators := []common.Address{
+		common.StringToAddress("addr1"),
+		common.StringToAddress("addr2"),
+		common.StringToAddress("addr3"),
+	}
+	dposContext, err := types.NewDposContext(db)
+	assert.Nil(t, err)
+	assert.Nil(t, dposContext.SetValidators(validators))
+	proto, err := dposContext.CommitTo(db)
+	assert.Nil(t, err)
+	lastBlock := func(time int64) *types.Block {
+		return types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1), Time: big.NewInt(time), DposContext: proto})
+	}
+	slot := epochInterval
+	grace := slot + config.StandbyGracePeriod
+
+	checkValidator := func(lastBlock *types.Block, now int64) error {
+		_, err := engine.CheckValidator(lastBlock, now)
+		return err
+	}
+
+	// The next validator in the rotation stands in for an empty slot once its
+	// grace period is over
+	engine.Authorize(validators[1], validators[1], nil)
+	assert.Equal(t, ErrWaitForPrevBlock, checkValidator(lastBlock(slot-blockInterval), grace-1))
+	assert.Nil(t, checkValidator(lastBlock(slot-blockInterval), grace))
+	assert.Nil(t, checkValidator(lastBlock(slot-blockInterval), slot+blockInterval-1))
+	assert.Equal(t, ErrSlotMinted, checkValidator(lastBlock(slot), grace))
+	assert.Equal(t, ErrSlotMinted, checkValidator(lastBlock(grace), slot+blockInterval-1))
+
+	engine.Deauthorize(validators[1])
+	engine.Authorize(validators[2], validators[2], nil)
+	assert.Equal(t, ErrInvalidBlockValidator, checkValidator(lastBlock(slot-blockInterval), grace))
+
+	// Blocks of the scheduled validator outweigh those of standbys
+	rules := engine.config.At(big0)
+	assert.Equal(t, diffInTurn, calcDifficulty(rules, slot))
+	assert.Equal(t, diffNoTurn, calcDifficulty(rules, grace))
+	assert.Equal(t, diffNoTurn, calcDifficulty(testRules, slot))
+}
+
+func TestCheckLocalValidators(t *testing.T) {
+	db, _ := bgmdb.NewMemDatabase()
+	engine, _ := New(testConfig, db)
+
+	validators := []common.Address{
+		common.StringToAddress("addr1"),
+		common.StringToAddress("addr2"),
+		common.StringToAddress("addr3"),
+	}
+	dposContext, err := types.NewDposContext(db)
+	assert.Nil(t, err)
+	assert.Nil(t, dposContext.SetValidators(validators))
+	proto, err := dposContext.CommitTo(db)
+	assert.Nil(t, err)
+	lastBlock := func(time int64) *types.Block {
+		return types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1), Time: big.NewInt(time), DposContext: proto})
+	}
+
+	// A single node mints the slots of every validator it was authorized for
+	engine.Authorize(validators[2], validators[2], nil)
+	engine.Authorize(validators[0], validators[0], nil)
+	assert.Equal(t, []common.Address{validators[0], validators[2]}, engine.Validators())
+	for i, validator := range validators {
+		slot := epochInterval + int64(i)*blockInterval
+		local, err := engine.CheckValidator(lastBlock(slot-blockInterval), slot)
+		if validator == validators[1] {
+			assert.Equal(t, ErrInvalidBlockValidator, err)
+			continue
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, validator, local)
+	}
+
+	// Deauthorized validators are no longer minted for
+	assert.True(t, engine.Authorized(validators[2]))
+	engine.Deauthorize(validators[2])
+	assert.False(t, engine.Authorized(validators[2]))
+	slot := epochInterval + 2*blockInterval
+	_, err = engine.CheckValidator(lastBlock(slot-blockInterval), slot)
+	assert.Equal(t, ErrInvalidBlockValidator, err)
+}
+
+func TestAccumulateRewards(t *testing.T) {
+	var (
+		validator = common.HexToAddress(MockEpoch[0])
+		coinbase  = common.HexToAddress(MockEpoch[1])
+		header    = &types.Header{Number: big.NewInt(1), Validator: validator, Coinbase: coinbase}
+		rate      = uint64(10)
+	)
+	accumulate := func(rewards bool) (*big.Int, *big.Int) {
+		db, _ := bgmdb.NewMemDatabase()
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+		dposContext, _ := types.NewDposContext(db)
+		assert.Nil(t, dposContext.SetCommission(validator, &rate))
+
+		config := *params.DposChainConfig
+		config.Dpos = &params.DposConfig{Rewards: rewards}
+		assert.Nil(t, AccumulateRewards(&config, statedb, header, nil, dposContext))
+		pool, err := dposContext.GetRewardPool(validator)
+		assert.Nil(t, err)
+		return statedb.GetBalance(coinbase), pool
+	}
+	// Before reward sharing the coinbase keeps the whole reward
+	credited, pooled := accumulate(false)
+	assert.Equal(t, byzantiumBlockReward, credited)
+	assert.Equal(t, int64(0), pooled.Int64())
+
+	// Afterwards it only keeps the commission, the rest is pooled
+	credited, pooled = accumulate(true)
+	assert.Equal(t, new(big.Int).Div(byzantiumBlockReward, big.NewInt(10)), credited)
+	assert.Equal(t, new(big.Int).Sub(byzantiumBlockReward, credited), pooled)
+}
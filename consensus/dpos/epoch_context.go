@@ -9,10 +9,11 @@ import (
 	"sort"
 
 	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/consensus"
 	"github.com/5sWind/bgmchain/core/state"
 	"github.com/5sWind/bgmchain/core/types"
-	"github.com/5sWind/bgmchain/crypto"
 	"github.com/5sWind/bgmchain/log"
+	"github.com/5sWind/bgmchain/params"
 	"github.com/5sWind/bgmchain/trie"
 )
 
@@ -20,47 +21,111 @@ type EpochContext struct {
 	TimeStamp   int64
 	DposContext *types.DposContext
 	statedb     *state.StateDB
+	config      *params.DposRules
 }
 
 // countVotes
 func (ec *EpochContext) countVotes() (votes map[common.Address]*big.Int, err error) {
 	votes = map[common.Address]*big.Int{}
-	delegateTrie := ec.DposContext.DelegateTrie()
-	candidateTrie := ec.DposContext.CandidateTrie()
-	statedb := ec.statedb
-
-	iterCandidate := trie.NewIterator(candidateTrie.NodeIterator(nil))
-	existCandidate := iterCandidate.Next()
-	if !existCandidate {
+	candidates, err := ec.DposContext.GetCandidates()
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
 		return votes, errors.New("no candidates")
 	}
-	for existCandidate {
-		candidate := iterCandidate.Value
-		candidateAddr := common.BytesToAddress(candidate)
-		delegateIterator := trie.NewIterator(delegateTrie.PrefixIterator(candidate))
-		existDelegator := delegateIterator.Next()
-		if !existDelegator {
-			votes[candidateAddr] = new(big.Int)
-			existCandidate = iterCandidate.Next()
-			continue
-		}
-		for existDelegator {
-			delegator := delegateIterator.Value
-			score, ok := votes[candidateAddr]
-			if !ok {
-				score = new(big.Int)
+	for _, candidateAddr := range candidates {
+		delegators, err := ec.DposContext.GetDelegators(candidateAddr)
+		if err != nil {
+			return nil, err
+		}
+		score := new(big.Int)
+		for _, delegatorAddr := range delegators {
+			weight, err := ec.voteWeight(delegatorAddr)
+			if err != nil {
+				return nil, err
 			}
-			delegatorAddr := common.BytesToAddress(delegator)
-			weight := statedb.GetBalance(delegatorAddr)
 			score.Add(score, weight)
-			votes[candidateAddr] = score
-			existDelegator = delegateIterator.Next()
 		}
-		existCandidate = iterCandidate.Next()
+		votes[candidateAddr] = score
 	}
 	return votes, nil
 }
 
+// voteWeight returns the weight a delegator's vote carries in the election,
+// which is the stake it has locked behind the vote once stake locking is on,
+// and its balance before.
+func (ec *EpochContext) voteWeight(delegator common.Address) (*big.Int, error) {
+	if !ec.config.Staking {
+		return ec.statedb.GetBalance(delegator), nil
+	}
+	return ec.DposContext.GetStake(delegator)
+}
+
+// releaseUnbondings returns the stake whose unbonding period is over to the
+// delegators' balances.
+func (ec *EpochContext) releaseUnbondings() error {
+	released, err := ec.DposContext.ReleaseUnbondings(uint64(ec.TimeStamp))
+	if err != nil {
+		return err
+	}
+	for delegator, amount := range released {
+		ec.statedb.AddBalance(delegator, amount)
+		log.Debug("Released unbonded stake", "delegator", delegator, "amount", amount)
+	}
+	return nil
+}
+
+// distributeRewards splits the reward pool each validator collected during the
+// closing epoch across its delegators, pro-rata to the weight their votes carry
+// in the election. Whatever is left by rounding, or for lack of delegators,
+// goes to the validator itself.
+func (ec *EpochContext) distributeRewards() error {
+	pools, err := ec.DposContext.RewardPools()
+	if err != nil {
+		return err
+	}
+	for validator, pool := range pools {
+		var (
+			delegators []common.Address
+			weights    []*big.Int
+			total      = new(big.Int)
+		)
+		iter := trie.NewIterator(ec.DposContext.DelegateTrie().PrefixIterator(validator.Bytes()))
+		for iter.Next() {
+			delegator := common.BytesToAddress(iter.Value)
+			weight, err := ec.voteWeight(delegator)
+			if err != nil {
+				return err
+			}
+			delegators = append(delegators, delegator)
+			weights = append(weights, weight)
+			total.Add(total, weight)
+		}
+		remaining := new(big.Int).Set(pool)
+		if total.Sign() > 0 {
+			for i, delegator := range delegators {
+				share := new(big.Int).Mul(pool, weights[i])
+				share.Div(share, total)
+				if share.Sign() == 0 {
+					continue
+				}
+				ec.statedb.AddBalance(delegator, share)
+				if err := ec.DposContext.AddAccruedReward(delegator, share); err != nil {
+					return err
+				}
+				remaining.Sub(remaining, share)
+			}
+		}
+		ec.statedb.AddBalance(validator, remaining)
+		if err := ec.DposContext.ClearRewardPool(validator); err != nil {
+			return err
+		}
+		log.Debug("Distributed delegator rewards", "validator", validator, "pool", pool, "delegators", len(delegators))
+	}
+	return nil
+}
+
 func (ec *EpochContext) kickoutValidator(epoch int64) error {
 	validators, err := ec.DposContext.GetValidators()
 	if err != nil {
@@ -70,6 +135,7 @@ func (ec *EpochContext) kickoutValidator(epoch int64) error {
 		return errors.New("no validator could be kickout")
 	}
 
+	epochInterval := ec.config.EpochInterval
 	epochDuration := epochInterval
 	// First epoch duration may lt epoch interval,
 	// while the first block time wouldn't always align with epoch interval,
@@ -88,7 +154,7 @@ func (ec *EpochContext) kickoutValidator(epoch int64) error {
 		if cntBytes := ec.DposContext.MintCntTrie().Get(key); cntBytes != nil {
 			cnt = int64(binary.BigEndian.Uint64(cntBytes))
 		}
-		if cnt < epochDuration/blockInterval/ maxValidatorSize /2 {
+		if cnt < epochDuration/ec.config.BlockInterval/int64(ec.config.MaxValidatorSize)/2 {
 			// not active validators need kickout
 			needKickoutValidators = append(needKickoutValidators, &sortableAddress{validator, big.NewInt(cnt)})
 		}
@@ -100,14 +166,12 @@ func (ec *EpochContext) kickoutValidator(epoch int64) error {
 	}
 	sort.Sort(sort.Reverse(needKickoutValidators))
 
-	candidateCount := 0
-	iter := trie.NewIterator(ec.DposContext.CandidateTrie().NodeIterator(nil))
-	for iter.Next() {
-		candidateCount++
-		if candidateCount >= needKickoutValidatorCnt+safeSize {
-			break
-		}
+	safeSize := ec.config.SafeSize()
+	candidates, err := ec.DposContext.GetCandidates()
+	if err != nil {
+		return err
 	}
+	candidateCount := len(candidates)
 
 	for i, validator := range needKickoutValidators {
 		// ensure candidate count greater than or equal to safeSize
@@ -127,26 +191,164 @@ func (ec *EpochContext) kickoutValidator(epoch int64) error {
 }
 
 func (ec *EpochContext) lookupValidator(now int64) (validator common.Address, err error) {
-	validator = common.Address{}
-	offset := now % epochInterval
-	if offset%blockInterval != 0 {
-		return common.Address{}, ErrInvalidMintBlockTime
-	}
-	offset /= blockInterval
-
 	validators, err := ec.DposContext.GetValidators()
 	if err != nil {
 		return common.Address{}, err
 	}
+	return scheduledValidator(ec.config, validators, now)
+}
+
+// scheduledValidator returns the validator allowed to mint at the given time,
+// out of the validators of the epoch. That is the validator of the slot if the
+// time is the start of one, or its standby, the next validator in the rotation,
+// once the grace period of the slot is over.
+func scheduledValidator(config *params.DposRules, validators []common.Address, now int64) (common.Address, error) {
+	blockInterval := config.BlockInterval
+	offset := now % config.EpochInterval
+	standby := isStandbyTime(config, now)
+	if offset%blockInterval != 0 && !standby {
+		return common.Address{}, ErrInvalidMintBlockTime
+	}
+	offset /= blockInterval
+
 	validatorSize := len(validators)
 	if validatorSize == 0 {
 		return common.Address{}, errors.New("failed to lookup validator")
 	}
+	if standby {
+		// A lone validator can't stand in for itself
+		if validatorSize == 1 {
+			return common.Address{}, ErrInvalidMintBlockTime
+		}
+		offset++
+	}
 	offset %= int64(validatorSize)
 	return validators[offset], nil
 }
 
-func (ec *EpochContext) tryElect(genesis, parent *types.Header) error {
+// isStandbyTime reports whether the given time is past the grace period of its
+// slot, so that the standby of the slot may mint at it.
+func isStandbyTime(config *params.DposRules, now int64) bool {
+	return config.StandbyGracePeriod > 0 && now%config.BlockInterval >= config.StandbyGracePeriod
+}
+
+// slotAssignment pairs a slot with the validator scheduled to mint in it.
+type slotAssignment struct {
+	slot      int64
+	validator common.Address
+}
+
+// schedule returns the validators scheduled for the slots from the first one
+// at or after from, up to but excluding to. Slots of an epoch without
+// validators are skipped.
+func (ec *EpochContext) schedule(from, to int64) ([]slotAssignment, error) {
+	validators, err := ec.DposContext.GetValidators()
+	if err != nil {
+		return nil, err
+	}
+	if len(validators) == 0 {
+		return nil, nil
+	}
+	var (
+		blockInterval = ec.config.BlockInterval
+		assignments   []slotAssignment
+	)
+	for slot := NextSlot(from, blockInterval); slot < to; slot += blockInterval {
+		offset := slot % ec.config.EpochInterval / blockInterval % int64(len(validators))
+		assignments = append(assignments, slotAssignment{slot, validators[offset]})
+	}
+	return assignments, nil
+}
+
+// ValidatorStat reports the liveness of a validator over an epoch.
+type ValidatorStat struct {
+	Produced uint64 `json:"produced"` // Blocks minted by the validator
+	Expected uint64 `json:"expected"` // Slots the validator was scheduled for
+	Missed   uint64 `json:"missed"`   // Scheduled slots left without a block
+}
+
+// validatorStats compares, for every validator of the epoch starting at or
+// after from, the slots it was scheduled for up to and including to with the
+// blocks it actually minted.
+func (ec *EpochContext) validatorStats(from, to int64) (map[common.Address]*ValidatorStat, error) {
+	validators, err := ec.DposContext.GetValidators()
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[common.Address]*ValidatorStat, len(validators))
+	for _, validator := range validators {
+		stats[validator] = new(ValidatorStat)
+	}
+	assignments, err := ec.schedule(from, to+1)
+	if err != nil {
+		return nil, err
+	}
+	for _, assignment := range assignments {
+		stats[assignment.validator].Expected++
+	}
+	epoch := uint64(from / ec.config.EpochInterval)
+	for validator, stat := range stats {
+		if stat.Produced, err = ec.DposContext.GetMintCnt(epoch, validator); err != nil {
+			return nil, err
+		}
+		if stat.Expected > stat.Produced {
+			stat.Missed = stat.Expected - stat.Produced
+		}
+	}
+	return stats, nil
+}
+
+// electAt holds the elections of the block with the given number minted on top
+// of parent, getHeader retrieving its ancestors.
+//
+// Mint counts recorded under other slot timings can't be judged by the new
+// ones, so the first block of a fork changing them drops the counts and elects
+// the validators of its epoch without any kickout. The epoch it falls in is a
+// partial one, whose validators aren't judged either when it ends.
+func (ec *EpochContext) electAt(number *big.Int, genesis, parent *types.Header, getHeader func(common.Hash, uint64) *types.Header) error {
+	if fork := ec.config.TimingFork; fork != nil && fork.Cmp(number) == 0 {
+		mintCntTrie, err := types.NewMintCntTrie(common.Hash{}, ec.DposContext.DB())
+		if err != nil {
+			return err
+		}
+		ec.DposContext.SetMintCnt(mintCntTrie)
+		return ec.elect(parent, ec.TimeStamp/ec.config.EpochInterval-1)
+	}
+	partial, err := ec.inForkEpoch(parent, getHeader)
+	if err != nil {
+		return err
+	}
+	return ec.tryElect(genesis, parent, partial)
+}
+
+// inForkEpoch reports whether the epoch of the given block started before the
+// fork setting the current slot timings, making it a partial one.
+func (ec *EpochContext) inForkEpoch(header *types.Header, getHeader func(common.Hash, uint64) *types.Header) (bool, error) {
+	fork := ec.config.TimingFork
+	if fork == nil || header.Number.Cmp(fork) < 0 {
+		return false, nil
+	}
+	// An epoch holds one block per slot at most, no need to walk back further
+	if new(big.Int).Sub(header.Number, fork).Cmp(big.NewInt(ec.config.EpochInterval/ec.config.BlockInterval)) >= 0 {
+		return false, nil
+	}
+	start := header.Time.Int64() / ec.config.EpochInterval * ec.config.EpochInterval
+	for header.Number.Cmp(fork) > 0 {
+		if header.Time.Int64() < start {
+			return false, nil
+		}
+		if header = getHeader(header.ParentHash, header.Number.Uint64()-1); header == nil {
+			return false, consensus.ErrUnknownAncestor
+		}
+	}
+	return header.Time.Int64() >= start, nil
+}
+
+// tryElect elects the validators of every epoch started since the one of the
+// parent. The validators of the parent's epoch are kicked out if they minted
+// too few blocks, unless it's the first epoch or a partial one.
+func (ec *EpochContext) tryElect(genesis, parent *types.Header, partial bool) error {
+	epochInterval := ec.config.EpochInterval
 	genesisEpoch := genesis.Time.Int64() / epochInterval
 	prevEpoch := parent.Time.Int64() / epochInterval
 	currentEpoch := ec.TimeStamp / epochInterval
@@ -161,44 +363,59 @@ func (ec *EpochContext) tryElect(genesis, parent *types.Header) error {
 	iter := trie.NewIterator(ec.DposContext.MintCntTrie().PrefixIterator(prevEpochBytes))
 	for i := prevEpoch; i < currentEpoch; i++ {
 		// if prevEpoch is not genesis, kickout not active candidate
-		if !prevEpochIsGenesis && iter.Next() {
+		if !prevEpochIsGenesis && !partial && iter.Next() {
 			if err := ec.kickoutValidator(prevEpoch); err != nil {
 				return err
 			}
 		}
-		votes, err := ec.countVotes()
-		if err != nil {
+		if err := ec.elect(parent, i); err != nil {
 			return err
 		}
-		candidates := sortableAddresses{}
-		for candidate, cnt := range votes {
-			candidates = append(candidates, &sortableAddress{candidate, cnt})
-		}
-		if len(candidates) < safeSize {
-			return errors.New("too few candidates")
-		}
-		sort.Sort(candidates)
-		if len(candidates) > maxValidatorSize {
-			candidates = candidates[:maxValidatorSize]
-		}
+	}
+	return nil
+}
 
-		// shuffle candidates
-		seed := int64(binary.LittleEndian.Uint32(crypto.Keccak512(parent.Hash().Bytes()))) + i
-		r := rand.New(rand.NewSource(seed))
-		for i := len(candidates) - 1; i > 0; i-- {
-			j := int(r.Int31n(int32(i + 1)))
-			candidates[i], candidates[j] = candidates[j], candidates[i]
-		}
-		sortedValidators := make([]common.Address, 0)
-		for _, candidate := range candidates {
-			sortedValidators = append(sortedValidators, candidate.address)
-		}
+// elect picks the validators of the epoch following the given one among the
+// candidates with the most votes.
+func (ec *EpochContext) elect(parent *types.Header, epoch int64) error {
+	votes, err := ec.countVotes()
+	if err != nil {
+		return err
+	}
+	candidates := sortableAddresses{}
+	for candidate, cnt := range votes {
+		candidates = append(candidates, &sortableAddress{candidate, cnt})
+	}
+	if len(candidates) < ec.config.SafeSize() {
+		return errors.New("too few candidates")
+	}
+	sort.Sort(candidates)
+	if len(candidates) > ec.config.MaxValidatorSize {
+		candidates = candidates[:ec.config.MaxValidatorSize]
+	}
+
+	// shuffle candidates
+	shuffler := shufflerFor(ec.config)
+	seed := shuffler.seed(ec.DposContext, parent, epoch)
+	r := rand.New(rand.NewSource(seed))
+	for i := len(candidates) - 1; i > 0; i-- {
+		j := int(r.Int31n(int32(i + 1)))
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	}
+	sortedValidators := make([]common.Address, 0)
+	for _, candidate := range candidates {
+		sortedValidators = append(sortedValidators, candidate.address)
+	}
 
-		epochTrie, _ := types.NewEpochTrie(common.Hash{}, ec.DposContext.DB())
-		ec.DposContext.SetEpoch(epochTrie)
-		ec.DposContext.SetValidators(sortedValidators)
-		log.Info("Come to new epoch", "prevEpoch", i, "nextEpoch", i+1)
+	prevEpochTrie := ec.DposContext.EpochTrie()
+	epochTrie, _ := types.NewEpochTrie(common.Hash{}, ec.DposContext.DB())
+	ec.DposContext.SetEpoch(epochTrie)
+	ec.DposContext.SetValidators(sortedValidators)
+	if err := ec.DposContext.SetEpochSigners(sortedValidators); err != nil {
+		return err
 	}
+	shuffler.carry(prevEpochTrie, ec.DposContext)
+	log.Info("Come to new epoch", "prevEpoch", epoch, "nextEpoch", epoch+1)
 	return nil
 }
 
@@ -10,6 +10,7 @@ import (
 	"github.com/5sWind/bgmchain/core/state"
 	"github.com/5sWind/bgmchain/core/types"
 	"github.com/5sWind/bgmchain/bgmdb"
+	"github.com/5sWind/bgmchain/params"
 	"github.com/5sWind/bgmchain/trie"
 
 	"github.com/stretchr/testify/assert"
@@ -40,24 +41,31 @@ func TestEpochContextCountVotes(t *testing.T) {
 	epochContext := &EpochContext{
 		DposContext: dposContext,
 		statedb:     stateDB,
+		config:      testRules,
 	}
 	_, err = epochContext.countVotes()
 	assert.NotNil(t, err)
 
+	stake := int64(7)
 	for candidate, electors := range voteMap {
 		assert.Nil(t, dposContext.BecomeCandidate(candidate))
 		for _, elector := range electors {
 			stateDB.SetBalance(elector, big.NewInt(balance))
 			assert.Nil(t, dposContext.Delegate(elector, candidate))
+			assert.Nil(t, dposContext.LockStake(elector, big.NewInt(stake)))
 		}
 	}
-	result, err := epochContext.countVotes()
-	assert.Nil(t, err)
-	assert.Equal(t, len(voteMap), len(result))
-	for candidate, electors := range voteMap {
-		voteCount, ok := result[candidate]
-		assert.True(t, ok)
-		assert.Equal(t, balance*int64(len(electors)), voteCount.Int64())
+	// Votes are weighted by balance before stake locking and by stake after
+	for rules, weight := range map[*params.DposRules]int64{testRules: balance, stakingRules: stake} {
+		epochContext.config = rules
+		result, err := epochContext.countVotes()
+		assert.Nil(t, err)
+		assert.Equal(t, len(voteMap), len(result))
+		for candidate, electors := range voteMap {
+			voteCount, ok := result[candidate]
+			assert.True(t, ok)
+			assert.Equal(t, weight*int64(len(electors)), voteCount.Int64())
+		}
 	}
 }
 
@@ -66,6 +74,7 @@ func TestLookupValidator(t *testing.T) {
 	dposCtx, _ := types.NewDposContext(db)
 	mockEpochContext := &EpochContext{
 		DposContext: dposCtx,
+		config:      testRules,
 	}
 	validators := []common.Address{
 		common.StringToAddress("addr1"),
@@ -85,6 +94,31 @@ func TestLookupValidator(t *testing.T) {
 	}
 }
 
+func TestLookupStandbyValidator(t *testing.T) {
+	config := *testRules
+	config.StandbyGracePeriod = 5
+	validators := []common.Address{
+		common.StringToAddress("addr1"),
+		common.StringToAddress("addr2"),
+		common.StringToAddress("addr3"),
+	}
+	for i := range validators {
+		slot := int64(i) * blockInterval
+		got, err := scheduledValidator(&config, validators, slot)
+		assert.Nil(t, err)
+		assert.Equal(t, validators[i], got)
+
+		_, err = scheduledValidator(&config, validators, slot+config.StandbyGracePeriod-1)
+		assert.Equal(t, ErrInvalidMintBlockTime, err)
+
+		got, err = scheduledValidator(&config, validators, slot+config.StandbyGracePeriod)
+		assert.Nil(t, err)
+		assert.Equal(t, validators[(i+1)%len(validators)], got)
+	}
+	_, err := scheduledValidator(&config, validators[:1], config.StandbyGracePeriod)
+	assert.Equal(t, ErrInvalidMintBlockTime, err)
+}
+
 func TestEpochContextKickoutValidator(t *testing.T) {
 	db, _ := bgmdb.NewMemDatabase()
 	stateDB, _ := state.New(common.Hash{}, state.NewDatabase(db))
@@ -94,8 +128,9 @@ func TestEpochContextKickoutValidator(t *testing.T) {
 		TimeStamp:   epochInterval,
 		DposContext: dposContext,
 		statedb:     stateDB,
+		config:      testRules,
 	}
-	atLeastMintCnt := epochInterval / blockInterval / maxValidatorSize / 2
+	atLeastMintCnt := epochInterval / blockInterval / int64(maxValidatorSize) / 2
 	testEpoch := int64(1)
 
 	// no validator can be kickout, because all validators mint enough block at least
@@ -119,6 +154,7 @@ func TestEpochContextKickoutValidator(t *testing.T) {
 		TimeStamp:   epochInterval,
 		DposContext: dposContext,
 		statedb:     stateDB,
+		config:      testRules,
 	}
 	validators = []common.Address{}
 	for i := 0; i < maxValidatorSize; i++ {
@@ -142,6 +178,7 @@ func TestEpochContextKickoutValidator(t *testing.T) {
 		TimeStamp:   epochInterval,
 		DposContext: dposContext,
 		statedb:     stateDB,
+		config:      testRules,
 	}
 	validators = []common.Address{}
 	for i := 0; i < maxValidatorSize; i++ {
@@ -166,6 +203,7 @@ func TestEpochContextKickoutValidator(t *testing.T) {
 		TimeStamp:   epochInterval,
 		DposContext: dposContext,
 		statedb:     stateDB,
+		config:      testRules,
 	}
 	validators = []common.Address{}
 	for i := 0; i < maxValidatorSize; i++ {
@@ -192,6 +230,7 @@ func TestEpochContextKickoutValidator(t *testing.T) {
 		TimeStamp:   epochInterval / 2,
 		DposContext: dposContext,
 		statedb:     stateDB,
+		config:      testRules,
 	}
 	validators = []common.Address{}
 	for i := 0; i < maxValidatorSize; i++ {
@@ -216,6 +255,7 @@ func TestEpochContextKickoutValidator(t *testing.T) {
 		TimeStamp:   epochInterval / 2,
 		DposContext: dposContext,
 		statedb:     stateDB,
+		config:      testRules,
 	}
 	validators = []common.Address{}
 	for i := 0; i < maxValidatorSize; i++ {
@@ -239,6 +279,7 @@ func TestEpochContextKickoutValidator(t *testing.T) {
 		TimeStamp:   epochInterval / 2,
 		DposContext: dposContext,
 		statedb:     stateDB,
+		config:      testRules,
 	}
 	assert.NotNil(t, epochContext.kickoutValidator(testEpoch))
 	dposContext.SetValidators([]common.Address{})
@@ -247,7 +288,7 @@ func TestEpochContextKickoutValidator(t *testing.T) {
 
 func setTestMintCnt(dposContext *types.DposContext, epoch int64, validator common.Address, count int64) {
 	for i := int64(0); i < count; i++ {
-		updateMintCnt(epoch*epochInterval, epoch*epochInterval+blockInterval, validator, dposContext)
+		updateMintCnt(epoch*epochInterval, epoch*epochInterval+blockInterval, epochInterval, validator, dposContext)
 	}
 }
 
@@ -269,8 +310,9 @@ func TestEpochContextTryElect(t *testing.T) {
 		TimeStamp:   epochInterval,
 		DposContext: dposContext,
 		statedb:     stateDB,
+		config:      testRules,
 	}
-	atLeastMintCnt := epochInterval / blockInterval / maxValidatorSize / 2
+	atLeastMintCnt := epochInterval / blockInterval / int64(maxValidatorSize) / 2
 	testEpoch := int64(1)
 	validators := []common.Address{}
 	for i := 0; i < maxValidatorSize; i++ {
@@ -292,7 +334,7 @@ func TestEpochContextTryElect(t *testing.T) {
 		Time: big.NewInt(epochInterval - blockInterval),
 	}
 	oldHash := dposContext.EpochTrie().Hash()
-	assert.Nil(t, epochContext.tryElect(genesis, parent))
+	assert.Nil(t, epochContext.tryElect(genesis, parent, false))
 	result, err := dposContext.GetValidators()
 	assert.Nil(t, err)
 	assert.Equal(t, maxValidatorSize, len(result))
@@ -311,7 +353,7 @@ func TestEpochContextTryElect(t *testing.T) {
 	}
 	epochContext.TimeStamp = epochInterval
 	oldHash = dposContext.EpochTrie().Hash()
-	assert.Nil(t, epochContext.tryElect(genesis, parent))
+	assert.Nil(t, epochContext.tryElect(genesis, parent, false))
 	result, err = dposContext.GetValidators()
 	assert.Nil(t, err)
 	assert.Equal(t, maxValidatorSize, len(result))
@@ -329,7 +371,7 @@ func TestEpochContextTryElect(t *testing.T) {
 	}
 	epochContext.TimeStamp = epochInterval * 2
 	oldHash = dposContext.EpochTrie().Hash()
-	assert.Nil(t, epochContext.tryElect(genesis, parent))
+	assert.Nil(t, epochContext.tryElect(genesis, parent, false))
 	result, err = dposContext.GetValidators()
 	assert.Nil(t, err)
 	assert.Equal(t, safeSize, len(result))
@@ -351,9 +393,243 @@ func TestEpochContextTryElect(t *testing.T) {
 	}
 	epochContext.TimeStamp = epochInterval + blockInterval
 	oldHash = dposContext.EpochTrie().Hash()
-	assert.Nil(t, epochContext.tryElect(genesis, parent))
+	assert.Nil(t, epochContext.tryElect(genesis, parent, false))
 	result, err = dposContext.GetValidators()
 	assert.Nil(t, err)
 	assert.Equal(t, safeSize, len(result))
 	assert.Equal(t, oldHash, dposContext.EpochTrie().Hash())
 }
+
+func TestEpochContextDistributeRewards(t *testing.T) {
+	db, _ := bgmdb.NewMemDatabase()
+	stateDB, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	dposContext, err := types.NewDposContext(db)
+	assert.Nil(t, err)
+	epochContext := &EpochContext{
+		DposContext: dposContext,
+		statedb:     stateDB,
+		config:      stakingRules,
+	}
+	validator := common.StringToAddress("validator")
+	delegators := []common.Address{
+		common.StringToAddress("delegator1"),
+		common.StringToAddress("delegator2"),
+	}
+	assert.Nil(t, dposContext.BecomeCandidate(validator))
+	for i, delegator := range delegators {
+		assert.Nil(t, dposContext.Delegate(delegator, validator))
+		assert.Nil(t, dposContext.LockStake(delegator, big.NewInt(int64(i+1)*100)))
+	}
+	assert.Nil(t, dposContext.AddRewardPool(validator, big.NewInt(1000)))
+	assert.Nil(t, epochContext.distributeRewards())
+
+	// delegators are paid pro-rata to their stake, the rounding rest goes to the validator
+	assert.Equal(t, int64(333), stateDB.GetBalance(delegators[0]).Int64())
+	assert.Equal(t, int64(666), stateDB.GetBalance(delegators[1]).Int64())
+	assert.Equal(t, int64(1), stateDB.GetBalance(validator).Int64())
+
+	accrued, err := dposContext.GetAccruedReward(delegators[1])
+	assert.Nil(t, err)
+	assert.Equal(t, int64(666), accrued.Int64())
+	pool, err := dposContext.GetRewardPool(validator)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), pool.Int64())
+}
+
+func TestEpochContextReleaseUnbondings(t *testing.T) {
+	db, _ := bgmdb.NewMemDatabase()
+	stateDB, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	dposContext, err := types.NewDposContext(db)
+	assert.Nil(t, err)
+	epochContext := &EpochContext{
+		TimeStamp:   epochInterval,
+		DposContext: dposContext,
+		statedb:     stateDB,
+		config:      stakingRules,
+	}
+	early, late := common.StringToAddress("early"), common.StringToAddress("late")
+	assert.Nil(t, dposContext.LockStake(early, big.NewInt(10)))
+	assert.Nil(t, dposContext.LockStake(late, big.NewInt(20)))
+	_, err = dposContext.UnbondStake(early, uint64(epochInterval))
+	assert.Nil(t, err)
+	_, err = dposContext.UnbondStake(late, uint64(epochInterval*2))
+	assert.Nil(t, err)
+
+	assert.Nil(t, epochContext.releaseUnbondings())
+	assert.Equal(t, int64(10), stateDB.GetBalance(early).Int64())
+	assert.Equal(t, int64(0), stateDB.GetBalance(late).Int64())
+
+	epochContext.TimeStamp = epochInterval * 2
+	assert.Nil(t, epochContext.releaseUnbondings())
+	assert.Equal(t, int64(10), stateDB.GetBalance(early).Int64())
+	assert.Equal(t, int64(20), stateDB.GetBalance(late).Int64())
+	unbondings, err := dposContext.GetUnbondings(late)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(unbondings))
+}
+
+func TestEpochContextValidatorStats(t *testing.T) {
+	db, _ := bgmdb.NewMemDatabase()
+	dposContext, err := types.NewDposContext(db)
+	assert.Nil(t, err)
+	validators := []common.Address{
+		common.StringToAddress("addr1"),
+		common.StringToAddress("addr2"),
+		common.StringToAddress("addr3"),
+	}
+	assert.Nil(t, dposContext.SetValidators(validators))
+	epochContext := &EpochContext{DposContext: dposContext, config: testRules}
+
+	// ten slots elapsed, addr1 minted all of its blocks, addr2 one and addr3 none
+	setTestMintCnt(dposContext, 0, validators[0], 4)
+	setTestMintCnt(dposContext, 0, validators[1], 1)
+	stats, err := epochContext.validatorStats(0, 9*blockInterval)
+	assert.Nil(t, err)
+	assert.Equal(t, &ValidatorStat{Produced: 4, Expected: 4}, stats[validators[0]])
+	assert.Equal(t, &ValidatorStat{Produced: 1, Expected: 3, Missed: 2}, stats[validators[1]])
+	assert.Equal(t, &ValidatorStat{Produced: 0, Expected: 3, Missed: 3}, stats[validators[2]])
+}
+
+func TestEpochContextTryElectSigners(t *testing.T) {
+	db, _ := bgmdb.NewMemDatabase()
+	stateDB, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	dposContext, err := types.NewDposContext(db)
+	assert.Nil(t, err)
+	epochContext := &EpochContext{
+		TimeStamp:   epochInterval,
+		DposContext: dposContext,
+		statedb:     stateDB,
+		config:      testRules,
+	}
+	validators := []common.Address{}
+	for i := 0; i < maxValidatorSize; i++ {
+		validator := common.StringToAddress("addr" + strconv.Itoa(i))
+		validators = append(validators, validator)
+		assert.Nil(t, dposContext.BecomeCandidate(validator))
+		assert.Nil(t, dposContext.Delegate(validator, validator))
+		stateDB.SetBalance(validator, big.NewInt(1))
+	}
+	bound, signer := validators[0], common.StringToAddress("signer")
+	assert.Nil(t, dposContext.BindSigner(bound, signer))
+
+	// The binding only takes effect with the election of the next epoch
+	current, err := dposContext.GetEpochSigner(bound)
+	assert.Nil(t, err)
+	assert.Equal(t, bound, current)
+
+	genesis := &types.Header{Time: big.NewInt(0)}
+	parent := &types.Header{Time: big.NewInt(epochInterval - blockInterval)}
+	assert.Nil(t, epochContext.tryElect(genesis, parent, false))
+	current, err = dposContext.GetEpochSigner(bound)
+	assert.Nil(t, err)
+	assert.Equal(t, signer, current)
+	current, err = dposContext.GetEpochSigner(validators[1])
+	assert.Nil(t, err)
+	assert.Equal(t, validators[1], current)
+
+	// Rotating the key keeps the votes and waits for the epoch boundary again
+	rotated := common.StringToAddress("rotated")
+	assert.Nil(t, dposContext.BindSigner(bound, rotated))
+	current, err = dposContext.GetEpochSigner(bound)
+	assert.Nil(t, err)
+	assert.Equal(t, signer, current)
+	delegators, err := dposContext.GetDelegators(bound)
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Address{bound}, delegators)
+
+	parent = &types.Header{Time: big.NewInt(epochInterval)}
+	epochContext.TimeStamp = epochInterval * 2
+	assert.Nil(t, epochContext.tryElect(genesis, parent, false))
+	current, err = dposContext.GetEpochSigner(bound)
+	assert.Nil(t, err)
+	assert.Equal(t, rotated, current)
+}
+
+func TestEpochContextElectAcrossEpochIntervalFork(t *testing.T) {
+	db, _ := bgmdb.NewMemDatabase()
+	stateDB, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	dposContext, err := types.NewDposContext(db)
+	assert.Nil(t, err)
+
+	config := &params.DposConfig{Forks: []params.DposFork{{Block: big.NewInt(10), EpochInterval: epochInterval / 2}}}
+	assert.Nil(t, config.Validate())
+	forked := config.At(big.NewInt(10))
+	newInterval := forked.EpochInterval
+
+	validators := []common.Address{}
+	for i := 0; i < maxValidatorSize; i++ {
+		validator := common.StringToAddress("addr" + strconv.Itoa(i))
+		validators = append(validators, validator)
+		assert.Nil(t, dposContext.BecomeCandidate(validator))
+		assert.Nil(t, dposContext.Delegate(validator, validator))
+		stateDB.SetBalance(validator, big.NewInt(1))
+	}
+	assert.Nil(t, dposContext.SetValidators(validators))
+	assert.Nil(t, dposContext.BecomeCandidate(common.StringToAddress("more1")))
+	assert.Nil(t, dposContext.BecomeCandidate(common.StringToAddress("more2")))
+	candidates := len(getCandidates(dposContext.CandidateTrie()))
+
+	// Headers 9 to 30, the fork block 10 starting new epoch 6 half way through old epoch 3
+	headers := make(map[uint64]*types.Header)
+	var parent *types.Header
+	for n := uint64(9); n <= 30; n++ {
+		header := &types.Header{Number: new(big.Int).SetUint64(n)}
+		switch {
+		case n == 9:
+			header.Time = big.NewInt(3*epochInterval - blockInterval)
+		case n <= 20:
+			header.Time = big.NewInt(3*epochInterval + int64(n-10)*blockInterval)
+		default:
+			header.Time = big.NewInt(7*newInterval + int64(n-21)*blockInterval)
+		}
+		if parent != nil {
+			header.ParentHash = parent.Hash()
+		}
+		headers[n] = header
+		parent = header
+	}
+	getHeader := func(hash common.Hash, number uint64) *types.Header {
+		if header := headers[number]; header != nil && header.Hash() == hash {
+			return header
+		}
+		return nil
+	}
+	genesis := &types.Header{Number: big.NewInt(0), Time: big.NewInt(0)}
+
+	// Mint counts of the old epochs, one colliding with a new epoch number
+	setTestMintCnt(dposContext, 2, validators[0], 1)
+	setTestMintCnt(dposContext, 6, validators[0], 1)
+
+	// The fork block elects without kickout and drops the old mint counts
+	epochContext := &EpochContext{TimeStamp: headers[10].Time.Int64(), DposContext: dposContext, statedb: stateDB, config: forked}
+	assert.Nil(t, epochContext.electAt(headers[10].Number, genesis, headers[9], getHeader))
+	counts, err := MintCounts(dposContext)
+	assert.Nil(t, err)
+	assert.Empty(t, counts)
+	assert.Equal(t, candidates, len(getCandidates(dposContext.CandidateTrie())))
+	elected, err := dposContext.GetValidators()
+	assert.Nil(t, err)
+	assert.Equal(t, maxValidatorSize, len(elected))
+
+	// The partial epoch 6 ends without kickout, though hardly anybody minted
+	updateMintCnt(headers[10].Time.Int64(), headers[11].Time.Int64(), newInterval, elected[2], dposContext)
+	epochContext.TimeStamp = headers[21].Time.Int64()
+	assert.Nil(t, epochContext.electAt(headers[21].Number, genesis, headers[20], getHeader))
+	assert.Equal(t, candidates, len(getCandidates(dposContext.CandidateTrie())))
+
+	// The whole epoch 7 is judged, by the mint counts of the new numbering
+	elected, err = dposContext.GetValidators()
+	assert.Nil(t, err)
+	threshold := newInterval / blockInterval / int64(maxValidatorSize) / 2
+	for _, validator := range elected[2:] {
+		for i := int64(0); i < threshold; i++ {
+			updateMintCnt(7*newInterval, 7*newInterval+blockInterval, newInterval, validator, dposContext)
+		}
+	}
+	epochContext.TimeStamp = 8 * newInterval
+	assert.Nil(t, epochContext.electAt(big.NewInt(31), genesis, headers[30], getHeader))
+	remaining := getCandidates(dposContext.CandidateTrie())
+	assert.Equal(t, candidates-2, len(remaining))
+	assert.False(t, remaining[elected[0]])
+	assert.False(t, remaining[elected[1]])
+}
@@ -0,0 +1,61 @@
+package dpos
+
+import (
+	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/consensus"
+	"github.com/5sWind/bgmchain/core/types"
+)
+
+// CompareChains implements consensus.ForkChoice. The chain holding the confirmed
+// block is preferred, then the chain whose blocks since the two diverged were
+// minted by more distinct validators, so that a few equivocating validators
+// can't outgrow the chain the others build on. Chains diverging further back
+// than an epoch worth of slots are left to total difficulty.
+func (d *Dpos) CompareChains(chain consensus.ChainReader, current, header *types.Header) (int, error) {
+	var confirmedHash common.Hash
+	if confirmed, err := d.ConfirmedHeader(chain); err == nil {
+		confirmedHash = confirmed.Hash()
+	}
+	var (
+		config = d.config.At(header.Number)
+		window = int(config.EpochInterval / config.BlockInterval)
+
+		currentValidators = make(map[common.Address]bool)
+		headerValidators  = make(map[common.Address]bool)
+		currentConfirmed  bool
+		headerConfirmed   bool
+	)
+	// Walk both chains back to the block they share
+	for steps := 0; current.Hash() != header.Hash(); steps++ {
+		if steps == window {
+			return 0, nil
+		}
+		currentNumber, headerNumber := current.Number.Uint64(), header.Number.Uint64()
+		if currentNumber >= headerNumber {
+			currentValidators[current.Validator] = true
+			currentConfirmed = currentConfirmed || current.Hash() == confirmedHash
+			if current = chain.GetHeader(current.ParentHash, currentNumber-1); current == nil {
+				return 0, consensus.ErrUnknownAncestor
+			}
+		}
+		if headerNumber >= currentNumber {
+			headerValidators[header.Validator] = true
+			headerConfirmed = headerConfirmed || header.Hash() == confirmedHash
+			if header = chain.GetHeader(header.ParentHash, headerNumber-1); header == nil {
+				return 0, consensus.ErrUnknownAncestor
+			}
+		}
+	}
+	switch {
+	case currentConfirmed != headerConfirmed:
+		if headerConfirmed {
+			return 1, nil
+		}
+		return -1, nil
+	case len(headerValidators) > len(currentValidators):
+		return 1, nil
+	case len(headerValidators) < len(currentValidators):
+		return -1, nil
+	}
+	return 0, nil
+}
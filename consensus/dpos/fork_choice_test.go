@@ -0,0 +1,66 @@
+package dpos
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/5sWind/bgmchain/bgmdb"
+	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/core/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareChains(t *testing.T) {
+	db, _ := bgmdb.NewMemDatabase()
+	engine, _ := New(testConfig, db)
+
+	chain := &testChainReader{headers: make(map[common.Hash]*types.Header)}
+	extend := func(parent *types.Header, validators ...string) *types.Header {
+		for _, validator := range validators {
+			h := &types.Header{
+				ParentHash: parent.Hash(),
+				Number:     new(big.Int).Add(parent.Number, big1),
+				Time:       new(big.Int).Add(parent.Time, big.NewInt(blockInterval)),
+				Validator:  common.StringToAddress(validator),
+			}
+			chain.headers[h.Hash()] = h
+			parent = h
+		}
+		return parent
+	}
+	genesis := &types.Header{Number: big.NewInt(0), Time: big.NewInt(0)}
+	chain.headers[genesis.Hash()] = genesis
+	fork := extend(genesis, "addr1", "addr2")
+
+	// An equivocating validator can't outgrow a chain built by more validators
+	honest := extend(fork, "addr3", "addr1")
+	equivocating := extend(fork, "addr2", "addr2", "addr2")
+	choice, err := engine.CompareChains(chain, honest, equivocating)
+	assert.Nil(t, err)
+	assert.True(t, choice < 0)
+	choice, err = engine.CompareChains(chain, equivocating, honest)
+	assert.Nil(t, err)
+	assert.True(t, choice > 0)
+
+	// Extending a chain is preferred over staying put
+	choice, err = engine.CompareChains(chain, honest, extend(honest, "addr2"))
+	assert.Nil(t, err)
+	assert.True(t, choice > 0)
+
+	// Chains the rule can't tell apart are left to total difficulty
+	choice, err = engine.CompareChains(chain, extend(fork, "addr1"), extend(fork, "addr2"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, choice)
+
+	// The chain holding the confirmed block wins regardless
+	engine.confirmedBlockHeader = equivocating
+	choice, err = engine.CompareChains(chain, equivocating, honest)
+	assert.Nil(t, err)
+	assert.True(t, choice < 0)
+
+	// Headers of unknown ancestry can't be compared
+	orphan := &types.Header{ParentHash: common.HexToHash("0x01"), Number: big.NewInt(10), Time: big.NewInt(10 * blockInterval)}
+	_, err = engine.CompareChains(chain, honest, orphan)
+	assert.NotNil(t, err)
+}
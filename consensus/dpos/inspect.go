@@ -0,0 +1,99 @@
+package dpos
+
+import (
+	"encoding/binary"
+	"math/big"
+
+	"github.com/5sWind/bgmchain/bgmdb"
+	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/core/state"
+	"github.com/5sWind/bgmchain/core/types"
+	"github.com/5sWind/bgmchain/params"
+	"github.com/5sWind/bgmchain/trie"
+)
+
+// Election is the outcome of the elections a block would hold on top of its
+// parent.
+type Election struct {
+	Epoch      int64            `json:"epoch"`      // Epoch the block opens
+	Kickouts   []common.Address `json:"kickouts"`   // Candidates removed for inactivity
+	Validators []common.Address `json:"validators"` // Validators of the epoch, in minting order
+}
+
+// SimulateElection re-runs the elections a block minted at the given time on top
+// of parent would hold, without writing anything to the database. The first
+// block of the chain is needed to judge the validators of the first epoch, and
+// may be nil if parent is the genesis block. The ancestors of parent are
+// retrieved with getHeader.
+//
+// Rewards and unbondings paid out at the epoch boundary don't take part in the
+// simulation. Before stake locking is on, the votes are weighted by the balances
+// in the state of parent, which is read from db.
+func SimulateElection(config *params.DposConfig, db bgmdb.Database, getHeader func(common.Hash, uint64) *types.Header, genesis, first, parent *types.Header, timestamp int64) (*Election, error) {
+	if timeOfFirstBlock == 0 && first != nil {
+		timeOfFirstBlock = first.Time.Int64()
+	}
+	// Fresh tries from the roots of parent keep every change in memory
+	dposContext, err := types.NewDposContextFromProto(db, parent.DposContext)
+	if err != nil {
+		return nil, err
+	}
+	before, err := dposContext.GetCandidates()
+	if err != nil {
+		return nil, err
+	}
+	number := new(big.Int).Add(parent.Number, big1)
+	rules := config.At(number)
+	epochContext := &EpochContext{
+		TimeStamp:   timestamp,
+		DposContext: dposContext,
+		config:      rules,
+	}
+	if !rules.Staking {
+		if epochContext.statedb, err = state.New(parent.Root, state.NewDatabase(db)); err != nil {
+			return nil, err
+		}
+	}
+	if err := epochContext.electAt(number, genesis, parent, getHeader); err != nil {
+		return nil, err
+	}
+	after, err := dposContext.GetCandidates()
+	if err != nil {
+		return nil, err
+	}
+	remaining := make(map[common.Address]bool, len(after))
+	for _, candidate := range after {
+		remaining[candidate] = true
+	}
+	election := &Election{Epoch: timestamp / rules.EpochInterval}
+	for _, candidate := range before {
+		if !remaining[candidate] {
+			election.Kickouts = append(election.Kickouts, candidate)
+		}
+	}
+	if election.Validators, err = dposContext.GetValidators(); err != nil {
+		return nil, err
+	}
+	return election, nil
+}
+
+// MintCounts returns the number of blocks each validator minted, by epoch, as
+// recorded in the dpos context.
+func MintCounts(dposContext *types.DposContext) (map[uint64]map[common.Address]uint64, error) {
+	counts := make(map[uint64]map[common.Address]uint64)
+
+	iter := trie.NewIterator(dposContext.MintCntTrie().NodeIterator(nil))
+	for iter.Next() {
+		// Iterated keys carry the prefix of the trie ahead of epoch and validator
+		if len(iter.Key) < 8+common.AddressLength {
+			continue
+		}
+		key := iter.Key[len(iter.Key)-8-common.AddressLength:]
+		epoch := binary.BigEndian.Uint64(key[:8])
+		if counts[epoch] == nil {
+			counts[epoch] = make(map[common.Address]uint64)
+		}
+		counts[epoch][common.BytesToAddress(key[8:])] = binary.BigEndian.Uint64(iter.Value)
+	}
+	return counts, iter.Err
+}
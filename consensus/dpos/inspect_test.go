@@ -0,0 +1,66 @@
+package dpos
+
+import (
+	"math/big"
+	"strconv"
+	"testing"
+
+	"github.com/5sWind/bgmchain/bgmdb"
+	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/core/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulateElection(t *testing.T) {
+	db, _ := bgmdb.NewMemDatabase()
+	dposContext, err := types.NewDposContext(db)
+	assert.Nil(t, err)
+
+	atLeastMintCnt := epochInterval / blockInterval / int64(maxValidatorSize) / 2
+	validators := []common.Address{}
+	for i := 0; i < maxValidatorSize; i++ {
+		validator := common.StringToAddress("addr" + strconv.Itoa(i))
+		validators = append(validators, validator)
+		assert.Nil(t, dposContext.BecomeCandidate(validator))
+		assert.Nil(t, dposContext.Delegate(validator, validator))
+		assert.Nil(t, dposContext.LockStake(validator, big.NewInt(1)))
+	}
+	assert.Nil(t, dposContext.SetValidators(validators))
+	assert.Nil(t, dposContext.BecomeCandidate(common.StringToAddress("more1")))
+	assert.Nil(t, dposContext.BecomeCandidate(common.StringToAddress("more2")))
+
+	// the first two validators didn't mint in the epoch
+	for _, validator := range validators[2:] {
+		setTestMintCnt(dposContext, 1, validator, atLeastMintCnt)
+	}
+	counts, err := MintCounts(dposContext)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(counts))
+	assert.Equal(t, maxValidatorSize-2, len(counts[1]))
+	assert.Equal(t, uint64(atLeastMintCnt), counts[1][validators[2]])
+
+	proto, err := dposContext.CommitTo(db)
+	assert.Nil(t, err)
+	keys := len(db.Keys())
+
+	genesis := &types.Header{Number: big.NewInt(0), Time: big.NewInt(0)}
+	first := &types.Header{Number: big.NewInt(1), Time: big.NewInt(blockInterval)}
+	parent := &types.Header{Number: big.NewInt(2), Time: big.NewInt(epochInterval*2 - blockInterval), DposContext: proto}
+	election, err := SimulateElection(testConfig, db, nil, genesis, first, parent, epochInterval*2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), election.Epoch)
+	assert.Equal(t, 2, len(election.Kickouts))
+	assert.Contains(t, election.Kickouts, validators[0])
+	assert.Contains(t, election.Kickouts, validators[1])
+	assert.Equal(t, maxValidatorSize, len(election.Validators))
+	assert.NotContains(t, election.Validators, validators[0])
+
+	// nothing was written, the candidates of parent are untouched
+	assert.Equal(t, keys, len(db.Keys()))
+	reopened, err := types.NewDposContextFromProto(db, proto)
+	assert.Nil(t, err)
+	candidates, err := reopened.GetCandidates()
+	assert.Nil(t, err)
+	assert.Equal(t, maxValidatorSize+2, len(candidates))
+}
@@ -0,0 +1,57 @@
+// Copyright 2017 The bgmchain Authors
+// This file is part of the bgmchain library.
+//
+// The bgmchain library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The bgmchain library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the bgmchain library. If not, see <http://www.gnu.org/licenses/>.
+
+package remotesigner
+
+import (
+	"github.com/5sWind/bgmchain/accounts"
+	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/common/hexutil"
+	"github.com/5sWind/bgmchain/rpc"
+)
+
+// SigningAPI is the daemon side of the remote signer, signing hashes with the
+// unlocked accounts of a local account manager. A standalone signing daemon
+// serves it under the "signer" namespace.
+type SigningAPI struct {
+	am *accounts.Manager
+}
+
+// NewSigningAPI creates the signing API backed by the given account manager.
+func NewSigningAPI(am *accounts.Manager) *SigningAPI {
+	return &SigningAPI{am: am}
+}
+
+// APIs returns the RPC descriptors a signing daemon offers.
+func APIs(am *accounts.Manager) []rpc.API {
+	return []rpc.API{{
+		Namespace: "signer",
+		Version:   "1.0",
+		Service:   NewSigningAPI(am),
+		Public:    false,
+	}}
+}
+
+// SignHash signs the hash with the key of the given account, which has to be
+// unlocked.
+func (api *SigningAPI) SignHash(address common.Address, hash hexutil.Bytes) (hexutil.Bytes, error) {
+	account := accounts.Account{Address: address}
+	wallet, err := api.am.Find(account)
+	if err != nil {
+		return nil, err
+	}
+	return wallet.SignHash(account, hash)
+}
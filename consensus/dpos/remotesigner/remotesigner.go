@@ -0,0 +1,133 @@
+// Copyright 2017 The bgmchain Authors
+// This file is part of the bgmchain library.
+//
+// The bgmchain library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The bgmchain library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the bgmchain library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package remotesigner seals DPoS blocks with keys held by an external signing
+// daemon, keeping slashing protection records so that no two different headers
+// are ever signed for the same slot.
+package remotesigner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/5sWind/bgmchain/accounts"
+	"github.com/5sWind/bgmchain/bgmdb"
+	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/common/hexutil"
+	"github.com/5sWind/bgmchain/log"
+	"github.com/5sWind/bgmchain/rpc"
+)
+
+// signHashMethod is the JSON-RPC method of the signing daemon signing a hash
+// with the key of an account.
+const signHashMethod = "signer_signHash"
+
+var (
+	// ErrDoubleSign is returned if a different header was already signed for
+	// the slot of the validator.
+	ErrDoubleSign = errors.New("refusing to sign a second header for the slot")
+
+	// errInvalidSignature is returned if the daemon replies with anything but a
+	// 65 byte secp256k1 signature.
+	errInvalidSignature = errors.New("invalid signature from remote signer")
+)
+
+var slotPrefix = []byte("slot-") // slotPrefix + validator + slot (uint64 big endian) -> signed hash
+
+// Signer forwards the signature hashes of DPoS headers to a signing daemon,
+// recording every slot signed for in its own database.
+type Signer struct {
+	client *rpc.Client
+	db     bgmdb.Database // Slashing protection records
+
+	mu sync.Mutex // Serializes the check and record of a slot
+}
+
+// New connects to the signing daemon listening on the given IPC path or HTTP or
+// WebSocket URL, keeping the slashing protection records in db.
+func New(endpoint string, db bgmdb.Database) (*Signer, error) {
+	client, err := rpc.Dial(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithClient(client, db), nil
+}
+
+// NewWithClient creates a signer talking to the signing daemon over an already
+// established connection.
+func NewWithClient(client *rpc.Client, db bgmdb.Database) *Signer {
+	return &Signer{client: client, db: db}
+}
+
+// SignSlot signs the signature hash of a header the validator mints in the
+// given slot with the key of account. It is a dpos.SlotSignerFn.
+//
+// The slot is recorded before the daemon is asked to sign, so a header is never
+// signed without a record even if the node crashes in between. Signing the same
+// hash again is allowed, signing a different one for the slot is refused.
+func (s *Signer) SignSlot(account accounts.Account, validator common.Address, slot int64, hash []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := slotKey(validator, slot)
+	signed, err := s.db.Get(key)
+	if err == nil && !bytes.Equal(signed, hash) {
+		log.Warn("Refused to sign a second header for the slot", "validator", validator, "slot", slot, "signed", common.BytesToHash(signed), "hash", common.BytesToHash(hash))
+		return nil, ErrDoubleSign
+	}
+	if err != nil {
+		if err := s.db.Put(key, hash); err != nil {
+			return nil, fmt.Errorf("failed to record slot: %v", err)
+		}
+	}
+	var sig hexutil.Bytes
+	if err := s.client.Call(&sig, signHashMethod, account.Address, hexutil.Bytes(hash)); err != nil {
+		return nil, err
+	}
+	if len(sig) != 65 {
+		return nil, errInvalidSignature
+	}
+	return sig, nil
+}
+
+// Signed returns the signature hash of the header signed for the slot of the
+// validator, if any.
+func (s *Signer) Signed(validator common.Address, slot int64) (common.Hash, bool) {
+	signed, err := s.db.Get(slotKey(validator, slot))
+	if err != nil {
+		return common.Hash{}, false
+	}
+	return common.BytesToHash(signed), true
+}
+
+// Close disconnects from the signing daemon and closes the slashing protection
+// database.
+func (s *Signer) Close() {
+	s.client.Close()
+	s.db.Close()
+}
+
+// slotKey returns the database key recording the slot of a validator.
+func slotKey(validator common.Address, slot int64) []byte {
+	key := make([]byte, len(slotPrefix)+common.AddressLength+8)
+	copy(key, slotPrefix)
+	copy(key[len(slotPrefix):], validator.Bytes())
+	binary.BigEndian.PutUint64(key[len(slotPrefix)+common.AddressLength:], uint64(slot))
+	return key
+}
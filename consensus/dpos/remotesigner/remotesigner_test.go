@@ -0,0 +1,87 @@
+// Copyright 2017 The bgmchain Authors
+// This file is part of the bgmchain library.
+//
+// The bgmchain library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The bgmchain library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the bgmchain library. If not, see <http://www.gnu.org/licenses/>.
+
+package remotesigner
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/5sWind/bgmchain/accounts"
+	"github.com/5sWind/bgmchain/accounts/keystore"
+	"github.com/5sWind/bgmchain/bgmdb"
+	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/crypto"
+	"github.com/5sWind/bgmchain/rpc"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignSlot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remotesigner-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// Run the signing daemon in process with an unlocked key
+	ks := keystore.NewPlaintextKeyStore(dir)
+	account, err := ks.NewAccount("")
+	assert.Nil(t, err)
+	assert.Nil(t, ks.Unlock(account, ""))
+	server := rpc.NewServer()
+	defer server.Stop()
+	assert.Nil(t, server.RegisterName("signer", NewSigningAPI(accounts.NewManager(ks))))
+
+	db, _ := bgmdb.NewMemDatabase()
+	signer := NewWithClient(rpc.DialInProc(server), db)
+	validator := common.StringToAddress("validator")
+	first, second := crypto.Keccak256([]byte("first")), crypto.Keccak256([]byte("second"))
+
+	// Signatures are made with the key of the daemon
+	sig, err := signer.SignSlot(account, validator, 10, first)
+	assert.Nil(t, err)
+	pubkey, err := crypto.SigToPub(first, sig)
+	assert.Nil(t, err)
+	assert.Equal(t, account.Address, crypto.PubkeyToAddress(*pubkey))
+
+	signed, ok := signer.Signed(validator, 10)
+	assert.True(t, ok)
+	assert.Equal(t, common.BytesToHash(first), signed)
+
+	// The same header may be signed again, a different one for the slot not
+	_, err = signer.SignSlot(account, validator, 10, first)
+	assert.Nil(t, err)
+	_, err = signer.SignSlot(account, validator, 10, second)
+	assert.Equal(t, ErrDoubleSign, err)
+
+	// Other slots and other validators are unaffected
+	_, err = signer.SignSlot(account, validator, 11, second)
+	assert.Nil(t, err)
+	_, err = signer.SignSlot(account, common.StringToAddress("other"), 10, second)
+	assert.Nil(t, err)
+
+	// The records outlive the signer
+	restarted := NewWithClient(rpc.DialInProc(server), db)
+	_, err = restarted.SignSlot(account, validator, 10, second)
+	assert.Equal(t, ErrDoubleSign, err)
+
+	// Locked keys can't sign, but the slot stays recorded
+	assert.Nil(t, ks.Lock(account.Address))
+	_, err = restarted.SignSlot(account, validator, 12, first)
+	assert.NotNil(t, err)
+	_, ok = restarted.Signed(validator, 12)
+	assert.True(t, ok)
+}
@@ -0,0 +1,239 @@
+package dpos
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/core/types"
+	"github.com/5sWind/bgmchain/crypto"
+	"github.com/5sWind/bgmchain/params"
+	"github.com/5sWind/bgmchain/trie"
+)
+
+const randaoSize = common.HashLength // Extra-data bytes holding a randao commitment or reveal
+
+var (
+	// errInvalidRandaoExtra is returned if the randao part of a block's
+	// extra-data is malformed.
+	errInvalidRandaoExtra = errors.New("invalid randao extra-data")
+	// errInvalidRandaoReveal is returned if a block's randao reveal isn't the
+	// preimage of the value its validator committed to.
+	errInvalidRandaoReveal = errors.New("randao reveal doesn't match commitment")
+	// errRandaoSecretUnknown is returned when minting if the local validator
+	// can't produce the reveal of its current commitment.
+	errRandaoSecretUnknown = errors.New("unknown randao commitment")
+
+	randaoMixKey  = []byte("randao-mix")
+	randaoPrefix  = []byte("randao-")
+	randaoSeedKey = []byte("dpos-randao-seed-")
+
+	shufflers = map[string]shuffler{
+		params.DposShuffleHash:   &hashShuffle{},
+		params.DposShuffleRandao: &randaoShuffle{},
+	}
+)
+
+// shuffler is a strategy deciding the order the validators elected for an
+// epoch mint in. Strategies may reserve a part of the header extra-data, between
+// the vanity and the seal, to collect the randomness they shuffle with.
+type shuffler interface {
+	// seed returns the seed to shuffle the validators of the given epoch with,
+	// reading the dpos context as left by the epoch before.
+	seed(dposContext *types.DposContext, parent *types.Header, epoch int64) int64
+
+	// carry moves the state of the strategy from the epoch trie of the previous
+	// epoch into the fresh one of the dpos context.
+	carry(prev *trie.Trie, dposContext *types.DposContext)
+
+	// extraSize is the number of extra-data bytes the strategy reserves, zero
+	// if the extra-data between vanity and seal is free-form.
+	extraSize() int
+
+	// verifyExtra checks the reserved extra-data without any state.
+	verifyExtra(extra []byte) error
+
+	// prepare fills the reserved extra-data of a header about to be minted.
+	prepare(d *Dpos, parent, header *types.Header, extra []byte) error
+
+	// accumulate checks the reserved extra-data of a header against the dpos
+	// context, after the election of the header took place, and records it.
+	accumulate(dposContext *types.DposContext, header *types.Header, extra []byte) error
+}
+
+// shufflerFor returns the shuffling strategy of the given rules.
+func shufflerFor(config *params.DposRules) shuffler {
+	if s, ok := shufflers[config.Shuffle]; ok {
+		return s
+	}
+	return shufflers[params.DposShuffleHash]
+}
+
+// verifyShuffleExtra checks the extra-data reserved by the strategy has the
+// right size and contents.
+func verifyShuffleExtra(s shuffler, header *types.Header) error {
+	if s.extraSize() == 0 {
+		return nil
+	}
+	if len(header.Extra) != extraVanity+s.extraSize()+extraSeal {
+		return errInvalidRandaoExtra
+	}
+	return s.verifyExtra(shuffleExtra(s, header))
+}
+
+// shuffleExtra returns the part of the extra-data reserved by the strategy.
+func shuffleExtra(s shuffler, header *types.Header) []byte {
+	if s.extraSize() == 0 {
+		return nil
+	}
+	return header.Extra[extraVanity : len(header.Extra)-extraSeal]
+}
+
+// hashShuffle seeds the shuffle with the hash of the parent of the electing
+// block. It is the original strategy, which the validator minting the last
+// block of an epoch can bias by grinding the contents of that block.
+type hashShuffle struct{}
+
+func (*hashShuffle) seed(dposContext *types.DposContext, parent *types.Header, epoch int64) int64 {
+	return int64(binary.LittleEndian.Uint32(crypto.Keccak512(parent.Hash().Bytes()))) + epoch
+}
+
+func (*hashShuffle) carry(prev *trie.Trie, dposContext *types.DposContext) {}
+func (*hashShuffle) extraSize() int                                        { return 0 }
+func (*hashShuffle) verifyExtra(extra []byte) error                        { return nil }
+
+func (*hashShuffle) prepare(d *Dpos, parent, header *types.Header, extra []byte) error {
+	return nil
+}
+
+func (*hashShuffle) accumulate(dposContext *types.DposContext, header *types.Header, extra []byte) error {
+	return nil
+}
+
+// randaoShuffle seeds the shuffle with randomness accumulated from all the
+// validators of the epoch before, RANDAO style.
+//
+// The first block a validator mints in an epoch carries a commitment, the top
+// of a hash chain only the validator knows. Every later block of the validator
+// in the epoch must carry the preimage of its previous value, which is mixed
+// into the randomness of the epoch. A validator thus can't choose what it
+// contributes, only withhold it by skipping its slot.
+type randaoShuffle struct{}
+
+func (*randaoShuffle) seed(dposContext *types.DposContext, parent *types.Header, epoch int64) int64 {
+	epochBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(epochBytes, uint64(epoch))
+
+	mix := dposContext.EpochTrie().Get(randaoMixKey)
+	return int64(binary.LittleEndian.Uint64(crypto.Keccak256(mix, epochBytes)))
+}
+
+func (*randaoShuffle) carry(prev *trie.Trie, dposContext *types.DposContext) {
+	if mix := prev.Get(randaoMixKey); mix != nil {
+		dposContext.EpochTrie().Update(randaoMixKey, mix)
+	}
+}
+
+func (*randaoShuffle) extraSize() int { return randaoSize }
+
+func (*randaoShuffle) verifyExtra(extra []byte) error {
+	if len(extra) != randaoSize || common.BytesToHash(extra) == (common.Hash{}) {
+		return errInvalidRandaoExtra
+	}
+	return nil
+}
+
+func (*randaoShuffle) prepare(d *Dpos, parent, header *types.Header, extra []byte) error {
+	if header.Validator == (common.Address{}) {
+		return ErrUnauthorizedValidator
+	}
+	config := d.config.At(header.Number)
+	epoch := header.Time.Int64() / config.EpochInterval
+
+	// The election at the start of an epoch drops the values of the epoch before
+	var stored []byte
+	if parent.Time.Int64()/config.EpochInterval == epoch {
+		dposContext, err := types.NewDposContextFromProto(d.triedb, parent.DposContext)
+		if err != nil {
+			return err
+		}
+		stored = dposContext.EpochTrie().Get(randaoKey(header.Validator))
+	}
+	chain, err := d.randaoChain(header.Validator, epoch, config)
+	if err != nil {
+		return err
+	}
+	if stored == nil {
+		copy(extra, chain[len(chain)-1].Bytes())
+		return nil
+	}
+	for i := len(chain) - 1; i > 0; i-- {
+		if chain[i] == common.BytesToHash(stored) {
+			copy(extra, chain[i-1].Bytes())
+			return nil
+		}
+	}
+	return errRandaoSecretUnknown
+}
+
+func (*randaoShuffle) accumulate(dposContext *types.DposContext, header *types.Header, extra []byte) error {
+	epochTrie := dposContext.EpochTrie()
+	key := randaoKey(header.Validator)
+
+	if stored := epochTrie.Get(key); stored != nil {
+		if crypto.Keccak256Hash(extra) != common.BytesToHash(stored) {
+			return errInvalidRandaoReveal
+		}
+		epochTrie.Update(randaoMixKey, crypto.Keccak256(epochTrie.Get(randaoMixKey), extra))
+	}
+	epochTrie.Update(key, common.CopyBytes(extra))
+	return nil
+}
+
+// randaoKey returns the epoch trie key the latest randao value of a validator
+// is stored under.
+func randaoKey(validator common.Address) []byte {
+	return append(common.CopyBytes(randaoPrefix), validator.Bytes()...)
+}
+
+// randaoChain returns the hash chain the local validator reveals in the given
+// epoch, long enough to mint every slot of it. The chain is derived from a
+// random seed kept in the database, so it survives restarts.
+func (d *Dpos) randaoChain(validator common.Address, epoch int64, config *params.DposRules) ([]common.Hash, error) {
+	cacheKey := randaoChainKey{validator: validator, epoch: epoch}
+	if chain, ok := d.randaoChains.Get(cacheKey); ok {
+		return chain.([]common.Hash), nil
+	}
+	d.randaoMu.Lock()
+	defer d.randaoMu.Unlock()
+
+	key := append(common.CopyBytes(randaoSeedKey), validator.Bytes()...)
+	seed, err := d.db.Get(key)
+	if err != nil {
+		seed = make([]byte, common.HashLength)
+		if _, err := rand.Read(seed); err != nil {
+			return nil, fmt.Errorf("failed to generate randao seed: %v", err)
+		}
+		if err := d.db.Put(key, seed); err != nil {
+			return nil, err
+		}
+	}
+	epochBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(epochBytes, uint64(epoch))
+
+	chain := make([]common.Hash, config.EpochInterval/config.BlockInterval+1)
+	chain[0] = crypto.Keccak256Hash(seed, epochBytes)
+	for i := 1; i < len(chain); i++ {
+		chain[i] = crypto.Keccak256Hash(chain[i-1].Bytes())
+	}
+	d.randaoChains.Add(cacheKey, chain)
+	return chain, nil
+}
+
+// randaoChainKey identifies the hash chain of a validator for an epoch.
+type randaoChainKey struct {
+	validator common.Address
+	epoch     int64
+}
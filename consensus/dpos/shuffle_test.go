@@ -0,0 +1,113 @@
+package dpos
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/5sWind/bgmchain/bgmdb"
+	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/core/types"
+	"github.com/5sWind/bgmchain/crypto"
+	"github.com/5sWind/bgmchain/params"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRandaoShuffle(t *testing.T) {
+	db, _ := bgmdb.NewMemDatabase()
+	config := *testConfig
+	config.Shuffle = params.DposShuffleRandao
+	engine, _ := New(&config, db)
+	shuffler := shufflerFor(engine.config.At(big0))
+	validator := common.StringToAddress("validator")
+
+	dposContext, err := types.NewDposContext(db)
+	assert.Nil(t, err)
+
+	// mint blocks of the same epoch in turn, checking each against the dpos
+	// context the block before left behind
+	parent := &types.Header{Number: big.NewInt(1), Time: big.NewInt(epochInterval)}
+	mint := func() *types.Header {
+		parent.DposContext, err = dposContext.CommitTo(db)
+		assert.Nil(t, err)
+		header := &types.Header{
+			Number:    new(big.Int).Add(parent.Number, big1),
+			Time:      new(big.Int).Add(parent.Time, big.NewInt(blockInterval)),
+			Validator: validator,
+			Extra:     make([]byte, extraVanity+randaoSize+extraSeal),
+		}
+		assert.Nil(t, shuffler.prepare(engine, parent, header, shuffleExtra(shuffler, header)))
+		assert.Nil(t, verifyShuffleExtra(shuffler, header))
+		return header
+	}
+	// the first block commits without contributing to the mix
+	first := mint()
+	assert.Nil(t, shuffler.accumulate(dposContext, first, shuffleExtra(shuffler, first)))
+	assert.Nil(t, dposContext.EpochTrie().Get(randaoMixKey))
+	seed := shuffler.seed(dposContext, parent, 1)
+
+	// later blocks reveal the preimage of the previous value
+	parent = first
+	second := mint()
+	reveal := shuffleExtra(shuffler, second)
+	assert.Equal(t, crypto.Keccak256Hash(reveal).Bytes(), shuffleExtra(shuffler, first))
+
+	forged := &types.Header{Validator: validator, Extra: common.CopyBytes(second.Extra)}
+	forged.Extra[extraVanity] ^= 0xff
+	assert.Equal(t, errInvalidRandaoReveal, shuffler.accumulate(dposContext, forged, shuffleExtra(shuffler, forged)))
+
+	assert.Nil(t, shuffler.accumulate(dposContext, second, reveal))
+	assert.Equal(t, crypto.Keccak256(reveal), dposContext.EpochTrie().Get(randaoMixKey))
+	assert.NotEqual(t, seed, shuffler.seed(dposContext, parent, 1))
+
+	// the chain of the validator survives a restart
+	parent = second
+	third := mint()
+	restarted, _ := New(&config, db)
+	replayed := &types.Header{Number: third.Number, Time: third.Time, Validator: validator, Extra: make([]byte, len(third.Extra))}
+	assert.Nil(t, shuffler.prepare(restarted, parent, replayed, shuffleExtra(shuffler, replayed)))
+	assert.Equal(t, third.Extra, replayed.Extra)
+
+	// minting for another validator doesn't evict the chain of the first one
+	other, err := engine.randaoChain(common.StringToAddress("other"), 1, engine.config.At(big0))
+	assert.Nil(t, err)
+	chain, err := engine.randaoChain(validator, 1, engine.config.At(big0))
+	assert.Nil(t, err)
+	assert.NotEqual(t, other, chain)
+	assert.Equal(t, chain[len(chain)-1].Bytes(), shuffleExtra(shuffler, first))
+
+	// a header without a local validator can't be prepared
+	orphan := &types.Header{Number: third.Number, Time: third.Time, Extra: make([]byte, len(third.Extra))}
+	assert.Equal(t, ErrUnauthorizedValidator, shuffler.prepare(engine, parent, orphan, shuffleExtra(shuffler, orphan)))
+
+	// the mix is carried over into the next epoch
+	mix := dposContext.EpochTrie().Get(randaoMixKey)
+	prevEpochTrie := dposContext.EpochTrie()
+	epochTrie, _ := types.NewEpochTrie(common.Hash{}, db)
+	dposContext.SetEpoch(epochTrie)
+	shuffler.carry(prevEpochTrie, dposContext)
+	assert.Equal(t, mix, dposContext.EpochTrie().Get(randaoMixKey))
+}
+
+func TestVerifyShuffleExtra(t *testing.T) {
+	randao := shufflers[params.DposShuffleRandao]
+	hash := shufflers[params.DposShuffleHash]
+
+	valid := make([]byte, extraVanity+randaoSize+extraSeal)
+	valid[extraVanity] = 1
+	tests := []struct {
+		shuffler shuffler
+		extra    []byte
+		err      error
+	}{
+		{hash, make([]byte, extraVanity+extraSeal), nil},
+		{hash, make([]byte, extraVanity+100+extraSeal), nil},
+		{randao, valid, nil},
+		{randao, make([]byte, extraVanity+randaoSize+extraSeal), errInvalidRandaoExtra},
+		{randao, make([]byte, extraVanity+extraSeal), errInvalidRandaoExtra},
+		{randao, append(common.CopyBytes(valid), 0), errInvalidRandaoExtra},
+	}
+	for i, test := range tests {
+		assert.Equal(t, test.err, verifyShuffleExtra(test.shuffler, &types.Header{Extra: test.extra}), "test %d", i)
+	}
+}
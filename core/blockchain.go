@@ -43,10 +43,12 @@ import (
 	"github.com/5sWind/bgmchain/rlp"
 	"github.com/5sWind/bgmchain/trie"
 	"github.com/hashicorp/golang-lru"
+	"gopkg.in/karalabe/cookiejar.v2/collections/prque"
 )
 
 var (
-	blockInsertTimer = metrics.NewTimer("chain/inserts")
+	blockInsertTimer       = metrics.NewTimer("chain/inserts")
+	confirmedConflictMeter = metrics.NewMeter("chain/reorgs/confirmed")
 
 	ErrNoGenesis = errors.New("Genesis not found in chain")
 )
@@ -57,11 +59,20 @@ const (
 	maxFutureBlocks     = 256
 	maxTimeFutureBlocks = 30
 	badBlockLimit       = 10
+	triesInMemory       = 128
 
 //
 	BlockChainVersion = 3
 )
 
+// CacheConfig contains the configuration values for the trie caching and
+// pruning of the blockchain.
+type CacheConfig struct {
+	Disabled      bool          // Whether to write every state to disk (archive node)
+	TrieNodeLimit int           // Memory limit (MB) at which to flush the in-memory tries to disk
+	TrieTimeLimit time.Duration // Time limit after which to flush the in-memory tries to disk
+}
+
 //
 //
 //
@@ -81,6 +92,10 @@ type BlockChain struct {
 
 	hc            *HeaderChain
 	chainDb       bgmdb.Database
+	cacheConfig   *CacheConfig       // Cache configuration for pruning
+	triedb        *trie.NodeDatabase // In-memory trie nodes of the recent states, flushed into chainDb
+	triegc        *prque.Prque       // Priority queue mapping block numbers to tries to gc
+	gcproc        time.Duration      // Accumulated canonical block processing since the last flush
 	rmLogsFeed    event.Feed
 	chainFeed     event.Feed
 	chainSideFeed event.Feed
@@ -120,17 +135,25 @@ type BlockChain struct {
 //
 //
 //
-func NewBlockChain(chainDb bgmdb.Database, config *params.ChainConfig, engine consensus.Engine, vmConfig vm.Config) (*BlockChain, error) {
+func NewBlockChain(chainDb bgmdb.Database, cacheConfig *CacheConfig, config *params.ChainConfig, engine consensus.Engine, vmConfig vm.Config) (*BlockChain, error) {
+	// Without a cache configuration every state is written out, as always
+	if cacheConfig == nil {
+		cacheConfig = &CacheConfig{Disabled: true}
+	}
 	bodyCache, _ := lru.New(bodyCacheLimit)
 	bodyRLPCache, _ := lru.New(bodyCacheLimit)
 	blockCache, _ := lru.New(blockCacheLimit)
 	futureBlocks, _ := lru.New(maxFutureBlocks)
 	badBlocks, _ := lru.New(badBlockLimit)
 
+	triedb := trie.NewNodeDatabase(chainDb)
 	bc := &BlockChain{
 		config:       config,
 		chainDb:      chainDb,
-		stateCache:   state.NewDatabase(chainDb),
+		cacheConfig:  cacheConfig,
+		triedb:       triedb,
+		triegc:       prque.New(),
+		stateCache:   state.NewDatabase(triedb),
 		quit:         make(chan struct{}),
 		bodyCache:    bodyCache,
 		bodyRLPCache: bodyRLPCache,
@@ -143,6 +166,11 @@ func NewBlockChain(chainDb bgmdb.Database, config *params.ChainConfig, engine co
 	bc.SetValidator(NewBlockValidator(config, bc, engine))
 	bc.SetProcessor(NewStateProcessor(config, bc, engine))
 
+	// The dpos context tries of the recent blocks may only be held in memory
+	if dposEngine, isDpos := engine.(*dpos.Dpos); isDpos {
+		dposEngine.SetTrieDatabase(triedb)
+	}
+
 	var err error
 	bc.hc, err = NewHeaderChain(chainDb, config, engine, bc.getProcInterrupt)
 	if err != nil {
@@ -170,6 +198,12 @@ func NewBlockChain(chainDb bgmdb.Database, config *params.ChainConfig, engine co
 	}
 //
 	go bc.update()
+
+	// Move the blocks the chain finalized into the ancient store, if any
+	if store, ok := chainDb.(bgmdb.AncientStore); ok {
+		bc.wg.Add(1)
+		go bc.freeze(store)
+	}
 	return bc, nil
 }
 
@@ -195,10 +229,12 @@ func (bc *BlockChain) loadLastState() error {
 		return bc.Reset()
 	}
 //
-	if _, err := state.New(currentBlock.Root(), bc.stateCache); err != nil {
-//
-		log.Warn("Head state missing, resetting chain", "number", currentBlock.Number(), "hash", currentBlock.Hash())
-		return bc.Reset()
+	if !bc.hasState(currentBlock.Header()) {
+		// The recent states were lost with the memory, rewind to a stored one
+		log.Warn("Head state missing, repairing chain", "number", currentBlock.Number(), "hash", currentBlock.Hash())
+		if err := bc.repair(&currentBlock); err != nil {
+			return err
+		}
 	}
 //
 	bc.currentBlock = currentBlock
@@ -232,6 +268,36 @@ func (bc *BlockChain) loadLastState() error {
 	return nil
 }
 
+// hasState reports whether both the account trie and the dpos context of a
+// block are available.
+func (bc *BlockChain) hasState(header *types.Header) bool {
+	if _, err := state.New(header.Root, bc.stateCache); err != nil {
+		return false
+	}
+	if header.DposContext != nil {
+		if _, err := types.NewDposContextFromProto(bc.triedb, header.DposContext); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// repair rolls the given head block back until one with its state available
+// is found. This is needed after a crash lost the states held in memory only.
+func (bc *BlockChain) repair(head **types.Block) error {
+	for {
+		if bc.hasState((*head).Header()) {
+			log.Info("Rewound blockchain to past state", "number", (*head).Number(), "hash", (*head).Hash())
+			return nil
+		}
+		block := bc.GetBlock((*head).ParentHash(), (*head).NumberU64()-1)
+		if block == nil {
+			return fmt.Errorf("missing block %d [%x…]", (*head).NumberU64()-1, (*head).ParentHash().Bytes()[:4])
+		}
+		*head = block
+	}
+}
+
 //
 //
 //
@@ -520,8 +586,10 @@ func (bc *BlockChain) HasBlock(hash common.Hash, number uint64) bool {
 	if bc.blockCache.Contains(hash) {
 		return true
 	}
-	ok, _ := bc.chainDb.Has(blockBodyKey(hash, number))
-	return ok
+	if ok, _ := bc.chainDb.Has(blockBodyKey(hash, number)); ok {
+		return true
+	}
+	return hasAncient(bc.chainDb, hash, number)
 }
 
 //
@@ -544,7 +612,7 @@ func (bc *BlockChain) GetBlock(hash common.Hash, number uint64) *types.Block {
 	if block, ok := bc.blockCache.Get(hash); ok {
 		return block.(*types.Block)
 	}
-	block := GetBlock(bc.chainDb, hash, number)
+	block := getBlock(bc.chainDb, bc.triedb, hash, number)
 	if block == nil {
 		return nil
 	}
@@ -607,6 +675,27 @@ func (bc *BlockChain) Stop() {
 	atomic.StoreInt32(&bc.procInterrupt, 1)
 
 	bc.wg.Wait()
+
+	// Unless running an archive node, flush the state of the head and of a few
+	// blocks before it, so a restart can pick up from there
+	if !bc.cacheConfig.Disabled {
+		for _, offset := range []uint64{0, 1, triesInMemory - 1} {
+			if number := bc.CurrentBlock().NumberU64(); number > offset {
+				recent := bc.GetBlockByNumber(number - offset)
+
+				log.Info("Writing cached state to disk", "block", recent.Number(), "hash", recent.Hash(), "root", recent.Root())
+				if err := bc.commitState(recent.Header()); err != nil {
+					log.Error("Failed to commit recent state trie", "err", err)
+				}
+			}
+		}
+		for !bc.triegc.Empty() {
+			bc.triedb.Dereference(bc.triegc.PopItem().(common.Hash))
+		}
+		if nodes := bc.triedb.Nodes(); nodes != 0 {
+			log.Error("Dangling trie nodes after full cleanup", "nodes", nodes)
+		}
+	}
 	log.Info("Blockchain manager stopped")
 }
 
@@ -809,10 +898,15 @@ func (bc *BlockChain) WriteBlockAndState(block *types.Block, receipts []*types.R
 	if err := WriteBlock(batch, block); err != nil {
 		return NonStatTy, err
 	}
-	if _, err := block.DposContext.CommitTo(batch); err != nil {
+	dposContext, err := block.DposContext.CommitTo(bc.triedb)
+	if err != nil {
+		return NonStatTy, err
+	}
+	root, err := state.CommitTo(bc.triedb, bc.config.IsEIP158(block.Number()))
+	if err != nil {
 		return NonStatTy, err
 	}
-	if _, err := state.CommitTo(batch, bc.config.IsEIP158(block.Number())); err != nil {
+	if err := bc.writeState(block.NumberU64(), append([]common.Hash{root}, dposRoots(dposContext)...)); err != nil {
 		return NonStatTy, err
 	}
 	if err := WriteBlockReceipts(batch, block.Hash(), block.NumberU64(), receipts); err != nil {
@@ -827,6 +921,10 @@ func (bc *BlockChain) WriteBlockAndState(block *types.Block, receipts []*types.R
 //
 		reorg = block.NumberU64() < bc.currentBlock.NumberU64() || (block.NumberU64() == bc.currentBlock.NumberU64() && mrand.Float64() < 0.5)
 	}
+	// The fork choice rule of the consensus engine overrides total difficulty
+	if choice := bc.hc.forkChoice(bc.currentBlock.Header(), block.Header()); choice != 0 {
+		reorg = choice > 0
+	}
 	if reorg {
 //
 		if block.ParentHash() != bc.currentBlock.Hash() {
@@ -858,6 +956,81 @@ func (bc *BlockChain) WriteBlockAndState(block *types.Block, receipts []*types.R
 	return status, nil
 }
 
+// writeState either flushes the freshly committed tries of a block to disk, or
+// references them in memory and garbage collects the tries of the blocks that
+// fell out of the retention window, flushing one of them now and then.
+func (bc *BlockChain) writeState(number uint64, roots []common.Hash) error {
+	if bc.cacheConfig.Disabled {
+		for _, root := range roots {
+			if err := bc.triedb.Commit(root); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, root := range roots {
+		bc.triedb.Reference(root, common.Hash{})
+		bc.triegc.Push(root, -float32(number))
+	}
+	if number <= triesInMemory {
+		return nil
+	}
+	header := bc.GetHeaderByNumber(number - triesInMemory)
+	if header == nil {
+		return nil
+	}
+	chosen := header.Number.Uint64()
+
+	limit := common.StorageSize(bc.cacheConfig.TrieNodeLimit) * 1024 * 1024
+	if size := bc.triedb.Size(); size > limit || bc.gcproc > bc.cacheConfig.TrieTimeLimit {
+		log.Info("Writing cached state to disk", "block", chosen, "hash", header.Hash(), "size", size, "elapsed", common.PrettyDuration(bc.gcproc))
+		if err := bc.commitState(header); err != nil {
+			return err
+		}
+		bc.gcproc = 0
+	}
+	// Garbage collect the tries below the retention window
+	for !bc.triegc.Empty() {
+		root, prio := bc.triegc.Pop()
+		if uint64(-prio) > chosen {
+			bc.triegc.Push(root, prio)
+			break
+		}
+		bc.triedb.Dereference(root.(common.Hash))
+	}
+	return nil
+}
+
+// commitState flushes the account trie and the dpos context tries of a block
+// from memory to disk.
+func (bc *BlockChain) commitState(header *types.Header) error {
+	roots := []common.Hash{header.Root}
+	if header.DposContext != nil {
+		roots = append(roots, dposRoots(header.DposContext)...)
+	}
+	for _, root := range roots {
+		if err := bc.triedb.Commit(root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dposRoots returns the roots of the tries making up a dpos context.
+func dposRoots(proto *types.DposContextProto) []common.Hash {
+	var roots []common.Hash
+	for t := types.DposEpochTrie; t.Valid(); t++ {
+		roots = append(roots, proto.TrieRoot(t))
+	}
+	return roots
+}
+
+// TrieDB returns the database the tries of the chain are opened on, holding the
+// recent ones in memory in front of the chain database.
+func (bc *BlockChain) TrieDB() *trie.NodeDatabase {
+	return bc.triedb
+}
+
 //
 //
 //
@@ -924,6 +1097,11 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 			bc.reportBlock(block, nil, ErrBlacklistedHash)
 			return i, events, coalescedLogs, ErrBlacklistedHash
 		}
+		// Refuse blocks of chains that would revert the confirmed block
+		if err := bc.hc.checkConfirmed(block.Header()); err != nil {
+			log.Warn("Rejected block conflicting with the confirmed block", "number", block.Number(), "hash", block.Hash())
+			return i, events, coalescedLogs, err
+		}
 //
 		bstart := time.Now()
 
@@ -967,7 +1145,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 		} else {
 			parent = chain[i-1]
 		}
-		block.DposContext, err = types.NewDposContextFromProto(bc.chainDb, parent.Header().DposContext)
+		block.DposContext, err = types.NewDposContextFromProto(bc.triedb, parent.Header().DposContext)
 		if err != nil {
 			return i, events, coalescedLogs, err
 		}
@@ -1017,6 +1195,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 
 			coalescedLogs = append(coalescedLogs, logs...)
 			blockInsertTimer.UpdateSince(bstart)
+			bc.gcproc += time.Since(bstart)
 			events = append(events, ChainEvent{block, block.Hash(), logs})
 			lastCanon = block
 
@@ -1154,6 +1333,13 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 			return fmt.Errorf("Invalid new chain")
 		}
 	}
+	// Never drop the confirmed block from the canonical chain
+	if confirmed := bc.hc.ConfirmedHeader(); confirmed != nil && commonBlock.NumberU64() < confirmed.Number.Uint64() {
+		confirmedConflictMeter.Mark(1)
+		log.Warn("Refused reorg past the confirmed block", "number", commonBlock.Number(), "hash", commonBlock.Hash(),
+			"confirmed", confirmed.Number, "confirmedhash", confirmed.Hash())
+		return ErrConfirmedConflict
+	}
 //
 	if len(oldChain) > 0 && len(newChain) > 0 {
 		logFn := log.Debug
@@ -1375,6 +1561,10 @@ func (bc *BlockChain) Config() *params.ChainConfig { return bc.config }
 //
 func (bc *BlockChain) Engine() consensus.Engine { return bc.engine }
 
+// ConfirmedHeader retrieves the irreversible block of the chain, or nil if the
+// consensus engine doesn't finalize blocks.
+func (bc *BlockChain) ConfirmedHeader() *types.Header { return bc.hc.ConfirmedHeader() }
+
 //
 func (bc *BlockChain) SubscribeRemovedLogsEvent(ch chan<- RemovedLogsEvent) event.Subscription {
 	return bc.scope.Track(bc.rmLogsFeed.Subscribe(ch))
@@ -17,6 +17,7 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
 	"math/rand"
@@ -25,6 +26,7 @@ import (
 	"time"
 
 	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/consensus"
 	"github.com/5sWind/bgmchain/consensus/bgmash"
 	"github.com/5sWind/bgmchain/core/state"
 	"github.com/5sWind/bgmchain/core/types"
@@ -46,7 +48,7 @@ func newTestBlockChain(fake bool) *BlockChain {
 	if !fake {
 		engine = bgmash.NewTester()
 	}
-	blockchain, err := NewBlockChain(db, gspec.Config, engine, vm.Config{})
+	blockchain, err := NewBlockChain(db, nil, gspec.Config, engine, vm.Config{})
 	if err != nil {
 		panic(err)
 	}
@@ -440,6 +442,142 @@ func testReorg(t *testing.T, first, second []int, td int64, full bool) {
 	}
 }
 
+// confirmingEngine is a consensus engine with a settable irreversible block.
+type confirmingEngine struct {
+	consensus.Engine
+	confirmed *types.Header
+}
+
+func (e *confirmingEngine) ConfirmedHeader(chain consensus.ChainReader) (*types.Header, error) {
+	if e.confirmed == nil {
+		return nil, errors.New("no confirmed block")
+	}
+	return e.confirmed, nil
+}
+
+// Tests that chains forking off below the confirmed block are refused, even if
+// they are heavier than the canonical one.
+func TestReorgPastConfirmedHeaders(t *testing.T) { testReorgPastConfirmed(t, false) }
+func TestReorgPastConfirmedBlocks(t *testing.T)  { testReorgPastConfirmed(t, true) }
+
+func testReorgPastConfirmed(t *testing.T, full bool) {
+	db, _ := bgmdb.NewMemDatabase()
+	gspec := &Genesis{
+		Config:     params.TestChainConfig,
+		Difficulty: big.NewInt(1),
+	}
+	genesis := gspec.MustCommit(db)
+	engine := &confirmingEngine{Engine: bgmash.NewFullFaker()}
+	bc, err := NewBlockChain(db, nil, gspec.Config, engine, vm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Stop()
+	bc.SetValidator(bproc{})
+
+	insert := func(d []int, seed byte) error {
+		if full {
+			_, err := bc.InsertChain(makeBlockChainWithDiff(genesis, d, seed))
+			return err
+		}
+		_, err := bc.InsertHeaderChain(makeHeaderChainWithDiff(genesis, d, seed), 1)
+		return err
+	}
+	head := func() common.Hash {
+		if full {
+			return bc.CurrentBlock().Hash()
+		}
+		return bc.CurrentHeader().Hash()
+	}
+	if err := insert([]int{1, 2, 3, 4}, 11); err != nil {
+		t.Fatalf("failed to insert canonical chain: %v", err)
+	}
+	canonical := head()
+
+	// A heavier fork from genesis must not replace a confirmed block
+	engine.confirmed = bc.GetHeaderByNumber(2)
+	if err := insert([]int{1, 10}, 22); err != ErrConfirmedConflict {
+		t.Fatalf("conflicting chain error mismatch: have %v, want %v", err, ErrConfirmedConflict)
+	}
+	if have := head(); have != canonical {
+		t.Fatalf("head reorganised past the confirmed block: have %x, want %x", have, canonical)
+	}
+	// The same fork is fine as long as the common ancestor is confirmed
+	engine.confirmed = bc.GetHeaderByNumber(0)
+	if err := insert([]int{1, 10}, 22); err != nil {
+		t.Fatalf("failed to reorg above the confirmed block: %v", err)
+	}
+	if have := head(); have == canonical {
+		t.Fatalf("head not reorganised above the confirmed block")
+	}
+}
+
+// candidateEngine is a consensus engine registering the coinbase of every block
+// as a dpos candidate.
+type candidateEngine struct {
+	consensus.Engine
+}
+
+func (e *candidateEngine) Finalize(chain consensus.ChainReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt, dposContext *types.DposContext) (*types.Block, error) {
+	if err := dposContext.BecomeCandidate(header.Coinbase); err != nil {
+		return nil, err
+	}
+	return e.Engine.Finalize(chain, header, state, txs, uncles, receipts, dposContext)
+}
+
+// Tests that the dpos context of a recent block can be read back while its tries
+// are only held in memory by the garbage collecting chain.
+func TestRecentBlockDposContext(t *testing.T) {
+	db, _ := bgmdb.NewMemDatabase()
+	gspec := &Genesis{
+		Config:     params.TestChainConfig,
+		Difficulty: big.NewInt(1),
+	}
+	genesis := gspec.MustCommit(db)
+	cacheConfig := &CacheConfig{TrieNodeLimit: 256, TrieTimeLimit: 5 * time.Minute}
+	bc, err := NewBlockChain(db, cacheConfig, gspec.Config, &candidateEngine{Engine: bgmash.NewFullFaker()}, vm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Stop()
+	bc.SetValidator(bproc{})
+
+	// Seal the block with the dpos context its coinbase registration results in
+	candidate := common.StringToAddress("candidate")
+	blocks, _ := GenerateChain(gspec.Config, genesis, db, 1, func(i int, gen *BlockGen) {
+		gen.SetCoinbase(candidate)
+	})
+	scratch, _ := bgmdb.NewMemDatabase()
+	dposContext, err := types.NewDposContext(scratch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dposContext.BecomeCandidate(candidate); err != nil {
+		t.Fatal(err)
+	}
+	header := blocks[0].Header()
+	header.DposContext = dposContext.ToProto()
+	block := blocks[0].WithSeal(header)
+	if _, err := bc.InsertChain(types.Blocks{block}); err != nil {
+		t.Fatalf("failed to insert block: %v", err)
+	}
+
+	if stored := GetBlock(db, block.Hash(), block.NumberU64()); stored.DposContext != nil {
+		t.Fatalf("dpos context of a recent block flushed to disk")
+	}
+	recent := bc.GetBlock(block.Hash(), block.NumberU64())
+	if recent == nil || recent.DposContext == nil {
+		t.Fatalf("dpos context of the recent block missing")
+	}
+	candidates, err := recent.DposContext.GetCandidates()
+	if err != nil {
+		t.Fatalf("failed to read candidates: %v", err)
+	}
+	if len(candidates) != 1 || candidates[0] != candidate {
+		t.Fatalf("candidates mismatch: have %x, want [%x]", candidates, candidate)
+	}
+}
+
 //
 func TestBadHeaderHashes(t *testing.T) { testBadHashes(t, false) }
 func TestBadBlockHashes(t *testing.T)  { testBadHashes(t, true) }
@@ -498,7 +636,7 @@ func testReorgBadHashes(t *testing.T, full bool) {
 	}
 
 //
-	ncm, err := NewBlockChain(bc.chainDb, bc.config, bgmash.NewFaker(), vm.Config{})
+	ncm, err := NewBlockChain(bc.chainDb, nil, bc.config, bgmash.NewFaker(), vm.Config{})
 	if err != nil {
 		t.Fatalf("failed to create new chain manager: %v", err)
 	}
@@ -611,7 +749,7 @@ func TestFastVsFullChains(t *testing.T) {
 //
 	archiveDb, _ := bgmdb.NewMemDatabase()
 	gspec.MustCommit(archiveDb)
-	archive, _ := NewBlockChain(archiveDb, gspec.Config, bgmash.NewFaker(), vm.Config{})
+	archive, _ := NewBlockChain(archiveDb, nil, gspec.Config, bgmash.NewFaker(), vm.Config{})
 	defer archive.Stop()
 
 	if n, err := archive.InsertChain(blocks); err != nil {
@@ -620,7 +758,7 @@ func TestFastVsFullChains(t *testing.T) {
 //
 	fastDb, _ := bgmdb.NewMemDatabase()
 	gspec.MustCommit(fastDb)
-	fast, _ := NewBlockChain(fastDb, gspec.Config, bgmash.NewFaker(), vm.Config{})
+	fast, _ := NewBlockChain(fastDb, nil, gspec.Config, bgmash.NewFaker(), vm.Config{})
 	defer fast.Stop()
 
 	headers := make([]*types.Header, len(blocks))
@@ -698,7 +836,7 @@ func TestLightVsFastVsFullChainHeads(t *testing.T) {
 	archiveDb, _ := bgmdb.NewMemDatabase()
 	gspec.MustCommit(archiveDb)
 
-	archive, _ := NewBlockChain(archiveDb, gspec.Config, bgmash.NewFaker(), vm.Config{})
+	archive, _ := NewBlockChain(archiveDb, nil, gspec.Config, bgmash.NewFaker(), vm.Config{})
 	if n, err := archive.InsertChain(blocks); err != nil {
 		t.Fatalf("failed to process block %d: %v", n, err)
 	}
@@ -711,7 +849,7 @@ func TestLightVsFastVsFullChainHeads(t *testing.T) {
 //
 	fastDb, _ := bgmdb.NewMemDatabase()
 	gspec.MustCommit(fastDb)
-	fast, _ := NewBlockChain(fastDb, gspec.Config, bgmash.NewFaker(), vm.Config{})
+	fast, _ := NewBlockChain(fastDb, nil, gspec.Config, bgmash.NewFaker(), vm.Config{})
 	defer fast.Stop()
 
 	headers := make([]*types.Header, len(blocks))
@@ -732,7 +870,7 @@ func TestLightVsFastVsFullChainHeads(t *testing.T) {
 	lightDb, _ := bgmdb.NewMemDatabase()
 	gspec.MustCommit(lightDb)
 
-	light, _ := NewBlockChain(lightDb, gspec.Config, bgmash.NewFaker(), vm.Config{})
+	light, _ := NewBlockChain(lightDb, nil, gspec.Config, bgmash.NewFaker(), vm.Config{})
 	if n, err := light.InsertHeaderChain(headers, 1); err != nil {
 		t.Fatalf("failed to insert header %d: %v", n, err)
 	}
@@ -801,7 +939,7 @@ func TestChainTxReorgs(t *testing.T) {
 		}
 	})
 //
-	blockchain, _ := NewBlockChain(db, gspec.Config, bgmash.NewFaker(), vm.Config{})
+	blockchain, _ := NewBlockChain(db, nil, gspec.Config, bgmash.NewFaker(), vm.Config{})
 	if i, err := blockchain.InsertChain(chain); err != nil {
 		t.Fatalf("failed to insert original chain[%d]: %v", i, err)
 	}
@@ -872,7 +1010,7 @@ func TestLogReorgs(t *testing.T) {
 		signer  = types.NewEIP155Signer(gspec.Config.ChainId)
 	)
 
-	blockchain, _ := NewBlockChain(db, gspec.Config, bgmash.NewFaker(), vm.Config{})
+	blockchain, _ := NewBlockChain(db, nil, gspec.Config, bgmash.NewFaker(), vm.Config{})
 	defer blockchain.Stop()
 
 	rmLogsCh := make(chan RemovedLogsEvent)
@@ -962,7 +1100,7 @@ func TestEIP155Transition(t *testing.T) {
 		genesis = gspec.MustCommit(db)
 	)
 
-	blockchain, _ := NewBlockChain(db, gspec.Config, bgmash.NewFaker(), vm.Config{})
+	blockchain, _ := NewBlockChain(db, nil, gspec.Config, bgmash.NewFaker(), vm.Config{})
 	defer blockchain.Stop()
 
 	blocks, _ := GenerateChain(gspec.Config, genesis, db, 4, func(i int, block *BlockGen) {
@@ -1070,7 +1208,7 @@ func TestEIP161AccountRemoval(t *testing.T) {
 		}
 		genesis = gspec.MustCommit(db)
 	)
-	blockchain, _ := NewBlockChain(db, gspec.Config, bgmash.NewFaker(), vm.Config{})
+	blockchain, _ := NewBlockChain(db, nil, gspec.Config, bgmash.NewFaker(), vm.Config{})
 	defer blockchain.Stop()
 
 	blocks, _ := GenerateChain(gspec.Config, genesis, db, 3, func(i int, block *BlockGen) {
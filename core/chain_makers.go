@@ -180,7 +180,7 @@ func GenerateChain(config *params.ChainConfig, parent *types.Block, db bgmdb.Dat
 		if gen != nil {
 			gen(i, b)
 		}
-		dpos.AccumulateRewards(config, statedb, h, b.uncles)
+		dpos.AccumulateRewards(config, statedb, h, b.uncles, nil)
 		root, err := statedb.CommitTo(db, config.IsEIP158(h.Number))
 		if err != nil {
 			panic(fmt.Sprintf("state write error: %v", err))
@@ -233,7 +233,7 @@ func newCanonical(n int, full bool) (bgmdb.Database, *BlockChain, error) {
 	db, _ := bgmdb.NewMemDatabase()
 	genesis := gspec.MustCommit(db)
 
-	blockchain, _ := NewBlockChain(db, params.AllBgmashProtocolChanges, bgmash.NewFaker(), vm.Config{})
+	blockchain, _ := NewBlockChain(db, nil, params.AllBgmashProtocolChanges, bgmash.NewFaker(), vm.Config{})
 //
 	if n == 0 {
 		return db, blockchain, nil
@@ -91,13 +91,39 @@ func encodeBlockNumber(number uint64) []byte {
 
 //
 func GetCanonicalHash(db DatabaseReader, number uint64) common.Hash {
-	data, _ := db.Get(append(append(headerPrefix, encodeBlockNumber(number)...), numSuffix...))
+	data, _ := db.Get(headerHashKey(number))
+	if len(data) == 0 {
+		if store, ok := db.(bgmdb.AncientReader); ok {
+			data, _ = store.Ancient(bgmdb.FreezerHashTable, number)
+		}
+	}
 	if len(data) == 0 {
 		return common.Hash{}
 	}
 	return common.BytesToHash(data)
 }
 
+// readAncient retrieves an item of a block moved into the ancient store of db,
+// if db has one and the block with the given hash was frozen.
+func readAncient(db DatabaseReader, kind string, hash common.Hash, number uint64) []byte {
+	if !hasAncient(db, hash, number) {
+		return nil
+	}
+	data, _ := db.(bgmdb.AncientReader).Ancient(kind, number)
+	return data
+}
+
+// hasAncient reports whether the block with the given hash was moved into the
+// ancient store of db.
+func hasAncient(db DatabaseReader, hash common.Hash, number uint64) bool {
+	store, ok := db.(bgmdb.AncientReader)
+	if !ok || number >= store.Ancients() {
+		return false
+	}
+	data, _ := store.Ancient(bgmdb.FreezerHashTable, number)
+	return bytes.Equal(data, hash[:])
+}
+
 //
 //
 const missingNumber = uint64(0xffffffffffffffff)
@@ -150,6 +176,9 @@ func GetHeadFastBlockHash(db DatabaseReader) common.Hash {
 //
 func GetHeaderRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
 	data, _ := db.Get(headerKey(hash, number))
+	if len(data) == 0 {
+		data = readAncient(db, bgmdb.FreezerHeaderTable, hash, number)
+	}
 	return data
 }
 
@@ -171,17 +200,32 @@ func GetHeader(db DatabaseReader, hash common.Hash, number uint64) *types.Header
 //
 func GetBodyRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
 	data, _ := db.Get(blockBodyKey(hash, number))
+	if len(data) == 0 {
+		data = readAncient(db, bgmdb.FreezerBodiesTable, hash, number)
+	}
 	return data
 }
 
+func headerHashKey(number uint64) []byte {
+	return append(append(headerPrefix, encodeBlockNumber(number)...), numSuffix...)
+}
+
 func headerKey(hash common.Hash, number uint64) []byte {
 	return append(append(headerPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
 }
 
+func headerTdKey(hash common.Hash, number uint64) []byte {
+	return append(headerKey(hash, number), tdSuffix...)
+}
+
 func blockBodyKey(hash common.Hash, number uint64) []byte {
 	return append(append(bodyPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
 }
 
+func blockReceiptsKey(hash common.Hash, number uint64) []byte {
+	return append(append(blockReceiptsPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
 //
 //
 func GetBody(db DatabaseReader, hash common.Hash, number uint64) *types.Body {
@@ -200,7 +244,10 @@ func GetBody(db DatabaseReader, hash common.Hash, number uint64) *types.Body {
 //
 //
 func GetTd(db DatabaseReader, hash common.Hash, number uint64) *big.Int {
-	data, _ := db.Get(append(append(append(headerPrefix, encodeBlockNumber(number)...), hash[:]...), tdSuffix...))
+	data, _ := db.Get(headerTdKey(hash, number))
+	if len(data) == 0 {
+		data = readAncient(db, bgmdb.FreezerDifficultyTable, hash, number)
+	}
 	if len(data) == 0 {
 		return nil
 	}
@@ -219,6 +266,12 @@ func GetTd(db DatabaseReader, hash common.Hash, number uint64) *big.Int {
 //
 //
 func GetBlock(db DatabaseReader, hash common.Hash, number uint64) *types.Block {
+	return getBlock(db, db.(bgmdb.Database), hash, number)
+}
+
+// getBlock assembles a block like GetBlock, opening its dpos context on triedb,
+// which may hold the tries of recent blocks in memory in front of db.
+func getBlock(db DatabaseReader, triedb bgmdb.Database, hash common.Hash, number uint64) *types.Block {
 //
 	header := GetHeader(db, hash, number)
 	if header == nil {
@@ -233,7 +286,7 @@ func GetBlock(db DatabaseReader, hash common.Hash, number uint64) *types.Block {
 	block := types.NewBlockWithHeader(header).WithBody(body.Transactions, body.Uncles)
 
 //
-	block.DposContext = getDposContextTrie(db.(bgmdb.Database), header)
+	block.DposContext = getDposContextTrie(triedb, header)
 	return block
 }
 
@@ -252,7 +305,10 @@ func getDposContextTrie(db bgmdb.Database, header *types.Header) *types.DposCont
 //
 //
 func GetBlockReceipts(db DatabaseReader, hash common.Hash, number uint64) types.Receipts {
-	data, _ := db.Get(append(append(blockReceiptsPrefix, encodeBlockNumber(number)...), hash[:]...))
+	data, _ := db.Get(blockReceiptsKey(hash, number))
+	if len(data) == 0 {
+		data = readAncient(db, bgmdb.FreezerReceiptTable, hash, number)
+	}
 	if len(data) == 0 {
 		return nil
 	}
@@ -617,7 +673,12 @@ func GetChainConfig(db DatabaseReader, hash common.Hash) (*params.ChainConfig, e
 	if err := json.Unmarshal(jsonChainConfig, &config); err != nil {
 		return nil, err
 	}
-
+	// Resolve the dpos rule schedule once, refusing a config that doesn't pass
+	if config.Dpos != nil {
+		if err := config.Dpos.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid stored dpos configuration: %v", err)
+		}
+	}
 	return &config, nil
 }
 
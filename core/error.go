@@ -32,4 +32,12 @@ var (
 //
 //
 	ErrNonceTooHigh = errors.New("nonce too high")
+
+	// ErrAlreadySlashed is the reason a double sign report is refused if the
+	// validator has already been slashed for the slot.
+	ErrAlreadySlashed = errors.New("validator already slashed for this slot")
+
+	// ErrConfirmedConflict is returned if a block or header belongs to a chain
+	// forking off below the confirmed block, which can never be reorganised.
+	ErrConfirmedConflict = errors.New("chain conflicts with the confirmed block")
 )
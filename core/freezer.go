@@ -0,0 +1,130 @@
+// Copyright 2017 The bgmchain Authors
+// This file is part of the bgmchain library.
+//
+// The bgmchain library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The bgmchain library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the bgmchain library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/5sWind/bgmchain/bgmdb"
+	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/log"
+)
+
+const (
+	// freezerMargin is the number of blocks below the confirmed one kept in the
+	// key-value store, for the recent history to stay cheap to serve.
+	freezerMargin = 1024
+
+	// freezerBatchLimit is the maximum number of blocks frozen in one go.
+	freezerBatchLimit = 30000
+
+	// freezerRecheckInterval is the time between two checks for blocks to freeze.
+	freezerRecheckInterval = time.Minute
+)
+
+// freeze moves the canonical blocks older than the confirmed block minus the
+// freezer margin from the key-value store into the ancient store, until the
+// chain is stopped.
+func (bc *BlockChain) freeze(store bgmdb.AncientStore) {
+	defer bc.wg.Done()
+
+	for {
+		var frozen uint64
+		if confirmed := bc.ConfirmedHeader(); confirmed != nil && confirmed.Number.Uint64() > freezerMargin {
+			// Receipts are only known for the full blocks
+			limit := confirmed.Number.Uint64() - freezerMargin
+			if head := bc.CurrentBlock().NumberU64(); limit > head {
+				limit = head
+			}
+			var err error
+			if frozen, err = freezeBlocks(bc.chainDb, store, limit); err != nil {
+				log.Error("Failed to freeze ancient blocks", "err", err)
+			}
+		}
+		// Keep going right away while catching up with the chain
+		wait := freezerRecheckInterval
+		if frozen == freezerBatchLimit {
+			wait = 0
+		}
+		select {
+		case <-bc.quit:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// freezeBlocks appends the canonical blocks from the first not frozen yet up to
+// limit to the ancient store, at most freezerBatchLimit of them, and deletes
+// them from the key-value store along with all the side chain blocks of the same
+// heights. It returns the number of blocks frozen.
+func freezeBlocks(db bgmdb.Database, store bgmdb.AncientStore, limit uint64) (uint64, error) {
+	first := store.Ancients()
+	if first > limit {
+		return 0, nil
+	}
+	if limit-first >= freezerBatchLimit {
+		limit = first + freezerBatchLimit - 1
+	}
+	var (
+		start  = time.Now()
+		number = first
+		err    error
+	)
+	for ; number <= limit; number++ {
+		if err = freezeBlock(db, store, number); err != nil {
+			break
+		}
+	}
+	if number == first {
+		return 0, err
+	}
+	// Only drop the blocks from the key-value store once safely on disk
+	if err := store.SyncAncients(); err != nil {
+		return 0, err
+	}
+	for _, prefix := range [][]byte{headerPrefix, bodyPrefix, blockReceiptsPrefix} {
+		from := append(append([]byte{}, prefix...), encodeBlockNumber(first)...)
+		to := append(append([]byte{}, prefix...), encodeBlockNumber(number)...)
+		if err := db.DeleteRange(from, to); err != nil {
+			return number - first, err
+		}
+	}
+	log.Info("Moved blocks into ancient store", "from", first, "to", number-1, "elapsed", common.PrettyDuration(time.Since(start)))
+	return number - first, err
+}
+
+// freezeBlock appends a canonical block of the key-value store to the ancient
+// store.
+func freezeBlock(db bgmdb.Database, store bgmdb.AncientStore, number uint64) error {
+	hash, _ := db.Get(headerHashKey(number))
+	if len(hash) == 0 {
+		return fmt.Errorf("canonical hash of block #%d missing", number)
+	}
+	var (
+		h           = common.BytesToHash(hash)
+		header, _   = db.Get(headerKey(h, number))
+		body, _     = db.Get(blockBodyKey(h, number))
+		receipts, _ = db.Get(blockReceiptsKey(h, number))
+		td, _       = db.Get(headerTdKey(h, number))
+	)
+	if len(header) == 0 || len(body) == 0 || len(receipts) == 0 || len(td) == 0 {
+		return fmt.Errorf("block #%d [%x…] incomplete", number, hash[:4])
+	}
+	return store.AppendAncient(number, hash, header, body, receipts, td)
+}
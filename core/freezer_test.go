@@ -0,0 +1,120 @@
+// Copyright 2017 The bgmchain Authors
+// This file is part of the bgmchain library.
+//
+// The bgmchain library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The bgmchain library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the bgmchain library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/5sWind/bgmchain/bgmdb"
+	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/core/types"
+)
+
+// writeTestBlocks stores blocks along with their receipts and total difficulty,
+// making them canonical if asked to.
+func writeTestBlocks(t *testing.T, db bgmdb.Database, blocks []*types.Block, canonical bool) {
+	for _, block := range blocks {
+		if err := WriteBlock(db, block); err != nil {
+			t.Fatalf("failed to write block #%d: %v", block.Number(), err)
+		}
+		if err := WriteTd(db, block.Hash(), block.NumberU64(), new(big.Int).Add(block.Number(), big.NewInt(1))); err != nil {
+			t.Fatalf("failed to write td of block #%d: %v", block.Number(), err)
+		}
+		if err := WriteBlockReceipts(db, block.Hash(), block.NumberU64(), nil); err != nil {
+			t.Fatalf("failed to write receipts of block #%d: %v", block.Number(), err)
+		}
+		if canonical {
+			WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		}
+	}
+}
+
+func TestFreezeBlocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	kvdb, _ := bgmdb.NewMemDatabase()
+	db, err := bgmdb.NewDatabaseWithFreezer(kvdb, dir, false)
+	if err != nil {
+		t.Fatalf("failed to open ancient store: %v", err)
+	}
+	genesis := new(Genesis).MustCommit(db)
+	blocks := append([]*types.Block{genesis}, makeBlockChain(genesis, 8, db, canonicalSeed)...)
+	writeTestBlocks(t, db, blocks[1:], true)
+	side := makeBlockChain(genesis, 3, db, forkSeed)
+	writeTestBlocks(t, db, side, false)
+
+	store := db.(bgmdb.AncientStore)
+	if frozen, err := freezeBlocks(db, store, 5); err != nil || frozen != 6 {
+		t.Fatalf("failed to freeze blocks: frozen %d, err %v", frozen, err)
+	}
+	if frozen := store.Ancients(); frozen != 6 {
+		t.Fatalf("ancient block count mismatch: have %d, want 6", frozen)
+	}
+	// Frozen or not, the canonical blocks read the same, the side chain is gone
+	for _, block := range blocks {
+		number, hash := block.NumberU64(), block.Hash()
+		if have := GetCanonicalHash(db, number); have != hash {
+			t.Errorf("block #%d: canonical hash mismatch: have %x, want %x", number, have, hash)
+		}
+		if have := GetBlock(db, hash, number); have == nil || have.Hash() != hash {
+			t.Errorf("block #%d: block not retrieved", number)
+		}
+		if td := GetTd(db, hash, number); td == nil {
+			t.Errorf("block #%d: total difficulty not retrieved", number)
+		}
+		if receipts := GetBlockReceipts(db, hash, number); receipts == nil {
+			t.Errorf("block #%d: receipts not retrieved", number)
+		}
+		if frozen, _ := kvdb.Has(headerKey(hash, number)); frozen != (number > 5) {
+			t.Errorf("block #%d: in key-value store %v, want %v", number, frozen, number > 5)
+		}
+	}
+	for _, block := range side {
+		if header := GetHeader(db, block.Hash(), block.NumberU64()); header != nil {
+			t.Errorf("side block #%d: not deleted", block.Number())
+		}
+	}
+	// Nothing more to freeze below the limit
+	if frozen, err := freezeBlocks(db, store, 5); err != nil || frozen != 0 {
+		t.Fatalf("refroze blocks: frozen %d, err %v", frozen, err)
+	}
+	// The frozen blocks survive a restart, and go away on a rewind
+	db.Close()
+	if db, err = bgmdb.NewDatabaseWithFreezer(kvdb, dir, false); err != nil {
+		t.Fatalf("failed to reopen ancient store: %v", err)
+	}
+	store = db.(bgmdb.AncientStore)
+	if header := GetHeader(db, blocks[3].Hash(), 3); header == nil || header.Hash() != blocks[3].Hash() {
+		t.Fatalf("frozen header not retrieved after restart")
+	}
+	if err := store.TruncateAncients(3); err != nil {
+		t.Fatalf("failed to truncate ancient store: %v", err)
+	}
+	if hash := GetCanonicalHash(db, 3); hash != (common.Hash{}) {
+		t.Errorf("truncated block still canonical: %x", hash)
+	}
+	if GetHeader(db, blocks[2].Hash(), 2) == nil {
+		t.Errorf("block below the truncation point dropped")
+	}
+}
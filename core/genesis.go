@@ -153,6 +153,11 @@ func SetupGenesisBlock(db bgmdb.Database, genesis *Genesis) (*params.ChainConfig
 	if genesis != nil && genesis.Config == nil {
 		return params.DposChainConfig, common.Hash{}, errGenesisNoConfig
 	}
+	if genesis != nil {
+		if err := genesis.Config.Dpos.Validate(); err != nil {
+			return genesis.Config, common.Hash{}, err
+		}
+	}
 
 //
 	stored := GetCanonicalHash(db, 0)
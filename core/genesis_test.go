@@ -72,7 +72,7 @@ func TestSetupGenesis(t *testing.T) {
 //
 //
 				genesis := oldcustomg.MustCommit(db)
-				bc, _ := NewBlockChain(db, oldcustomg.Config, bgmash.NewFullFaker(), vm.Config{})
+				bc, _ := NewBlockChain(db, nil, oldcustomg.Config, bgmash.NewFullFaker(), vm.Config{})
 				defer bc.Stop()
 				bc.SetValidator(bproc{})
 				bc.InsertChain(makeBlockChainWithDiff(genesis, []int{2, 3, 4, 5}, 0))
@@ -113,3 +113,29 @@ func TestSetupGenesis(t *testing.T) {
 		}
 	}
 }
+
+func TestSetupGenesisInvalidDpos(t *testing.T) {
+	invalid := &params.DposConfig{BlockInterval: 3, EpochInterval: 10}
+
+	// A genesis with an invalid dpos config is refused before anything is written
+	db, _ := bgmdb.NewMemDatabase()
+	genesis := &Genesis{Config: &params.ChainConfig{Dpos: invalid}}
+	if _, _, err := SetupGenesisBlock(db, genesis); err == nil {
+		t.Fatal("invalid genesis dpos config accepted")
+	}
+	if stored := GetCanonicalHash(db, 0); stored != (common.Hash{}) {
+		t.Fatalf("genesis written despite the invalid config: %x", stored)
+	}
+
+	// So is an invalid config found in the database
+	block := (&Genesis{Config: &params.ChainConfig{}}).MustCommit(db)
+	if err := WriteChainConfig(db, block.Hash(), &params.ChainConfig{Dpos: invalid}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetChainConfig(db, block.Hash()); err == nil {
+		t.Fatal("invalid stored dpos config accepted")
+	}
+	if _, _, err := SetupGenesisBlock(db, nil); err == nil {
+		t.Fatal("invalid stored dpos config accepted on startup")
+	}
+}
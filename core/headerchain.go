@@ -139,6 +139,9 @@ func (hc *HeaderChain) WriteHeader(header *types.Header) (status WriteStatus, er
 	if ptd == nil {
 		return NonStatTy, consensus.ErrUnknownAncestor
 	}
+	if err := hc.checkConfirmed(header); err != nil {
+		return NonStatTy, err
+	}
 	localTd := hc.GetTd(hc.currentHeaderHash, hc.currentHeader.Number.Uint64())
 	externTd := new(big.Int).Add(header.Difficulty, ptd)
 
@@ -152,7 +155,11 @@ func (hc *HeaderChain) WriteHeader(header *types.Header) (status WriteStatus, er
 //
 //
 //
-	if externTd.Cmp(localTd) > 0 || (externTd.Cmp(localTd) == 0 && mrand.Float64() < 0.5) {
+	reorg := externTd.Cmp(localTd) > 0 || (externTd.Cmp(localTd) == 0 && mrand.Float64() < 0.5)
+	if choice := hc.forkChoice(hc.currentHeader, header); choice != 0 {
+		reorg = choice > 0
+	}
+	if reorg {
 //
 		for i := number + 1; ; i++ {
 			hash := GetCanonicalHash(hc.chainDb, i)
@@ -366,8 +373,10 @@ func (hc *HeaderChain) HasHeader(hash common.Hash, number uint64) bool {
 	if hc.numberCache.Contains(hash) || hc.headerCache.Contains(hash) {
 		return true
 	}
-	ok, _ := hc.chainDb.Has(headerKey(hash, number))
-	return ok
+	if ok, _ := hc.chainDb.Has(headerKey(hash, number)); ok {
+		return true
+	}
+	return hasAncient(hc.chainDb, hash, number)
 }
 
 //
@@ -421,6 +430,12 @@ func (hc *HeaderChain) SetHead(head uint64, delFn DeleteCallback) {
 	for i := height; i > head; i-- {
 		DeleteCanonicalHash(hc.chainDb, i)
 	}
+	// Rewinding below the ancient store drops the frozen blocks too
+	if store, ok := hc.chainDb.(bgmdb.AncientStore); ok && store.Ancients() > head+1 {
+		if err := store.TruncateAncients(head + 1); err != nil {
+			log.Crit("Failed to truncate ancient store", "head", head, "err", err)
+		}
+	}
 //
 	hc.headerCache.Purge()
 	hc.tdCache.Purge()
@@ -452,3 +467,60 @@ func (hc *HeaderChain) Engine() consensus.Engine { return hc.engine }
 func (hc *HeaderChain) GetBlock(hash common.Hash, number uint64) *types.Block {
 	return nil
 }
+
+// confirmer is implemented by consensus engines tracking an irreversible block.
+type confirmer interface {
+	ConfirmedHeader(chain consensus.ChainReader) (*types.Header, error)
+}
+
+// ConfirmedHeader retrieves the irreversible block of the chain, or nil if the
+// consensus engine doesn't finalize blocks or nothing was confirmed yet.
+func (hc *HeaderChain) ConfirmedHeader() *types.Header {
+	engine, ok := hc.engine.(confirmer)
+	if !ok {
+		return nil
+	}
+	header, err := engine.ConfirmedHeader(hc)
+	if err != nil {
+		return nil
+	}
+	return header
+}
+
+// forkChoice compares the chain ending at header with the canonical one ending
+// at current by the fork choice rule of the consensus engine. Zero is returned
+// if the engine has no such rule or it can't tell the chains apart, leaving the
+// choice to total difficulty.
+func (hc *HeaderChain) forkChoice(current, header *types.Header) int {
+	engine, ok := hc.engine.(consensus.ForkChoice)
+	if !ok {
+		return 0
+	}
+	choice, err := engine.CompareChains(hc, current, header)
+	if err != nil {
+		log.Warn("Fork choice failed, falling back to total difficulty", "number", header.Number, "hash", header.Hash(), "err", err)
+		return 0
+	}
+	return choice
+}
+
+// checkConfirmed returns ErrConfirmedConflict if the chain of the header forks
+// off the canonical one below the confirmed block. Headers extending the
+// canonical chain are accepted without walking their ancestry.
+func (hc *HeaderChain) checkConfirmed(header *types.Header) error {
+	confirmed := hc.ConfirmedHeader()
+	if confirmed == nil {
+		return nil
+	}
+	limit := confirmed.Number.Uint64()
+	for GetCanonicalHash(hc.chainDb, header.Number.Uint64()) != header.Hash() {
+		if header.Number.Uint64() <= limit {
+			confirmedConflictMeter.Mark(1)
+			return ErrConfirmedConflict
+		}
+		if header = hc.GetHeader(header.ParentHash, header.Number.Uint64()-1); header == nil {
+			return nil
+		}
+	}
+	return nil
+}
@@ -58,6 +58,7 @@ type Trie interface {
 	TryUpdate(key, value []byte) error
 	TryDelete(key []byte) error
 	CommitTo(trie.DatabaseWriter) (common.Hash, error)
+	CommitToWithCallback(trie.DatabaseWriter, trie.LeafCallback) (common.Hash, error)
 	Hash() common.Hash
 	NodeIterator(startKey []byte) trie.NodeIterator
 	GetKey([]byte) []byte // TODO(fjl): remove this when SecureTrie is removed
@@ -146,7 +147,11 @@ type cachedTrie struct {
 }
 
 func (m cachedTrie) CommitTo(dbw trie.DatabaseWriter) (common.Hash, error) {
-	root, err := m.SecureTrie.CommitTo(dbw)
+	return m.CommitToWithCallback(dbw, nil)
+}
+
+func (m cachedTrie) CommitToWithCallback(dbw trie.DatabaseWriter, onleaf trie.LeafCallback) (common.Hash, error) {
+	root, err := m.SecureTrie.CommitToWithCallback(dbw, onleaf)
 	if err == nil {
 		m.db.pushTrie(m.SecureTrie)
 	}
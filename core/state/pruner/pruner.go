@@ -0,0 +1,316 @@
+// Copyright 2017 The bgmchain Authors
+// This file is part of the bgmchain library.
+//
+// The bgmchain library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The bgmchain library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the bgmchain library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package pruner implements an offline mark and sweep pruner deleting the trie
+// nodes of the states and DPoS contexts no longer needed from a chain database.
+package pruner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/5sWind/bgmchain/bgmdb"
+	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/core"
+	"github.com/5sWind/bgmchain/core/state"
+	"github.com/5sWind/bgmchain/core/types"
+	"github.com/5sWind/bgmchain/crypto"
+	"github.com/5sWind/bgmchain/log"
+	"github.com/5sWind/bgmchain/rlp"
+	"github.com/5sWind/bgmchain/trie"
+)
+
+var (
+	// progressKey tracks the sweep of an interrupted prune, so it can be resumed.
+	progressKey = []byte("prune-state-progress")
+
+	emptyCodeHash = crypto.Keccak256(nil)
+
+	errNoHead = errors.New("chain database has no head block")
+)
+
+// progress is the marker of a prune in progress. The retained blocks are
+// recorded along with the last swept key, as the states of any other block may
+// already be partially deleted.
+type progress struct {
+	Head common.Hash // Head block the retained blocks were counted from
+	Keep uint64      // Number of retained blocks
+	Key  []byte      // Last key swept
+}
+
+// Stats reports the outcome of a prune.
+type Stats struct {
+	Retained int                // Number of states retained
+	Marked   int                // Number of trie nodes and contract codes reachable from them
+	Deleted  int                // Number of entries deleted, or deletable on a dry run
+	Size     common.StorageSize // Storage size of the deleted entries
+}
+
+// Pruner deletes every trie node and contract code of a chain database not
+// reachable from the state or the DPoS context of the retained blocks: the head
+// block, the blocks preceding it up to the configured count and the genesis.
+//
+// Pruning requires exclusive access to the database, the node must not run.
+type Pruner struct {
+	db   bgmdb.Database
+	keep uint64
+
+	marked map[common.Hash]struct{}
+}
+
+// New creates a pruner retaining the states of the last keep blocks of the
+// chain, which is at least the head block.
+func New(db bgmdb.Database, keep uint64) *Pruner {
+	if keep == 0 {
+		keep = 1
+	}
+	return &Pruner{db: db, keep: keep}
+}
+
+// Prune marks the nodes reachable from the retained states and deletes all the
+// others. On a dry run nothing is deleted, only the reclaimable entries are
+// counted.
+//
+// An interrupted prune leaves a progress marker in the database. The next one
+// resumes the sweep from it, retaining the blocks of the interrupted prune
+// whatever the current head or count are.
+func (p *Pruner) Prune(dryRun bool) (*Stats, error) {
+	marker, err := p.readProgress()
+	if err != nil {
+		return nil, err
+	}
+	if marker != nil {
+		log.Info("Resuming interrupted state prune", "head", marker.Head, "keep", marker.Keep, "key", common.ToHex(marker.Key))
+	} else {
+		head := core.GetHeadBlockHash(p.db)
+		if head == (common.Hash{}) {
+			return nil, errNoHead
+		}
+		marker = &progress{Head: head, Keep: p.keep}
+	}
+	headers, err := p.retained(marker.Head, marker.Keep)
+	if err != nil {
+		return nil, err
+	}
+	stats := &Stats{}
+	if err := p.mark(headers, stats); err != nil {
+		return nil, err
+	}
+	if err := p.sweep(marker, dryRun, stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// retained returns the headers of the blocks whose state is kept: head and its
+// keep-1 ancestors, followed by the genesis.
+func (p *Pruner) retained(head common.Hash, keep uint64) ([]*types.Header, error) {
+	header := core.GetHeader(p.db, head, core.GetBlockNumber(p.db, head))
+	if header == nil {
+		return nil, fmt.Errorf("head block %x not found", head)
+	}
+	var headers []*types.Header
+	for i := uint64(0); i < keep; i++ {
+		headers = append(headers, header)
+
+		number := header.Number.Uint64()
+		if number == 0 {
+			return headers, nil
+		}
+		if header = core.GetHeader(p.db, header.ParentHash, number-1); header == nil {
+			return nil, fmt.Errorf("block #%d [%x…] not found", number-1, headers[len(headers)-1].ParentHash.Bytes()[:4])
+		}
+	}
+	genesis := core.GetHeader(p.db, core.GetCanonicalHash(p.db, 0), 0)
+	if genesis == nil {
+		return nil, errors.New("chain database has no genesis block")
+	}
+	return append(headers, genesis), nil
+}
+
+// mark collects the hashes of every node of the state and DPoS context tries of
+// the given blocks, along with the storage tries and code of the accounts. The
+// state of the first one, the head, must be complete, while the others are
+// skipped if missing, as a garbage collected chain only has some of them.
+func (p *Pruner) mark(headers []*types.Header, stats *Stats) error {
+	p.marked = make(map[common.Hash]struct{})
+
+	start := time.Now()
+	for i, header := range headers {
+		roots := []common.Hash{header.Root}
+		if header.DposContext != nil {
+			for t := types.DposEpochTrie; t.Valid(); t++ {
+				roots = append(roots, header.DposContext.TrieRoot(t))
+			}
+		}
+		if !p.complete(roots) {
+			if i == 0 {
+				return fmt.Errorf("state of head block #%d [%x…] is missing", header.Number, header.Hash().Bytes()[:4])
+			}
+			log.Debug("Skipping block without state", "number", header.Number, "hash", header.Hash())
+			continue
+		}
+		if err := p.markTrie(header.Root, p.markAccount); err != nil {
+			return err
+		}
+		for _, root := range roots[1:] {
+			if err := p.markTrie(root, nil); err != nil {
+				return err
+			}
+		}
+		stats.Retained++
+	}
+	stats.Marked = len(p.marked)
+
+	log.Info("Marked retained state", "blocks", stats.Retained, "nodes", stats.Marked, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// complete reports whether the root nodes of all the given tries are present.
+// Nodes are persisted children first, so those tries are complete.
+func (p *Pruner) complete(roots []common.Hash) bool {
+	for _, root := range roots {
+		if root == (common.Hash{}) || root == types.EmptyRootHash {
+			continue
+		}
+		if ok, _ := p.db.Has(root[:]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// markTrie marks the nodes of the trie at root, calling onleaf for all of its
+// leaves. Subtries already marked are skipped along with their leaves.
+func (p *Pruner) markTrie(root common.Hash, onleaf func(leaf []byte) error) error {
+	if _, ok := p.marked[root]; ok {
+		return nil
+	}
+	tr, err := trie.New(root, p.db)
+	if err != nil {
+		return err
+	}
+	it := tr.NodeIterator(nil)
+	for descend := true; it.Next(descend); {
+		descend = true
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			if _, ok := p.marked[hash]; ok {
+				descend = false
+				continue
+			}
+			p.marked[hash] = struct{}{}
+		}
+		if it.Leaf() && onleaf != nil {
+			if err := onleaf(it.LeafBlob()); err != nil {
+				return err
+			}
+		}
+	}
+	return it.Error()
+}
+
+// markAccount marks the storage trie and the code of an account.
+func (p *Pruner) markAccount(leaf []byte) error {
+	var account state.Account
+	if err := rlp.DecodeBytes(leaf, &account); err != nil {
+		return err
+	}
+	if !bytes.Equal(account.CodeHash, emptyCodeHash) {
+		p.marked[common.BytesToHash(account.CodeHash)] = struct{}{}
+	}
+	return p.markTrie(account.Root, nil)
+}
+
+// sweep deletes every trie node and contract code not marked, saving its
+// progress along with each batch of deletions.
+func (p *Pruner) sweep(marker *progress, dryRun bool, stats *Stats) error {
+	var (
+		batch = p.db.NewBatch()
+		start = time.Now()
+		it    = p.db.NewIteratorWithRange(marker.Key, nil)
+	)
+	defer it.Release()
+
+	for it.Next() {
+		key := it.Key()
+		if len(key) != common.HashLength {
+			continue
+		}
+		if _, ok := p.marked[common.BytesToHash(key)]; ok {
+			continue
+		}
+		stats.Deleted++
+		stats.Size += common.StorageSize(len(key) + len(it.Value()))
+		if dryRun {
+			continue
+		}
+		if err := batch.Delete(key); err != nil {
+			return err
+		}
+		if batch.ValueSize() < bgmdb.IdealBatchSize {
+			continue
+		}
+		marker.Key = common.CopyBytes(key)
+		if err := p.writeBatch(batch, marker); err != nil {
+			return err
+		}
+		batch.Reset()
+
+		log.Info("Pruning state", "deleted", stats.Deleted, "size", stats.Size, "key", common.ToHex(marker.Key), "elapsed", common.PrettyDuration(time.Since(start)))
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+	// Sweep done, drop the marker with the last deletions
+	if err := batch.Delete(progressKey); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Info("Pruned state", "deleted", stats.Deleted, "size", stats.Size, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// writeBatch writes a batch of deletions along with the progress marker.
+func (p *Pruner) writeBatch(batch bgmdb.Batch, marker *progress) error {
+	enc, err := rlp.EncodeToBytes(marker)
+	if err != nil {
+		return err
+	}
+	if err := batch.Put(progressKey, enc); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// readProgress returns the marker of an interrupted prune, if any.
+func (p *Pruner) readProgress() (*progress, error) {
+	enc, err := p.db.Get(progressKey)
+	if err != nil {
+		return nil, nil
+	}
+	marker := new(progress)
+	if err := rlp.DecodeBytes(enc, marker); err != nil {
+		return nil, fmt.Errorf("invalid prune progress marker: %v", err)
+	}
+	return marker, nil
+}
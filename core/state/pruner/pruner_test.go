@@ -0,0 +1,169 @@
+// Copyright 2017 The bgmchain Authors
+// This file is part of the bgmchain library.
+//
+// The bgmchain library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The bgmchain library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the bgmchain library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/5sWind/bgmchain/bgmdb"
+	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/core"
+	"github.com/5sWind/bgmchain/core/state"
+	"github.com/5sWind/bgmchain/core/types"
+	"github.com/5sWind/bgmchain/rlp"
+)
+
+var (
+	contract = common.HexToAddress("0x01")
+	code     = []byte{0x60, 0x00, 0x60, 0x00, 0xf3}
+)
+
+// testChain writes a chain of blocks into db, each adding an account and
+// changing the storage of a contract, and returns their headers.
+func testChain(t *testing.T, db bgmdb.Database, blocks int) []*types.Header {
+	var (
+		headers []*types.Header
+		root    common.Hash
+	)
+	dposContext, err := types.NewDposContext(db)
+	if err != nil {
+		t.Fatalf("failed to create dpos context: %v", err)
+	}
+	for i := 0; i < blocks; i++ {
+		statedb, _ := state.New(root, state.NewDatabase(db))
+		statedb.SetCode(contract, code)
+		statedb.SetState(contract, common.BigToHash(big.NewInt(int64(i))), common.BigToHash(big.NewInt(int64(i+1))))
+		statedb.AddBalance(common.BigToAddress(big.NewInt(int64(100+i))), big.NewInt(int64(i+1)))
+		if root, err = statedb.CommitTo(db, false); err != nil {
+			t.Fatalf("failed to commit state: %v", err)
+		}
+		dposContext.BecomeCandidate(common.BigToAddress(big.NewInt(int64(200 + i))))
+		proto, err := dposContext.CommitTo(db)
+		if err != nil {
+			t.Fatalf("failed to commit dpos context: %v", err)
+		}
+		header := &types.Header{Number: big.NewInt(int64(i)), Root: root, DposContext: proto, Difficulty: common.Big1}
+		if i > 0 {
+			header.ParentHash = headers[i-1].Hash()
+		}
+		core.WriteHeader(db, header)
+		core.WriteCanonicalHash(db, header.Hash(), header.Number.Uint64())
+		headers = append(headers, header)
+	}
+	core.WriteHeadBlockHash(db, headers[len(headers)-1].Hash())
+	return headers
+}
+
+// checkState verifies that the full state and dpos context of a block can be
+// read from the database.
+func checkState(t *testing.T, db bgmdb.Database, header *types.Header) {
+	statedb, err := state.New(header.Root, state.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("block #%d: failed to open state: %v", header.Number, err)
+	}
+	it := state.NewNodeIterator(statedb)
+	for it.Next() {
+	}
+	if it.Error != nil {
+		t.Fatalf("block #%d: incomplete state: %v", header.Number, it.Error)
+	}
+	if !bytes.Equal(statedb.GetCode(contract), code) {
+		t.Fatalf("block #%d: contract code missing", header.Number)
+	}
+	dposContext, err := types.NewDposContextFromProto(db, header.DposContext)
+	if err != nil {
+		t.Fatalf("block #%d: failed to open dpos context: %v", header.Number, err)
+	}
+	if _, err := dposContext.GetCandidates(); err != nil {
+		t.Fatalf("block #%d: incomplete dpos context: %v", header.Number, err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	db, _ := bgmdb.NewMemDatabase()
+
+	headers := testChain(t, db, 5)
+
+	// A dry run reports the stale nodes without deleting them
+	stats, err := New(db, 2).Prune(true)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if stats.Retained != 3 || stats.Deleted == 0 || stats.Size == 0 {
+		t.Fatalf("unexpected dry run stats: %+v", stats)
+	}
+	for _, header := range headers {
+		checkState(t, db, header)
+	}
+	// The actual prune deletes them, keeping the recent blocks and the genesis
+	pruned, err := New(db, 2).Prune(false)
+	if err != nil {
+		t.Fatalf("prune failed: %v", err)
+	}
+	if pruned.Deleted != stats.Deleted || pruned.Size != stats.Size {
+		t.Errorf("prune stats mismatch: have %+v, dry run %+v", pruned, stats)
+	}
+	for _, header := range []*types.Header{headers[0], headers[3], headers[4]} {
+		checkState(t, db, header)
+	}
+	for _, header := range headers[1:3] {
+		if ok, _ := db.Has(header.Root[:]); ok {
+			t.Errorf("block #%d: state root not pruned", header.Number)
+		}
+	}
+	if ok, _ := db.Has(progressKey); ok {
+		t.Errorf("progress marker left after prune")
+	}
+}
+
+func TestPruneResume(t *testing.T) {
+	db, _ := bgmdb.NewMemDatabase()
+
+	headers := testChain(t, db, 5)
+
+	// Leave the marker of an interrupted prune retaining more blocks
+	enc, _ := rlp.EncodeToBytes(&progress{Head: headers[4].Hash(), Keep: 4, Key: []byte{0x80}})
+	db.Put(progressKey, enc)
+
+	stats, err := New(db, 1).Prune(false)
+	if err != nil {
+		t.Fatalf("prune failed: %v", err)
+	}
+	if stats.Retained != 5 {
+		t.Errorf("retained states mismatch: have %d, want 5", stats.Retained)
+	}
+	for _, header := range headers {
+		checkState(t, db, header)
+	}
+	if ok, _ := db.Has(progressKey); ok {
+		t.Errorf("progress marker left after prune")
+	}
+}
+
+func TestPruneMissingHeadState(t *testing.T) {
+	db, _ := bgmdb.NewMemDatabase()
+
+	headers := testChain(t, db, 3)
+	db.Delete(headers[2].Root[:])
+
+	if _, err := New(db, 1).Prune(false); err == nil {
+		t.Fatalf("prune succeeded without head state")
+	}
+	checkState(t, db, headers[1])
+}
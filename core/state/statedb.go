@@ -600,8 +600,21 @@ func (s *StateDB) CommitTo(dbw trie.DatabaseWriter, deleteEmptyObjects bool) (ro
 		}
 		delete(s.stateObjectsDirty, addr)
 	}
-	// Write trie changes.
-	root, err = s.trie.CommitTo(dbw)
+	// Write trie changes. If the nodes are reference counted, the leaves of the
+	// account trie keep the storage tries and code of the accounts alive.
+	var onleaf trie.LeafCallback
+	if triedb, ok := dbw.(*trie.NodeDatabase); ok {
+		onleaf = func(leaf []byte, parent common.Hash) error {
+			var account Account
+			if err := rlp.DecodeBytes(leaf, &account); err != nil {
+				return nil
+			}
+			triedb.Reference(account.Root, parent)
+			triedb.Reference(common.BytesToHash(account.CodeHash), parent)
+			return nil
+		}
+	}
+	root, err = s.trie.CommitToWithCallback(dbw, onleaf)
 	log.Debug("Trie cache stats after commit", "misses", trie.CacheMisses(), "unloads", trie.CacheUnloads())
 	return root, err
 }
@@ -21,11 +21,13 @@ import (
 
 	"github.com/5sWind/bgmchain/common"
 	"github.com/5sWind/bgmchain/consensus"
+	"github.com/5sWind/bgmchain/consensus/dpos"
 	"github.com/5sWind/bgmchain/consensus/misc"
 	"github.com/5sWind/bgmchain/core/state"
 	"github.com/5sWind/bgmchain/core/types"
 	"github.com/5sWind/bgmchain/core/vm"
 	"github.com/5sWind/bgmchain/crypto"
+	"github.com/5sWind/bgmchain/log"
 	"github.com/5sWind/bgmchain/params"
 )
 
@@ -94,22 +96,36 @@ func ApplyTransaction(config *params.ChainConfig, dposContext *types.DposContext
 		return nil, nil, err
 	}
 
-	if msg.To() == nil && msg.Type() != types.Binary {
+	candidacy := msg.Type() == types.LoginCandidate || msg.Type() == types.LogoutCandidate
+	if msg.To() == nil && msg.Type() != types.Binary && !candidacy {
 		return nil, nil, types.ErrInvalidType
 	}
 
+	// Once stake locking is on, the value of a delegation or candidate
+	// registration is locked as stake or deposit instead of being sent to the
+	// recipient
+	evmMsg := msg
+	if (msg.Type() == types.Delegate || msg.Type() == types.LoginCandidate) && config.Dpos.At(header.Number).Staking {
+		evmMsg = msg.WithValue(new(big.Int))
+	}
+	// Candidacy transactions have no recipient, run them as a plain call to the
+	// sender so they aren't mistaken for contract creations
+	if msg.To() == nil && candidacy {
+		from := msg.From()
+		evmMsg = evmMsg.WithTo(&from)
+	}
 //
-	context := NewEVMContext(msg, header, bc, author)
+	context := NewEVMContext(evmMsg, header, bc, author)
 //
 //
 	vmenv := vm.NewEVM(context, statedb, config, cfg)
 //
-	_, gas, failed, err := ApplyMessage(vmenv, msg, gp)
+	_, gas, failed, err := ApplyMessage(vmenv, evmMsg, gp)
 	if err != nil {
 		return nil, nil, err
 	}
 	if msg.Type() != types.Binary {
-		if err = applyDposMessage(dposContext, msg); err != nil {
+		if err = applyDposMessage(config, dposContext, statedb, header, msg); err != nil {
 			return nil, nil, err
 		}
 	}
@@ -129,7 +145,7 @@ func ApplyTransaction(config *params.ChainConfig, dposContext *types.DposContext
 	receipt.TxHash = tx.Hash()
 	receipt.GasUsed = new(big.Int).Set(gas)
 //
-	if msg.To() == nil {
+	if evmMsg.To() == nil {
 		receipt.ContractAddress = crypto.CreateAddress(vmenv.Context.Origin, tx.Nonce())
 	}
 
@@ -140,18 +156,208 @@ func ApplyTransaction(config *params.ChainConfig, dposContext *types.DposContext
 	return receipt, gas, err
 }
 
-func applyDposMessage(dposContext *types.DposContext, msg types.Message) error {
+func applyDposMessage(config *params.ChainConfig, dposContext *types.DposContext, statedb *state.StateDB, header *types.Header, msg types.Message) error {
 	switch msg.Type() {
 	case types.LoginCandidate:
-		dposContext.BecomeCandidate(msg.From())
+		return applyLoginCandidate(config, dposContext, statedb, header, msg)
 	case types.LogoutCandidate:
-		dposContext.KickoutCandidate(msg.From())
+		return applyLogoutCandidate(config, dposContext, header, msg)
 	case types.Delegate:
-		dposContext.Delegate(msg.From(), *(msg.To()))
+		return applyDelegate(config, dposContext, statedb, header, msg)
 	case types.UnDelegate:
-		dposContext.UnDelegate(msg.From(), *(msg.To()))
+		return applyUnDelegate(config, dposContext, header, msg)
+	case types.ReportDoubleSign:
+		return applyDoubleSignReport(config, dposContext, statedb, header, msg)
+	case types.BindSigner:
+		return applyBindSigner(dposContext, msg)
 	default:
 		return types.ErrInvalidType
 	}
-	return nil
+}
+
+// applyLoginCandidate registers the sender as a candidate, adding the value of
+// the message to its deposit and recording its commission and metadata. A
+// registration leaving the deposit below the minimum is refused and the value
+// stays with the sender. The deposit is kept in the stake trie and the
+// commission and metadata in the reward trie, so no deposit is taken before
+// stake locking is on and the commission and metadata are ignored before
+// reward sharing is.
+func applyLoginCandidate(config *params.ChainConfig, dposContext *types.DposContext, statedb *state.StateDB, header *types.Header, msg types.Message) error {
+	var (
+		commission *uint64
+		meta       *types.CandidateMeta
+	)
+	if len(msg.Data()) > 0 {
+		payload, err := types.DecodeCandidatePayload(msg.Data())
+		if err != nil {
+			return err
+		}
+		commission = &payload.Commission
+		if len(payload.Meta) > 0 {
+			meta = payload.Meta[0]
+		}
+	}
+	rules := config.Dpos.At(header.Number)
+	if rules.Staking {
+		if statedb.GetBalance(msg.From()).Cmp(msg.Value()) < 0 {
+			return ErrInsufficientFunds
+		}
+		deposit, err := dposContext.GetDeposit(msg.From())
+		if err != nil {
+			return err
+		}
+		deposit.Add(deposit, msg.Value())
+		if required := rules.CandidateDeposit; required != nil && deposit.Cmp(required) < 0 {
+			log.Debug("Dpos candidate registration refused", "candidate", msg.From(), "deposit", deposit, "required", required)
+			return nil
+		}
+		statedb.SubBalance(msg.From(), msg.Value())
+		if err := dposContext.AddDeposit(msg.From(), msg.Value()); err != nil {
+			return err
+		}
+	}
+	if err := dposContext.BecomeCandidate(msg.From()); err != nil {
+		return err
+	}
+	if !rules.Rewards {
+		return nil
+	}
+	if err := dposContext.SetCommission(msg.From(), commission); err != nil {
+		return err
+	}
+	return dposContext.SetCandidateMeta(msg.From(), meta)
+}
+
+// applyLogoutCandidate removes the sender from the candidates and starts the
+// cooldown of its deposit. Candidates which were kicked out meanwhile get their
+// deposit back the same way.
+func applyLogoutCandidate(config *params.ChainConfig, dposContext *types.DposContext, header *types.Header, msg types.Message) error {
+	dposContext.KickoutCandidate(msg.From())
+
+	rules := config.Dpos.At(header.Number)
+	epoch := header.Time.Int64() / rules.EpochInterval
+	release := uint64((epoch + rules.CandidateCooldownEpochs) * rules.EpochInterval)
+	_, err := dposContext.UnbondDeposit(msg.From(), release)
+	return err
+}
+
+// applyBindSigner binds the sending candidate to the key it seals its blocks
+// with from the next epoch on, so the key holding its funds can stay offline.
+// Bindings from senders which aren't candidates are refused.
+func applyBindSigner(dposContext *types.DposContext, msg types.Message) error {
+	candidate, err := dposContext.CandidateTrie().TryGet(msg.From().Bytes())
+	if err != nil {
+		return err
+	}
+	if candidate == nil {
+		log.Debug("Dpos signer binding refused", "candidate", msg.From(), "signer", msg.To(), "err", "not a candidate")
+		return nil
+	}
+	return dposContext.BindSigner(msg.From(), *(msg.To()))
+}
+
+// applyDelegate votes for a candidate and, once stake locking is on, locks the
+// value of the message as stake behind the vote. A refused vote leaves the value
+// with the delegator.
+func applyDelegate(config *params.ChainConfig, dposContext *types.DposContext, statedb *state.StateDB, header *types.Header, msg types.Message) error {
+	staking := config.Dpos.At(header.Number).Staking
+	if staking && statedb.GetBalance(msg.From()).Cmp(msg.Value()) < 0 {
+		return ErrInsufficientFunds
+	}
+	if err := dposContext.Delegate(msg.From(), *(msg.To())); err != nil {
+		log.Debug("Dpos delegation refused", "delegator", msg.From(), "candidate", msg.To(), "err", err)
+		return nil
+	}
+	if !staking {
+		return nil
+	}
+	statedb.SubBalance(msg.From(), msg.Value())
+	return dposContext.LockStake(msg.From(), msg.Value())
+}
+
+// applyUnDelegate withdraws a vote and starts the unbonding period of the stake
+// behind it. Stake is unbonded whenever the delegator is left without a vote,
+// which also lets delegators of kicked out candidates get their stake back.
+func applyUnDelegate(config *params.ChainConfig, dposContext *types.DposContext, header *types.Header, msg types.Message) error {
+	if err := dposContext.UnDelegate(msg.From(), *(msg.To())); err != nil {
+		log.Debug("Dpos undelegation refused", "delegator", msg.From(), "candidate", msg.To(), "err", err)
+	}
+	vote, err := dposContext.VoteTrie().TryGet(msg.From().Bytes())
+	if err != nil {
+		return err
+	}
+	if vote != nil {
+		return nil
+	}
+	rules := config.Dpos.At(header.Number)
+	epoch := header.Time.Int64() / rules.EpochInterval
+	release := uint64((epoch + rules.UnbondingEpochs) * rules.EpochInterval)
+	_, err = dposContext.UnbondStake(msg.From(), release)
+	return err
+}
+
+// applyDoubleSignReport slashes a validator that sealed two different headers
+// for the same slot: it is removed from the candidates and loses a share of its
+// deposit and bonded stake, or of its balance before stake locking is on. Part
+// of the penalty is paid to the reporter while the rest is burnt. A report with
+// invalid evidence, or for a slot the validator was already slashed for, is
+// refused and only costs the reporter its gas.
+func applyDoubleSignReport(config *params.ChainConfig, dposContext *types.DposContext, statedb *state.StateDB, header *types.Header, msg types.Message) error {
+	evidence, err := types.DecodeDoubleSignEvidence(msg.Data())
+	if err != nil {
+		log.Debug("Dpos double sign report refused", "reporter", msg.From(), "offender", msg.To(), "err", err)
+		return nil
+	}
+	offender, signer, slot, err := dpos.VerifyDoubleSign(config.Dpos, evidence)
+	if err == nil && offender != *msg.To() {
+		err = types.ErrInvalidEvidence
+	}
+	if err != nil {
+		log.Debug("Dpos double sign report refused", "reporter", msg.From(), "offender", msg.To(), "err", err)
+		return nil
+	}
+	// Besides its own key, only the signing keys the offender is bound to now
+	// count: a key it rotated away from may since have leaked.
+	if signer != offender {
+		epochSigner, err := dposContext.GetEpochSigner(offender)
+		if err != nil {
+			return err
+		}
+		boundSigner, err := dposContext.GetBoundSigner(offender)
+		if err != nil {
+			return err
+		}
+		if signer != epochSigner && signer != boundSigner {
+			log.Debug("Dpos double sign report refused", "reporter", msg.From(), "offender", offender, "err", dpos.ErrMismatchSignerAndValidator)
+			return nil
+		}
+	}
+	slashed, err := dposContext.IsSlashed(offender, slot)
+	if err != nil {
+		return err
+	}
+	if slashed {
+		log.Debug("Dpos double sign report refused", "reporter", msg.From(), "offender", offender, "err", ErrAlreadySlashed)
+		return nil
+	}
+	if err := dposContext.KickoutCandidate(offender); err != nil {
+		return err
+	}
+	rules := config.Dpos.At(header.Number)
+	var penalty *big.Int
+	if rules.Staking {
+		if penalty, err = dposContext.SlashStake(offender, rules.SlashPercent); err != nil {
+			return err
+		}
+	} else {
+		penalty = new(big.Int).Mul(statedb.GetBalance(offender), new(big.Int).SetUint64(rules.SlashPercent))
+		penalty.Div(penalty, big.NewInt(100))
+		statedb.SubBalance(offender, penalty)
+	}
+	reward := new(big.Int).Mul(penalty, new(big.Int).SetUint64(rules.SlashReporterPercent))
+	reward.Div(reward, big.NewInt(100))
+
+	statedb.AddBalance(msg.From(), reward)
+	log.Info("Slashed double signing validator", "validator", offender, "slot", slot, "penalty", penalty, "reporter", msg.From(), "reward", reward)
+	return dposContext.MarkSlashed(offender, slot)
 }
@@ -0,0 +1,328 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/consensus/dpos"
+	"github.com/5sWind/bgmchain/core/state"
+	"github.com/5sWind/bgmchain/core/types"
+	"github.com/5sWind/bgmchain/core/vm"
+	"github.com/5sWind/bgmchain/crypto"
+	"github.com/5sWind/bgmchain/bgmdb"
+	"github.com/5sWind/bgmchain/params"
+	"github.com/5sWind/bgmchain/rlp"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests that double signing is slashed from the balance before stake locking
+// is on, and from the deposit and bonded stake after.
+func TestApplyDoubleSignReport(t *testing.T)        { testApplyDoubleSignReport(t, false) }
+func TestApplyDoubleSignReportStaking(t *testing.T) { testApplyDoubleSignReport(t, true) }
+
+func testApplyDoubleSignReport(t *testing.T, staking bool) {
+	var (
+		validatorKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		reporterKey, _  = crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+		validator       = crypto.PubkeyToAddress(validatorKey.PublicKey)
+		reporter        = crypto.PubkeyToAddress(reporterKey.PublicKey)
+		balance         = big.NewInt(1000000)
+		deposit         = big.NewInt(500000)
+		stake           = big.NewInt(200000)
+		db, _           = bgmdb.NewMemDatabase()
+		config          = *params.DposChainConfig
+		signer          = types.NewEIP155Signer(config.ChainId)
+	)
+	config.Dpos = &params.DposConfig{Staking: staking}
+	gspec := &Genesis{
+		Config: &config,
+		Alloc:  GenesisAlloc{validator: {Balance: balance}, reporter: {Balance: big.NewInt(0)}},
+	}
+	genesis := gspec.MustCommit(db)
+
+	// Build two conflicting blocks on top of genesis, both in the same slot
+	sealed := func(coinbase common.Address) *types.Header {
+		blocks, _ := GenerateChain(&config, genesis, db, 1, func(i int, gen *BlockGen) {
+			gen.SetCoinbase(coinbase)
+		})
+		header := blocks[0].Header()
+		header.Validator = validator
+		header.Extra = make([]byte, 32+65)
+		sig, err := crypto.Sign(dpos.SigHash(header).Bytes(), validatorKey)
+		assert.Nil(t, err)
+		copy(header.Extra[32:], sig)
+		return header
+	}
+	first, second := sealed(validator), sealed(reporter)
+	assert.Equal(t, first.Time, second.Time)
+
+	statedb, _ := state.New(genesis.Root(), state.NewDatabase(db))
+	dposContext, _ := types.NewDposContext(db)
+	assert.Nil(t, dposContext.BecomeCandidate(validator))
+	if staking {
+		assert.Nil(t, dposContext.AddDeposit(validator, deposit))
+		assert.Nil(t, dposContext.LockStake(validator, stake))
+	}
+
+	report := func(nonce uint64, evidence *types.DoubleSignEvidence) {
+		payload, err := rlp.EncodeToBytes(evidence)
+		assert.Nil(t, err)
+		tx, err := types.SignTx(types.NewTransaction(types.ReportDoubleSign, nonce, validator, new(big.Int), big.NewInt(100000), new(big.Int), payload), signer, reporterKey)
+		assert.Nil(t, err)
+		_, _, err = ApplyTransaction(&config, dposContext, nil, &reporter, new(GasPool).AddGas(big.NewInt(1000000)), statedb, first, tx, new(big.Int), vm.Config{})
+		assert.Nil(t, err)
+	}
+	isCandidate := func() bool {
+		candidate, err := dposContext.CandidateTrie().TryGet(validator.Bytes())
+		assert.Nil(t, err)
+		return candidate != nil
+	}
+
+	// Evidence made of the same header twice is refused
+	report(0, &types.DoubleSignEvidence{First: first, Second: first})
+	assert.True(t, isCandidate())
+	assert.Equal(t, new(big.Int), statedb.GetBalance(reporter))
+
+	// Genuine evidence removes the validator and slashes it
+	report(1, &types.DoubleSignEvidence{First: first, Second: second})
+	assert.False(t, isCandidate())
+	candidates, err := dposContext.GetCandidates()
+	assert.Nil(t, err)
+	assert.Empty(t, candidates)
+
+	rules := config.Dpos.At(first.Number)
+	slash := func(amount *big.Int) *big.Int {
+		return new(big.Int).Div(new(big.Int).Mul(amount, new(big.Int).SetUint64(rules.SlashPercent)), big.NewInt(100))
+	}
+	var penalty *big.Int
+	if staking {
+		// The deposit and the bonded stake are slashed, the balance is left alone
+		penalty = new(big.Int).Add(slash(deposit), slash(stake))
+		left, err := dposContext.GetDeposit(validator)
+		assert.Nil(t, err)
+		assert.Equal(t, new(big.Int).Sub(deposit, slash(deposit)), left)
+		left, err = dposContext.GetStake(validator)
+		assert.Nil(t, err)
+		assert.Equal(t, new(big.Int).Sub(stake, slash(stake)), left)
+		assert.Equal(t, balance, statedb.GetBalance(validator))
+	} else {
+		// Nothing is locked yet, the balance is slashed and the stake trie unused
+		penalty = slash(balance)
+		assert.Equal(t, new(big.Int).Sub(balance, penalty), statedb.GetBalance(validator))
+		assert.Equal(t, common.Hash{}, dposContext.ToProto().StakeHash)
+	}
+	reward := new(big.Int).Div(new(big.Int).Mul(penalty, new(big.Int).SetUint64(rules.SlashReporterPercent)), big.NewInt(100))
+	assert.Equal(t, reward, statedb.GetBalance(reporter))
+
+	// The same slot can't be slashed twice
+	slashedBalance := statedb.GetBalance(validator)
+	slashedDeposit, err := dposContext.GetDeposit(validator)
+	assert.Nil(t, err)
+	report(2, &types.DoubleSignEvidence{First: second, Second: first})
+	assert.Equal(t, slashedBalance, statedb.GetBalance(validator))
+	left, err := dposContext.GetDeposit(validator)
+	assert.Nil(t, err)
+	assert.Equal(t, slashedDeposit, left)
+	assert.Equal(t, reward, statedb.GetBalance(reporter))
+}
+
+func TestApplyCandidateRegistration(t *testing.T) {
+	var (
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr     = crypto.PubkeyToAddress(key.PublicKey)
+		balance  = big.NewInt(1000000)
+		db, _    = bgmdb.NewMemDatabase()
+		config   = *params.DposChainConfig
+		signer   = types.NewEIP155Signer(config.ChainId)
+		cooldown = int64(2)
+	)
+	config.Dpos = &params.DposConfig{CandidateDeposit: big.NewInt(1000), CandidateCooldownEpochs: &cooldown, Rewards: true, Staking: true}
+	gspec := &Genesis{
+		Config: &config,
+		Alloc:  GenesisAlloc{addr: {Balance: balance}},
+	}
+	genesis := gspec.MustCommit(db)
+	blocks, _ := GenerateChain(&config, genesis, db, 1, func(i int, gen *BlockGen) {})
+	header := blocks[0].Header()
+
+	statedb, _ := state.New(genesis.Root(), state.NewDatabase(db))
+	dposContext, _ := types.NewDposContext(db)
+
+	nonce := uint64(0)
+	apply := func(txType types.TxType, value int64, payload *types.CandidatePayload) {
+		var data []byte
+		if payload != nil {
+			var err error
+			data, err = rlp.EncodeToBytes(payload)
+			assert.Nil(t, err)
+		}
+		tx, err := types.SignTx(types.NewTransaction(txType, nonce, common.Address{}, big.NewInt(value), big.NewInt(100000), new(big.Int), data), signer, key)
+		assert.Nil(t, err)
+		_, _, err = ApplyTransaction(&config, dposContext, nil, &addr, new(GasPool).AddGas(big.NewInt(1000000)), statedb, header, tx, new(big.Int), vm.Config{})
+		assert.Nil(t, err)
+		nonce++
+	}
+	isCandidate := func() bool {
+		candidate, err := dposContext.CandidateTrie().TryGet(addr.Bytes())
+		assert.Nil(t, err)
+		return candidate != nil
+	}
+
+	// Registrations below the minimum deposit are refused and cost nothing
+	apply(types.LoginCandidate, 500, nil)
+	assert.False(t, isCandidate())
+	assert.Equal(t, balance, statedb.GetBalance(addr))
+
+	// A sufficient deposit is locked and the metadata recorded
+	meta := &types.CandidateMeta{Name: "node", Website: "https://example.org"}
+	apply(types.LoginCandidate, 1000, &types.CandidatePayload{Commission: 10, Meta: []*types.CandidateMeta{meta}})
+	assert.True(t, isCandidate())
+	assert.Equal(t, new(big.Int).Sub(balance, big.NewInt(1000)), statedb.GetBalance(addr))
+	deposit, err := dposContext.GetDeposit(addr)
+	assert.Nil(t, err)
+	assert.Equal(t, big.NewInt(1000), deposit)
+	stored, err := dposContext.GetCandidateMeta(addr)
+	assert.Nil(t, err)
+	assert.Equal(t, meta, stored)
+
+	// The locked deposit counts towards registering again with new metadata
+	meta = &types.CandidateMeta{Name: "renamed"}
+	apply(types.LoginCandidate, 0, &types.CandidatePayload{Commission: 10, Meta: []*types.CandidateMeta{meta}})
+	stored, err = dposContext.GetCandidateMeta(addr)
+	assert.Nil(t, err)
+	assert.Equal(t, meta, stored)
+
+	// Logging out returns the deposit once the cooldown is over
+	apply(types.LogoutCandidate, 0, nil)
+	assert.False(t, isCandidate())
+	deposit, err = dposContext.GetDeposit(addr)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), deposit.Int64())
+	unbondings, err := dposContext.GetUnbondings(addr)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(unbondings))
+	assert.Equal(t, big.NewInt(1000), unbondings[0].Amount)
+
+	rules := config.Dpos.At(header.Number)
+	epoch := header.Time.Int64() / rules.EpochInterval
+	assert.Equal(t, uint64((epoch+2)*rules.EpochInterval), unbondings[0].Release)
+}
+
+func TestApplyBindSigner(t *testing.T) {
+	var (
+		candidateKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		signerKey, _    = crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+		candidate       = crypto.PubkeyToAddress(candidateKey.PublicKey)
+		signer          = crypto.PubkeyToAddress(signerKey.PublicKey)
+		balance         = big.NewInt(1000000)
+		db, _           = bgmdb.NewMemDatabase()
+		config          = *params.DposChainConfig
+		txSigner        = types.NewEIP155Signer(config.ChainId)
+	)
+	config.Dpos = &params.DposConfig{}
+	gspec := &Genesis{
+		Config: &config,
+		Alloc:  GenesisAlloc{candidate: {Balance: balance}, signer: {Balance: balance}},
+	}
+	genesis := gspec.MustCommit(db)
+	blocks, _ := GenerateChain(&config, genesis, db, 1, func(i int, gen *BlockGen) {})
+	header := blocks[0].Header()
+
+	statedb, _ := state.New(genesis.Root(), state.NewDatabase(db))
+	dposContext, _ := types.NewDposContext(db)
+
+	bind := func(nonce uint64) {
+		tx, err := types.SignTx(types.NewTransaction(types.BindSigner, nonce, signer, new(big.Int), big.NewInt(100000), new(big.Int), nil), txSigner, candidateKey)
+		assert.Nil(t, err)
+		_, _, err = ApplyTransaction(&config, dposContext, nil, &candidate, new(GasPool).AddGas(big.NewInt(1000000)), statedb, header, tx, new(big.Int), vm.Config{})
+		assert.Nil(t, err)
+	}
+	// Only candidates may bind a signing key
+	bind(0)
+	bound, err := dposContext.GetBoundSigner(candidate)
+	assert.Nil(t, err)
+	assert.Equal(t, candidate, bound)
+
+	// Which needs neither reward sharing nor stake locking
+	assert.Nil(t, dposContext.BecomeCandidate(candidate))
+	bind(1)
+	bound, err = dposContext.GetBoundSigner(candidate)
+	assert.Nil(t, err)
+	assert.Equal(t, signer, bound)
+	proto := dposContext.ToProto()
+	assert.Equal(t, common.Hash{}, proto.RewardHash)
+	assert.Equal(t, common.Hash{}, proto.StakeHash)
+
+	// Double signing with the bound key is slashable
+	sealed := func(coinbase common.Address) *types.Header {
+		blocks, _ := GenerateChain(&config, genesis, db, 1, func(i int, gen *BlockGen) {
+			gen.SetCoinbase(coinbase)
+		})
+		header := blocks[0].Header()
+		header.Validator = candidate
+		header.Extra = make([]byte, 32+65)
+		sig, err := crypto.Sign(dpos.SigHash(header).Bytes(), signerKey)
+		assert.Nil(t, err)
+		copy(header.Extra[32:], sig)
+		return header
+	}
+	payload, err := rlp.EncodeToBytes(&types.DoubleSignEvidence{First: sealed(candidate), Second: sealed(signer)})
+	assert.Nil(t, err)
+	tx, err := types.SignTx(types.NewTransaction(types.ReportDoubleSign, 0, candidate, new(big.Int), big.NewInt(100000), new(big.Int), payload), txSigner, signerKey)
+	assert.Nil(t, err)
+	_, _, err = ApplyTransaction(&config, dposContext, nil, &signer, new(GasPool).AddGas(big.NewInt(1000000)), statedb, header, tx, new(big.Int), vm.Config{})
+	assert.Nil(t, err)
+	registered, err := dposContext.CandidateTrie().TryGet(candidate.Bytes())
+	assert.Nil(t, err)
+	assert.Nil(t, registered)
+}
+
+func TestApplyDelegate(t *testing.T) {
+	var (
+		key, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		delegator = crypto.PubkeyToAddress(key.PublicKey)
+		candidate = common.StringToAddress("candidate")
+		balance   = big.NewInt(1000000)
+		db, _     = bgmdb.NewMemDatabase()
+		signer    = types.NewEIP155Signer(params.DposChainConfig.ChainId)
+	)
+	gspec := &Genesis{
+		Config: params.DposChainConfig,
+		Alloc:  GenesisAlloc{delegator: {Balance: balance}},
+	}
+	genesis := gspec.MustCommit(db)
+	blocks, _ := GenerateChain(params.DposChainConfig, genesis, db, 1, func(i int, gen *BlockGen) {})
+	header := blocks[0].Header()
+
+	delegate := func(staking bool) (*state.StateDB, *types.DposContext) {
+		config := *params.DposChainConfig
+		config.Dpos = &params.DposConfig{Staking: staking}
+
+		statedb, _ := state.New(genesis.Root(), state.NewDatabase(db))
+		dposContext, _ := types.NewDposContext(db)
+		assert.Nil(t, dposContext.BecomeCandidate(candidate))
+
+		tx, err := types.SignTx(types.NewTransaction(types.Delegate, 0, candidate, big.NewInt(1000), big.NewInt(100000), new(big.Int), nil), signer, key)
+		assert.Nil(t, err)
+		_, _, err = ApplyTransaction(&config, dposContext, nil, &delegator, new(GasPool).AddGas(big.NewInt(1000000)), statedb, header, tx, new(big.Int), vm.Config{})
+		assert.Nil(t, err)
+
+		vote, err := dposContext.GetVote(delegator)
+		assert.Nil(t, err)
+		assert.Equal(t, &candidate, vote)
+		return statedb, dposContext
+	}
+	// Before stake locking the value is sent to the candidate and the stake trie stays empty
+	statedb, dposContext := delegate(false)
+	assert.Equal(t, big.NewInt(1000), statedb.GetBalance(candidate))
+	assert.Equal(t, common.Hash{}, dposContext.ToProto().StakeHash)
+
+	// Afterwards it is locked as stake behind the vote
+	statedb, dposContext = delegate(true)
+	assert.Equal(t, int64(0), statedb.GetBalance(candidate).Int64())
+	assert.Equal(t, new(big.Int).Sub(balance, big.NewInt(1000)), statedb.GetBalance(delegator))
+	stake, err := dposContext.GetStake(delegator)
+	assert.Nil(t, err)
+	assert.Equal(t, big.NewInt(1000), stake)
+}
@@ -563,6 +563,10 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	if tx.Value().Sign() < 0 {
 		return ErrNegativeValue
 	}
+	// Reject malformed DPoS transactions before they reach the state processor
+	if err := tx.Validate(); err != nil {
+		return err
+	}
 //
 	if pool.currentMaxGas.Cmp(tx.Gas()) < 0 {
 		return ErrGasLimit
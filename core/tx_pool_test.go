@@ -329,6 +329,34 @@ func TestTransactionNegativeValue(t *testing.T) {
 	}
 }
 
+func TestInvalidDposTransactions(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	pool.currentState.AddBalance(from, big.NewInt(0xffffffffffffff))
+
+	tests := []struct {
+		txType types.TxType
+		value  int64
+		data   []byte
+	}{
+		{types.TxType(42), 0, nil},                // unknown transaction type
+		{types.UnDelegate, 100, nil},              // value on a non delegation
+		{types.LogoutCandidate, 0, []byte{0x01}},  // unexpected payload
+		{types.LoginCandidate, 0, []byte{0x01}},   // malformed candidate payload
+		{types.ReportDoubleSign, 0, []byte{0xc0}}, // malformed double sign evidence
+	}
+	for i, tt := range tests {
+		tx, _ := types.SignTx(types.NewTransaction(tt.txType, 0, common.Address{}, big.NewInt(tt.value), big.NewInt(100000), big.NewInt(1), tt.data), types.HomesteadSigner{}, key)
+		if err := pool.AddRemote(tx); err == nil {
+			t.Errorf("test %d: expected malformed transaction to be rejected", i)
+		}
+	}
+}
+
 func TestTransactionChainFork(t *testing.T) {
 	t.Parallel()
 
@@ -2,8 +2,11 @@ package types
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	"math/big"
 
 	"github.com/5sWind/bgmchain/common"
 	"github.com/5sWind/bgmchain/crypto/sha3"
@@ -18,6 +21,8 @@ type DposContext struct {
 	voteTrie      *trie.Trie
 	candidateTrie *trie.Trie
 	mintCntTrie   *trie.Trie
+	rewardTrie    *trie.Trie
+	stakeTrie     *trie.Trie
 
 	db bgmdb.Database
 }
@@ -28,8 +33,60 @@ var (
 	votePrefix      = []byte("vote-")
 	candidatePrefix = []byte("candidate-")
 	mintCntPrefix   = []byte("mintCnt-")
+	rewardPrefix    = []byte("reward-")
+	stakePrefix     = []byte("stake-")
+
+	commissionKey = []byte("commission-")
+	rewardPoolKey = []byte("pool-")
+	accruedKey    = []byte("accrued-")
+	lockedKey     = []byte("locked-")
+	unbondingKey  = []byte("unbonding-")
+	slashedKey    = []byte("slashed-")
+	depositKey    = []byte("deposit-")
+	metaKey       = []byte("meta-")
+	signerKey     = []byte("signer-")
+
+	// ValidatorsKey is the epoch trie key the validators of an epoch are stored under.
+	ValidatorsKey = []byte("validator")
 )
 
+// DposTrie identifies one of the tries making up a dpos context.
+type DposTrie uint8
+
+const (
+	DposEpochTrie DposTrie = iota
+	DposDelegateTrie
+	DposVoteTrie
+	DposCandidateTrie
+	DposMintCntTrie
+	DposRewardTrie
+	DposStakeTrie
+)
+
+var dposTriePrefixes = [...][]byte{
+	DposEpochTrie:     epochPrefix,
+	DposDelegateTrie:  delegatePrefix,
+	DposVoteTrie:      votePrefix,
+	DposCandidateTrie: candidatePrefix,
+	DposMintCntTrie:   mintCntPrefix,
+	DposRewardTrie:    rewardPrefix,
+	DposStakeTrie:     stakePrefix,
+}
+
+// Valid reports whether t names a known dpos trie.
+func (t DposTrie) Valid() bool { return int(t) < len(dposTriePrefixes) }
+
+// Key returns the raw trie key an entry of the trie is stored under, which is
+// the key needed to prove it.
+func (t DposTrie) Key(key []byte) []byte {
+	return append(common.CopyBytes(dposTriePrefixes[t]), key...)
+}
+
+// NewDposTrie opens the given dpos trie at root.
+func NewDposTrie(t DposTrie, root common.Hash, db bgmdb.Database) (*trie.Trie, error) {
+	return trie.NewTrieWithPrefix(root, dposTriePrefixes[t], db)
+}
+
 func NewEpochTrie(root common.Hash, db bgmdb.Database) (*trie.Trie, error) {
 	return trie.NewTrieWithPrefix(root, epochPrefix, db)
 }
@@ -50,6 +107,14 @@ func NewMintCntTrie(root common.Hash, db bgmdb.Database) (*trie.Trie, error) {
 	return trie.NewTrieWithPrefix(root, mintCntPrefix, db)
 }
 
+func NewRewardTrie(root common.Hash, db bgmdb.Database) (*trie.Trie, error) {
+	return trie.NewTrieWithPrefix(root, rewardPrefix, db)
+}
+
+func NewStakeTrie(root common.Hash, db bgmdb.Database) (*trie.Trie, error) {
+	return trie.NewTrieWithPrefix(root, stakePrefix, db)
+}
+
 func NewDposContext(db bgmdb.Database) (*DposContext, error) {
 	epochTrie, err := NewEpochTrie(common.Hash{}, db)
 	if err != nil {
@@ -71,12 +136,22 @@ func NewDposContext(db bgmdb.Database) (*DposContext, error) {
 	if err != nil {
 		return nil, err
 	}
+	rewardTrie, err := NewRewardTrie(common.Hash{}, db)
+	if err != nil {
+		return nil, err
+	}
+	stakeTrie, err := NewStakeTrie(common.Hash{}, db)
+	if err != nil {
+		return nil, err
+	}
 	return &DposContext{
 		epochTrie:     epochTrie,
 		delegateTrie:  delegateTrie,
 		voteTrie:      voteTrie,
 		candidateTrie: candidateTrie,
 		mintCntTrie:   mintCntTrie,
+		rewardTrie:    rewardTrie,
+		stakeTrie:     stakeTrie,
 		db:            db,
 	}, nil
 }
@@ -102,12 +177,22 @@ func NewDposContextFromProto(db bgmdb.Database, ctxProto *DposContextProto) (*Dp
 	if err != nil {
 		return nil, err
 	}
+	rewardTrie, err := NewRewardTrie(ctxProto.RewardHash, db)
+	if err != nil {
+		return nil, err
+	}
+	stakeTrie, err := NewStakeTrie(ctxProto.StakeHash, db)
+	if err != nil {
+		return nil, err
+	}
 	return &DposContext{
 		epochTrie:     epochTrie,
 		delegateTrie:  delegateTrie,
 		voteTrie:      voteTrie,
 		candidateTrie: candidateTrie,
 		mintCntTrie:   mintCntTrie,
+		rewardTrie:    rewardTrie,
+		stakeTrie:     stakeTrie,
 		db:            db,
 	}, nil
 }
@@ -118,24 +203,21 @@ func (d *DposContext) Copy() *DposContext {
 	voteTrie := *d.voteTrie
 	candidateTrie := *d.candidateTrie
 	mintCntTrie := *d.mintCntTrie
+	rewardTrie := *d.rewardTrie
+	stakeTrie := *d.stakeTrie
 	return &DposContext{
 		epochTrie:     &epochTrie,
 		delegateTrie:  &delegateTrie,
 		voteTrie:      &voteTrie,
 		candidateTrie: &candidateTrie,
 		mintCntTrie:   &mintCntTrie,
+		rewardTrie:    &rewardTrie,
+		stakeTrie:     &stakeTrie,
 	}
 }
 
 func (d *DposContext) Root() (h common.Hash) {
-	hw := sha3.NewKeccak256()
-	rlp.Encode(hw, d.epochTrie.Hash())
-	rlp.Encode(hw, d.delegateTrie.Hash())
-	rlp.Encode(hw, d.candidateTrie.Hash())
-	rlp.Encode(hw, d.voteTrie.Hash())
-	rlp.Encode(hw, d.mintCntTrie.Hash())
-	hw.Sum(h[:0])
-	return h
+	return d.ToProto().Root()
 }
 
 func (d *DposContext) Snapshot() *DposContext {
@@ -148,6 +230,8 @@ func (d *DposContext) RevertToSnapShot(snapshot *DposContext) {
 	d.candidateTrie = snapshot.candidateTrie
 	d.voteTrie = snapshot.voteTrie
 	d.mintCntTrie = snapshot.mintCntTrie
+	d.rewardTrie = snapshot.rewardTrie
+	d.stakeTrie = snapshot.stakeTrie
 }
 
 func (d *DposContext) FromProto(dcp *DposContextProto) error {
@@ -169,15 +253,91 @@ func (d *DposContext) FromProto(dcp *DposContextProto) error {
 		return err
 	}
 	d.mintCntTrie, err = NewMintCntTrie(dcp.MintCntHash, d.db)
+	if err != nil {
+		return err
+	}
+	d.rewardTrie, err = NewRewardTrie(dcp.RewardHash, d.db)
+	if err != nil {
+		return err
+	}
+	d.stakeTrie, err = NewStakeTrie(dcp.StakeHash, d.db)
 	return err
 }
 
+// DposContextProto holds the roots of the dpos context tries. The reward and
+// stake roots are optional: they are zero as long as their tries are empty,
+// which they stay until a fork turns them on, and zero trailing roots are left
+// out of the encoding and the context root. Headers from before those forks
+// thus keep their original encoding and hash.
 type DposContextProto struct {
 	EpochHash     common.Hash `json:"epochRoot"        gencodec:"required"`
 	DelegateHash  common.Hash `json:"delegateRoot"     gencodec:"required"`
 	CandidateHash common.Hash `json:"candidateRoot"    gencodec:"required"`
 	VoteHash      common.Hash `json:"voteRoot"         gencodec:"required"`
 	MintCntHash   common.Hash `json:"mintCntRoot"      gencodec:"required"`
+	RewardHash    common.Hash `json:"rewardRoot"`
+	StakeHash     common.Hash `json:"stakeRoot"`
+}
+
+// The number of roots a dpos context has, the optional ones following the
+// required ones.
+const (
+	dposContextRequiredRoots = 5
+	dposContextRoots         = 7
+)
+
+// roots returns the roots the context is encoded and hashed with, in order.
+func (p *DposContextProto) roots() []common.Hash {
+	roots := []common.Hash{p.EpochHash, p.DelegateHash, p.CandidateHash, p.VoteHash, p.MintCntHash, p.RewardHash, p.StakeHash}
+	n := len(roots)
+	for n > dposContextRequiredRoots && roots[n-1] == (common.Hash{}) {
+		n--
+	}
+	return roots[:n]
+}
+
+// EncodeRLP implements rlp.Encoder, leaving out the unused optional roots.
+func (p *DposContextProto) EncodeRLP(w io.Writer) error {
+	if p == nil {
+		p = new(DposContextProto)
+	}
+	return rlp.Encode(w, p.roots())
+}
+
+// DecodeRLP implements rlp.Decoder, accepting contexts with and without the
+// optional roots. Zero trailing roots are refused so the encoding stays unique.
+func (p *DposContextProto) DecodeRLP(s *rlp.Stream) error {
+	var roots []common.Hash
+	if err := s.Decode(&roots); err != nil {
+		return err
+	}
+	switch {
+	case len(roots) < dposContextRequiredRoots || len(roots) > dposContextRoots:
+		return fmt.Errorf("invalid dpos context with %d roots", len(roots))
+	case len(roots) > dposContextRequiredRoots && roots[len(roots)-1] == (common.Hash{}):
+		return errors.New("non-canonical dpos context with zero trailing root")
+	}
+	var full [dposContextRoots]common.Hash
+	copy(full[:], roots)
+	*p = DposContextProto{
+		EpochHash:     full[0],
+		DelegateHash:  full[1],
+		CandidateHash: full[2],
+		VoteHash:      full[3],
+		MintCntHash:   full[4],
+		RewardHash:    full[5],
+		StakeHash:     full[6],
+	}
+	return nil
+}
+
+// optionalRoot returns the root an optional trie is recorded with, zero while
+// the trie is empty.
+func optionalRoot(root common.Hash) common.Hash {
+	if root == EmptyRootHash {
+		return common.Hash{}
+	}
+	return root
 }
 
 func (d *DposContext) ToProto() *DposContextProto {
@@ -187,16 +347,49 @@ func (d *DposContext) ToProto() *DposContextProto {
 		CandidateHash: d.candidateTrie.Hash(),
 		VoteHash:      d.voteTrie.Hash(),
 		MintCntHash:   d.mintCntTrie.Hash(),
+		RewardHash:    optionalRoot(d.rewardTrie.Hash()),
+		StakeHash:     optionalRoot(d.stakeTrie.Hash()),
+	}
+}
+
+// TrieRoot returns the root hash of the given trie, zero for an optional trie
+// which is empty.
+func (p *DposContextProto) TrieRoot(t DposTrie) common.Hash {
+	switch t {
+	case DposEpochTrie:
+		return p.EpochHash
+	case DposDelegateTrie:
+		return p.DelegateHash
+	case DposVoteTrie:
+		return p.VoteHash
+	case DposCandidateTrie:
+		return p.CandidateHash
+	case DposMintCntTrie:
+		return p.MintCntHash
+	case DposRewardTrie:
+		return p.RewardHash
+	case DposStakeTrie:
+		return p.StakeHash
+	}
+	return common.Hash{}
+}
+
+// Prove writes a Merkle proof of the entry under key in the given trie to
+// proofDb. The proof can be checked with trie.VerifyProof against the trie
+// root and t.Key(key).
+func (p *DposContextProto) Prove(db bgmdb.Database, t DposTrie, key []byte, proofDb trie.DatabaseWriter) error {
+	tr, err := NewDposTrie(t, p.TrieRoot(t), db)
+	if err != nil {
+		return err
 	}
+	return tr.Prove(t.Key(key), 0, proofDb)
 }
 
 func (p *DposContextProto) Root() (h common.Hash) {
 	hw := sha3.NewKeccak256()
-	rlp.Encode(hw, p.EpochHash)
-	rlp.Encode(hw, p.DelegateHash)
-	rlp.Encode(hw, p.CandidateHash)
-	rlp.Encode(hw, p.VoteHash)
-	rlp.Encode(hw, p.MintCntHash)
+	for _, root := range p.roots() {
+		rlp.Encode(hw, root)
+	}
 	hw.Sum(h[:0])
 	return h
 }
@@ -209,6 +402,17 @@ func (d *DposContext) KickoutCandidate(candidateAddr common.Address) error {
 			return err
 		}
 	}
+	if err := d.rewardTrie.TryDelete(addressKey(commissionKey, candidateAddr)); err != nil {
+		if _, ok := err.(*trie.MissingNodeError); !ok {
+			return err
+		}
+	}
+	if err := d.SetCandidateMeta(candidateAddr, nil); err != nil {
+		return err
+	}
+	if err := d.BindSigner(candidateAddr, candidateAddr); err != nil {
+		return err
+	}
 	iter := trie.NewIterator(d.delegateTrie.PrefixIterator(candidate))
 	for iter.Next() {
 		delegator := iter.Value
@@ -317,12 +521,22 @@ func (d *DposContext) CommitTo(dbw trie.DatabaseWriter) (*DposContextProto, erro
 	if err != nil {
 		return nil, err
 	}
+	rewardRoot, err := d.rewardTrie.CommitTo(dbw)
+	if err != nil {
+		return nil, err
+	}
+	stakeRoot, err := d.stakeTrie.CommitTo(dbw)
+	if err != nil {
+		return nil, err
+	}
 	return &DposContextProto{
 		EpochHash:     epochRoot,
 		DelegateHash:  delegateRoot,
 		VoteHash:      voteRoot,
 		CandidateHash: candidateRoot,
 		MintCntHash:   mintCntRoot,
+		RewardHash:    optionalRoot(rewardRoot),
+		StakeHash:     optionalRoot(stakeRoot),
 	}, nil
 }
 
@@ -331,17 +545,20 @@ func (d *DposContext) DelegateTrie() *trie.Trie           { return d.delegateTri
 func (d *DposContext) VoteTrie() *trie.Trie               { return d.voteTrie }
 func (d *DposContext) EpochTrie() *trie.Trie              { return d.epochTrie }
 func (d *DposContext) MintCntTrie() *trie.Trie            { return d.mintCntTrie }
+func (d *DposContext) RewardTrie() *trie.Trie             { return d.rewardTrie }
+func (d *DposContext) StakeTrie() *trie.Trie              { return d.stakeTrie }
 func (d *DposContext) DB() bgmdb.Database                 { return d.db }
 func (dc *DposContext) SetEpoch(epoch *trie.Trie)         { dc.epochTrie = epoch }
 func (dc *DposContext) SetDelegate(delegate *trie.Trie)   { dc.delegateTrie = delegate }
 func (dc *DposContext) SetVote(vote *trie.Trie)           { dc.voteTrie = vote }
 func (dc *DposContext) SetCandidate(candidate *trie.Trie) { dc.candidateTrie = candidate }
 func (dc *DposContext) SetMintCnt(mintCnt *trie.Trie)     { dc.mintCntTrie = mintCnt }
+func (dc *DposContext) SetReward(reward *trie.Trie)       { dc.rewardTrie = reward }
+func (dc *DposContext) SetStake(stake *trie.Trie)         { dc.stakeTrie = stake }
 
 func (dc *DposContext) GetValidators() ([]common.Address, error) {
 	var validators []common.Address
-	key := []byte("validator")
-	validatorsRLP := dc.epochTrie.Get(key)
+	validatorsRLP := dc.epochTrie.Get(ValidatorsKey)
 	if err := rlp.DecodeBytes(validatorsRLP, &validators); err != nil {
 		return nil, fmt.Errorf("failed to decode validators: %s", err)
 	}
@@ -349,11 +566,429 @@ func (dc *DposContext) GetValidators() ([]common.Address, error) {
 }
 
 func (dc *DposContext) SetValidators(validators []common.Address) error {
-	key := []byte("validator")
 	validatorsRLP, err := rlp.EncodeToBytes(validators)
 	if err != nil {
 		return fmt.Errorf("failed to encode validators to rlp bytes: %s", err)
 	}
-	dc.epochTrie.Update(key, validatorsRLP)
+	dc.epochTrie.Update(ValidatorsKey, validatorsRLP)
+	return nil
+}
+
+// GetCandidates returns all the registered candidates.
+func (dc *DposContext) GetCandidates() ([]common.Address, error) {
+	candidates := []common.Address{}
+	iter := trie.NewIterator(dc.candidateTrie.NodeIterator(nil))
+	for iter.Next() {
+		// Skip the signer bindings and slashing records kept alongside the candidates
+		if len(iter.Key) != len(candidatePrefix)+common.AddressLength {
+			continue
+		}
+		candidates = append(candidates, common.BytesToAddress(iter.Value))
+	}
+	return candidates, iter.Err
+}
+
+// GetDelegators returns all the delegators voting for a candidate.
+func (dc *DposContext) GetDelegators(candidateAddr common.Address) ([]common.Address, error) {
+	delegators := []common.Address{}
+	iter := trie.NewIterator(dc.delegateTrie.PrefixIterator(candidateAddr.Bytes()))
+	for iter.Next() {
+		delegators = append(delegators, common.BytesToAddress(iter.Value))
+	}
+	return delegators, iter.Err
+}
+
+// GetVote returns the candidate a delegator votes for, or nil if it doesn't vote.
+func (dc *DposContext) GetVote(delegatorAddr common.Address) (*common.Address, error) {
+	candidate, err := dc.voteTrie.TryGet(delegatorAddr.Bytes())
+	if err != nil || candidate == nil {
+		return nil, err
+	}
+	candidateAddr := common.BytesToAddress(candidate)
+	return &candidateAddr, nil
+}
+
+// GetMintCnt returns the number of blocks a validator minted in an epoch.
+func (dc *DposContext) GetMintCnt(epoch uint64, validatorAddr common.Address) (uint64, error) {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, epoch)
+	cntBytes, err := dc.mintCntTrie.TryGet(append(key, validatorAddr.Bytes()...))
+	if err != nil || cntBytes == nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(cntBytes), nil
+}
+
+func addressKey(prefix []byte, addr common.Address) []byte {
+	return append(common.CopyBytes(prefix), addr.Bytes()...)
+}
+
+// GetCommission returns the percentage of the block reward the candidate keeps
+// for itself. Candidates which never declared a commission keep the whole reward.
+func (dc *DposContext) GetCommission(candidateAddr common.Address) (uint64, bool, error) {
+	commission, err := dc.rewardTrie.TryGet(addressKey(commissionKey, candidateAddr))
+	if err != nil {
+		return 0, false, err
+	}
+	if commission == nil {
+		return MaxCommission, false, nil
+	}
+	return binary.BigEndian.Uint64(commission), true, nil
+}
+
+// SetCommission records the commission declared by a candidate, removing the
+// declaration if commission is nil.
+func (dc *DposContext) SetCommission(candidateAddr common.Address, commission *uint64) error {
+	key := addressKey(commissionKey, candidateAddr)
+	if commission == nil {
+		err := dc.rewardTrie.TryDelete(key)
+		if _, ok := err.(*trie.MissingNodeError); err != nil && !ok {
+			return err
+		}
+		return nil
+	}
+	if *commission > MaxCommission {
+		return ErrInvalidCommission
+	}
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, *commission)
+	return dc.rewardTrie.TryUpdate(key, value)
+}
+
+// GetCandidateMeta returns the description a candidate registered with, nil if
+// it didn't provide any.
+func (dc *DposContext) GetCandidateMeta(candidateAddr common.Address) (*CandidateMeta, error) {
+	enc, err := dc.rewardTrie.TryGet(addressKey(metaKey, candidateAddr))
+	if err != nil || len(enc) == 0 {
+		return nil, err
+	}
+	meta := new(CandidateMeta)
+	if err := rlp.DecodeBytes(enc, meta); err != nil {
+		return nil, fmt.Errorf("failed to decode candidate metadata: %s", err)
+	}
+	return meta, nil
+}
+
+// SetCandidateMeta records the description of a candidate, removing it if meta
+// is nil.
+func (dc *DposContext) SetCandidateMeta(candidateAddr common.Address, meta *CandidateMeta) error {
+	key := addressKey(metaKey, candidateAddr)
+	if meta == nil {
+		err := dc.rewardTrie.TryDelete(key)
+		if _, ok := err.(*trie.MissingNodeError); err != nil && !ok {
+			return err
+		}
+		return nil
+	}
+	if err := meta.Validate(); err != nil {
+		return err
+	}
+	enc, err := rlp.EncodeToBytes(meta)
+	if err != nil {
+		return fmt.Errorf("failed to encode candidate metadata: %s", err)
+	}
+	return dc.rewardTrie.TryUpdate(key, enc)
+}
+
+// SignerKey returns the epoch trie key the signing key a validator seals the
+// blocks of the epoch with is stored under.
+func SignerKey(validatorAddr common.Address) []byte {
+	return addressKey(signerKey, validatorAddr)
+}
+
+// BindSigner records the address a candidate wants to seal its blocks with,
+// removing the binding if the signer is the candidate itself. The binding is
+// kept in the candidate trie and only takes effect for the epochs elected
+// afterwards, see SetEpochSigners.
+func (dc *DposContext) BindSigner(candidateAddr, signerAddr common.Address) error {
+	key := addressKey(signerKey, candidateAddr)
+	if signerAddr == candidateAddr {
+		err := dc.candidateTrie.TryDelete(key)
+		if _, ok := err.(*trie.MissingNodeError); err != nil && !ok {
+			return err
+		}
+		return nil
+	}
+	return dc.candidateTrie.TryUpdate(key, signerAddr.Bytes())
+}
+
+// GetBoundSigner returns the address a candidate asked to seal its blocks with
+// from the next epoch on, the candidate itself if it didn't bind any.
+func (dc *DposContext) GetBoundSigner(candidateAddr common.Address) (common.Address, error) {
+	signer, err := dc.candidateTrie.TryGet(addressKey(signerKey, candidateAddr))
+	if err != nil || signer == nil {
+		return candidateAddr, err
+	}
+	return common.BytesToAddress(signer), nil
+}
+
+// SetEpochSigners records in the epoch trie the signing key every validator
+// of the epoch is bound to, fixing them for the whole epoch.
+func (dc *DposContext) SetEpochSigners(validators []common.Address) error {
+	for _, validator := range validators {
+		signer, err := dc.GetBoundSigner(validator)
+		if err != nil {
+			return err
+		}
+		if signer != validator {
+			if err := dc.epochTrie.TryUpdate(SignerKey(validator), signer.Bytes()); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
+
+// GetEpochSigner returns the address a validator seals the blocks of the
+// current epoch with, the validator itself unless it bound a signing key.
+func (dc *DposContext) GetEpochSigner(validatorAddr common.Address) (common.Address, error) {
+	signer, err := dc.epochTrie.TryGet(SignerKey(validatorAddr))
+	if err != nil || signer == nil {
+		return validatorAddr, err
+	}
+	return common.BytesToAddress(signer), nil
+}
+
+func getBig(t *trie.Trie, key []byte) (*big.Int, error) {
+	value, err := t.TryGet(key)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(value), nil
+}
+
+func addBig(t *trie.Trie, key []byte, amount *big.Int) error {
+	value, err := getBig(t, key)
+	if err != nil {
+		return err
+	}
+	return t.TryUpdate(key, value.Add(value, amount).Bytes())
+}
+
+// GetRewardPool returns the delegator share of the block rewards a validator
+// collected during the current epoch which has not been distributed yet.
+func (dc *DposContext) GetRewardPool(validatorAddr common.Address) (*big.Int, error) {
+	return getBig(dc.rewardTrie, addressKey(rewardPoolKey, validatorAddr))
+}
+
+func (dc *DposContext) AddRewardPool(validatorAddr common.Address, amount *big.Int) error {
+	return addBig(dc.rewardTrie, addressKey(rewardPoolKey, validatorAddr), amount)
+}
+
+// RewardPools returns every validator with an undistributed reward pool.
+func (dc *DposContext) RewardPools() (map[common.Address]*big.Int, error) {
+	pools := make(map[common.Address]*big.Int)
+	iter := trie.NewIterator(dc.rewardTrie.PrefixIterator(rewardPoolKey))
+	for iter.Next() {
+		validator := common.BytesToAddress(iter.Key[len(rewardPrefix)+len(rewardPoolKey):])
+		pools[validator] = new(big.Int).SetBytes(iter.Value)
+	}
+	if iter.Err != nil {
+		return nil, iter.Err
+	}
+	return pools, nil
+}
+
+func (dc *DposContext) ClearRewardPool(validatorAddr common.Address) error {
+	return dc.rewardTrie.TryDelete(addressKey(rewardPoolKey, validatorAddr))
+}
+
+// GetAccruedReward returns the total block rewards paid out to a delegator.
+func (dc *DposContext) GetAccruedReward(delegatorAddr common.Address) (*big.Int, error) {
+	return getBig(dc.rewardTrie, addressKey(accruedKey, delegatorAddr))
+}
+
+func (dc *DposContext) AddAccruedReward(delegatorAddr common.Address, amount *big.Int) error {
+	return addBig(dc.rewardTrie, addressKey(accruedKey, delegatorAddr), amount)
+}
+
+// Unbonding is stake released by an UnDelegate transaction, or the deposit of a
+// retired candidate, which is returned to its owner once the unbonding period
+// is over.
+type Unbonding struct {
+	Amount  *big.Int `json:"amount"`
+	Release uint64   `json:"release"` // Block time from which the stake is returned
+}
+
+// GetStake returns the stake a delegator has locked behind its vote.
+func (dc *DposContext) GetStake(delegatorAddr common.Address) (*big.Int, error) {
+	return getBig(dc.stakeTrie, addressKey(lockedKey, delegatorAddr))
+}
+
+// LockStake adds to the stake a delegator has locked behind its vote.
+func (dc *DposContext) LockStake(delegatorAddr common.Address, amount *big.Int) error {
+	return addBig(dc.stakeTrie, addressKey(lockedKey, delegatorAddr), amount)
+}
+
+// UnbondStake moves the whole locked stake of a delegator into unbonding, to be
+// returned at the given block time. It returns the amount put into unbonding.
+func (dc *DposContext) UnbondStake(delegatorAddr common.Address, release uint64) (*big.Int, error) {
+	stake, err := dc.GetStake(delegatorAddr)
+	if err != nil || stake.Sign() == 0 {
+		return stake, err
+	}
+	unbondings, err := dc.GetUnbondings(delegatorAddr)
+	if err != nil {
+		return nil, err
+	}
+	unbondings = append(unbondings, &Unbonding{Amount: stake, Release: release})
+	if err := dc.setUnbondings(delegatorAddr, unbondings); err != nil {
+		return nil, err
+	}
+	return stake, dc.stakeTrie.TryDelete(addressKey(lockedKey, delegatorAddr))
+}
+
+// GetDeposit returns the deposit a candidate has locked to register.
+func (dc *DposContext) GetDeposit(candidateAddr common.Address) (*big.Int, error) {
+	return getBig(dc.stakeTrie, addressKey(depositKey, candidateAddr))
+}
+
+// AddDeposit adds to the deposit a candidate has locked to register.
+func (dc *DposContext) AddDeposit(candidateAddr common.Address, amount *big.Int) error {
+	return addBig(dc.stakeTrie, addressKey(depositKey, candidateAddr), amount)
+}
+
+// UnbondDeposit moves the whole deposit of a candidate into unbonding, to be
+// returned at the given block time together with any unbonded stake. It returns
+// the amount put into unbonding.
+func (dc *DposContext) UnbondDeposit(candidateAddr common.Address, release uint64) (*big.Int, error) {
+	deposit, err := dc.GetDeposit(candidateAddr)
+	if err != nil || deposit.Sign() == 0 {
+		return deposit, err
+	}
+	unbondings, err := dc.GetUnbondings(candidateAddr)
+	if err != nil {
+		return nil, err
+	}
+	unbondings = append(unbondings, &Unbonding{Amount: deposit, Release: release})
+	if err := dc.setUnbondings(candidateAddr, unbondings); err != nil {
+		return nil, err
+	}
+	return deposit, dc.stakeTrie.TryDelete(addressKey(depositKey, candidateAddr))
+}
+
+// SlashStake takes the given percentage away from the deposit, the locked stake
+// and the unbondings of an account, the stake waiting to be returned still being
+// at stake. It returns the total amount taken.
+func (dc *DposContext) SlashStake(addr common.Address, percent uint64) (*big.Int, error) {
+	slashed := new(big.Int)
+	cut := func(amount *big.Int) *big.Int {
+		penalty := new(big.Int).Mul(amount, new(big.Int).SetUint64(percent))
+		penalty.Div(penalty, big.NewInt(100))
+		slashed.Add(slashed, penalty)
+		return penalty
+	}
+	for _, key := range [][]byte{addressKey(depositKey, addr), addressKey(lockedKey, addr)} {
+		amount, err := getBig(dc.stakeTrie, key)
+		if err != nil {
+			return nil, err
+		}
+		if amount.Sign() == 0 {
+			continue
+		}
+		amount.Sub(amount, cut(amount))
+		if amount.Sign() == 0 {
+			err = dc.stakeTrie.TryDelete(key)
+		} else {
+			err = dc.stakeTrie.TryUpdate(key, amount.Bytes())
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	unbondings, err := dc.GetUnbondings(addr)
+	if err != nil || len(unbondings) == 0 {
+		return slashed, err
+	}
+	var remaining []*Unbonding
+	for _, unbonding := range unbondings {
+		amount := new(big.Int).Sub(unbonding.Amount, cut(unbonding.Amount))
+		if amount.Sign() > 0 {
+			remaining = append(remaining, &Unbonding{Amount: amount, Release: unbonding.Release})
+		}
+	}
+	return slashed, dc.setUnbondings(addr, remaining)
+}
+
+// GetUnbondings returns the stake of a delegator which is waiting to be returned.
+func (dc *DposContext) GetUnbondings(delegatorAddr common.Address) ([]*Unbonding, error) {
+	enc, err := dc.stakeTrie.TryGet(addressKey(unbondingKey, delegatorAddr))
+	if err != nil || len(enc) == 0 {
+		return nil, err
+	}
+	var unbondings []*Unbonding
+	if err := rlp.DecodeBytes(enc, &unbondings); err != nil {
+		return nil, fmt.Errorf("failed to decode unbondings: %s", err)
+	}
+	return unbondings, nil
+}
+
+func (dc *DposContext) setUnbondings(delegatorAddr common.Address, unbondings []*Unbonding) error {
+	key := addressKey(unbondingKey, delegatorAddr)
+	if len(unbondings) == 0 {
+		return dc.stakeTrie.TryDelete(key)
+	}
+	enc, err := rlp.EncodeToBytes(unbondings)
+	if err != nil {
+		return fmt.Errorf("failed to encode unbondings: %s", err)
+	}
+	return dc.stakeTrie.TryUpdate(key, enc)
+}
+
+// ReleaseUnbondings drops every unbonding which is due at the given block time
+// and returns the amounts to be credited back to each delegator.
+func (dc *DposContext) ReleaseUnbondings(now uint64) (map[common.Address]*big.Int, error) {
+	pending := make(map[common.Address][]*Unbonding)
+	iter := trie.NewIterator(dc.stakeTrie.PrefixIterator(unbondingKey))
+	for iter.Next() {
+		var unbondings []*Unbonding
+		if err := rlp.DecodeBytes(iter.Value, &unbondings); err != nil {
+			return nil, fmt.Errorf("failed to decode unbondings: %s", err)
+		}
+		pending[common.BytesToAddress(iter.Key[len(stakePrefix)+len(unbondingKey):])] = unbondings
+	}
+	if iter.Err != nil {
+		return nil, iter.Err
+	}
+	released := make(map[common.Address]*big.Int)
+	for delegator, unbondings := range pending {
+		var remaining []*Unbonding
+		for _, unbonding := range unbondings {
+			if unbonding.Release > now {
+				remaining = append(remaining, unbonding)
+				continue
+			}
+			if _, ok := released[delegator]; !ok {
+				released[delegator] = new(big.Int)
+			}
+			released[delegator].Add(released[delegator], unbonding.Amount)
+		}
+		if len(remaining) != len(unbondings) {
+			if err := dc.setUnbondings(delegator, remaining); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return released, nil
+}
+
+func slashedSlotKey(validatorAddr common.Address, slot uint64) []byte {
+	key := addressKey(slashedKey, validatorAddr)
+	slotBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(slotBytes, slot)
+	return append(key, slotBytes...)
+}
+
+// IsSlashed reports whether a validator has already been slashed for double
+// signing the given slot.
+func (dc *DposContext) IsSlashed(validatorAddr common.Address, slot uint64) (bool, error) {
+	value, err := dc.candidateTrie.TryGet(slashedSlotKey(validatorAddr, slot))
+	return value != nil, err
+}
+
+// MarkSlashed records that a validator was slashed for double signing the
+// given slot, so the same evidence can't be used twice. The records are kept
+// in the candidate trie, which every chain uses, and outlive the candidacy.
+func (dc *DposContext) MarkSlashed(validatorAddr common.Address, slot uint64) error {
+	return dc.candidateTrie.TryUpdate(slashedSlotKey(validatorAddr, slot), []byte{1})
+}
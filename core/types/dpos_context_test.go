@@ -1,10 +1,13 @@
 package types
 
 import (
+	"encoding/binary"
+	"math/big"
 	"testing"
 
 	"github.com/5sWind/bgmchain/common"
 	"github.com/5sWind/bgmchain/bgmdb"
+	"github.com/5sWind/bgmchain/rlp"
 	"github.com/5sWind/bgmchain/trie"
 	"github.com/stretchr/testify/assert"
 )
@@ -28,6 +31,39 @@ func TestDposContextSnapshot(t *testing.T) {
 	assert.NotEqual(t, dposContext, snapshot)
 }
 
+func TestDposContextProtoOptionalRoots(t *testing.T) {
+	db, _ := bgmdb.NewMemDatabase()
+	dposContext, err := NewDposContext(db)
+	assert.Nil(t, err)
+	assert.Nil(t, dposContext.BecomeCandidate(common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c")))
+
+	// Without rewards or stake the context is encoded with the five original roots
+	proto := dposContext.ToProto()
+	assert.Equal(t, common.Hash{}, proto.RewardHash)
+	assert.Equal(t, common.Hash{}, proto.StakeHash)
+	enc, err := rlp.EncodeToBytes(proto)
+	assert.Nil(t, err)
+	original, err := rlp.EncodeToBytes([]common.Hash{proto.EpochHash, proto.DelegateHash, proto.CandidateHash, proto.VoteHash, proto.MintCntHash})
+	assert.Nil(t, err)
+	assert.Equal(t, original, enc)
+
+	// The optional roots are carried once their tries are in use
+	assert.Nil(t, dposContext.AddRewardPool(common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c"), big.NewInt(1)))
+	proto = dposContext.ToProto()
+	assert.NotEqual(t, common.Hash{}, proto.RewardHash)
+	enc, err = rlp.EncodeToBytes(proto)
+	assert.Nil(t, err)
+	decoded := new(DposContextProto)
+	assert.Nil(t, rlp.DecodeBytes(enc, decoded))
+	assert.Equal(t, proto, decoded)
+	assert.Equal(t, proto.Root(), dposContext.Root())
+
+	// Zero trailing roots would give a second encoding of the same context
+	enc, err = rlp.EncodeToBytes([]common.Hash{proto.EpochHash, proto.DelegateHash, proto.CandidateHash, proto.VoteHash, proto.MintCntHash, proto.RewardHash, {}})
+	assert.Nil(t, err)
+	assert.NotNil(t, rlp.DecodeBytes(enc, decoded))
+}
+
 func TestDposContextBecomeCandidate(t *testing.T) {
 	candidates := []common.Address{
 		common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6e"),
@@ -176,3 +212,308 @@ func TestDposContextValidators(t *testing.T) {
 		assert.True(t, validatorMap[validator])
 	}
 }
+
+func TestDposContextRewards(t *testing.T) {
+	validator := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6e")
+	delegator := common.HexToAddress("0xa60a3886b552ff9992cfcd208ec1152079e046c2")
+
+	db, _ := bgmdb.NewMemDatabase()
+	dposContext, err := NewDposContext(db)
+	assert.Nil(t, err)
+
+	// candidates without a declared commission keep the whole reward
+	commission, declared, err := dposContext.GetCommission(validator)
+	assert.Nil(t, err)
+	assert.False(t, declared)
+	assert.Equal(t, MaxCommission, commission)
+
+	rate := uint64(20)
+	assert.Nil(t, dposContext.SetCommission(validator, &rate))
+	commission, declared, err = dposContext.GetCommission(validator)
+	assert.Nil(t, err)
+	assert.True(t, declared)
+	assert.Equal(t, rate, commission)
+
+	rate = MaxCommission + 1
+	assert.Equal(t, ErrInvalidCommission, dposContext.SetCommission(validator, &rate))
+
+	// reward pools accumulate until cleared
+	assert.Nil(t, dposContext.AddRewardPool(validator, big.NewInt(3)))
+	assert.Nil(t, dposContext.AddRewardPool(validator, big.NewInt(4)))
+	pools, err := dposContext.RewardPools()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pools))
+	assert.Equal(t, int64(7), pools[validator].Int64())
+	assert.Nil(t, dposContext.ClearRewardPool(validator))
+	pools, err = dposContext.RewardPools()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(pools))
+
+	assert.Nil(t, dposContext.AddAccruedReward(delegator, big.NewInt(5)))
+	assert.Nil(t, dposContext.AddAccruedReward(delegator, big.NewInt(6)))
+	accrued, err := dposContext.GetAccruedReward(delegator)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(11), accrued.Int64())
+
+	// kickout drops the declared commission
+	assert.Nil(t, dposContext.BecomeCandidate(validator))
+	assert.Nil(t, dposContext.KickoutCandidate(validator))
+	_, declared, err = dposContext.GetCommission(validator)
+	assert.Nil(t, err)
+	assert.False(t, declared)
+}
+
+func TestDposContextStake(t *testing.T) {
+	delegator := common.HexToAddress("0xa60a3886b552ff9992cfcd208ec1152079e046c2")
+
+	db, _ := bgmdb.NewMemDatabase()
+	dposContext, err := NewDposContext(db)
+	assert.Nil(t, err)
+
+	assert.Nil(t, dposContext.LockStake(delegator, big.NewInt(10)))
+	assert.Nil(t, dposContext.LockStake(delegator, big.NewInt(5)))
+	stake, err := dposContext.GetStake(delegator)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(15), stake.Int64())
+
+	unbonded, err := dposContext.UnbondStake(delegator, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(15), unbonded.Int64())
+	stake, err = dposContext.GetStake(delegator)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), stake.Int64())
+
+	assert.Nil(t, dposContext.LockStake(delegator, big.NewInt(7)))
+	_, err = dposContext.UnbondStake(delegator, 200)
+	assert.Nil(t, err)
+	unbondings, err := dposContext.GetUnbondings(delegator)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(unbondings))
+
+	released, err := dposContext.ReleaseUnbondings(99)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(released))
+
+	released, err = dposContext.ReleaseUnbondings(150)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(15), released[delegator].Int64())
+	unbondings, err = dposContext.GetUnbondings(delegator)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(unbondings))
+	assert.Equal(t, uint64(200), unbondings[0].Release)
+}
+
+func TestDposContextCandidateDeposit(t *testing.T) {
+	candidate := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6e")
+
+	db, _ := bgmdb.NewMemDatabase()
+	dposContext, err := NewDposContext(db)
+	assert.Nil(t, err)
+
+	assert.Nil(t, dposContext.AddDeposit(candidate, big.NewInt(100)))
+	assert.Nil(t, dposContext.AddDeposit(candidate, big.NewInt(20)))
+	deposit, err := dposContext.GetDeposit(candidate)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(120), deposit.Int64())
+
+	// the deposit shares the unbonding queue of the stake
+	assert.Nil(t, dposContext.LockStake(candidate, big.NewInt(5)))
+	_, err = dposContext.UnbondStake(candidate, 100)
+	assert.Nil(t, err)
+	unbonded, err := dposContext.UnbondDeposit(candidate, 200)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(120), unbonded.Int64())
+	deposit, err = dposContext.GetDeposit(candidate)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), deposit.Int64())
+
+	released, err := dposContext.ReleaseUnbondings(150)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), released[candidate].Int64())
+	released, err = dposContext.ReleaseUnbondings(200)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(120), released[candidate].Int64())
+
+	unbonded, err = dposContext.UnbondDeposit(candidate, 300)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), unbonded.Int64())
+	unbondings, err := dposContext.GetUnbondings(candidate)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(unbondings))
+}
+
+func TestDposContextSlashStake(t *testing.T) {
+	validator := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6e")
+
+	db, _ := bgmdb.NewMemDatabase()
+	dposContext, err := NewDposContext(db)
+	assert.Nil(t, err)
+
+	// nothing at stake, nothing to slash
+	slashed, err := dposContext.SlashStake(validator, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), slashed.Int64())
+
+	assert.Nil(t, dposContext.LockStake(validator, big.NewInt(200)))
+	_, err = dposContext.UnbondStake(validator, 100)
+	assert.Nil(t, err)
+	assert.Nil(t, dposContext.LockStake(validator, big.NewInt(50)))
+	assert.Nil(t, dposContext.AddDeposit(validator, big.NewInt(1000)))
+
+	// deposit, locked stake and unbondings all lose their share
+	slashed, err = dposContext.SlashStake(validator, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(125), slashed.Int64())
+	deposit, err := dposContext.GetDeposit(validator)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(900), deposit.Int64())
+	stake, err := dposContext.GetStake(validator)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(45), stake.Int64())
+	unbondings, err := dposContext.GetUnbondings(validator)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(unbondings))
+	assert.Equal(t, int64(180), unbondings[0].Amount.Int64())
+	assert.Equal(t, uint64(100), unbondings[0].Release)
+
+	// a full slash leaves nothing behind
+	slashed, err = dposContext.SlashStake(validator, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1125), slashed.Int64())
+	unbondings, err = dposContext.GetUnbondings(validator)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(unbondings))
+	assert.Equal(t, EmptyRootHash, dposContext.StakeTrie().Hash())
+}
+
+func TestDposContextCandidateMeta(t *testing.T) {
+	candidate := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6e")
+
+	db, _ := bgmdb.NewMemDatabase()
+	dposContext, err := NewDposContext(db)
+	assert.Nil(t, err)
+
+	meta, err := dposContext.GetCandidateMeta(candidate)
+	assert.Nil(t, err)
+	assert.Nil(t, meta)
+
+	want := &CandidateMeta{Name: "node", Website: "https://example.org", Enode: "enode://1234@127.0.0.1:17575"}
+	assert.Nil(t, dposContext.SetCandidateMeta(candidate, want))
+	meta, err = dposContext.GetCandidateMeta(candidate)
+	assert.Nil(t, err)
+	assert.Equal(t, want, meta)
+
+	assert.Equal(t, ErrInvalidCandidateMeta, dposContext.SetCandidateMeta(candidate, &CandidateMeta{Enode: "127.0.0.1:17575"}))
+
+	// the metadata is kept out of the candidate trie, which only lists addresses
+	assert.Nil(t, dposContext.BecomeCandidate(candidate))
+	candidates, err := dposContext.GetCandidates()
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Address{candidate}, candidates)
+
+	// kickout drops the metadata
+	assert.Nil(t, dposContext.KickoutCandidate(candidate))
+	meta, err = dposContext.GetCandidateMeta(candidate)
+	assert.Nil(t, err)
+	assert.Nil(t, meta)
+}
+
+func TestDposContextSigner(t *testing.T) {
+	candidate := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6e")
+	signer := common.HexToAddress("0xa60a3886b552ff9992cfcd208ec1152079e046c2")
+
+	db, _ := bgmdb.NewMemDatabase()
+	dposContext, err := NewDposContext(db)
+	assert.Nil(t, err)
+
+	// candidates seal with their own key unless they bind another
+	bound, err := dposContext.GetBoundSigner(candidate)
+	assert.Nil(t, err)
+	assert.Equal(t, candidate, bound)
+
+	assert.Nil(t, dposContext.BindSigner(candidate, signer))
+	bound, err = dposContext.GetBoundSigner(candidate)
+	assert.Nil(t, err)
+	assert.Equal(t, signer, bound)
+
+	// the binding is fixed into the epoch trie for the validators of an epoch
+	current, err := dposContext.GetEpochSigner(candidate)
+	assert.Nil(t, err)
+	assert.Equal(t, candidate, current)
+	assert.Nil(t, dposContext.SetEpochSigners([]common.Address{candidate}))
+	current, err = dposContext.GetEpochSigner(candidate)
+	assert.Nil(t, err)
+	assert.Equal(t, signer, current)
+	assert.Equal(t, signer.Bytes(), dposContext.EpochTrie().Get(SignerKey(candidate)))
+
+	// binding the candidate itself removes the binding
+	assert.Nil(t, dposContext.BindSigner(candidate, candidate))
+	bound, err = dposContext.GetBoundSigner(candidate)
+	assert.Nil(t, err)
+	assert.Equal(t, candidate, bound)
+
+	// kickout drops the binding, but not the one of the running epoch
+	assert.Nil(t, dposContext.BecomeCandidate(candidate))
+	assert.Nil(t, dposContext.BindSigner(candidate, signer))
+	candidates, err := dposContext.GetCandidates()
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Address{candidate}, candidates)
+	assert.Nil(t, dposContext.KickoutCandidate(candidate))
+	bound, err = dposContext.GetBoundSigner(candidate)
+	assert.Nil(t, err)
+	assert.Equal(t, candidate, bound)
+	current, err = dposContext.GetEpochSigner(candidate)
+	assert.Nil(t, err)
+	assert.Equal(t, signer, current)
+}
+
+func TestDposContextQueries(t *testing.T) {
+	candidate := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6e")
+	delegators := []common.Address{
+		common.HexToAddress("0xa60a3886b552ff9992cfcd208ec1152079e046c2"),
+		common.HexToAddress("0x4e080e49f62694554871e669aeb4ebe17c4a9670"),
+	}
+	db, _ := bgmdb.NewMemDatabase()
+	dposContext, err := NewDposContext(db)
+	assert.Nil(t, err)
+
+	candidates, err := dposContext.GetCandidates()
+	assert.Nil(t, err)
+	assert.Empty(t, candidates)
+	vote, err := dposContext.GetVote(delegators[0])
+	assert.Nil(t, err)
+	assert.Nil(t, vote)
+
+	assert.Nil(t, dposContext.BecomeCandidate(candidate))
+	for _, delegator := range delegators {
+		assert.Nil(t, dposContext.Delegate(delegator, candidate))
+	}
+	candidates, err = dposContext.GetCandidates()
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Address{candidate}, candidates)
+
+	result, err := dposContext.GetDelegators(candidate)
+	assert.Nil(t, err)
+	assert.Len(t, result, len(delegators))
+	for _, delegator := range delegators {
+		assert.Contains(t, result, delegator)
+	}
+
+	vote, err = dposContext.GetVote(delegators[1])
+	assert.Nil(t, err)
+	if assert.NotNil(t, vote) {
+		assert.Equal(t, candidate, *vote)
+	}
+
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, 3)
+	cnt := make([]byte, 8)
+	binary.BigEndian.PutUint64(cnt, 42)
+	assert.Nil(t, dposContext.mintCntTrie.TryUpdate(append(key, candidate.Bytes()...), cnt))
+	mintCnt, err := dposContext.GetMintCnt(3, candidate)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(42), mintCnt)
+	mintCnt, err = dposContext.GetMintCnt(4, candidate)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), mintCnt)
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io"
 	"math/big"
+	"strings"
 	"sync/atomic"
 
 	"github.com/5sWind/bgmchain/common"
@@ -41,6 +42,8 @@ const (
 	LogoutCandidate
 	Delegate
 	UnDelegate
+	ReportDoubleSign
+	BindSigner
 )
 
 var (
@@ -49,8 +52,66 @@ var (
 	ErrInvalidType    = errors.New("invalid transaction type")
 	ErrInvalidAddress = errors.New("invalid transaction payload address")
 	ErrInvalidAction  = errors.New("invalid transaction payload action")
+
+	ErrInvalidCommission    = errors.New("invalid candidate commission")
+	ErrInvalidCandidateMeta = errors.New("invalid candidate metadata")
+	ErrInvalidEvidence      = errors.New("invalid double sign evidence")
 )
 
+// MaxCommission is the highest commission, in percent of the block reward, a
+// candidate may declare.
+const MaxCommission uint64 = 100
+
+// MaxCandidateMetaField is the longest, in bytes, each field of the metadata of
+// a candidate may be.
+const MaxCandidateMetaField = 256
+
+// CandidatePayload is the optional RLP encoded payload of a LoginCandidate
+// transaction.
+type CandidatePayload struct {
+	Commission uint64           // Percentage of the block reward kept by the validator, the rest is shared with its delegators
+	Meta       []*CandidateMeta `rlp:"tail"` // Optional description of the candidate, at most one
+}
+
+// CandidateMeta describes a candidate to the delegators choosing whom to vote for.
+type CandidateMeta struct {
+	Name    string `json:"name"`
+	Website string `json:"website"`
+	Enode   string `json:"enode"` // Node URL of the candidate, if it accepts peers
+}
+
+// Validate checks the size of the metadata fields and the scheme of the node URL.
+func (m *CandidateMeta) Validate() error {
+	if len(m.Name) > MaxCandidateMetaField || len(m.Website) > MaxCandidateMetaField || len(m.Enode) > MaxCandidateMetaField {
+		return ErrInvalidCandidateMeta
+	}
+	if m.Enode != "" && !strings.HasPrefix(m.Enode, "enode://") {
+		return ErrInvalidCandidateMeta
+	}
+	return nil
+}
+
+// DecodeCandidatePayload decodes and sanity checks the payload of a
+// LoginCandidate transaction.
+func DecodeCandidatePayload(data []byte) (*CandidatePayload, error) {
+	payload := new(CandidatePayload)
+	if err := rlp.DecodeBytes(data, payload); err != nil {
+		return nil, fmt.Errorf("invalid candidate payload: %v", err)
+	}
+	if payload.Commission > MaxCommission {
+		return nil, ErrInvalidCommission
+	}
+	if len(payload.Meta) > 1 {
+		return nil, ErrInvalidCandidateMeta
+	}
+	for _, meta := range payload.Meta {
+		if err := meta.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return payload, nil
+}
+
 // deriveSigner makes a *best* guess about which signer to use.
 func deriveSigner(V *big.Int) Signer {
 	if V.Sign() != 0 && isProtectedV(V) {
@@ -144,16 +205,48 @@ func (tx *Transaction) ChainId() *big.Int {
 	return deriveChainId(tx.data.V)
 }
 
+// DoubleSignEvidence is the payload of a ReportDoubleSign transaction: two
+// different headers sealed by the same validator for the same slot.
+type DoubleSignEvidence struct {
+	First  *Header
+	Second *Header
+}
+
+// DecodeDoubleSignEvidence decodes the payload of a ReportDoubleSign transaction.
+func DecodeDoubleSignEvidence(data []byte) (*DoubleSignEvidence, error) {
+	evidence := new(DoubleSignEvidence)
+	if err := rlp.DecodeBytes(data, evidence); err != nil {
+		return nil, fmt.Errorf("invalid double sign evidence: %v", err)
+	}
+	if evidence.First == nil || evidence.Second == nil || evidence.First.Time == nil || evidence.Second.Time == nil {
+		return nil, ErrInvalidEvidence
+	}
+	return evidence, nil
+}
+
 // Valid the transaction when the type isn't the binary
 func (tx *Transaction) Validate() error {
+	if tx.Type() > BindSigner {
+		return ErrInvalidType
+	}
 	if tx.Type() != Binary {
-		if tx.Value().Uint64() != 0 {
+		if tx.Type() != Delegate && tx.Type() != LoginCandidate && tx.Value().Sign() != 0 {
 			return errors.New("transaction value should be 0")
 		}
 		if tx.To() == nil && tx.Type() != LoginCandidate && tx.Type() != LogoutCandidate {
 			return errors.New("receipient was required")
 		}
-		if tx.Data() != nil {
+		if tx.Type() == LoginCandidate {
+			if len(tx.Data()) > 0 {
+				if _, err := DecodeCandidatePayload(tx.Data()); err != nil {
+					return err
+				}
+			}
+		} else if tx.Type() == ReportDoubleSign {
+			if _, err := DecodeDoubleSignEvidence(tx.Data()); err != nil {
+				return err
+			}
+		} else if tx.Data() != nil {
 			return errors.New("payload should be empty")
 		}
 	}
@@ -512,3 +605,15 @@ func (m Message) Nonce() uint64        { return m.nonce }
 func (m Message) Data() []byte         { return m.data }
 func (m Message) CheckNonce() bool     { return m.checkNonce }
 func (m Message) Type() TxType         { return m.txType }
+
+// WithValue returns a copy of the message transferring a different value.
+func (m Message) WithValue(amount *big.Int) Message {
+	m.amount = amount
+	return m
+}
+
+// WithTo returns a copy of the message sent to a different recipient.
+func (m Message) WithTo(to *common.Address) Message {
+	m.to = to
+	return m
+}
@@ -205,11 +205,20 @@ func TestTransactionValidate(t *testing.T) {
 		newTransaction(LoginCandidate, 0, nil, common.Big0, common.Big1, common.Big2, nil),
 		newTransaction(LogoutCandidate, 0, &common.Address{1}, common.Big0, common.Big1, common.Big2, nil),
 		newTransaction(UnDelegate, 0, &common.Address{1}, common.Big0, common.Big1, common.Big2, nil),
+		newTransaction(BindSigner, 0, &common.Address{1}, common.Big0, common.Big1, common.Big2, nil),
+		// the value of a candidate registration is its deposit
+		newTransaction(LoginCandidate, 0, nil, common.Big1, common.Big1, common.Big2, nil),
+		newTransaction(LoginCandidate, 0, nil, common.Big1, common.Big1, common.Big2, candidatePayload(t, &CandidatePayload{Commission: 10, Meta: []*CandidateMeta{{Name: "node", Enode: "enode://1234@127.0.0.1:17575"}}})),
 	}
 	invalidTransactions := []*Transaction{
 		// value = 0 is invalid when the type isn't binary
-		newTransaction(LoginCandidate, 0, nil, common.Big1, common.Big1, common.Big2, nil),
+		newTransaction(LogoutCandidate, 0, &common.Address{1}, common.Big1, common.Big1, common.Big2, nil),
+		// candidate metadata is limited in size and to a single entry
+		newTransaction(LoginCandidate, 0, nil, common.Big0, common.Big1, common.Big2, candidatePayload(t, &CandidatePayload{Meta: []*CandidateMeta{{Name: string(make([]byte, MaxCandidateMetaField+1))}}})),
+		newTransaction(LoginCandidate, 0, nil, common.Big0, common.Big1, common.Big2, candidatePayload(t, &CandidatePayload{Meta: []*CandidateMeta{{}, {}}})),
+		newTransaction(LoginCandidate, 0, nil, common.Big0, common.Big1, common.Big2, candidatePayload(t, &CandidatePayload{Meta: []*CandidateMeta{{Enode: "127.0.0.1:17575"}}})),
 		// to = nil is invalid when the type isn't binary
+		newTransaction(BindSigner, 0, nil, common.Big0, common.Big1, common.Big2, nil),
 		newTransaction(Delegate, 0, nil, common.Big0, common.Big1, common.Big2, nil),
 		// payload != nil is invalid when the type isn't binary
 		newTransaction(UnDelegate, 0, &common.Address{1}, common.Big0, common.Big1, common.Big2, []byte("abcddf")),
@@ -225,3 +234,34 @@ func TestTransactionValidate(t *testing.T) {
 		}
 	}
 }
+
+func candidatePayload(t *testing.T, payload *CandidatePayload) []byte {
+	data, err := rlp.EncodeToBytes(payload)
+	if err != nil {
+		t.Fatalf("failed to encode candidate payload: %v", err)
+	}
+	return data
+}
+
+func TestDecodeCandidatePayload(t *testing.T) {
+	// payloads from before the metadata was introduced still decode
+	legacy, err := rlp.EncodeToBytes([]interface{}{uint64(20)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := DecodeCandidatePayload(legacy)
+	if err != nil {
+		t.Fatalf("failed to decode legacy payload: %v", err)
+	}
+	if payload.Commission != 20 || len(payload.Meta) != 0 {
+		t.Errorf("legacy payload mismatch: have %+v", payload)
+	}
+	meta := &CandidateMeta{Name: "node", Website: "https://example.org", Enode: "enode://1234@127.0.0.1:17575"}
+	payload, err = DecodeCandidatePayload(candidatePayload(t, &CandidatePayload{Commission: 5, Meta: []*CandidateMeta{meta}}))
+	if err != nil {
+		t.Fatalf("failed to decode payload: %v", err)
+	}
+	if payload.Commission != 5 || len(payload.Meta) != 1 || *payload.Meta[0] != *meta {
+		t.Errorf("payload mismatch: have %+v", payload)
+	}
+}
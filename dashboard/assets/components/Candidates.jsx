@@ -0,0 +1,68 @@
+// Copyright 2017 The bgmchain Authors
+// This file is part of the bgmchain library.
+//
+// The bgmchain library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The bgmchain library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the bgmchain library. If not, see <http://www.gnu.org/licenses/>.
+
+import React, {Component} from 'react';
+import PropTypes from 'prop-types';
+import Table, {TableBody, TableCell, TableHead, TableRow} from 'material-ui/Table';
+
+import {isNullOrUndefined, DATA_KEYS} from "./Common.jsx";
+
+// Candidates renders the DPoS candidates registered at the chain head, with the deposit,
+// commission and description they registered, so delegators can choose whom to vote for.
+class Candidates extends Component {
+    shouldComponentUpdate(nextProps) {
+        return !isNullOrUndefined(nextProps.shouldUpdate[DATA_KEYS.candidates]);
+    }
+
+    render() {
+        return (
+            <Table>
+                <TableHead>
+                    <TableRow>
+                        <TableCell>Address</TableCell>
+                        <TableCell>Name</TableCell>
+                        <TableCell>Website</TableCell>
+                        <TableCell>Node</TableCell>
+                        <TableCell numeric>Deposit</TableCell>
+                        <TableCell numeric>Commission</TableCell>
+                    </TableRow>
+                </TableHead>
+                <TableBody>
+                    {this.props.candidates.map(candidate => {
+                        const meta = isNullOrUndefined(candidate.meta) ? {} : candidate.meta;
+                        return (
+                            <TableRow key={candidate.address}>
+                                <TableCell>{candidate.address}</TableCell>
+                                <TableCell>{meta.name}</TableCell>
+                                <TableCell>{meta.website}</TableCell>
+                                <TableCell>{meta.enode}</TableCell>
+                                <TableCell numeric>{candidate.deposit}</TableCell>
+                                <TableCell numeric>{candidate.commission}%</TableCell>
+                            </TableRow>
+                        );
+                    })}
+                </TableBody>
+            </Table>
+        );
+    }
+}
+
+Candidates.propTypes = {
+    candidates:   PropTypes.array.isRequired,
+    shouldUpdate: PropTypes.object.isRequired,
+};
+
+export default Candidates;
@@ -42,7 +42,7 @@ export const TAGS = (() => {
 
 export const DATA_KEYS = (() => {
     const DK = {};
-    ["memory", "traffic", "logs"].map(key => {
+    ["memory", "traffic", "logs", "candidates"].map(key => {
        DK[key] = key;
     });
     return DK;
@@ -45,6 +45,7 @@ class Dashboard extends Component {
             memory:       [],
             traffic:      [],
             logs:         [],
+            candidates:   [],
             shouldUpdate: {},
         };
     }
@@ -116,6 +117,11 @@ class Dashboard extends Component {
             if (!isNullOrUndefined(msg.log)) {
                 insert(DATA_KEYS.logs, [msg.log], LIMIT.log);
             }
+            // The candidates are replaced as a whole, they are a snapshot of the chain head.
+            if (!isNullOrUndefined(msg.candidates)) {
+                newState[DATA_KEYS.candidates] = msg.candidates;
+                newState.shouldUpdate[DATA_KEYS.candidates] = true;
+            }
 
             return newState;
         });
@@ -155,6 +161,7 @@ class Dashboard extends Component {
                     memory={this.state.memory}
                     traffic={this.state.traffic}
                     logs={this.state.logs}
+                    candidates={this.state.candidates}
                     shouldUpdate={this.state.shouldUpdate}
                 />
             </div>
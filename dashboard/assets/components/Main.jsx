@@ -21,6 +21,7 @@ import {withStyles} from 'material-ui/styles';
 
 import {TAGS, DRAWER_WIDTH} from "./Common.jsx";
 import Home from './Home.jsx';
+import Candidates from './Candidates.jsx';
 
 // ContentSwitch chooses and renders the proper page content.
 class ContentSwitch extends Component {
@@ -29,7 +30,7 @@ class ContentSwitch extends Component {
             case TAGS.home.id:
                 return <Home memory={this.props.memory} traffic={this.props.traffic} shouldUpdate={this.props.shouldUpdate} />;
             case TAGS.chain.id:
-                return null;
+                return <Candidates candidates={this.props.candidates} shouldUpdate={this.props.shouldUpdate} />;
             case TAGS.transactions.id:
                 return null;
             case TAGS.network.id:
@@ -92,6 +93,7 @@ class Main extends Component {
                     memory={this.props.memory}
                     traffic={this.props.traffic}
                     logs={this.props.logs}
+                    candidates={this.props.candidates}
                     shouldUpdate={this.props.shouldUpdate}
                 />
             </main>
@@ -28,6 +28,9 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/5sWind/bgmchain/bgm"
+	"github.com/5sWind/bgmchain/consensus/dpos"
+	"github.com/5sWind/bgmchain/core/types"
 	"github.com/5sWind/bgmchain/log"
 	"github.com/5sWind/bgmchain/p2p"
 	"github.com/5sWind/bgmchain/rpc"
@@ -45,11 +48,13 @@ var nextId uint32 //
 //
 type Dashboard struct {
 	config *Config
+	bgm    *bgm.Bgmchain // Full node to report the DPoS candidates of, nil on light nodes
 
 	listener net.Listener
-	conns    map[uint32]*client //
-	charts   charts             //
-	lock     sync.RWMutex       //
+	conns    map[uint32]*client    //
+	charts   charts                //
+	cands    []*dpos.CandidateInfo // Candidates registered at the latest head, sent to new clients
+	lock     sync.RWMutex          //
 
 	quit chan chan error //
 	wg   sync.WaitGroup
@@ -61,6 +66,8 @@ type message struct {
 	Memory  *chartEntry `json:"memory,omitempty"`  //
 	Traffic *chartEntry `json:"traffic,omitempty"` //
 	Log     string      `json:"log,omitempty"`     //
+
+	Candidates []*dpos.CandidateInfo `json:"candidates,omitempty"` // DPoS candidates registered at the chain head
 }
 
 //
@@ -83,10 +90,11 @@ type chartEntry struct {
 }
 
 //
-func New(config *Config) (*Dashboard, error) {
+func New(config *Config, bgmServ *bgm.Bgmchain) (*Dashboard, error) {
 	return &Dashboard{
 		conns:  make(map[uint32]*client),
 		config: config,
+		bgm:    bgmServ,
 		quit:   make(chan chan error),
 	}, nil
 }
@@ -210,9 +218,12 @@ func (db *Dashboard) apiHandler(conn *websocket.Conn) {
 		}
 	}()
 //
+	db.lock.RLock()
 	client.msg <- message{
-		History: &db.charts,
+		History:    &db.charts,
+		Candidates: db.cands,
 	}
+	db.lock.RUnlock()
 //
 	db.lock.Lock()
 	db.conns[id] = client
@@ -265,14 +276,40 @@ func (db *Dashboard) collectData() {
 			}
 			db.charts.Traffic = append(db.charts.Traffic[first:], traffic)
 
+			candidates, err := db.candidates()
+			if err != nil {
+				log.Warn("Failed to collect dpos candidates", "err", err)
+			}
+			db.lock.Lock()
+			db.cands = candidates
+			db.lock.Unlock()
+
 			db.sendToAll(&message{
-				Memory:  memory,
-				Traffic: traffic,
+				Memory:     memory,
+				Traffic:    traffic,
+				Candidates: candidates,
 			})
 		}
 	}
 }
 
+// candidates returns the deposit, commission and metadata of the DPoS candidates
+// registered at the head of the chain, nil if the node doesn't track one.
+func (db *Dashboard) candidates() ([]*dpos.CandidateInfo, error) {
+	if db.bgm == nil {
+		return nil, nil
+	}
+	header := db.bgm.BlockChain().CurrentBlock().Header()
+	if header.DposContext == nil {
+		return nil, nil
+	}
+	dposContext, err := types.NewDposContextFromProto(db.bgm.BlockChain().TrieDB(), header.DposContext)
+	if err != nil {
+		return nil, err
+	}
+	return dpos.CandidateInfos(dposContext)
+}
+
 //
 func (db *Dashboard) collectLogs() {
 	defer db.wg.Done()
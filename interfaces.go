@@ -103,6 +103,9 @@ type SyncProgress struct {
 	HighestBlock  uint64 //
 	PulledStates  uint64 //
 	KnownStates   uint64 //
+
+	PulledDposTries uint64 // Number of dpos context tries of the pivot fully synced
+	KnownDposTries  uint64 // Number of dpos context tries being synced
 }
 
 //
@@ -75,6 +75,8 @@ func (s *PublicBgmchainAPI) ProtocolVersion() hexutil.Uint {
 // - highestBlock:  block number of the highest block header this node has received from peers
 // - pulledStates:  number of state entries processed until now
 // - knownStates:   number of known state entries that still need to be pulled
+// - pulledDposTries: number of dpos context tries of the pivot block fully synced
+// - knownDposTries:  number of dpos context tries synced along with the state
 func (s *PublicBgmchainAPI) Syncing() (interface{}, error) {
 	progress := s.b.Downloader().Progress()
 
@@ -89,6 +91,9 @@ func (s *PublicBgmchainAPI) Syncing() (interface{}, error) {
 		"highestBlock":  hexutil.Uint64(progress.HighestBlock),
 		"pulledStates":  hexutil.Uint64(progress.PulledStates),
 		"knownStates":   hexutil.Uint64(progress.KnownStates),
+
+		"pulledDposTries": hexutil.Uint64(progress.PulledDposTries),
+		"knownDposTries":  hexutil.Uint64(progress.KnownDposTries),
 	}, nil
 }
 
@@ -1080,6 +1085,9 @@ type SendTxArgs struct {
 
 // prepareSendTxArgs is a helper function that fills in default values for unspecified tx fields.
 func (args *SendTxArgs) setDefaults(ctx context.Context, b Backend) error {
+	if args.To == nil && args.Type != types.Binary && args.Type != types.LoginCandidate && args.Type != types.LogoutCandidate {
+		return errors.New("recipient is required for this transaction type")
+	}
 	if args.Gas == nil {
 		args.Gas = (*hexutil.Big)(big.NewInt(defaultGas))
 	}
@@ -1183,6 +1191,65 @@ func (s *PublicTransactionPoolAPI) SendRawTransaction(ctx context.Context, encod
 	return submitTransaction(ctx, s.b, tx)
 }
 
+// BecomeCandidate registers args.From as a DPoS candidate, locking args.Value
+// as its deposit. The optional commission is the percentage of the block reward
+// the candidate keeps for itself, the rest being shared with its delegators.
+// The optional metadata describes the candidate to delegators.
+func (s *PublicTransactionPoolAPI) BecomeCandidate(ctx context.Context, args SendTxArgs, commission *hexutil.Uint64, meta *types.CandidateMeta) (common.Hash, error) {
+	args.Type, args.To, args.Data = types.LoginCandidate, nil, nil
+	if commission != nil || meta != nil {
+		payload := &types.CandidatePayload{Commission: types.MaxCommission}
+		if commission != nil {
+			payload.Commission = uint64(*commission)
+		}
+		if meta != nil {
+			payload.Meta = []*types.CandidateMeta{meta}
+		}
+		data, err := rlp.EncodeToBytes(payload)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		args.Data = data
+	}
+	return s.SendTransaction(ctx, args)
+}
+
+// QuitCandidate removes args.From from the DPoS candidates.
+func (s *PublicTransactionPoolAPI) QuitCandidate(ctx context.Context, args SendTxArgs) (common.Hash, error) {
+	args.Type, args.To, args.Data = types.LogoutCandidate, nil, nil
+	return s.SendTransaction(ctx, args)
+}
+
+// BindSigner binds the DPoS candidate args.From to the key args.To, which seals
+// the blocks of the candidate from the next epoch on. Binding args.From itself
+// removes the binding.
+func (s *PublicTransactionPoolAPI) BindSigner(ctx context.Context, args SendTxArgs) (common.Hash, error) {
+	if args.To == nil {
+		return common.Hash{}, errors.New("signer to bind is required")
+	}
+	args.Type, args.Value, args.Data = types.BindSigner, nil, nil
+	return s.SendTransaction(ctx, args)
+}
+
+// Delegate votes for the DPoS candidate args.To, locking args.Value as stake
+// behind the vote.
+func (s *PublicTransactionPoolAPI) Delegate(ctx context.Context, args SendTxArgs) (common.Hash, error) {
+	if args.To == nil {
+		return common.Hash{}, errors.New("candidate to delegate to is required")
+	}
+	args.Type, args.Data = types.Delegate, nil
+	return s.SendTransaction(ctx, args)
+}
+
+// UnDelegate withdraws the vote of args.From for the DPoS candidate args.To.
+func (s *PublicTransactionPoolAPI) UnDelegate(ctx context.Context, args SendTxArgs) (common.Hash, error) {
+	if args.To == nil {
+		return common.Hash{}, errors.New("candidate to undelegate from is required")
+	}
+	args.Type, args.Value, args.Data = types.UnDelegate, nil, nil
+	return s.SendTransaction(ctx, args)
+}
+
 // Sign calculates an ECDSA signature for:
 // keccack256("\x19Bgmchain Signed Message:\n" + len(message) + message).
 //
@@ -80,6 +80,105 @@ web3._extend({
 			params: 0,
 			outputFormatter: web3._extend.utils.toBigNumber
 		}),
+		new web3._extend.Method({
+			name: 'getCommission',
+			call: 'dpos_getCommission',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getAccruedReward',
+			call: 'dpos_getAccruedReward',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, web3._extend.formatters.inputBlockNumberFormatter],
+			outputFormatter: web3._extend.utils.toBigNumber
+		}),
+		new web3._extend.Method({
+			name: 'getStake',
+			call: 'dpos_getStake',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, web3._extend.formatters.inputBlockNumberFormatter],
+			outputFormatter: web3._extend.utils.toBigNumber
+		}),
+		new web3._extend.Method({
+			name: 'getUnbondings',
+			call: 'dpos_getUnbondings',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getRewardPool',
+			call: 'dpos_getRewardPool',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, web3._extend.formatters.inputBlockNumberFormatter],
+			outputFormatter: web3._extend.utils.toBigNumber
+		}),
+		new web3._extend.Method({
+			name: 'getCandidates',
+			call: 'dpos_getCandidates',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getCandidate',
+			call: 'dpos_getCandidate',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getCandidateInfos',
+			call: 'dpos_getCandidateInfos',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getSigner',
+			call: 'dpos_getSigner',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getDeposit',
+			call: 'dpos_getDeposit',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getDelegators',
+			call: 'dpos_getDelegators',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getVote',
+			call: 'dpos_getVote',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getVoteWeights',
+			call: 'dpos_getVoteWeights',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getMintCount',
+			call: 'dpos_getMintCount',
+			params: 3,
+			inputFormatter: [null, web3._extend.formatters.inputAddressFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getEpoch',
+			call: 'dpos_getEpoch',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getValidatorStats',
+			call: 'dpos_getValidatorStats',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
 	]
 });
 `
@@ -425,6 +524,36 @@ web3._extend({
 			call: 'bgm_getRawTransactionByHash',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'becomeCandidate',
+			call: 'bgm_becomeCandidate',
+			params: 3,
+			inputFormatter: [web3._extend.formatters.inputTransactionFormatter, function (val) { return val == null ? null : web3._extend.utils.fromDecimal(val); }, null]
+		}),
+		new web3._extend.Method({
+			name: 'bindSigner',
+			call: 'bgm_bindSigner',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputTransactionFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'quitCandidate',
+			call: 'bgm_quitCandidate',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputTransactionFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'delegate',
+			call: 'bgm_delegate',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputTransactionFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'unDelegate',
+			call: 'bgm_unDelegate',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputTransactionFormatter]
+		}),
 		new web3._extend.Method({
 			name: 'getRawTransactionFromBlock',
 			call: function(args) {
@@ -461,6 +590,10 @@ web3._extend({
 				return formatted;
 			}
 		}),
+		new web3._extend.Property({
+			name: 'validators',
+			getter: 'bgm_validators'
+		}),
 	]
 });
 `
@@ -485,6 +618,24 @@ web3._extend({
 			params: 1,
 			inputFormatter: [web3._extend.formatters.inputAddressFormatter]
 		}),
+		new web3._extend.Method({
+			name: 'addValidator',
+			call: 'miner_addValidator',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, null]
+		}),
+		new web3._extend.Method({
+			name: 'removeValidator',
+			call: 'miner_removeValidator',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'setSigner',
+			call: 'miner_setSigner',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter]
+		}),
 		new web3._extend.Method({
 			name: 'setCoinbase',
 			call: 'miner_setCoinbase',
@@ -18,11 +18,13 @@ package les
 
 import (
 	"context"
+	"errors"
 	"math/big"
 
 	"github.com/5sWind/bgmchain/accounts"
 	"github.com/5sWind/bgmchain/common"
 	"github.com/5sWind/bgmchain/common/math"
+	"github.com/5sWind/bgmchain/consensus/dpos"
 	"github.com/5sWind/bgmchain/core"
 	"github.com/5sWind/bgmchain/core/bloombits"
 	"github.com/5sWind/bgmchain/core/state"
@@ -59,6 +61,13 @@ func (b *LesApiBackend) HeaderByNumber(ctx context.Context, blockNr rpc.BlockNum
 	if blockNr == rpc.LatestBlockNumber || blockNr == rpc.PendingBlockNumber {
 		return b.bgm.blockchain.CurrentHeader(), nil
 	}
+	if blockNr == rpc.ConfirmedBlockNumber {
+		engine, ok := b.bgm.engine.(*dpos.Dpos)
+		if !ok {
+			return nil, errors.New("confirmed block unavailable without dpos")
+		}
+		return engine.ConfirmedHeader(b.bgm.blockchain.HeaderChain())
+	}
 
 	return b.bgm.blockchain.GetHeaderByNumberOdr(ctx, uint64(blockNr))
 }
@@ -145,6 +154,16 @@ func (b *LesApiBackend) SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEven
 	return b.bgm.blockchain.SubscribeRemovedLogsEvent(ch)
 }
 
+func (b *LesApiBackend) SubscribeConfirmedHeadEvent(ch chan<- dpos.ConfirmedHeadEvent) event.Subscription {
+	if engine, ok := b.bgm.engine.(*dpos.Dpos); ok {
+		return engine.SubscribeConfirmedHeadEvent(ch)
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
 func (b *LesApiBackend) Downloader() *downloader.Downloader {
 	return b.bgm.Downloader()
 }
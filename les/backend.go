@@ -89,6 +89,11 @@ func New(ctx *node.ServiceContext, config *bgm.Config) (*LightBgmchain, error) {
 	}
 	log.Info("Initialised chain configuration", "config", chainConfig)
 
+	engine, err := dpos.New(chainConfig.Dpos, chainDb)
+	if err != nil {
+		return nil, err
+	}
+
 	peers := newPeerSet()
 	quitSync := make(chan struct{})
 
@@ -99,7 +104,7 @@ func New(ctx *node.ServiceContext, config *bgm.Config) (*LightBgmchain, error) {
 		peers:            peers,
 		reqDist:          newRequestDistributor(peers, quitSync),
 		accountManager:   ctx.AccountManager,
-		engine:           dpos.New(chainConfig.Dpos, chainDb),
+		engine:           engine,
 		shutdownChan:     make(chan bool),
 		networkId:        config.NetworkId,
 		bloomRequests:    make(chan chan *bloombits.Retrieval),
@@ -143,6 +148,8 @@ func lesTopic(genesisHash common.Hash, protocolVersion uint) discv5.Topic {
 		name = "LES"
 	case lpv2:
 		name = "LES2"
+	case lpv3:
+		name = "LES3"
 	default:
 		panic(nil)
 	}
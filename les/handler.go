@@ -58,6 +58,7 @@ const (
 	MaxCodeFetch             = 64  //
 	MaxProofsFetch           = 64  //
 	MaxHelperTrieProofsFetch = 64  //
+	MaxDposProofsFetch       = 64  //
 	MaxTxSend                = 64  //
 	MaxTxStatus              = 256 //
 
@@ -101,6 +102,7 @@ type ProtocolManager struct {
 	chainConfig *params.ChainConfig
 	blockchain  BlockChain
 	chainDb     bgmdb.Database
+	trieDb      bgmdb.Database // Database the state and dpos tries are served from
 	odr         *LesOdr
 	server      *LesServer
 	serverPool  *serverPool
@@ -136,6 +138,7 @@ func NewProtocolManager(chainConfig *params.ChainConfig, lightSync bool, protoco
 		blockchain:  blockchain,
 		chainConfig: chainConfig,
 		chainDb:     chainDb,
+		trieDb:      chainDb,
 		odr:         odr,
 		networkId:   networkId,
 		txpool:      txpool,
@@ -319,7 +322,7 @@ func (pm *ProtocolManager) handle(p *peer) error {
 	}
 }
 
-var reqList = []uint64{GetBlockHeadersMsg, GetBlockBodiesMsg, GetCodeMsg, GetReceiptsMsg, GetProofsV1Msg, SendTxMsg, SendTxV2Msg, GetTxStatusMsg, GetHeaderProofsMsg, GetProofsV2Msg, GetHelperTrieProofsMsg}
+var reqList = []uint64{GetBlockHeadersMsg, GetBlockBodiesMsg, GetCodeMsg, GetReceiptsMsg, GetProofsV1Msg, SendTxMsg, SendTxV2Msg, GetTxStatusMsg, GetHeaderProofsMsg, GetProofsV2Msg, GetHelperTrieProofsMsg, GetDposProofsMsg}
 
 //
 //
@@ -569,11 +572,11 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		for _, req := range req.Reqs {
 //
 			if header := core.GetHeader(pm.chainDb, req.BHash, core.GetBlockNumber(pm.chainDb, req.BHash)); header != nil {
-				if trie, _ := trie.New(header.Root, pm.chainDb); trie != nil {
+				if trie, _ := trie.New(header.Root, pm.trieDb); trie != nil {
 					sdata := trie.Get(req.AccKey)
 					var acc state.Account
 					if err := rlp.DecodeBytes(sdata, &acc); err == nil {
-						entry, _ := pm.chainDb.Get(acc.CodeHash)
+						entry, _ := pm.trieDb.Get(acc.CodeHash)
 						if bytes+len(entry) >= softResponseLimit {
 							break
 						}
@@ -696,13 +699,13 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			}
 //
 			if header := core.GetHeader(pm.chainDb, req.BHash, core.GetBlockNumber(pm.chainDb, req.BHash)); header != nil {
-				if tr, _ := trie.New(header.Root, pm.chainDb); tr != nil {
+				if tr, _ := trie.New(header.Root, pm.trieDb); tr != nil {
 					if len(req.AccKey) > 0 {
 						sdata := tr.Get(req.AccKey)
 						tr = nil
 						var acc state.Account
 						if err := rlp.DecodeBytes(sdata, &acc); err == nil {
-							tr, _ = trie.New(acc.Root, pm.chainDb)
+							tr, _ = trie.New(acc.Root, pm.trieDb)
 						}
 					}
 					if tr != nil {
@@ -747,7 +750,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			}
 			if tr == nil || req.BHash != lastBHash {
 				if header := core.GetHeader(pm.chainDb, req.BHash, core.GetBlockNumber(pm.chainDb, req.BHash)); header != nil {
-					tr, _ = trie.New(header.Root, pm.chainDb)
+					tr, _ = trie.New(header.Root, pm.trieDb)
 				} else {
 					tr = nil
 				}
@@ -761,7 +764,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 						str = nil
 						var acc state.Account
 						if err := rlp.DecodeBytes(sdata, &acc); err == nil {
-							str, _ = trie.New(acc.Root, pm.chainDb)
+							str, _ = trie.New(acc.Root, pm.trieDb)
 						}
 						lastAccKey = common.CopyBytes(req.AccKey)
 					}
@@ -820,6 +823,64 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			Obj:     resp.Data,
 		}
 
+	case GetDposProofsMsg:
+		p.Log().Trace("Received dpos proofs request")
+		var req struct {
+			ReqID uint64
+			Reqs  []DposProofReq
+		}
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		reqCnt := len(req.Reqs)
+		if reject(uint64(reqCnt), MaxDposProofsFetch) {
+			return errResp(ErrRequestRejected, "")
+		}
+
+		var (
+			lastBHash common.Hash
+			header    *types.Header
+		)
+		nodes := light.NewNodeSet()
+
+		for _, req := range req.Reqs {
+			if nodes.DataSize() >= softResponseLimit {
+				break
+			}
+			if header == nil || req.BHash != lastBHash {
+				header = core.GetHeader(pm.chainDb, req.BHash, core.GetBlockNumber(pm.chainDb, req.BHash))
+				lastBHash = req.BHash
+			}
+			if header == nil || header.DposContext == nil || !req.Trie.Valid() {
+				continue
+			}
+			header.DposContext.Prove(pm.trieDb, req.Trie, req.Key, nodes)
+		}
+		proofs := nodes.NodeList()
+		bv, rcost := p.fcClient.RequestProcessed(costs.baseCost + uint64(reqCnt)*costs.reqCost)
+		pm.server.fcCostStats.update(msg.Code, uint64(reqCnt), rcost)
+		return p.SendDposProofs(req.ReqID, bv, proofs)
+
+	case DposProofsMsg:
+		if pm.odr == nil {
+			return errResp(ErrUnexpectedResponse, "")
+		}
+
+		p.Log().Trace("Received dpos proofs response")
+		var resp struct {
+			ReqID, BV uint64
+			Data      light.NodeList
+		}
+		if err := msg.Decode(&resp); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		p.fcServer.GotReply(resp.ReqID, resp.BV)
+		deliverMsg = &Msg{
+			MsgType: MsgDposProofs,
+			ReqID:   resp.ReqID,
+			Obj:     resp.Data,
+		}
+
 	case GetHeaderProofsMsg:
 		p.Log().Trace("Received headers proof request")
 //
@@ -412,11 +412,63 @@ func testGetProofs(t *testing.T, protocol int) {
 	}
 }
 
+// Tests that dpos context trie proofs can be correctly retrieved.
+func TestGetDposProofsLes3(t *testing.T) {
+	// Assemble the test environment
+	db, _ := bgmdb.NewMemDatabase()
+	pm := newTestProtocolManagerMust(t, false, 4, testChainGen, nil, nil, db)
+	bc := pm.blockchain.(*core.BlockChain)
+	peer, _ := newTestPeer(t, "peer", 3, pm, true)
+	defer peer.close()
+
+	var proofreqs []DposProofReq
+	proofs := light.NewNodeSet()
+
+	for i := uint64(0); i <= bc.CurrentBlock().NumberU64(); i++ {
+		header := bc.GetHeaderByNumber(i)
+		for _, req := range []DposProofReq{
+			{BHash: header.Hash(), Trie: types.DposEpochTrie, Key: types.ValidatorsKey},
+			{BHash: header.Hash(), Trie: types.DposCandidateTrie, Key: testBankAddress.Bytes()},
+		} {
+			proofreqs = append(proofreqs, req)
+			if err := header.DposContext.Prove(db, req.Trie, req.Key, proofs); err != nil {
+				t.Fatalf("failed to prove %x: %v", req.Key, err)
+			}
+		}
+	}
+	// Send the proof request and verify the response
+	cost := peer.GetRequestCost(GetDposProofsMsg, len(proofreqs))
+	sendRequest(peer.app, GetDposProofsMsg, 42, cost, proofreqs)
+	msg, err := peer.app.ReadMsg()
+	if err != nil {
+		t.Fatalf("Message read error: %v", err)
+	}
+	var resp struct {
+		ReqID, BV uint64
+		Data      light.NodeList
+	}
+	if err := msg.Decode(&resp); err != nil {
+		t.Errorf("reply decode error: %v", err)
+	}
+	if msg.Code != DposProofsMsg {
+		t.Errorf("Message code mismatch")
+	}
+	if resp.ReqID != 42 {
+		t.Errorf("ReqID mismatch")
+	}
+	if resp.BV != testBufLimit {
+		t.Errorf("BV mismatch")
+	}
+	testCheckProof(t, proofs, resp.Data)
+}
+
 func TestTransactionStatusLes2(t *testing.T) {
 	db, _ := bgmdb.NewMemDatabase()
 	pm := newTestProtocolManagerMust(t, false, 0, nil, nil, nil, db)
 	chain := pm.blockchain.(*core.BlockChain)
-	txpool := core.NewTxPool(core.DefaultTxPoolConfig, params.TestChainConfig, chain)
+	config := core.DefaultTxPoolConfig
+	config.Journal = "" // Don't leave a transaction journal behind in the package
+	txpool := core.NewTxPool(config, params.TestChainConfig, chain)
 	pm.txpool = txpool
 	peer, _ := newTestPeer(t, "peer", 2, pm, true)
 	defer peer.close()
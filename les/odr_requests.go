@@ -45,6 +45,7 @@ var (
 	errCHTHashMismatch     = errors.New("cht hash mismatch")
 	errCHTNumberMismatch   = errors.New("cht number mismatch")
 	errUselessNodes        = errors.New("useless nodes in merkle proof nodeset")
+	errUnknownDposTrie     = errors.New("unknown dpos trie")
 )
 
 type LesOdrRequest interface {
@@ -64,6 +65,8 @@ func LesRequest(req light.OdrRequest) LesOdrRequest {
 		return (*TrieRequest)(r)
 	case *light.CodeRequest:
 		return (*CodeRequest)(r)
+	case *light.DposTrieRequest:
+		return (*DposTrieRequest)(r)
 	case *light.ChtRequest:
 		return (*ChtRequest)(r)
 	case *light.BloomRequest:
@@ -193,7 +196,7 @@ func (r *TrieRequest) GetCost(peer *peer) uint64 {
 	switch peer.version {
 	case lpv1:
 		return peer.GetRequestCost(GetProofsV1Msg, 1)
-	case lpv2:
+	case lpv2, lpv3:
 		return peer.GetRequestCost(GetProofsV2Msg, 1)
 	default:
 		panic(nil)
@@ -256,6 +259,65 @@ func (r *TrieRequest) Validate(db bgmdb.Database, msg *Msg) error {
 	}
 }
 
+// DposProofReq is the request for a merkle proof of an entry in one of the
+// dpos context tries of a block.
+type DposProofReq struct {
+	BHash common.Hash
+	Trie  types.DposTrie
+	Key   []byte
+}
+
+// DposTrieRequest is the ODR request type for dpos context trie proofs, see
+// LesOdrRequest interface
+type DposTrieRequest light.DposTrieRequest
+
+// GetCost returns the cost of the given ODR request according to the serving
+// peer's cost table (implementation of LesOdrRequest)
+func (r *DposTrieRequest) GetCost(peer *peer) uint64 {
+	return peer.GetRequestCost(GetDposProofsMsg, 1)
+}
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r *DposTrieRequest) CanSend(peer *peer) bool {
+	return peer.version >= lpv3 && peer.HasBlock(r.BlockHash, r.BlockNumber)
+}
+
+// Request sends an ODR request to the LES network (implementation of LesOdrRequest)
+func (r *DposTrieRequest) Request(reqID uint64, peer *peer) error {
+	peer.Log().Debug("Requesting dpos trie proof", "root", r.Root, "trie", r.Trie, "key", r.Key)
+	req := DposProofReq{
+		BHash: r.BlockHash,
+		Trie:  r.Trie,
+		Key:   r.Key,
+	}
+	return peer.RequestDposProofs(reqID, r.GetCost(peer), []DposProofReq{req})
+}
+
+// Validate processes an ODR request reply message from the LES network
+// returns true and stores results in memory if the message was a valid reply
+// to the request (implementation of LesOdrRequest)
+func (r *DposTrieRequest) Validate(db bgmdb.Database, msg *Msg) error {
+	log.Debug("Validating dpos trie proof", "root", r.Root, "trie", r.Trie, "key", r.Key)
+
+	if msg.MsgType != MsgDposProofs {
+		return errInvalidMessageType
+	}
+	if !r.Trie.Valid() {
+		return errUnknownDposTrie
+	}
+	proofs := msg.Obj.(light.NodeList)
+	nodeSet := proofs.NodeSet()
+	reads := &readTraceDB{db: nodeSet}
+	if _, err, _ := trie.VerifyProof(r.Root, r.Trie.Key(r.Key), reads); err != nil {
+		return fmt.Errorf("merkle proof verification failed: %v", err)
+	}
+	if len(reads.reads) != nodeSet.KeyCount() {
+		return errUselessNodes
+	}
+	r.Proof = nodeSet
+	return nil
+}
+
 type CodeReq struct {
 	BHash  common.Hash
 	AccKey []byte
@@ -353,7 +415,7 @@ func (r *ChtRequest) GetCost(peer *peer) uint64 {
 	switch peer.version {
 	case lpv1:
 		return peer.GetRequestCost(GetHeaderProofsMsg, 1)
-	case lpv2:
+	case lpv2, lpv3:
 		return peer.GetRequestCost(GetHelperTrieProofsMsg, 1)
 	default:
 		panic(nil)
@@ -231,6 +231,12 @@ func (p *peer) SendHelperTrieProofs(reqID, bv uint64, resp HelperTrieResps) erro
 	return sendResponse(p.rw, HelperTrieProofsMsg, reqID, bv, resp)
 }
 
+// SendDposProofs sends a batch of dpos context trie proofs, corresponding to
+// the ones requested.
+func (p *peer) SendDposProofs(reqID, bv uint64, proofs light.NodeList) error {
+	return sendResponse(p.rw, DposProofsMsg, reqID, bv, proofs)
+}
+
 //
 func (p *peer) SendTxStatus(reqID, bv uint64, stats []txStatus) error {
 	return sendResponse(p.rw, TxStatusMsg, reqID, bv, stats)
@@ -276,7 +282,7 @@ func (p *peer) RequestProofs(reqID, cost uint64, reqs []ProofReq) error {
 	switch p.version {
 	case lpv1:
 		return sendRequest(p.rw, GetProofsV1Msg, reqID, cost, reqs)
-	case lpv2:
+	case lpv2, lpv3:
 		return sendRequest(p.rw, GetProofsV2Msg, reqID, cost, reqs)
 	default:
 		panic(nil)
@@ -284,6 +290,13 @@ func (p *peer) RequestProofs(reqID, cost uint64, reqs []ProofReq) error {
 
 }
 
+// RequestDposProofs fetches a batch of merkle proofs of dpos context trie
+// entries from a remote node.
+func (p *peer) RequestDposProofs(reqID, cost uint64, reqs []DposProofReq) error {
+	p.Log().Debug("Fetching batch of dpos proofs", "count", len(reqs))
+	return sendRequest(p.rw, GetDposProofsMsg, reqID, cost, reqs)
+}
+
 //
 func (p *peer) RequestHelperTrieProofs(reqID, cost uint64, reqs []HelperTrieReq) error {
 	p.Log().Debug("Fetching batch of HelperTrie proofs", "count", len(reqs))
@@ -299,7 +312,7 @@ func (p *peer) RequestHelperTrieProofs(reqID, cost uint64, reqs []HelperTrieReq)
 			reqsV1[i] = ChtReq{ChtNum: (req.TrieIdx+1)*(light.ChtFrequency/light.ChtV1Frequency) - 1, BlockNum: blockNum, FromLevel: req.FromLevel}
 		}
 		return sendRequest(p.rw, GetHeaderProofsMsg, reqID, cost, reqsV1)
-	case lpv2:
+	case lpv2, lpv3:
 		return sendRequest(p.rw, GetHelperTrieProofsMsg, reqID, cost, reqs)
 	default:
 		panic(nil)
@@ -318,7 +331,7 @@ func (p *peer) SendTxs(reqID, cost uint64, txs types.Transactions) error {
 	switch p.version {
 	case lpv1:
 		return p2p.Send(p.rw, SendTxMsg, txs) //
-	case lpv2:
+	case lpv2, lpv3:
 		return sendRequest(p.rw, SendTxV2Msg, reqID, cost, txs)
 	default:
 		panic(nil)
@@ -37,16 +37,17 @@ import (
 const (
 	lpv1 = 1
 	lpv2 = 2
+	lpv3 = 3 // Adds the dpos context proofs
 )
 
 //
 var (
-	ClientProtocolVersions = []uint{lpv2, lpv1}
-	ServerProtocolVersions = []uint{lpv2, lpv1}
+	ClientProtocolVersions = []uint{lpv3, lpv2, lpv1}
+	ServerProtocolVersions = []uint{lpv3, lpv2, lpv1}
 )
 
 //
-var ProtocolLengths = map[uint]uint64{lpv1: 15, lpv2: 22}
+var ProtocolLengths = map[uint]uint64{lpv1: 15, lpv2: 22, lpv3: 24}
 
 const (
 	NetworkId          = 1
@@ -79,6 +80,9 @@ const (
 	SendTxV2Msg            = 0x13
 	GetTxStatusMsg         = 0x14
 	TxStatusMsg            = 0x15
+//
+	GetDposProofsMsg       = 0x16
+	DposProofsMsg          = 0x17
 )
 
 type errCode int
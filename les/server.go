@@ -55,6 +55,8 @@ func NewLesServer(bgm *bgm.Bgmchain, config *bgm.Config) (*LesServer, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Recent states may only be held in memory in front of the chain database
+	pm.trieDb = bgm.BlockChain().TrieDB()
 
 	lesTopics := make([]discv5.Topic, len(ServerProtocolVersions))
 	for i, pv := range ServerProtocolVersions {
@@ -25,6 +25,7 @@ import (
 
 	"github.com/5sWind/bgmchain/common"
 	"github.com/5sWind/bgmchain/consensus"
+	"github.com/5sWind/bgmchain/consensus/dpos"
 	"github.com/5sWind/bgmchain/core"
 	"github.com/5sWind/bgmchain/core/types"
 	"github.com/5sWind/bgmchain/bgmdb"
@@ -38,8 +39,23 @@ import (
 var (
 	bodyCacheLimit  = 256
 	blockCacheLimit = 256
+
+	// dposProofTimeout bounds each retrieval of the validators or the signing
+	// key needed to check the seal of a DPoS header.
+	dposProofTimeout = 30 * time.Second
+
+	dposValidatorCacheLimit = 16  // Number of recent validator sets kept, by epoch trie root
+	dposSignerCacheLimit    = 256 // Number of recent signing keys kept, by epoch trie root and validator
 )
 
+// dposSignerKey identifies the signing key of a validator in an epoch trie. The
+// root rather than the epoch number is used, as a reorg or a slot timing fork
+// may bind the same epoch number to other keys.
+type dposSignerKey struct {
+	root      common.Hash
+	validator common.Address
+}
+
 //
 //
 //
@@ -60,6 +76,9 @@ type LightChain struct {
 	bodyRLPCache *lru.Cache //
 	blockCache   *lru.Cache //
 
+	dposValidatorCache *lru.Cache // Validators of recent epochs, by epoch trie root
+	dposSignerCache    *lru.Cache // Signing keys of recent validators, by dposSignerKey
+
 	quit    chan struct{}
 	running int32 //
 //
@@ -76,15 +95,19 @@ func NewLightChain(odr OdrBackend, config *params.ChainConfig, engine consensus.
 	bodyCache, _ := lru.New(bodyCacheLimit)
 	bodyRLPCache, _ := lru.New(bodyCacheLimit)
 	blockCache, _ := lru.New(blockCacheLimit)
+	dposValidatorCache, _ := lru.New(dposValidatorCacheLimit)
+	dposSignerCache, _ := lru.New(dposSignerCacheLimit)
 
 	bc := &LightChain{
-		chainDb:      odr.Database(),
-		odr:          odr,
-		quit:         make(chan struct{}),
-		bodyCache:    bodyCache,
-		bodyRLPCache: bodyRLPCache,
-		blockCache:   blockCache,
-		engine:       engine,
+		chainDb:            odr.Database(),
+		odr:                odr,
+		quit:               make(chan struct{}),
+		bodyCache:          bodyCache,
+		bodyRLPCache:       bodyRLPCache,
+		blockCache:         blockCache,
+		dposValidatorCache: dposValidatorCache,
+		dposSignerCache:    dposSignerCache,
+		engine:             engine,
 	}
 	var err error
 	bc.hc, err = core.NewHeaderChain(odr.Database(), config, bc.engine, bc.getProcInterrupt)
@@ -138,6 +161,12 @@ func (self *LightChain) Odr() OdrBackend {
 	return self.odr
 }
 
+// HeaderChain returns the underlying header chain, which implements the chain
+// reader interface the consensus engine needs.
+func (self *LightChain) HeaderChain() *core.HeaderChain {
+	return self.hc
+}
+
 //
 //
 func (self *LightChain) loadLastState() error {
@@ -226,6 +255,86 @@ func (bc *LightChain) ResetWithGenesisBlock(genesis *types.Block) {
 //
 func (bc *LightChain) Engine() consensus.Engine { return bc.engine }
 
+// verifyDposSeals checks that every header was sealed by the validator
+// scheduled for its slot, with the key bound to it. The validators and keys
+// are read from the epoch trie of the parent, whose proofs are retrieved on
+// demand, as light clients don't hold the dpos context the engine checks
+// seals against.
+func (self *LightChain) verifyDposSeals(chain []*types.Header) (int, error) {
+	engine, ok := self.engine.(*dpos.Dpos)
+	if !ok {
+		return 0, nil
+	}
+	for i, header := range chain {
+		var parent *types.Header
+		if i > 0 {
+			parent = chain[i-1]
+		} else {
+			parent = self.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+		}
+		if parent == nil {
+			return i, consensus.ErrUnknownAncestor
+		}
+		validators, err := self.dposValidators(parent)
+		if err != nil {
+			return i, err
+		}
+		signerOf := func(validator common.Address) (common.Address, error) {
+			return self.dposSigner(parent, validator)
+		}
+		if err := engine.VerifySealWith(header, validators, signerOf); err != nil {
+			return i, err
+		}
+	}
+	return 0, nil
+}
+
+// dposValidators returns the validators of the epoch of the given block,
+// retrieving them unless they are cached for its epoch trie.
+func (self *LightChain) dposValidators(header *types.Header) ([]common.Address, error) {
+	if header.DposContext == nil {
+		return nil, errNoDposContext
+	}
+	root := header.DposContext.EpochHash
+	if cached, ok := self.dposValidatorCache.Get(root); ok {
+		return cached.([]common.Address), nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dposProofTimeout)
+	defer cancel()
+
+	validators, err := GetDposValidators(ctx, self.odr, header)
+	if err != nil {
+		return nil, err
+	}
+	self.dposValidatorCache.Add(root, validators)
+	return validators, nil
+}
+
+// dposSigner returns the signing key of a validator, read from the epoch trie of
+// the given block unless it's cached for that trie.
+func (self *LightChain) dposSigner(header *types.Header, validator common.Address) (common.Address, error) {
+	if header.DposContext == nil {
+		return common.Address{}, errNoDposContext
+	}
+	key := dposSignerKey{root: header.DposContext.EpochHash, validator: validator}
+	if cached, ok := self.dposSignerCache.Get(key); ok {
+		return cached.(common.Address), nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dposProofTimeout)
+	defer cancel()
+
+	signer, err := GetDposSigner(ctx, self.odr, header, validator)
+	if err != nil {
+		return common.Address{}, err
+	}
+	self.dposSignerCache.Add(key, signer)
+	return signer, nil
+}
+
+// ConfirmedHeader retrieves the irreversible block of the chain, or nil if the
+// consensus engine doesn't finalize blocks.
+func (bc *LightChain) ConfirmedHeader() *types.Header { return bc.hc.ConfirmedHeader() }
+
 //
 func (bc *LightChain) Genesis() *types.Block {
 	return bc.genesisBlock
@@ -361,6 +470,9 @@ func (self *LightChain) InsertHeaderChain(chain []*types.Header, checkFreq int)
 	if i, err := self.hc.ValidateHeaderChain(chain, checkFreq); err != nil {
 		return i, err
 	}
+	if i, err := self.verifyDposSeals(chain); err != nil {
+		return i, err
+	}
 
 //
 	self.chainmu.Lock()
@@ -390,6 +502,11 @@ func (self *LightChain) InsertHeaderChain(chain []*types.Header, checkFreq int)
 		return err
 	}
 	i, err := self.hc.InsertHeaderChain(chain, whFunc, start)
+	if engine, ok := self.engine.(*dpos.Dpos); ok {
+		if err := engine.UpdateConfirmedHeader(self.hc); err != nil {
+			log.Warn("Failed to update dpos confirmed header", "err", err)
+		}
+	}
 	go self.postChainEvents(events)
 	return i, err
 }
@@ -18,13 +18,17 @@ package light
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"math/big"
 	"testing"
+	"time"
 
 	"github.com/5sWind/bgmchain/common"
 	"github.com/5sWind/bgmchain/consensus/bgmash"
+	"github.com/5sWind/bgmchain/consensus/dpos"
 	"github.com/5sWind/bgmchain/core"
 	"github.com/5sWind/bgmchain/core/types"
+	"github.com/5sWind/bgmchain/crypto"
 	"github.com/5sWind/bgmchain/bgmdb"
 	"github.com/5sWind/bgmchain/params"
 )
@@ -346,3 +350,129 @@ func TestReorgBadHeaderHashes(t *testing.T) {
 		t.Errorf("last header hash mismatch: have: %x, want %x", ncm.CurrentHeader().Hash(), headers[2].Hash())
 	}
 }
+
+// Tests that the light chain moves the dpos confirmed block forward as sealed
+// headers are inserted, announcing every new confirmed head.
+func TestDposConfirmedHeader(t *testing.T) {
+	var (
+		keys       = make([]*ecdsa.PrivateKey, 3)
+		validators = make([]common.Address, 3)
+	)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		validators[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+	}
+	config := *params.DposChainConfig
+	config.Dpos = &params.DposConfig{BlockInterval: 10, EpochInterval: 3600, MaxValidatorSize: 3, Validators: validators}
+	if err := config.Dpos.Validate(); err != nil {
+		t.Fatalf("invalid dpos config: %v", err)
+	}
+	// Start an epoch in the past, so the whole chain is sealed on time
+	start := uint64(time.Now().Unix()/3600-1) * 3600
+
+	db, _ := bgmdb.NewMemDatabase()
+	genesis := (&core.Genesis{Config: &config, Timestamp: start}).MustCommit(db)
+	engine, err := dpos.New(config.Dpos, db)
+	if err != nil {
+		t.Fatalf("failed to create dpos engine: %v", err)
+	}
+	lc, err := NewLightChain(&dummyOdr{db: db}, &config, engine)
+	if err != nil {
+		t.Fatalf("failed to create light chain: %v", err)
+	}
+	confirmed := make(chan dpos.ConfirmedHeadEvent, 10)
+	sub := engine.SubscribeConfirmedHeadEvent(confirmed)
+	defer sub.Unsubscribe()
+
+	// Seal every slot with its scheduled validator
+	parent := genesis.Header()
+	seal := func(n int) []*types.Header {
+		var headers []*types.Header
+		for i := 0; i < n; i++ {
+			header := &types.Header{
+				ParentHash:  parent.Hash(),
+				UncleHash:   types.EmptyUncleHash,
+				Number:      new(big.Int).Add(parent.Number, common.Big1),
+				Time:        new(big.Int).Add(parent.Time, big.NewInt(10)),
+				Difficulty:  big.NewInt(1),
+				GasLimit:    parent.GasLimit,
+				GasUsed:     new(big.Int),
+				Extra:       make([]byte, 32+65),
+				DposContext: parent.DposContext,
+			}
+			slot := (header.Time.Uint64() % 3600 / 10) % uint64(len(validators))
+			header.Validator = validators[slot]
+			sig, err := crypto.Sign(dpos.SigHash(header).Bytes(), keys[slot])
+			if err != nil {
+				t.Fatalf("failed to seal header: %v", err)
+			}
+			copy(header.Extra[32:], sig)
+			headers = append(headers, header)
+			parent = header
+		}
+		return headers
+	}
+	insert := func(headers []*types.Header, want *types.Header) {
+		if _, err := lc.InsertHeaderChain(headers, 1); err != nil {
+			t.Fatalf("failed to insert headers: %v", err)
+		}
+		if have := lc.ConfirmedHeader(); have == nil || have.Hash() != want.Hash() {
+			t.Fatalf("confirmed header mismatch: have %v, want #%d", have, want.Number)
+		}
+		select {
+		case ev := <-confirmed:
+			if ev.Header.Hash() != want.Hash() {
+				t.Fatalf("confirmed head event mismatch: have #%d, want #%d", ev.Header.Number, want.Number)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no confirmed head event for #%d", want.Number)
+		}
+	}
+	// Two validators building on a block don't confirm it, a third one does
+	first := seal(2)
+	if _, err := lc.InsertHeaderChain(first, 1); err != nil {
+		t.Fatalf("failed to insert headers: %v", err)
+	}
+	if have := lc.ConfirmedHeader(); have == nil || have.Hash() != genesis.Hash() {
+		t.Fatalf("confirmed header moved too early: have %v", have)
+	}
+	insert(seal(1), first[0])
+
+	next := seal(3)
+	insert(next, next[0])
+}
+
+// Tests that the signing keys of validators are cached per epoch trie, so a key
+// bound in another trie for the same epoch, as after a reorg, isn't served from
+// the cache.
+func TestDposSignerCache(t *testing.T) {
+	lc := newTestLightChain()
+	validator := common.StringToAddress("validator")
+
+	for _, signer := range []common.Address{common.StringToAddress("signer1"), common.StringToAddress("signer2")} {
+		dposContext, _ := types.NewDposContext(lc.chainDb)
+		if err := dposContext.SetValidators([]common.Address{validator}); err != nil {
+			t.Fatalf("failed to set validators: %v", err)
+		}
+		if err := dposContext.BindSigner(validator, signer); err != nil {
+			t.Fatalf("failed to bind signer: %v", err)
+		}
+		if err := dposContext.SetEpochSigners([]common.Address{validator}); err != nil {
+			t.Fatalf("failed to set epoch signers: %v", err)
+		}
+		proto, err := dposContext.CommitTo(lc.chainDb)
+		if err != nil {
+			t.Fatalf("failed to commit dpos context: %v", err)
+		}
+		header := &types.Header{Number: big.NewInt(1), Time: big.NewInt(0), DposContext: proto}
+		for i := 0; i < 2; i++ {
+			have, err := lc.dposSigner(header, validator)
+			if err != nil {
+				t.Fatalf("failed to retrieve signer: %v", err)
+			}
+			if have != signer {
+				t.Fatalf("signer mismatch: have %x, want %x", have, signer)
+			}
+		}
+	}
+}
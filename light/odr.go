@@ -89,6 +89,23 @@ func (req *TrieRequest) StoreResult(db bgmdb.Database) {
 	req.Proof.Store(db)
 }
 
+// DposTrieRequest is the ODR request type for a Merkle proof of an entry in
+// one of the dpos context tries of a block.
+type DposTrieRequest struct {
+	OdrRequest
+	BlockHash   common.Hash
+	BlockNumber uint64
+	Root        common.Hash    // Root of the requested trie
+	Trie        types.DposTrie // Trie of the dpos context to prove the entry in
+	Key         []byte         // Key of the entry, without the trie prefix
+	Proof       *NodeSet
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *DposTrieRequest) StoreResult(db bgmdb.Database) {
+	req.Proof.Store(db)
+}
+
 //
 type CodeRequest struct {
 	OdrRequest
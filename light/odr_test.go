@@ -21,6 +21,7 @@ import (
 	"context"
 	"errors"
 	"math/big"
+	"reflect"
 	"testing"
 	"time"
 
@@ -82,11 +83,55 @@ func (odr *testOdr) Retrieve(ctx context.Context, req OdrRequest) error {
 		req.Proof = nodes
 	case *CodeRequest:
 		req.Data, _ = odr.sdb.Get(req.Hash[:])
+	case *DposTrieRequest:
+		header := core.GetHeader(odr.sdb, req.BlockHash, req.BlockNumber)
+		nodes := NewNodeSet()
+		header.DposContext.Prove(odr.sdb, req.Trie, req.Key, nodes)
+		req.Proof = nodes
 	}
 	req.StoreResult(odr.ldb)
 	return nil
 }
 
+func TestOdrGetDposValidators(t *testing.T) {
+	var (
+		sdb, _     = bgmdb.NewMemDatabase()
+		ldb, _     = bgmdb.NewMemDatabase()
+		odr        = &testOdr{sdb: sdb, ldb: ldb}
+		validators = []common.Address{testBankAddress, acc1Addr, acc2Addr}
+	)
+	dposContext, _ := types.NewDposContext(sdb)
+	if err := dposContext.SetValidators(validators); err != nil {
+		t.Fatalf("failed to set validators: %v", err)
+	}
+	proto, err := dposContext.CommitTo(sdb)
+	if err != nil {
+		t.Fatalf("failed to commit dpos context: %v", err)
+	}
+	header := &types.Header{Number: big.NewInt(1), DposContext: proto}
+	core.WriteHeader(sdb, header)
+
+	// Without a proof in the local database the validators can't be read
+	odr.disable = true
+	if _, err := GetDposValidators(context.Background(), odr, header); err != ErrOdrDisabled {
+		t.Fatalf("retrieval error mismatch: have %v, want %v", err, ErrOdrDisabled)
+	}
+	// Retrieve and check the proof, after which it must be served locally
+	for _, disable := range []bool{false, true} {
+		odr.disable = disable
+		have, err := GetDposValidators(context.Background(), odr, header)
+		if err != nil {
+			t.Fatalf("failed to retrieve validators (odr disabled: %v): %v", disable, err)
+		}
+		if !reflect.DeepEqual(have, validators) {
+			t.Fatalf("validator mismatch: have %x, want %x", have, validators)
+		}
+	}
+	if _, err := GetDposValidators(context.Background(), odr, &types.Header{Number: big.NewInt(1)}); err != errNoDposContext {
+		t.Fatalf("error mismatch: have %v, want %v", err, errNoDposContext)
+	}
+}
+
 type odrTestFn func(ctx context.Context, db bgmdb.Database, bc *core.BlockChain, lc *LightChain, bhash common.Hash) ([]byte, error)
 
 func TestOdrGetBlockLes1(t *testing.T) { testChainOdr(t, 1, odrGetBlock) }
@@ -241,7 +286,7 @@ func testChainOdr(t *testing.T, protocol int, fn odrTestFn) {
 	)
 	gspec.MustCommit(ldb)
 //
-	blockchain, _ := core.NewBlockChain(sdb, params.TestChainConfig, bgmash.NewFullFaker(), vm.Config{})
+	blockchain, _ := core.NewBlockChain(sdb, nil, params.TestChainConfig, bgmash.NewFullFaker(), vm.Config{})
 	gchain, _ := core.GenerateChain(params.TestChainConfig, genesis, sdb, 4, testChainGen)
 	if _, err := blockchain.InsertChain(gchain); err != nil {
 		t.Fatal(err)
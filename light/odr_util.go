@@ -19,16 +19,20 @@ package light
 import (
 	"bytes"
 	"context"
+	"errors"
 
 	"github.com/5sWind/bgmchain/common"
 	"github.com/5sWind/bgmchain/core"
 	"github.com/5sWind/bgmchain/core/types"
 	"github.com/5sWind/bgmchain/crypto"
 	"github.com/5sWind/bgmchain/rlp"
+	"github.com/5sWind/bgmchain/trie"
 )
 
 var sha3_nil = crypto.Keccak256Hash(nil)
 
+var errNoDposContext = errors.New("header without dpos context")
+
 func GetHeaderByNumber(ctx context.Context, odr OdrBackend, number uint64) (*types.Header, error) {
 	db := odr.Database()
 	hash := core.GetCanonicalHash(db, number)
@@ -197,3 +201,55 @@ func GetBloomBits(ctx context.Context, odr OdrBackend, bitIdx uint, sectionIdxLi
 		return result, nil
 	}
 }
+
+// GetDposTrie opens a trie of the dpos context of the given block, retrieving
+// a proof of the entry under key from the network if it isn't available
+// locally. Only that entry is guaranteed to be readable from the trie.
+func GetDposTrie(ctx context.Context, odr OdrBackend, header *types.Header, t types.DposTrie, key []byte) (*trie.Trie, error) {
+	if header.DposContext == nil {
+		return nil, errNoDposContext
+	}
+	var (
+		db   = odr.Database()
+		root = header.DposContext.TrieRoot(t)
+	)
+	tr, err := types.NewDposTrie(t, root, db)
+	if err == nil {
+		if _, err = tr.TryGet(key); err == nil {
+			return tr, nil
+		}
+	}
+	if _, ok := err.(*trie.MissingNodeError); !ok {
+		return nil, err
+	}
+	req := &DposTrieRequest{BlockHash: header.Hash(), BlockNumber: header.Number.Uint64(), Root: root, Trie: t, Key: key}
+	if err := odr.Retrieve(ctx, req); err != nil {
+		return nil, err
+	}
+	return types.NewDposTrie(t, root, db)
+}
+
+// GetDposValidators retrieves the validators of the epoch of the given block,
+// proving them from the network if they aren't available locally.
+func GetDposValidators(ctx context.Context, odr OdrBackend, header *types.Header) ([]common.Address, error) {
+	epochTrie, err := GetDposTrie(ctx, odr, header, types.DposEpochTrie, types.ValidatorsKey)
+	if err != nil {
+		return nil, err
+	}
+	dposContext := new(types.DposContext)
+	dposContext.SetEpoch(epochTrie)
+	return dposContext.GetValidators()
+}
+
+// GetDposSigner retrieves the signing key a validator seals the blocks of the
+// epoch of the given block with, proving it from the network if it isn't
+// available locally.
+func GetDposSigner(ctx context.Context, odr OdrBackend, header *types.Header, validator common.Address) (common.Address, error) {
+	epochTrie, err := GetDposTrie(ctx, odr, header, types.DposEpochTrie, types.SignerKey(validator))
+	if err != nil {
+		return common.Address{}, err
+	}
+	dposContext := new(types.DposContext)
+	dposContext.SetEpoch(epochTrie)
+	return dposContext.GetEpochSigner(validator)
+}
@@ -114,10 +114,14 @@ func (t *odrTrie) TryDelete(key []byte) error {
 }
 
 func (t *odrTrie) CommitTo(db trie.DatabaseWriter) (common.Hash, error) {
+	return t.CommitToWithCallback(db, nil)
+}
+
+func (t *odrTrie) CommitToWithCallback(db trie.DatabaseWriter, onleaf trie.LeafCallback) (common.Hash, error) {
 	if t.trie == nil {
 		return t.id.Root, nil
 	}
-	return t.trie.CommitTo(db)
+	return t.trie.CommitToWithCallback(db, onleaf)
 }
 
 func (t *odrTrie) Hash() common.Hash {
@@ -0,0 +1,128 @@
+// Copyright 2017 The bgmchain Authors
+// This file is part of the bgmchain library.
+//
+// The bgmchain library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The bgmchain library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the bgmchain library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/consensus"
+	"github.com/5sWind/bgmchain/consensus/dpos"
+	"github.com/5sWind/bgmchain/core/types"
+	"github.com/5sWind/bgmchain/event"
+	"github.com/5sWind/bgmchain/log"
+	"github.com/5sWind/bgmchain/metrics"
+)
+
+const (
+	// maxLivenessBlocks is the maximum number of new canonical blocks inspected
+	// for missed slots on a single head change, to bound the work done after a sync.
+	maxLivenessBlocks = 256
+
+	// livenessInterval is the time between two checks for the slots elapsed
+	// without a block after the head.
+	livenessInterval = time.Second
+)
+
+// livenessTracker follows the canonical chain and reports the slots that
+// elapsed without a block from the validator scheduled for them. The slots
+// after the head are reported as their deadline passes, the others when the
+// blocks skipping them are imported.
+type livenessTracker struct {
+	chain    consensus.ChainReader // Blockchain to retrieve the new canonical blocks from
+	engine   *dpos.Dpos            // DPoS engine scheduling the validators
+	mux      *event.TypeMux        // Event multiplexer to post missed slots to
+	last     *types.Header         // Last head inspected for missed slots
+	reported int64                 // Latest slot reported as missed
+}
+
+// newLivenessTracker creates a tracker starting at the current head of the chain.
+func newLivenessTracker(chain consensus.ChainReader, engine *dpos.Dpos, mux *event.TypeMux) *livenessTracker {
+	return &livenessTracker{
+		chain:  chain,
+		engine: engine,
+		mux:    mux,
+		last:   chain.CurrentHeader(),
+	}
+}
+
+// Update inspects the blocks added to the canonical chain since the last head,
+// posting a dpos.MissedSlotEvent and updating the validator metrics for each
+// of them.
+func (t *livenessTracker) Update(head *types.Header) {
+	var headers []*types.Header
+	for header := head; header != nil && len(headers) < maxLivenessBlocks; header = t.chain.GetHeader(header.ParentHash, header.Number.Uint64()-1) {
+		if t.last != nil && header.Number.Cmp(t.last.Number) <= 0 {
+			break
+		}
+		headers = append(headers, header)
+	}
+	t.last = head
+
+	for i := len(headers) - 1; i >= 0; i-- {
+		header := headers[i]
+		metrics.NewCounter(validatorMetric(header.Validator, "produced")).Inc(1)
+
+		missed, err := t.engine.MissedSlots(t.chain, header)
+		if err != nil {
+			log.Debug("Failed to look up missed slots", "number", header.Number, "hash", header.Hash(), "err", err)
+			continue
+		}
+		for _, ev := range missed {
+			t.report(ev)
+		}
+	}
+}
+
+// Tick reports the slots after the head whose deadline passed by now without
+// a block.
+func (t *livenessTracker) Tick(now time.Time) {
+	if t.last == nil {
+		return
+	}
+	overdue, err := t.engine.OverdueSlots(t.last, now.Unix())
+	if err != nil {
+		log.Debug("Failed to look up overdue slots", "number", t.last.Number, "hash", t.last.Hash(), "err", err)
+		return
+	}
+	for _, ev := range overdue {
+		t.report(ev)
+	}
+}
+
+// report posts a missed slot and updates the metrics of its validator, unless
+// the slot was reported already.
+func (t *livenessTracker) report(ev dpos.MissedSlotEvent) {
+	if ev.Slot <= t.reported {
+		return
+	}
+	t.reported = ev.Slot
+
+	metrics.NewCounter(validatorMetric(ev.Validator, "missed")).Inc(1)
+	if t.engine.Authorized(ev.Validator) {
+		log.Warn("Local validator missed its slot", "slot", ev.Slot, "validator", ev.Validator, "next", ev.Number)
+	} else {
+		log.Debug("Validator missed its slot", "slot", ev.Slot, "validator", ev.Validator, "next", ev.Number)
+	}
+	t.mux.Post(ev)
+}
+
+// validatorMetric returns the name of a per validator metric.
+func validatorMetric(validator common.Address, name string) string {
+	return fmt.Sprintf("dpos/validators/%x/%s", validator, name)
+}
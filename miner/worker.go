@@ -113,6 +113,7 @@ type worker struct {
 	possibleUncles map[common.Hash]*types.Block
 
 	unconfirmed *unconfirmedBlocks // set of locally mined blocks pending canonicalness confirmations
+	liveness    *livenessTracker   // tracker of the slots missed by the validators, nil if not DPoS
 
 	// atomic status counters
 	mining int32
@@ -144,10 +145,13 @@ func newWorker(config *params.ChainConfig, engine consensus.Engine, coinbase com
 	worker.txSub = bgm.TxPool().SubscribeTxPreEvent(worker.txCh)
 	// Subscribe events for blockchain
 	worker.chainHeadSub = bgm.BlockChain().SubscribeChainHeadEvent(worker.chainHeadCh)
+	if engine, ok := engine.(*dpos.Dpos); ok {
+		worker.liveness = newLivenessTracker(worker.chain, engine, mux)
+	}
 
 	go worker.update()
 	go worker.wait()
-	worker.createNewWork()
+	worker.createNewWork(common.Address{})
 
 	return worker
 }
@@ -208,20 +212,21 @@ func (self *worker) mintBlock(now int64) {
 		log.Error("Only the dpos engine was allowed")
 		return
 	}
-	err := engine.CheckValidator(self.chain.CurrentBlock(), now)
+	validator, err := engine.CheckValidator(self.chain.CurrentBlock(), now)
 	if err != nil {
 		switch err {
 		case dpos.ErrWaitForPrevBlock,
 			dpos.ErrMintFutureBlock,
 			dpos.ErrInvalidBlockValidator,
-			dpos.ErrInvalidMintBlockTime:
+			dpos.ErrInvalidMintBlockTime,
+			dpos.ErrSlotMinted:
 			log.Debug("Failed to mint the block, while ", "err", err)
 		default:
 			log.Error("Failed to mint the block", "err", err)
 		}
 		return
 	}
-	work, err := self.createNewWork()
+	work, err := self.createNewWork(validator)
 	if err != nil {
 		log.Error("Failed to create the new work", "err", err)
 		return
@@ -269,14 +274,28 @@ func (self *worker) update() {
 	defer self.txSub.Unsubscribe()
 	defer self.chainHeadSub.Unsubscribe()
 
+	// The liveness of the validators is also checked while no block arrives
+	var livenessTick <-chan time.Time
+	if self.liveness != nil {
+		ticker := time.NewTicker(livenessInterval)
+		defer ticker.Stop()
+		livenessTick = ticker.C
+	}
 	for {
 		// A real event arrived, process interesting content
 		select {
+		case now := <-livenessTick:
+			self.liveness.Tick(now)
+
 		// Handle ChainHeadEvent
-		case <-self.chainHeadCh:
+		case ev := <-self.chainHeadCh:
 			close(self.quitCh)
 			self.quitCh = make(chan struct{}, 1)
 
+			if self.liveness != nil {
+				self.liveness.Update(ev.Block.Header())
+			}
+
 		// Handle TxPreEvent
 		case ev := <-self.txCh:
 			// Apply transaction to the pending state if we're not mining
@@ -353,7 +372,7 @@ func (self *worker) makeCurrent(parent *types.Block, header *types.Header) error
 	if err != nil {
 		return err
 	}
-	dposContext, err := types.NewDposContextFromProto(self.chainDb, parent.Header().DposContext)
+	dposContext, err := types.NewDposContextFromProto(self.chain.TrieDB(), parent.Header().DposContext)
 	if err != nil {
 		return err
 	}
@@ -384,7 +403,9 @@ func (self *worker) makeCurrent(parent *types.Block, header *types.Header) error
 	return nil
 }
 
-func (self *worker) createNewWork() (*Work, error) {
+// createNewWork assembles a new block on top of the current head, minted by the
+// given local validator or by the engine's default one if it's empty.
+func (self *worker) createNewWork(validator common.Address) (*Work, error) {
 	self.mu.Lock()
 	defer self.mu.Unlock()
 	self.uncleMu.Lock()
@@ -414,14 +435,16 @@ func (self *worker) createNewWork() (*Work, error) {
 		GasUsed:    new(big.Int),
 		Extra:      self.extra,
 		Time:       big.NewInt(tstamp),
-	}
-	// Only set the coinbase if we are mining (avoid spurious block rewards)
-	if atomic.LoadInt32(&self.mining) == 1 {
-		header.Coinbase = self.coinbase
+		Validator:  validator,
 	}
 	if err := self.engine.Prepare(self.chain, header); err != nil {
 		return nil, fmt.Errorf("got error when preparing header, err: %s", err)
 	}
+	// Only set the coinbase if we are mining (avoid spurious block rewards). The
+	// rewards of the slot go to the validator the engine picked for it.
+	if atomic.LoadInt32(&self.mining) == 1 {
+		header.Coinbase = header.Validator
+	}
 	// If we are care about TheDAO hard-fork check whbgmchain to override the extra-data or not
 	if daoBlock := self.config.DAOForkBlock; daoBlock != nil {
 		// Check whbgmchain the block is among the fork extra-override range
@@ -451,7 +474,7 @@ func (self *worker) createNewWork() (*Work, error) {
 		return nil, fmt.Errorf("got error when fetch pending transactions, err: %s", err)
 	}
 	txs := types.NewTransactionsByPriceAndNonce(self.current.signer, pending)
-	work.commitTransactions(self.mux, txs, self.chain, self.coinbase)
+	work.commitTransactions(self.mux, txs, self.chain, header.Coinbase)
 
 	// compute uncles for the new block.
 	var (
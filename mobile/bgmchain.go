@@ -78,11 +78,13 @@ type SyncProgress struct {
 	progress bgmchain.SyncProgress
 }
 
-func (p *SyncProgress) GetStartingBlock() int64 { return int64(p.progress.StartingBlock) }
-func (p *SyncProgress) GetCurrentBlock() int64  { return int64(p.progress.CurrentBlock) }
-func (p *SyncProgress) GetHighestBlock() int64  { return int64(p.progress.HighestBlock) }
-func (p *SyncProgress) GetPulledStates() int64  { return int64(p.progress.PulledStates) }
-func (p *SyncProgress) GetKnownStates() int64   { return int64(p.progress.KnownStates) }
+func (p *SyncProgress) GetStartingBlock() int64   { return int64(p.progress.StartingBlock) }
+func (p *SyncProgress) GetCurrentBlock() int64    { return int64(p.progress.CurrentBlock) }
+func (p *SyncProgress) GetHighestBlock() int64    { return int64(p.progress.HighestBlock) }
+func (p *SyncProgress) GetPulledStates() int64    { return int64(p.progress.PulledStates) }
+func (p *SyncProgress) GetKnownStates() int64     { return int64(p.progress.KnownStates) }
+func (p *SyncProgress) GetPulledDposTries() int64 { return int64(p.progress.PulledDposTries) }
+func (p *SyncProgress) GetKnownDposTries() int64  { return int64(p.progress.KnownDposTries) }
 
 //
 type Topics struct{ topics [][]common.Hash }
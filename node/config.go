@@ -66,6 +66,11 @@ type Config struct {
 //
 	DataDir string
 
+	// DBEngine is the storage engine of the databases created in the data
+	// directory. When empty, existing databases are opened with the engine they
+	// were created by and new ones with bgmdb.DefaultEngine.
+	DBEngine string `toml:",omitempty"`
+
 //
 	P2P p2p.Config
 
@@ -639,7 +639,7 @@ func (n *Node) OpenDatabase(name string, cache, handles int) (bgmdb.Database, er
 	if n.config.DataDir == "" {
 		return bgmdb.NewMemDatabase()
 	}
-	return bgmdb.NewLDBDatabase(n.config.resolvePath(name), cache, handles)
+	return bgmdb.OpenDatabase(n.config.DBEngine, n.config.resolvePath(name), cache, handles)
 }
 
 //
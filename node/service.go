@@ -43,7 +43,7 @@ func (ctx *ServiceContext) OpenDatabase(name string, cache int, handles int) (bg
 	if ctx.config.DataDir == "" {
 		return bgmdb.NewMemDatabase()
 	}
-	db, err := bgmdb.NewLDBDatabase(ctx.config.resolvePath(name), cache, handles)
+	db, err := bgmdb.OpenDatabase(ctx.config.DBEngine, ctx.config.resolvePath(name), cache, handles)
 	if err != nil {
 		return nil, err
 	}
@@ -19,6 +19,7 @@ package params
 import (
 	"fmt"
 	"math/big"
+	"sort"
 
 	"github.com/5sWind/bgmchain/common"
 )
@@ -46,6 +47,13 @@ var (
 	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), nil}
 )
 
+func init() {
+	// Resolve the rule schedule of the default chain once for all its users
+	if err := DposChainConfig.Dpos.Validate(); err != nil {
+		panic(err)
+	}
+}
+
 //
 //
 //
@@ -85,6 +93,69 @@ func (c *CliqueConfig) String() string {
 //
 type DposConfig struct {
 	Validators []common.Address `json:"validators"` //
+
+	BlockInterval    int64  `json:"blockInterval,omitempty"`    // Seconds between two consecutive block slots
+	EpochInterval    int64  `json:"epochInterval,omitempty"`    // Seconds after which the validator set is re-elected
+	MaxValidatorSize int    `json:"maxValidatorSize,omitempty"` // Maximum number of validators elected per epoch
+	UnbondingEpochs  *int64 `json:"unbondingEpochs,omitempty"`  // Epochs undelegated stake stays locked before it is returned
+
+	SlashPercent         *uint64 `json:"slashPercent,omitempty"`         // Percentage of a double signing validator's funds taken away
+	SlashReporterPercent *uint64 `json:"slashReporterPercent,omitempty"` // Percentage of the slashed amount paid to the reporter, the rest is burnt
+
+	CandidateDeposit        *big.Int `json:"candidateDeposit,omitempty"`        // Minimum deposit a candidate keeps locked, none if unset
+	CandidateCooldownEpochs *int64   `json:"candidateCooldownEpochs,omitempty"` // Epochs the deposit of a retired candidate stays locked before it is returned
+
+	Shuffle string `json:"shuffle,omitempty"` // Strategy ordering the validators of an epoch, DposShuffleHash if unset
+
+	StandbyGracePeriod int64 `json:"standbyGracePeriod,omitempty"` // Seconds into an empty slot after which the next validator may mint it, never if unset
+
+	Rewards bool `json:"rewards,omitempty"` // Whether validators share their block rewards with their delegators from genesis on
+	Staking bool `json:"staking,omitempty"` // Whether votes are weighted by locked stake instead of balance from genesis on
+
+	Forks []DposFork `json:"forks,omitempty"` // Block activated overrides of the parameters above, ordered by block
+
+	rules []*DposRules // Rule schedule resolved by Validate, the base rules followed by those of every fork
+}
+
+// DposFork overrides the DPoS timing, validator-count, shuffling and standby
+// parameters from the given block onwards, and may turn on the features which
+// extend the DPoS context. Unset values inherit the rules in force before it.
+type DposFork struct {
+	Block *big.Int `json:"block"` // Block number at which the overrides take effect
+
+	BlockInterval    int64  `json:"blockInterval,omitempty"`
+	EpochInterval    int64  `json:"epochInterval,omitempty"`
+	MaxValidatorSize int    `json:"maxValidatorSize,omitempty"`
+	Shuffle          string `json:"shuffle,omitempty"`
+
+	StandbyGracePeriod *int64 `json:"standbyGracePeriod,omitempty"` // Zero turns standby minting off again
+
+	Rewards bool `json:"rewards,omitempty"` // Turns reward sharing on, it can't be turned off again
+	Staking bool `json:"staking,omitempty"` // Turns stake locking on, it can't be turned off again
+}
+
+// DposRules are the DPoS parameters in force for a range of blocks, with the
+// protocol defaults and the fork overrides applied. They are shared and must
+// not be modified.
+type DposRules struct {
+	BlockInterval    int64 // Seconds between two consecutive block slots
+	EpochInterval    int64 // Seconds after which the validator set is re-elected
+	MaxValidatorSize int   // Maximum number of validators elected per epoch
+	UnbondingEpochs  int64 // Epochs undelegated stake stays locked before it is returned
+
+	SlashPercent         uint64 // Percentage of a double signing validator's funds taken away
+	SlashReporterPercent uint64 // Percentage of the slashed amount paid to the reporter, the rest is burnt
+
+	CandidateDeposit        *big.Int // Minimum deposit a candidate keeps locked, nil if none
+	CandidateCooldownEpochs int64    // Epochs the deposit of a retired candidate stays locked before it is returned
+
+	Shuffle            string // Strategy ordering the validators of an epoch
+	StandbyGracePeriod int64  // Seconds into an empty slot after which the next validator may mint it, never if zero
+
+	TimingFork *big.Int // Fork block from which the block and epoch intervals are in force, nil if since genesis
+
+	Rewards bool // Whether the reward trie holding reward pools, commissions and candidate metadata is in use
+	Staking bool // Whether the stake trie holding locked stake, deposits and unbondings is in use, votes being weighted by balance before
 }
 
 //
@@ -92,6 +163,212 @@ func (d *DposConfig) String() string {
 	return "dpos"
 }
 
+// At returns the rules in force for the given block number, i.e. the defaulted
+// base parameters with every scheduled fork up to num applied. The schedule
+// resolved by Validate is used if there is one, otherwise it is resolved anew.
+func (d *DposConfig) At(num *big.Int) *DposRules {
+	var (
+		schedule []*DposRules
+		forks    []DposFork
+	)
+	if d != nil {
+		schedule, forks = d.rules, d.Forks
+	}
+	if schedule == nil {
+		schedule = d.schedule()
+	}
+	n := 0
+	for n < len(forks) && isForked(forks[n].Block, num) {
+		n++
+	}
+	return schedule[n]
+}
+
+// schedule resolves the rules of the base parameters, followed by the rules in
+// force after every fork.
+func (d *DposConfig) schedule() []*DposRules {
+	base := &DposRules{
+		BlockInterval:           DposBlockInterval,
+		EpochInterval:           DposEpochInterval,
+		MaxValidatorSize:        DposMaxValidatorSize,
+		UnbondingEpochs:         DposUnbondingEpochs,
+		SlashPercent:            DposSlashPercent,
+		SlashReporterPercent:    DposSlashReporterPercent,
+		CandidateCooldownEpochs: DposCandidateCooldownEpochs,
+		Shuffle:                 DposShuffleHash,
+	}
+	if d == nil {
+		return []*DposRules{base}
+	}
+	if d.BlockInterval != 0 {
+		base.BlockInterval = d.BlockInterval
+	}
+	if d.EpochInterval != 0 {
+		base.EpochInterval = d.EpochInterval
+	}
+	if d.MaxValidatorSize != 0 {
+		base.MaxValidatorSize = d.MaxValidatorSize
+	}
+	if d.UnbondingEpochs != nil {
+		base.UnbondingEpochs = *d.UnbondingEpochs
+	}
+	if d.SlashPercent != nil {
+		base.SlashPercent = *d.SlashPercent
+	}
+	if d.SlashReporterPercent != nil {
+		base.SlashReporterPercent = *d.SlashReporterPercent
+	}
+	if d.CandidateDeposit != nil {
+		base.CandidateDeposit = new(big.Int).Set(d.CandidateDeposit)
+	}
+	if d.CandidateCooldownEpochs != nil {
+		base.CandidateCooldownEpochs = *d.CandidateCooldownEpochs
+	}
+	if d.Shuffle != "" {
+		base.Shuffle = d.Shuffle
+	}
+	base.StandbyGracePeriod = d.StandbyGracePeriod
+	base.Rewards = d.Rewards
+	base.Staking = d.Staking
+
+	schedule := make([]*DposRules, 1, len(d.Forks)+1)
+	schedule[0] = base
+	for _, fork := range d.Forks {
+		prev := schedule[len(schedule)-1]
+		rules := *prev
+		if fork.BlockInterval != 0 {
+			rules.BlockInterval = fork.BlockInterval
+		}
+		if fork.EpochInterval != 0 {
+			rules.EpochInterval = fork.EpochInterval
+		}
+		if fork.MaxValidatorSize != 0 {
+			rules.MaxValidatorSize = fork.MaxValidatorSize
+		}
+		if fork.Shuffle != "" {
+			rules.Shuffle = fork.Shuffle
+		}
+		if fork.StandbyGracePeriod != nil {
+			rules.StandbyGracePeriod = *fork.StandbyGracePeriod
+		}
+		if fork.Rewards {
+			rules.Rewards = true
+		}
+		if fork.Staking {
+			rules.Staking = true
+		}
+		if rules.BlockInterval != prev.BlockInterval || rules.EpochInterval != prev.EpochInterval {
+			rules.TimingFork = fork.Block
+		}
+		schedule = append(schedule, &rules)
+	}
+	return schedule
+}
+
+// SafeSize is the minimum number of candidates that must survive a kickout
+// and take part in an election.
+func (r *DposRules) SafeSize() int {
+	return r.MaxValidatorSize*2/3 + 1
+}
+
+// ConsensusSize is the number of distinct validators that must build on top of
+// a block before it is considered irreversible.
+func (r *DposRules) ConsensusSize() int {
+	return r.MaxValidatorSize*2/3 + 1
+}
+
+// Validate checks the timing and validator-count parameters, as well as every
+// rule set produced by the fork schedule, for consistency. Unset values are
+// treated as their defaults. The schedule of a valid configuration is kept for
+// At to return, so Validate has to be called again after any change.
+func (d *DposConfig) Validate() error {
+	schedule := d.schedule()
+	if err := schedule[0].validate(); err != nil {
+		return err
+	}
+	if d == nil {
+		return nil
+	}
+	if len(d.Validators) > schedule[0].MaxValidatorSize {
+		return fmt.Errorf("too many genesis validators: have %d, max %d", len(d.Validators), schedule[0].MaxValidatorSize)
+	}
+	for i, fork := range d.Forks {
+		if fork.Block == nil || fork.Block.Sign() <= 0 {
+			return fmt.Errorf("invalid dpos fork #%d activation block %v", i, fork.Block)
+		}
+		if i > 0 && d.Forks[i-1].Block.Cmp(fork.Block) >= 0 {
+			return fmt.Errorf("dpos fork #%d activation block %v not after previous fork block %v", i, fork.Block, d.Forks[i-1].Block)
+		}
+		if err := schedule[i+1].validate(); err != nil {
+			return fmt.Errorf("dpos fork at block %v: %v", fork.Block, err)
+		}
+	}
+	d.rules = schedule
+	return nil
+}
+
+func (r *DposRules) validate() error {
+	switch {
+	case r.BlockInterval < 0:
+		return fmt.Errorf("invalid dpos block interval %d", r.BlockInterval)
+	case r.EpochInterval < 0:
+		return fmt.Errorf("invalid dpos epoch interval %d", r.EpochInterval)
+	case r.MaxValidatorSize < 0:
+		return fmt.Errorf("invalid dpos max validator size %d", r.MaxValidatorSize)
+	case r.UnbondingEpochs < 0:
+		return fmt.Errorf("invalid dpos unbonding epochs %d", r.UnbondingEpochs)
+	case r.SlashPercent > 100:
+		return fmt.Errorf("invalid dpos slash percent %d", r.SlashPercent)
+	case r.SlashReporterPercent > 100:
+		return fmt.Errorf("invalid dpos slash reporter percent %d", r.SlashReporterPercent)
+	case r.CandidateDeposit != nil && r.CandidateDeposit.Sign() < 0:
+		return fmt.Errorf("invalid dpos candidate deposit %v", r.CandidateDeposit)
+	case r.CandidateCooldownEpochs < 0:
+		return fmt.Errorf("invalid dpos candidate cooldown epochs %d", r.CandidateCooldownEpochs)
+	case r.Shuffle != DposShuffleHash && r.Shuffle != DposShuffleRandao:
+		return fmt.Errorf("unknown dpos shuffle strategy %q", r.Shuffle)
+	case r.StandbyGracePeriod < 0 || (r.StandbyGracePeriod != 0 && r.StandbyGracePeriod >= r.BlockInterval):
+		return fmt.Errorf("dpos standby grace period %d not within block interval %d", r.StandbyGracePeriod, r.BlockInterval)
+	case r.EpochInterval%r.BlockInterval != 0:
+		return fmt.Errorf("dpos epoch interval %d is not a multiple of block interval %d", r.EpochInterval, r.BlockInterval)
+	case r.EpochInterval/r.BlockInterval < int64(r.MaxValidatorSize):
+		return fmt.Errorf("dpos epoch interval %d too short to schedule %d validators", r.EpochInterval, r.MaxValidatorSize)
+	}
+	return nil
+}
+
+// checkCompatible reports the first block at or below head from which the two
+// DPoS rule schedules disagree.
+func (d *DposConfig) checkCompatible(newcfg *DposConfig, head *big.Int) *ConfigCompatError {
+	var blocks []*big.Int
+	blocks = append(blocks, new(big.Int))
+	if d != nil {
+		for _, fork := range d.Forks {
+			blocks = append(blocks, fork.Block)
+		}
+	}
+	if newcfg != nil {
+		for _, fork := range newcfg.Forks {
+			blocks = append(blocks, fork.Block)
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Cmp(blocks[j]) < 0 })
+
+	for _, num := range blocks {
+		if !isForked(num, head) {
+			break
+		}
+		stored, next := d.At(num), newcfg.At(num)
+		if stored.BlockInterval != next.BlockInterval || stored.EpochInterval != next.EpochInterval || stored.MaxValidatorSize != next.MaxValidatorSize ||
+			stored.Shuffle != next.Shuffle || stored.StandbyGracePeriod != next.StandbyGracePeriod || stored.Rewards != next.Rewards || stored.Staking != next.Staking ||
+			stored.UnbondingEpochs != next.UnbondingEpochs || stored.SlashPercent != next.SlashPercent || stored.SlashReporterPercent != next.SlashReporterPercent ||
+			!configNumEqual(stored.CandidateDeposit, next.CandidateDeposit) || stored.CandidateCooldownEpochs != next.CandidateCooldownEpochs {
+			return newCompatError("DPoS rule schedule", num, num)
+		}
+	}
+	return nil
+}
+
 //
 func (c *ChainConfig) String() string {
 	return fmt.Sprintf("{ChainID: %v Homestead: %v DAO: %v DAOSupport: %v EIP150: %v EIP155: %v EIP158: %v Byzantium: %v Engine: %v}",
@@ -193,6 +470,11 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *Confi
 	if isForkIncompatible(c.ByzantiumBlock, newcfg.ByzantiumBlock, head) {
 		return newCompatError("Byzantium fork block", c.ByzantiumBlock, newcfg.ByzantiumBlock)
 	}
+	if c.Dpos != nil || newcfg.Dpos != nil {
+		if err := c.Dpos.checkCompatible(newcfg.Dpos, head); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
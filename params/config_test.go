@@ -20,6 +20,8 @@ import (
 	"math/big"
 	"reflect"
 	"testing"
+
+	"github.com/5sWind/bgmchain/common"
 )
 
 func TestCheckCompatible(t *testing.T) {
@@ -28,6 +30,9 @@ func TestCheckCompatible(t *testing.T) {
 		head        uint64
 		wantErr     *ConfigCompatError
 	}
+	unbonding := int64(DposUnbondingEpochs + 1)
+	slash, slashReporter := DposSlashPercent+1, DposSlashReporterPercent+1
+	cooldown := DposCandidateCooldownEpochs + 1
 	tests := []test{
 		{stored: AllBgmashProtocolChanges, new: AllBgmashProtocolChanges, head: 0, wantErr: nil},
 		{stored: AllBgmashProtocolChanges, new: AllBgmashProtocolChanges, head: 100, wantErr: nil},
@@ -70,6 +75,127 @@ func TestCheckCompatible(t *testing.T) {
 				RewindTo:     9,
 			},
 		},
+		{
+			stored:  &ChainConfig{Dpos: &DposConfig{Forks: []DposFork{{Block: big.NewInt(100), BlockInterval: 5}}}},
+			new:     &ChainConfig{Dpos: &DposConfig{Forks: []DposFork{{Block: big.NewInt(200), BlockInterval: 5}}}},
+			head:    99,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{Dpos: &DposConfig{Forks: []DposFork{{Block: big.NewInt(100), BlockInterval: 5}}}},
+			new:    &ChainConfig{Dpos: &DposConfig{Forks: []DposFork{{Block: big.NewInt(200), BlockInterval: 5}}}},
+			head:   150,
+			wantErr: &ConfigCompatError{
+				What:         "DPoS rule schedule",
+				StoredConfig: big.NewInt(100),
+				NewConfig:    big.NewInt(100),
+				RewindTo:     99,
+			},
+		},
+		{
+			stored: &ChainConfig{Dpos: &DposConfig{}},
+			new:    &ChainConfig{Dpos: &DposConfig{MaxValidatorSize: 21}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "DPoS rule schedule",
+				StoredConfig: big.NewInt(0),
+				NewConfig:    big.NewInt(0),
+				RewindTo:     0,
+			},
+		},
+		{
+			stored: &ChainConfig{Dpos: &DposConfig{}},
+			new:    &ChainConfig{Dpos: &DposConfig{UnbondingEpochs: &unbonding}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "DPoS rule schedule",
+				StoredConfig: big.NewInt(0),
+				NewConfig:    big.NewInt(0),
+				RewindTo:     0,
+			},
+		},
+		{
+			stored: &ChainConfig{Dpos: &DposConfig{}},
+			new:    &ChainConfig{Dpos: &DposConfig{SlashPercent: &slash}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "DPoS rule schedule",
+				StoredConfig: big.NewInt(0),
+				NewConfig:    big.NewInt(0),
+				RewindTo:     0,
+			},
+		},
+		{
+			stored: &ChainConfig{Dpos: &DposConfig{SlashPercent: &slash}},
+			new:    &ChainConfig{Dpos: &DposConfig{SlashPercent: &slash, SlashReporterPercent: &slashReporter}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "DPoS rule schedule",
+				StoredConfig: big.NewInt(0),
+				NewConfig:    big.NewInt(0),
+				RewindTo:     0,
+			},
+		},
+		{
+			stored: &ChainConfig{Dpos: &DposConfig{CandidateDeposit: big.NewInt(1000)}},
+			new:    &ChainConfig{Dpos: &DposConfig{CandidateDeposit: big.NewInt(2000)}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "DPoS rule schedule",
+				StoredConfig: big.NewInt(0),
+				NewConfig:    big.NewInt(0),
+				RewindTo:     0,
+			},
+		},
+		{
+			stored: &ChainConfig{Dpos: &DposConfig{CandidateDeposit: big.NewInt(1000)}},
+			new:    &ChainConfig{Dpos: &DposConfig{CandidateDeposit: big.NewInt(1000), CandidateCooldownEpochs: &cooldown}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "DPoS rule schedule",
+				StoredConfig: big.NewInt(0),
+				NewConfig:    big.NewInt(0),
+				RewindTo:     0,
+			},
+		},
+		{
+			stored: &ChainConfig{Dpos: &DposConfig{}},
+			new:    &ChainConfig{Dpos: &DposConfig{Forks: []DposFork{{Block: big.NewInt(50), Shuffle: DposShuffleRandao}}}},
+			head:   60,
+			wantErr: &ConfigCompatError{
+				What:         "DPoS rule schedule",
+				StoredConfig: big.NewInt(50),
+				NewConfig:    big.NewInt(50),
+				RewindTo:     49,
+			},
+		},
+		{
+			stored: &ChainConfig{Dpos: &DposConfig{}},
+			new:    &ChainConfig{Dpos: &DposConfig{Forks: []DposFork{{Block: big.NewInt(50), Rewards: true}}}},
+			head:   40,
+		},
+		{
+			stored: &ChainConfig{Dpos: &DposConfig{Forks: []DposFork{{Block: big.NewInt(50), Rewards: true}}}},
+			new:    &ChainConfig{Dpos: &DposConfig{Forks: []DposFork{{Block: big.NewInt(50), Rewards: true, Staking: true}}}},
+			head:   60,
+			wantErr: &ConfigCompatError{
+				What:         "DPoS rule schedule",
+				StoredConfig: big.NewInt(50),
+				NewConfig:    big.NewInt(50),
+				RewindTo:     49,
+			},
+		},
+		{
+			stored: &ChainConfig{Dpos: &DposConfig{}},
+			new:    &ChainConfig{Dpos: &DposConfig{Forks: []DposFork{{Block: big.NewInt(50), Rewards: true}}}},
+			head:   60,
+			wantErr: &ConfigCompatError{
+				What:         "DPoS rule schedule",
+				StoredConfig: big.NewInt(50),
+				NewConfig:    big.NewInt(50),
+				RewindTo:     49,
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -79,3 +205,115 @@ func TestCheckCompatible(t *testing.T) {
 		}
 	}
 }
+
+func TestDposConfigValidate(t *testing.T) {
+	tests := []struct {
+		config  *DposConfig
+		wantErr bool
+	}{
+		{config: &DposConfig{}, wantErr: false},
+		{config: &DposConfig{BlockInterval: 3, EpochInterval: 3600, MaxValidatorSize: 21}, wantErr: false},
+		{config: &DposConfig{BlockInterval: -1}, wantErr: true},
+		{config: &DposConfig{BlockInterval: 7}, wantErr: true},
+		{config: &DposConfig{BlockInterval: 10, EpochInterval: 20, MaxValidatorSize: 3}, wantErr: true},
+		{config: &DposConfig{Validators: make([]common.Address, 4)}, wantErr: true},
+		{config: &DposConfig{Forks: []DposFork{{Block: big.NewInt(10), MaxValidatorSize: 21}}}, wantErr: false},
+		{config: &DposConfig{Forks: []DposFork{{Block: nil, BlockInterval: 5}}}, wantErr: true},
+		{config: &DposConfig{Forks: []DposFork{{Block: big.NewInt(10), BlockInterval: 5}, {Block: big.NewInt(10), BlockInterval: 3}}}, wantErr: true},
+		{config: &DposConfig{Forks: []DposFork{{Block: big.NewInt(10), BlockInterval: 7}}}, wantErr: true},
+		{config: &DposConfig{CandidateDeposit: big.NewInt(1000), CandidateCooldownEpochs: newInt64(2)}, wantErr: false},
+		{config: &DposConfig{CandidateDeposit: big.NewInt(-1)}, wantErr: true},
+		{config: &DposConfig{CandidateCooldownEpochs: newInt64(-1)}, wantErr: true},
+		{config: &DposConfig{SlashPercent: newUint64(101)}, wantErr: true},
+		{config: &DposConfig{UnbondingEpochs: newInt64(-1)}, wantErr: true},
+		{config: &DposConfig{Shuffle: DposShuffleRandao}, wantErr: false},
+		{config: &DposConfig{Shuffle: "dice"}, wantErr: true},
+		{config: &DposConfig{Forks: []DposFork{{Block: big.NewInt(10), Shuffle: DposShuffleRandao}}}, wantErr: false},
+		{config: &DposConfig{Forks: []DposFork{{Block: big.NewInt(10), Shuffle: "dice"}}}, wantErr: true},
+		{config: &DposConfig{StandbyGracePeriod: 5}, wantErr: false},
+		{config: &DposConfig{StandbyGracePeriod: -1}, wantErr: true},
+		{config: &DposConfig{StandbyGracePeriod: DposBlockInterval}, wantErr: true},
+		{config: &DposConfig{StandbyGracePeriod: 8, Forks: []DposFork{{Block: big.NewInt(10), BlockInterval: 5}}}, wantErr: true},
+		{config: &DposConfig{StandbyGracePeriod: 8, Forks: []DposFork{{Block: big.NewInt(10), BlockInterval: 5, StandbyGracePeriod: newInt64(0)}}}, wantErr: false},
+	}
+	for i, test := range tests {
+		if err := test.config.Validate(); (err != nil) != test.wantErr {
+			t.Errorf("test %d: error mismatch: have %v, want error %v", i, err, test.wantErr)
+		}
+	}
+}
+
+func TestDposConfigAt(t *testing.T) {
+	config := &DposConfig{
+		MaxValidatorSize: 5,
+		Forks: []DposFork{
+			{Block: big.NewInt(10), BlockInterval: 5},
+			{Block: big.NewInt(20), MaxValidatorSize: 21, EpochInterval: 3600},
+		},
+	}
+	tests := []struct {
+		number                       int64
+		blockInterval, epochInterval int64
+		maxValidatorSize             int
+	}{
+		{0, DposBlockInterval, DposEpochInterval, 5},
+		{9, DposBlockInterval, DposEpochInterval, 5},
+		{10, 5, DposEpochInterval, 5},
+		{19, 5, DposEpochInterval, 5},
+		{20, 5, 3600, 21},
+		{1000, 5, 3600, 21},
+	}
+	check := func() {
+		for _, test := range tests {
+			rules := config.At(big.NewInt(test.number))
+			if rules.BlockInterval != test.blockInterval || rules.EpochInterval != test.epochInterval || rules.MaxValidatorSize != test.maxValidatorSize {
+				t.Errorf("block %d: rules mismatch: have (%d, %d, %d), want (%d, %d, %d)", test.number,
+					rules.BlockInterval, rules.EpochInterval, rules.MaxValidatorSize, test.blockInterval, test.epochInterval, test.maxValidatorSize)
+			}
+		}
+	}
+	// The rules are resolved on the fly until validation, and looked up after
+	check()
+	if err := config.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+	check()
+	for num, want := range map[int64]*big.Int{5: nil, 10: big.NewInt(10), 19: big.NewInt(10), 25: big.NewInt(20)} {
+		if have := config.At(big.NewInt(num)).TimingFork; !configNumEqual(have, want) {
+			t.Errorf("block %d: timing fork mismatch: have %v, want %v", num, have, want)
+		}
+	}
+	if allocs := testing.AllocsPerRun(100, func() { config.At(big.NewInt(15)) }); allocs != 0 {
+		t.Errorf("rule lookup allocates: %v allocations", allocs)
+	}
+}
+
+// Tests that explicitly set zero values override the defaults and the values
+// of earlier forks.
+func TestDposConfigAtZero(t *testing.T) {
+	config := &DposConfig{
+		UnbondingEpochs:      newInt64(0),
+		SlashPercent:         newUint64(0),
+		SlashReporterPercent: newUint64(0),
+		StandbyGracePeriod:   5,
+		Forks: []DposFork{
+			{Block: big.NewInt(10), StandbyGracePeriod: newInt64(0)},
+		},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+	rules := config.At(big.NewInt(0))
+	if rules.UnbondingEpochs != 0 || rules.SlashPercent != 0 || rules.SlashReporterPercent != 0 || rules.StandbyGracePeriod != 5 {
+		t.Errorf("base rules mismatch: %+v", rules)
+	}
+	if rules := config.At(big.NewInt(10)); rules.StandbyGracePeriod != 0 {
+		t.Errorf("standby grace period not turned off: have %d", rules.StandbyGracePeriod)
+	}
+	if rules := new(DposConfig).At(big.NewInt(0)); rules.UnbondingEpochs != DposUnbondingEpochs || rules.SlashPercent != DposSlashPercent {
+		t.Errorf("default rules mismatch: %+v", rules)
+	}
+}
+
+func newInt64(v int64) *int64    { return &v }
+func newUint64(v uint64) *uint64 { return &v }
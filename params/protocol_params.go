@@ -69,6 +69,21 @@ const (
 	Bn256ScalarMulGas       uint64 = 40000  //
 	Bn256PairingBaseGas     uint64 = 100000 //
 	Bn256PairingPerPointGas uint64 = 80000  //
+
+	DposBlockInterval    int64 = 10    // Default seconds between two DPoS block slots
+	DposEpochInterval    int64 = 86400 // Default seconds between two DPoS validator elections
+	DposMaxValidatorSize int   = 3     // Default number of validators elected per DPoS epoch
+	DposUnbondingEpochs  int64 = 7     // Default epochs undelegated DPoS stake stays locked
+
+	DposSlashPercent         uint64 = 10 // Default percentage of a double signing DPoS validator's funds slashed
+	DposSlashReporterPercent uint64 = 50 // Default percentage of the slashed amount paid to the reporter
+
+	DposCandidateCooldownEpochs int64 = 7 // Default epochs the deposit of a retired DPoS candidate stays locked
+)
+
+const (
+	DposShuffleHash   = "hash"   // Shuffle the validators of an epoch seeded by the hash of the electing block's parent
+	DposShuffleRandao = "randao" // Shuffle the validators of an epoch seeded by randomness accumulated from validator reveals
 )
 
 var (
@@ -46,6 +46,8 @@ func TestBlockNumberJSONUnmarshal(t *testing.T) {
 		14: {`someString`, true, BlockNumber(0)},
 		15: {`""`, true, BlockNumber(0)},
 		16: {``, true, BlockNumber(0)},
+		17: {`"confirmed"`, false, ConfirmedBlockNumber},
+		18: {`"finalized"`, false, ConfirmedBlockNumber},
 	}
 
 	for i, test := range tests {
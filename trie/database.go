@@ -0,0 +1,429 @@
+// Copyright 2017 The bgmchain Authors
+// This file is part of the bgmchain library.
+//
+// The bgmchain library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The bgmchain library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the bgmchain library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/5sWind/bgmchain/bgmdb"
+	"github.com/5sWind/bgmchain/common"
+	"github.com/5sWind/bgmchain/log"
+)
+
+// LeafCallback is invoked for every leaf of a trie stored by a commit, along
+// with the hash of the node holding it. The owner of the trie can use it to
+// reference the data a leaf points to, like the storage trie of an account.
+type LeafCallback func(leaf []byte, parent common.Hash) error
+
+// NodeDatabase is an intermediate write layer between the tries and the disk
+// database. Trie nodes committed to it are kept in memory and reference
+// counted, so the nodes of states no longer needed can be dropped before they
+// ever reach the disk. Only explicitly committed states are flushed.
+//
+// It satisfies bgmdb.Database so that tries can be opened on it just like on
+// the disk database it wraps. Entries other than trie nodes, like the preimages
+// of secure tries, are buffered and written out with the next commit.
+type NodeDatabase struct {
+	diskdb bgmdb.Database // Persistent store the committed nodes are flushed to
+
+	nodes     map[common.Hash]*cachedNode // Dirty trie nodes, keyed by hash
+	nodesSize common.StorageSize          // Storage size of the dirty nodes
+
+	preimages     map[string][]byte  // Non-node entries waiting for a flush
+	preimagesSize common.StorageSize // Storage size of the buffered entries
+
+	lock sync.RWMutex
+}
+
+// cachedNode is a trie node held in memory along with its reference counts.
+type cachedNode struct {
+	blob     []byte              // Encoded node, or contract code
+	parents  int                 // Number of live nodes and roots referencing it
+	children map[common.Hash]int // Dirty nodes referenced by this one
+}
+
+// NewNodeDatabase creates an in-memory node database flushing into diskdb.
+func NewNodeDatabase(diskdb bgmdb.Database) *NodeDatabase {
+	return &NodeDatabase{
+		diskdb:    diskdb,
+		nodes:     make(map[common.Hash]*cachedNode),
+		preimages: make(map[string][]byte),
+	}
+}
+
+// DiskDB returns the persistent database the nodes are flushed to.
+func (db *NodeDatabase) DiskDB() bgmdb.Database {
+	return db.diskdb
+}
+
+// Put inserts a trie node into the memory database, or buffers any other entry
+// until the next commit. Nodes already present are left untouched.
+func (db *NodeDatabase) Put(key, value []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.put(key, value)
+	return nil
+}
+
+// put inserts an entry, the caller holding the write lock.
+func (db *NodeDatabase) put(key, value []byte) {
+	if len(key) != common.HashLength {
+		if old, ok := db.preimages[string(key)]; ok {
+			db.preimagesSize -= common.StorageSize(len(key) + len(old))
+		}
+		db.preimages[string(key)] = common.CopyBytes(value)
+		db.preimagesSize += common.StorageSize(len(key) + len(value))
+		return
+	}
+	hash := common.BytesToHash(key)
+	if _, ok := db.nodes[hash]; ok {
+		return
+	}
+	entry := &cachedNode{
+		blob:     common.CopyBytes(value),
+		children: make(map[common.Hash]int),
+	}
+	// Contract code is stored by hash too, but has no children to reference
+	if n, err := decodeNode(key, value, 0); err == nil {
+		forChildren(n, func(child common.Hash) {
+			if node, ok := db.nodes[child]; ok {
+				node.parents++
+				entry.children[child]++
+			}
+		})
+	}
+	db.nodes[hash] = entry
+	db.nodesSize += common.StorageSize(common.HashLength + len(value))
+}
+
+// forChildren invokes onChild for the hash of every node referenced by n,
+// descending into the children embedded in it.
+func forChildren(n node, onChild func(child common.Hash)) {
+	switch n := n.(type) {
+	case *shortNode:
+		forChildren(n.Val, onChild)
+	case *fullNode:
+		for i := 0; i < 16; i++ {
+			forChildren(n.Children[i], onChild)
+		}
+	case hashNode:
+		onChild(common.BytesToHash(n))
+	}
+}
+
+// Get retrieves an entry from memory, falling back to the disk database.
+func (db *NodeDatabase) Get(key []byte) ([]byte, error) {
+	db.lock.RLock()
+	if len(key) == common.HashLength {
+		if node, ok := db.nodes[common.BytesToHash(key)]; ok {
+			db.lock.RUnlock()
+			return node.blob, nil
+		}
+	} else if value, ok := db.preimages[string(key)]; ok {
+		db.lock.RUnlock()
+		return value, nil
+	}
+	db.lock.RUnlock()
+
+	return db.diskdb.Get(key)
+}
+
+// Has reports whether an entry is held in memory or on disk.
+func (db *NodeDatabase) Has(key []byte) (bool, error) {
+	db.lock.RLock()
+	if len(key) == common.HashLength {
+		if _, ok := db.nodes[common.BytesToHash(key)]; ok {
+			db.lock.RUnlock()
+			return true, nil
+		}
+	} else if _, ok := db.preimages[string(key)]; ok {
+		db.lock.RUnlock()
+		return true, nil
+	}
+	db.lock.RUnlock()
+
+	return db.diskdb.Has(key)
+}
+
+// Delete drops a buffered entry and removes it from the disk database. Trie
+// nodes are only ever removed by dereferencing them.
+func (db *NodeDatabase) Delete(key []byte) error {
+	db.lock.Lock()
+	db.unbuffer(key)
+	db.lock.Unlock()
+
+	return db.diskdb.Delete(key)
+}
+
+// unbuffer drops a buffered entry, the caller holding the write lock.
+func (db *NodeDatabase) unbuffer(key []byte) {
+	if old, ok := db.preimages[string(key)]; ok {
+		delete(db.preimages, string(key))
+		db.preimagesSize -= common.StorageSize(len(key) + len(old))
+	}
+}
+
+// NewIteratorWithPrefix iterates over the entries of the disk database whose
+// key starts with prefix. Nodes and entries held in memory are not included.
+func (db *NodeDatabase) NewIteratorWithPrefix(prefix []byte) bgmdb.Iterator {
+	return db.diskdb.NewIteratorWithPrefix(prefix)
+}
+
+// NewIteratorWithRange iterates over the entries of the disk database whose
+// key is in [start, limit). Nodes and entries held in memory are not included.
+func (db *NodeDatabase) NewIteratorWithRange(start, limit []byte) bgmdb.Iterator {
+	return db.diskdb.NewIteratorWithRange(start, limit)
+}
+
+// DeleteRange drops the buffered entries in [start, limit) and removes the
+// range from the disk database.
+func (db *NodeDatabase) DeleteRange(start, limit []byte) error {
+	db.lock.Lock()
+	for key := range db.preimages {
+		if bytes.Compare([]byte(key), start) >= 0 && (limit == nil || bytes.Compare([]byte(key), limit) < 0) {
+			db.unbuffer([]byte(key))
+		}
+	}
+	db.lock.Unlock()
+
+	return db.diskdb.DeleteRange(start, limit)
+}
+
+// Stat returns a statistic of the disk database.
+func (db *NodeDatabase) Stat(property string) (string, error) {
+	return db.diskdb.Stat(property)
+}
+
+// Compact compacts the disk database.
+func (db *NodeDatabase) Compact(start, limit []byte) error {
+	return db.diskdb.Compact(start, limit)
+}
+
+// Close is a no-op, the disk database is owned and closed by the caller.
+func (db *NodeDatabase) Close() {}
+
+// NewBatch creates a batch inserting its entries into the memory database when
+// written.
+func (db *NodeDatabase) NewBatch() bgmdb.Batch {
+	return &nodeBatch{db: db}
+}
+
+// Reference adds a reference from a parent node to a child, keeping the child
+// alive for as long as the parent is. An empty parent references the child as
+// a root, which is kept until dereferenced.
+func (db *NodeDatabase) Reference(child, parent common.Hash) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	node, ok := db.nodes[child]
+	if !ok {
+		return
+	}
+	if parent == (common.Hash{}) {
+		node.parents++
+		return
+	}
+	owner, ok := db.nodes[parent]
+	if !ok {
+		return
+	}
+	// A leaf committed again must not reference its data twice
+	if _, ok := owner.children[child]; ok {
+		return
+	}
+	owner.children[child]++
+	node.parents++
+}
+
+// Dereference drops a root reference, removing from memory every node of the
+// trie that is no longer referenced by anything else.
+func (db *NodeDatabase) Dereference(root common.Hash) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	nodes, storage, start := len(db.nodes), db.nodesSize, time.Now()
+	db.dereference(root)
+
+	log.Debug("Dereferenced trie from memory database", "nodes", nodes-len(db.nodes), "size", storage-db.nodesSize, "time", time.Since(start),
+		"livenodes", len(db.nodes), "livesize", db.nodesSize)
+}
+
+// dereference drops a reference to a node, the caller holding the write lock.
+func (db *NodeDatabase) dereference(hash common.Hash) {
+	node, ok := db.nodes[hash]
+	if !ok {
+		return
+	}
+	if node.parents > 0 {
+		node.parents--
+	}
+	if node.parents > 0 {
+		return
+	}
+	delete(db.nodes, hash)
+	db.nodesSize -= common.StorageSize(common.HashLength + len(node.blob))
+
+	for child, refs := range node.children {
+		for i := 0; i < refs; i++ {
+			db.dereference(child)
+		}
+	}
+}
+
+// Commit flushes the trie rooted at root to the disk database, along with all
+// the buffered non-node entries, and drops the flushed nodes from memory.
+func (db *NodeDatabase) Commit(root common.Hash) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	start := time.Now()
+	batch := db.diskdb.NewBatch()
+	for key, value := range db.preimages {
+		if err := batch.Put([]byte(key), value); err != nil {
+			return err
+		}
+		if batch.ValueSize() > bgmdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch = db.diskdb.NewBatch()
+		}
+	}
+	nodes, storage := len(db.nodes), db.nodesSize
+	if err := db.commit(root, &batch); err != nil {
+		log.Error("Failed to commit trie from memory database", "err", err)
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		log.Error("Failed to write trie to disk", "err", err)
+		return err
+	}
+	db.preimages, db.preimagesSize = make(map[string][]byte), 0
+	db.uncache(root)
+
+	log.Debug("Persisted trie from memory database", "nodes", nodes-len(db.nodes), "size", storage-db.nodesSize, "time", time.Since(start),
+		"livenodes", len(db.nodes), "livesize", db.nodesSize)
+	return nil
+}
+
+// commit writes a node and its dirty children to the batch, children first so
+// a node is never persisted without its subtree.
+func (db *NodeDatabase) commit(hash common.Hash, batch *bgmdb.Batch) error {
+	node, ok := db.nodes[hash]
+	if !ok {
+		return nil
+	}
+	for child := range node.children {
+		if err := db.commit(child, batch); err != nil {
+			return err
+		}
+	}
+	if err := (*batch).Put(hash[:], node.blob); err != nil {
+		return err
+	}
+	if (*batch).ValueSize() > bgmdb.IdealBatchSize {
+		if err := (*batch).Write(); err != nil {
+			return err
+		}
+		*batch = db.diskdb.NewBatch()
+	}
+	return nil
+}
+
+// uncache drops a persisted node and its dirty children from memory.
+func (db *NodeDatabase) uncache(hash common.Hash) {
+	node, ok := db.nodes[hash]
+	if !ok {
+		return
+	}
+	delete(db.nodes, hash)
+	db.nodesSize -= common.StorageSize(common.HashLength + len(node.blob))
+
+	for child := range node.children {
+		db.uncache(child)
+	}
+}
+
+// Size returns the storage size of the trie nodes and other entries held in
+// memory.
+func (db *NodeDatabase) Size() common.StorageSize {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.nodesSize + db.preimagesSize
+}
+
+// Nodes returns the number of trie nodes held in memory.
+func (db *NodeDatabase) Nodes() int {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return len(db.nodes)
+}
+
+// nodeBatch collects entries and inserts them into a node database at once.
+type nodeBatch struct {
+	db     *NodeDatabase
+	writes []batchEntry
+	size   int
+}
+
+type batchEntry struct {
+	key, value []byte
+	del        bool
+}
+
+func (b *nodeBatch) Put(key, value []byte) error {
+	b.writes = append(b.writes, batchEntry{key: common.CopyBytes(key), value: common.CopyBytes(value)})
+	b.size += len(value)
+	return nil
+}
+
+func (b *nodeBatch) Delete(key []byte) error {
+	b.writes = append(b.writes, batchEntry{key: common.CopyBytes(key), del: true})
+	b.size += len(key)
+	return nil
+}
+
+func (b *nodeBatch) ValueSize() int {
+	return b.size
+}
+
+func (b *nodeBatch) Write() error {
+	b.db.lock.Lock()
+	defer b.db.lock.Unlock()
+
+	for _, entry := range b.writes {
+		if entry.del {
+			b.db.unbuffer(entry.key)
+			if err := b.db.diskdb.Delete(entry.key); err != nil {
+				return err
+			}
+			continue
+		}
+		b.db.put(entry.key, entry.value)
+	}
+	return nil
+}
+
+func (b *nodeBatch) Reset() {
+	b.writes = b.writes[:0]
+	b.size = 0
+}
@@ -0,0 +1,134 @@
+// Copyright 2017 The bgmchain Authors
+// This file is part of the bgmchain library.
+//
+// The bgmchain library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The bgmchain library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the bgmchain library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/5sWind/bgmchain/bgmdb"
+	"github.com/5sWind/bgmchain/common"
+)
+
+// makeNodeTrie commits a trie of n entries into the node database, overriding
+// the values of the given keys, and references its root.
+func makeNodeTrie(t *testing.T, triedb *NodeDatabase, n int, override map[string]string) common.Hash {
+	tr, _ := New(common.Hash{}, triedb)
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("key-%04d", i)
+		value := fmt.Sprintf("value-%04d-padded-to-exceed-thirty-two-bytes", i)
+		if v, ok := override[key]; ok {
+			value = v
+		}
+		tr.Update([]byte(key), []byte(value))
+	}
+	root, err := tr.CommitTo(triedb)
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	triedb.Reference(root, common.Hash{})
+	return root
+}
+
+func checkNodeTrie(t *testing.T, db Database, root common.Hash, key, value string) {
+	tr, err := New(root, db)
+	if err != nil {
+		t.Fatalf("failed to open trie %x: %v", root, err)
+	}
+	if have, err := tr.TryGet([]byte(key)); err != nil || !bytes.Equal(have, []byte(value)) {
+		t.Fatalf("trie %x: value mismatch for %s: have %q, want %q (err %v)", root, key, have, value, err)
+	}
+}
+
+func TestNodeDatabaseCommit(t *testing.T) {
+	diskdb, _ := bgmdb.NewMemDatabase()
+	triedb := NewNodeDatabase(diskdb)
+
+	root := makeNodeTrie(t, triedb, 100, nil)
+	if keys := len(diskdb.Keys()); keys != 0 {
+		t.Fatalf("disk database written before commit: %d entries", keys)
+	}
+	checkNodeTrie(t, triedb, root, "key-0042", "value-0042-padded-to-exceed-thirty-two-bytes")
+
+	if err := triedb.Commit(root); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	if nodes := triedb.Nodes(); nodes != 0 {
+		t.Errorf("nodes left in memory after commit: %d", nodes)
+	}
+	checkNodeTrie(t, diskdb, root, "key-0042", "value-0042-padded-to-exceed-thirty-two-bytes")
+}
+
+func TestNodeDatabaseDereference(t *testing.T) {
+	diskdb, _ := bgmdb.NewMemDatabase()
+	triedb := NewNodeDatabase(diskdb)
+
+	// Two tries sharing all but a single path
+	first := makeNodeTrie(t, triedb, 100, nil)
+	nodes := triedb.Nodes()
+	second := makeNodeTrie(t, triedb, 100, map[string]string{"key-0042": "changed"})
+	if triedb.Nodes() <= nodes {
+		t.Fatalf("no new nodes for the second trie: %d", triedb.Nodes())
+	}
+	// Dropping the first trie removes only the nodes not shared with the second
+	triedb.Dereference(first)
+	if triedb.Nodes() >= 2*nodes || triedb.Nodes() <= nodes/2 {
+		t.Errorf("unexpected node count after dereference: have %d, shared trie of %d", triedb.Nodes(), nodes)
+	}
+	if _, err := New(first, triedb); err == nil {
+		t.Errorf("dereferenced root still available")
+	}
+	checkNodeTrie(t, triedb, second, "key-0042", "changed")
+	checkNodeTrie(t, triedb, second, "key-0043", "value-0043-padded-to-exceed-thirty-two-bytes")
+
+	// Dropping the second one empties the database without touching the disk
+	triedb.Dereference(second)
+	if nodes := triedb.Nodes(); nodes != 0 {
+		t.Errorf("nodes left in memory after dereferencing everything: %d", nodes)
+	}
+	if keys := len(diskdb.Keys()); keys != 0 {
+		t.Errorf("disk database written without commit: %d entries", keys)
+	}
+}
+
+func TestNodeDatabaseLeafReference(t *testing.T) {
+	diskdb, _ := bgmdb.NewMemDatabase()
+	triedb := NewNodeDatabase(diskdb)
+
+	// A trie referenced from the leaves of another one lives as long as it
+	child := makeNodeTrie(t, triedb, 10, nil)
+
+	tr, _ := New(common.Hash{}, triedb)
+	tr.Update([]byte("account"), child.Bytes())
+	parent, err := tr.CommitToWithCallback(triedb, func(leaf []byte, owner common.Hash) error {
+		triedb.Reference(common.BytesToHash(leaf), owner)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	triedb.Reference(parent, common.Hash{})
+
+	triedb.Dereference(child)
+	checkNodeTrie(t, triedb, child, "key-0005", "value-0005-padded-to-exceed-thirty-two-bytes")
+
+	triedb.Dereference(parent)
+	if nodes := triedb.Nodes(); nodes != 0 {
+		t.Errorf("nodes left in memory after dereferencing the parent: %d", nodes)
+	}
+}
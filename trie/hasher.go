@@ -30,6 +30,7 @@ type hasher struct {
 	tmp                  *bytes.Buffer
 	sha                  hash.Hash
 	cachegen, cachelimit uint16
+	onleaf               LeafCallback // Invoked for the leaves of stored nodes, if set
 }
 
 //
@@ -39,9 +40,9 @@ var hasherPool = sync.Pool{
 	},
 }
 
-func newHasher(cachegen, cachelimit uint16) *hasher {
+func newHasher(cachegen, cachelimit uint16, onleaf LeafCallback) *hasher {
 	h := hasherPool.Get().(*hasher)
-	h.cachegen, h.cachelimit = cachegen, cachelimit
+	h.cachegen, h.cachelimit, h.onleaf = cachegen, cachelimit, onleaf
 	return h
 }
 
@@ -167,7 +168,32 @@ func (h *hasher) store(n node, db DatabaseWriter, force bool) (node, error) {
 		hash = hashNode(h.sha.Sum(nil))
 	}
 	if db != nil {
-		return hash, db.Put(hash, h.tmp.Bytes())
+		if err := db.Put(hash, h.tmp.Bytes()); err != nil {
+			return hash, err
+		}
+		if h.onleaf != nil {
+			return hash, h.notifyLeaves(n, common.BytesToHash(hash))
+		}
 	}
 	return hash, nil
 }
+
+// notifyLeaves invokes the leaf callback for the values held by a stored node,
+// including those in the children embedded into it.
+func (h *hasher) notifyLeaves(n node, parent common.Hash) error {
+	switch n := n.(type) {
+	case *shortNode:
+		return h.notifyLeaves(n.Val, parent)
+	case *fullNode:
+		for _, child := range n.Children {
+			if err := h.notifyLeaves(child, parent); err != nil {
+				return err
+			}
+		}
+	case valueNode:
+		if len(n) > 0 {
+			return h.onleaf(n, parent)
+		}
+	}
+	return nil
+}
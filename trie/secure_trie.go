@@ -174,6 +174,12 @@ func (t *SecureTrie) NodeIterator(start []byte) NodeIterator {
 //
 //
 func (t *SecureTrie) CommitTo(db DatabaseWriter) (root common.Hash, err error) {
+	return t.CommitToWithCallback(db, nil)
+}
+
+// CommitToWithCallback is like CommitTo, invoking onleaf for every leaf of the
+// nodes it writes.
+func (t *SecureTrie) CommitToWithCallback(db DatabaseWriter, onleaf LeafCallback) (root common.Hash, err error) {
 	if len(t.getSecKeyCache()) > 0 {
 		for hk, key := range t.secKeyCache {
 			if err := db.Put(t.secKey([]byte(hk)), key); err != nil {
@@ -182,7 +188,7 @@ func (t *SecureTrie) CommitTo(db DatabaseWriter) (root common.Hash, err error) {
 		}
 		t.secKeyCache = make(map[string][]byte)
 	}
-	return t.trie.CommitTo(db)
+	return t.trie.CommitToWithCallback(db, onleaf)
 }
 
 //
@@ -198,7 +204,7 @@ func (t *SecureTrie) secKey(key []byte) []byte {
 //
 //
 func (t *SecureTrie) hashKey(key []byte) []byte {
-	h := newHasher(0, 0)
+	h := newHasher(0, 0, nil)
 	h.sha.Reset()
 	h.sha.Write(key)
 	buf := h.sha.Sum(t.hashKeyBuf[:0])
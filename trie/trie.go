@@ -493,7 +493,7 @@ func (t *Trie) Root() []byte { return t.Hash().Bytes() }
 //
 //
 func (t *Trie) Hash() common.Hash {
-	hash, cached, _ := t.hashRoot(nil)
+	hash, cached, _ := t.hashRoot(nil, nil)
 	t.root = cached
 	return common.BytesToHash(hash.(hashNode))
 }
@@ -518,7 +518,13 @@ func (t *Trie) Commit() (root common.Hash, err error) {
 //
 //
 func (t *Trie) CommitTo(db DatabaseWriter) (root common.Hash, err error) {
-	hash, cached, err := t.hashRoot(db)
+	return t.CommitToWithCallback(db, nil)
+}
+
+// CommitToWithCallback is like CommitTo, invoking onleaf for every leaf of the
+// nodes it writes.
+func (t *Trie) CommitToWithCallback(db DatabaseWriter, onleaf LeafCallback) (root common.Hash, err error) {
+	hash, cached, err := t.hashRoot(db, onleaf)
 	if err != nil {
 		return (common.Hash{}), err
 	}
@@ -527,11 +533,11 @@ func (t *Trie) CommitTo(db DatabaseWriter) (root common.Hash, err error) {
 	return common.BytesToHash(hash.(hashNode)), nil
 }
 
-func (t *Trie) hashRoot(db DatabaseWriter) (node, node, error) {
+func (t *Trie) hashRoot(db DatabaseWriter, onleaf LeafCallback) (node, node, error) {
 	if t.root == nil {
 		return hashNode(emptyRoot.Bytes()), nil, nil
 	}
-	h := newHasher(t.cachegen, t.cachelimit)
+	h := newHasher(t.cachegen, t.cachelimit, onleaf)
 	defer returnHasherToPool(h)
 	return h.hash(t.root, db, true)
 }